@@ -2,25 +2,47 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"rest-api-go/web"
 )
 
 func main() {
-	//Initialize setup for Org1
-	cryptoPath := "../../test-network/organizations/peerOrganizations/org1.example.com"
-	orgConfig := web.OrgSetup{
-		OrgName:      "Org1",
-		MSPID:        "Org1MSP",
-		CertPath:     cryptoPath + "/users/User1@org1.example.com/msp/signcerts/cert.pem",
-		KeyPath:      cryptoPath + "/users/User1@org1.example.com/msp/keystore/",
-		TLSCertPath:  cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt",
-		PeerEndpoint: "localhost:7051",
-		GatewayPeer:  "peer0.org1.example.com",
+	//Initialize setup for the OEM and airline users
+	oemCryptoPath := "../../test-network/organizations/peerOrganizations/oem.example.com"
+	airlineCryptoPath := "../../test-network/organizations/peerOrganizations/airline.example.com"
+	orgConfigs := []web.OrgSetup{
+		{
+			OrgName:      "OEM",
+			MSPID:        "OEMMSP",
+			CertPath:     oemCryptoPath + "/users/User1@oem.example.com/msp/signcerts/cert.pem",
+			KeyPath:      oemCryptoPath + "/users/User1@oem.example.com/msp/keystore/",
+			TLSCertPath:  oemCryptoPath + "/peers/SW1.1.oem.example.com/tls/ca.crt",
+			PeerEndpoint: "localhost:7051",
+			GatewayPeer:  "SW1.1.oem.example.com",
+			Signer:       web.SignerSetupFromEnv("OEM_"),
+			APIToken:     os.Getenv("OEM_API_TOKEN"),
+		},
+		{
+			OrgName:      "Airline",
+			MSPID:        "AirlineMSP",
+			CertPath:     airlineCryptoPath + "/users/User1@airline.example.com/msp/signcerts/cert.pem",
+			KeyPath:      airlineCryptoPath + "/users/User1@airline.example.com/msp/keystore/",
+			TLSCertPath:  airlineCryptoPath + "/peers/QA3.1.airline.example.com/tls/ca.crt",
+			PeerEndpoint: "localhost:9051",
+			GatewayPeer:  "QA3.1.airline.example.com",
+			Signer:       web.SignerSetupFromEnv("AIRLINE_"),
+			APIToken:     os.Getenv("AIRLINE_API_TOKEN"),
+		},
 	}
 
-	orgSetup, err := web.Initialize(orgConfig)
-	if err != nil {
-		fmt.Println("Error initializing setup for Org1: ", err)
+	var orgSetups []web.OrgSetup
+	for _, orgConfig := range orgConfigs {
+		orgSetup, err := web.Initialize(orgConfig)
+		if err != nil {
+			fmt.Printf("Error initializing setup for %s: %s\n", orgConfig.OrgName, err)
+			continue
+		}
+		orgSetups = append(orgSetups, *orgSetup)
 	}
-	web.Serve(web.OrgSetup(*orgSetup))
+	web.Serve(web.AircraftNetwork{ChannelName: "oemchannel", ChaincodeName: "oemChaincode"}, orgSetups...)
 }
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// aircraftAPI serves the typed assembly line endpoints on top of the oemContract chaincode.
+type aircraftAPI struct {
+	identities identities
+	network    AircraftNetwork
+}
+
+// RegisterAircraftRequest is the body of POST /aircraft.
+type RegisterAircraftRequest struct {
+	ACNumber        string `json:"acNumber"`
+	Model           string `json:"model"`
+	Variant         string `json:"variant"`
+	CustomerAirline string `json:"customerAirline"`
+}
+
+// PartRef identifies a serialized part installed by an activity.
+type PartRef struct {
+	PartNumber   string `json:"partNumber"`
+	SerialNumber string `json:"serialNumber"`
+}
+
+// ActivityWorker identifies the staff behind an activity. It is sent in the transient map, so it only reaches
+// the OEM private data collection.
+type ActivityWorker struct {
+	WorkerID           string `json:"workerID"`
+	StationResponsible string `json:"stationResponsible"`
+}
+
+// RecordActivityRequest is the body of POST /aircraft/{ac}/activities.
+type RecordActivityRequest struct {
+	ActivityID      string         `json:"activityID"`
+	StationNumber   int            `json:"stationNumber"`
+	StartTime       string         `json:"startTime"`
+	EndTime         string         `json:"endTime"`
+	MachineID       string         `json:"machineID"`
+	ToolsOrDrill    string         `json:"toolsOrDrill"`
+	Parts           []PartRef      `json:"parts"`
+	PreviousStation string         `json:"previousStation"`
+	NextStation     string         `json:"nextStation"`
+	Worker          ActivityWorker `json:"worker"`
+}
+
+// TransferAircraftRequest is the body of POST /aircraft/{ac}/transfer.
+type TransferAircraftRequest struct {
+	NextStation string `json:"nextStation"`
+}
+
+// TransactionResponse is returned for every committed transaction.
+type TransactionResponse struct {
+	TransactionID string `json:"transactionId"`
+	BlockNumber   uint64 `json:"blockNumber"`
+}
+
+// HistoryResponse is the body of GET /aircraft/{ac}/history.
+type HistoryResponse struct {
+	Asset       json.RawMessage `json:"asset"`
+	Activities  json.RawMessage `json:"activities"`
+	Inspections json.RawMessage `json:"inspections"`
+}
+
+func (api *aircraftAPI) registerAircraft(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+	var request RegisterAircraftRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if request.ACNumber == "" {
+		writeError(w, http.StatusBadRequest, apiError{Code: "INVALID_ARGUMENT", Message: "acNumber is required"})
+		return
+	}
+
+	api.submit(setup, w, http.StatusCreated, "CreateAsset",
+		client.WithArguments(request.ACNumber, request.Model, request.Variant, request.CustomerAirline))
+}
+
+func (api *aircraftAPI) recordActivity(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+	var request RecordActivityRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if request.Worker.WorkerID == "" {
+		writeError(w, http.StatusBadRequest, apiError{Code: "INVALID_ARGUMENT", Message: "worker.workerID is required"})
+		return
+	}
+	if request.Parts == nil {
+		request.Parts = []PartRef{}
+	}
+
+	partsJSON, err := json.Marshal(request.Parts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, apiError{Code: "INTERNAL", Message: err.Error()})
+		return
+	}
+	workerJSON, err := newActivityWorkerTransient(request.Worker)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, apiError{Code: "INTERNAL", Message: err.Error()})
+		return
+	}
+
+	// Only the submitting organization holds the worker identities, so it alone endorses the transaction
+	api.submit(setup, w, http.StatusCreated, "CreateActivity",
+		client.WithArguments(r.PathValue("ac"), request.ActivityID, request.StartTime, request.EndTime, strconv.Itoa(request.StationNumber),
+			request.MachineID, request.ToolsOrDrill, string(partsJSON), request.PreviousStation, request.NextStation),
+		client.WithTransient(map[string][]byte{"activity_worker": workerJSON}),
+		client.WithEndorsingOrganizations(setup.MSPID))
+}
+
+func (api *aircraftAPI) transferAircraft(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+	var request TransferAircraftRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if request.NextStation == "" {
+		writeError(w, http.StatusBadRequest, apiError{Code: "INVALID_ARGUMENT", Message: "nextStation is required"})
+		return
+	}
+
+	api.submit(setup, w, http.StatusOK, "TransferAsset", client.WithArguments(r.PathValue("ac"), request.NextStation))
+}
+
+func (api *aircraftAPI) history(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+	contract := api.contract(setup)
+	acNumber := r.PathValue("ac")
+
+	var response HistoryResponse
+	for _, query := range []struct {
+		function string
+		result   *json.RawMessage
+	}{
+		{"GetAssetHistory", &response.Asset},
+		{"GetActivitiesForAsset", &response.Activities},
+		{"GetInspectionsForAsset", &response.Inspections},
+	} {
+		evaluateResponse, err := contract.EvaluateTransaction(query.function, acNumber)
+		if err != nil {
+			writeTransactionError(w, err)
+			return
+		}
+		*query.result = evaluateResponse
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// submit endorses, submits and waits for the commit of a transaction, answering with its ID and block number.
+func (api *aircraftAPI) submit(setup *OrgSetup, w http.ResponseWriter, successStatus int, function string, options ...client.ProposalOption) {
+	fmt.Printf("identity: %s, function: %s\n", setup.OrgName, function)
+
+	proposal, err := api.contract(setup).NewProposal(function, options...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, apiError{Code: "INTERNAL", Message: err.Error()})
+		return
+	}
+	endorsed, err := proposal.Endorse()
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	commit, err := endorsed.Submit()
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	status, err := commit.Status()
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	if !status.Successful {
+		writeTransactionError(w, &commitError{TransactionID: status.TransactionID, Code: status.Code})
+		return
+	}
+
+	writeJSON(w, successStatus, TransactionResponse{TransactionID: status.TransactionID, BlockNumber: status.BlockNumber})
+}
+
+func (api *aircraftAPI) contract(setup *OrgSetup) *client.Contract {
+	return setup.Gateway.GetNetwork(api.network.ChannelName).GetContract(api.network.ChaincodeName)
+}
+
+// decodeRequest decodes a JSON request body, answering 400 if it is malformed.
+func decodeRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, apiError{Code: "INVALID_ARGUMENT", Message: fmt.Sprintf("invalid request body: %s", err)})
+		return false
+	}
+	return true
+}
+
+// newActivityWorkerTransient builds the transient activity_worker value, adding a random salt so that the hash
+// on the public ledger cannot be matched against guessed worker IDs.
+func newActivityWorkerTransient(worker ActivityWorker) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return json.Marshal(struct {
+		ActivityWorker
+		Salt string `json:"salt"`
+	}{worker, base64.StdEncoding.EncodeToString(salt)})
+}
@@ -17,13 +17,37 @@ type OrgSetup struct {
 	TLSCertPath  string
 	PeerEndpoint string
 	GatewayPeer  string
+	Signer       SignerSetup // Where the identity's private key lives, the key file in KeyPath by default
+	APIToken     string      // Bearer token callers authenticate with to send requests with this identity
 	Gateway      client.Gateway
 }
 
-// Serve starts http web server.
-func Serve(setups OrgSetup) {
-	http.HandleFunc("/query", setups.Query)
-	http.HandleFunc("/invoke", setups.Invoke)
+// AircraftNetwork names the channel and chaincode the aircraft endpoints talk to.
+type AircraftNetwork struct {
+	ChannelName   string
+	ChaincodeName string
+}
+
+// Serve starts http web server. Requests are sent with the identity whose API token they carry as bearer token.
+func Serve(aircraft AircraftNetwork, setups ...OrgSetup) {
+	ids, err := newIdentities(setups)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	api := &aircraftAPI{identities: ids, network: aircraft}
+
+	http.HandleFunc("/query", ids.handle(func(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+		setup.Query(w, r)
+	}))
+	http.HandleFunc("/invoke", ids.handle(func(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+		setup.Invoke(w, r)
+	}))
+	http.HandleFunc("POST /aircraft", ids.handle(api.registerAircraft))
+	http.HandleFunc("POST /aircraft/{ac}/activities", ids.handle(api.recordActivity))
+	http.HandleFunc("POST /aircraft/{ac}/transfer", ids.handle(api.transferAircraft))
+	http.HandleFunc("GET /aircraft/{ac}/history", ids.handle(api.history))
+	http.HandleFunc("GET /openapi.yaml", serveOpenAPI)
 	fmt.Println("Listening (http://localhost:3000/)...")
 	if err := http.ListenAndServe(":3000", nil); err != nil {
 		fmt.Println(err)
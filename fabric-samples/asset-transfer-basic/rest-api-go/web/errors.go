@@ -0,0 +1,151 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// apiError is the body of every error response of the aircraft endpoints.
+type apiError struct {
+	Code          string        `json:"code"`
+	Message       string        `json:"message"`
+	TransactionID string        `json:"transactionId,omitempty"`
+	Details       []errorDetail `json:"details,omitempty"`
+}
+
+// errorDetail is the error a single peer or orderer returned for a transaction.
+type errorDetail struct {
+	Address string `json:"address"`
+	MSPID   string `json:"mspId"`
+	Message string `json:"message"`
+}
+
+// commitError is returned when a transaction was ordered but failed validation, e.g. on an MVCC read conflict.
+type commitError struct {
+	TransactionID string
+	Code          peer.TxValidationCode
+}
+
+func (e *commitError) Error() string {
+	return fmt.Sprintf("transaction %s failed to commit with status code %d (%s)", e.TransactionID, int32(e.Code), e.Code)
+}
+
+// contractErrorCode matches the "CODE: message" prefix oemContract puts on the errors it returns.
+var contractErrorCode = regexp.MustCompile(`\b(INVALID_ARGUMENT|INVALID_TIMESTAMP|NOT_FOUND|ALREADY_EXISTS|FORBIDDEN|NOT_CLEARED|EQUIPMENT_UNUSABLE|NOT_CERTIFIED): `)
+
+// contractErrorStatus maps oemContract error codes to HTTP status codes.
+var contractErrorStatus = map[string]int{
+	"INVALID_ARGUMENT":   http.StatusBadRequest,
+	"INVALID_TIMESTAMP":  http.StatusBadRequest,
+	"NOT_FOUND":          http.StatusNotFound,
+	"ALREADY_EXISTS":     http.StatusConflict,
+	"FORBIDDEN":          http.StatusForbidden,
+	"NOT_CLEARED":        http.StatusConflict,
+	"EQUIPMENT_UNUSABLE": http.StatusConflict,
+	"NOT_CERTIFIED":      http.StatusForbidden,
+}
+
+// writeTransactionError writes the response for a failed evaluate or submit.
+func writeTransactionError(w http.ResponseWriter, err error) {
+	statusCode, body := classifyError(err)
+	writeError(w, statusCode, body)
+}
+
+// classifyError picks the HTTP status for a gateway error. Errors returned by the chaincode keep their contract
+// error code; failures of the gateway, orderer or commit are reported as such.
+func classifyError(err error) (int, apiError) {
+	body := apiError{Message: err.Error()}
+
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	var commitErr *commitError
+	switch {
+	case errors.As(err, &endorseErr):
+		body.TransactionID = endorseErr.TransactionID
+	case errors.As(err, &submitErr):
+		body.TransactionID = submitErr.TransactionID
+		body.Code = "SUBMIT_FAILED"
+		return grpcStatus(err, http.StatusBadGateway), withDetails(body, err)
+	case errors.As(err, &commitStatusErr):
+		body.TransactionID = commitStatusErr.TransactionID
+		if errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded {
+			// The transaction may still commit; the client should check its history before retrying.
+			body.Code = "COMMIT_STATUS_TIMEOUT"
+			return http.StatusGatewayTimeout, body
+		}
+		body.Code = "COMMIT_STATUS_FAILED"
+		return grpcStatus(err, http.StatusBadGateway), withDetails(body, err)
+	case errors.As(err, &commitErr):
+		body.TransactionID = commitErr.TransactionID
+		body.Code = "COMMIT_FAILED"
+		return http.StatusConflict, body
+	}
+
+	// Endorse and evaluate errors carry the chaincode response in the error details.
+	body = withDetails(body, err)
+	messages := []string{err.Error()}
+	for _, detail := range body.Details {
+		messages = append(messages, detail.Message)
+	}
+	for _, message := range messages {
+		if match := contractErrorCode.FindStringSubmatch(message); match != nil {
+			body.Code = match[1]
+			return contractErrorStatus[match[1]], body
+		}
+	}
+
+	switch status.Code(err) {
+	case codes.Aborted, codes.Unknown:
+		// The chaincode rejected the transaction with an error that has no contract error code
+		body.Code = "REJECTED"
+		return http.StatusUnprocessableEntity, body
+	default:
+		body.Code = "ENDORSE_FAILED"
+		return grpcStatus(err, http.StatusBadGateway), body
+	}
+}
+
+// grpcStatus maps gRPC statuses that describe the connection to the network, falling back to the given status.
+func grpcStatus(err error, fallback int) int {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return fallback
+	}
+}
+
+// withDetails adds the errors returned by the individual peers and orderers, which are embedded in the gRPC status.
+func withDetails(body apiError, err error) apiError {
+	for _, detail := range status.Convert(err).Details() {
+		if detail, ok := detail.(*gateway.ErrorDetail); ok {
+			body.Details = append(body.Details, errorDetail{Address: detail.Address, MSPID: detail.MspId, Message: detail.Message})
+		}
+	}
+	return body
+}
+
+func writeError(w http.ResponseWriter, statusCode int, body apiError) {
+	writeJSON(w, statusCode, map[string]apiError{"error": body})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Println("Error writing response: ", err)
+	}
+}
@@ -0,0 +1,237 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// chaincodeError builds the gRPC status error the gateway returns when a peer's chaincode fails a proposal
+func chaincodeError(code codes.Code, message string) error {
+	st, err := status.New(code, "failed to endorse transaction, see attached details for more info").WithDetails(&gateway.ErrorDetail{
+		Address: "peer0.oem.example.com:7051",
+		MspId:   "OEMMSP",
+		Message: "chaincode response 500, " + message,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return st.Err()
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid argument", chaincodeError(codes.Aborted, "INVALID_ARGUMENT: station must not be empty"), http.StatusBadRequest, "INVALID_ARGUMENT"},
+		{"invalid timestamp", chaincodeError(codes.Aborted, "INVALID_TIMESTAMP: start time is not RFC3339"), http.StatusBadRequest, "INVALID_TIMESTAMP"},
+		{"not found", chaincodeError(codes.Aborted, "NOT_FOUND: the asset MSN001 does not exist"), http.StatusNotFound, "NOT_FOUND"},
+		{"already exists", chaincodeError(codes.Aborted, "ALREADY_EXISTS: the asset MSN001 already exists"), http.StatusConflict, "ALREADY_EXISTS"},
+		{"forbidden", chaincodeError(codes.Aborted, "FORBIDDEN: client does not have the qa role"), http.StatusForbidden, "FORBIDDEN"},
+		{"not cleared", chaincodeError(codes.Aborted, "NOT_CLEARED: station 40 exit inspection of aircraft MSN001 has result FAIL"), http.StatusConflict, "NOT_CLEARED"},
+		{"equipment unusable", chaincodeError(codes.Aborted, "EQUIPMENT_UNUSABLE: machine M1 is out of calibration"), http.StatusConflict, "EQUIPMENT_UNUSABLE"},
+		{"not certified", chaincodeError(codes.Aborted, "NOT_CERTIFIED: worker W1 is not certified"), http.StatusForbidden, "NOT_CERTIFIED"},
+		{"code in message", fmt.Errorf("evaluate failed: NOT_FOUND: the asset MSN001 does not exist"), http.StatusNotFound, "NOT_FOUND"},
+		{"rejected without code", chaincodeError(codes.Aborted, "some other failure"), http.StatusUnprocessableEntity, "REJECTED"},
+		{"unknown without code", status.Error(codes.Unknown, "chaincode panicked"), http.StatusUnprocessableEntity, "REJECTED"},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), http.StatusServiceUnavailable, "ENDORSE_FAILED"},
+		{"deadline exceeded", status.Error(codes.DeadlineExceeded, "context deadline exceeded"), http.StatusGatewayTimeout, "ENDORSE_FAILED"},
+		{"other status", status.Error(codes.Internal, "internal error"), http.StatusBadGateway, "ENDORSE_FAILED"},
+		{"non-gRPC error", errors.New("pop"), http.StatusUnprocessableEntity, "REJECTED"},
+		{"commit failed", &commitError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT}, http.StatusConflict, "COMMIT_FAILED"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statusCode, body := classifyError(test.err)
+			if statusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", statusCode, test.wantStatus)
+			}
+			if body.Code != test.wantCode {
+				t.Errorf("code = %s, want %s", body.Code, test.wantCode)
+			}
+			if body.Message != test.err.Error() {
+				t.Errorf("message = %s, want %s", body.Message, test.err.Error())
+			}
+		})
+	}
+}
+
+func TestClassifyErrorDetails(t *testing.T) {
+	_, body := classifyError(chaincodeError(codes.Aborted, "NOT_FOUND: the asset MSN001 does not exist"))
+	if len(body.Details) != 1 {
+		t.Fatalf("details = %v, want one peer error", body.Details)
+	}
+	want := errorDetail{Address: "peer0.oem.example.com:7051", MSPID: "OEMMSP", Message: "chaincode response 500, NOT_FOUND: the asset MSN001 does not exist"}
+	if body.Details[0] != want {
+		t.Errorf("detail = %+v, want %+v", body.Details[0], want)
+	}
+
+	_, body = classifyError(&commitError{TransactionID: "tx1", Code: peer.TxValidationCode_MVCC_READ_CONFLICT})
+	if body.TransactionID != "tx1" {
+		t.Errorf("transaction ID = %s, want tx1", body.TransactionID)
+	}
+}
+
+// fakeGateway is an in-process Fabric Gateway service that fails the step of a transaction the test chooses
+type fakeGateway struct {
+	gateway.UnimplementedGatewayServer
+	endorseErr      error
+	submitErr       error
+	commitStatusErr error
+}
+
+func mustMarshal(m proto.Message) []byte {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (g *fakeGateway) Endorse(ctx context.Context, req *gateway.EndorseRequest) (*gateway.EndorseResponse, error) {
+	if g.endorseErr != nil {
+		return nil, g.endorseErr
+	}
+	action := &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: mustMarshal(&peer.ProposalResponsePayload{
+				Extension: mustMarshal(&peer.ChaincodeAction{Response: &peer.Response{Status: 200}}),
+			}),
+		},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{ChannelHeader: mustMarshal(&common.ChannelHeader{TxId: req.TransactionId})},
+		Data:   mustMarshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: mustMarshal(action)}}}),
+	}
+	return &gateway.EndorseResponse{PreparedTransaction: &common.Envelope{Payload: mustMarshal(payload)}}, nil
+}
+
+func (g *fakeGateway) Submit(ctx context.Context, req *gateway.SubmitRequest) (*gateway.SubmitResponse, error) {
+	if g.submitErr != nil {
+		return nil, g.submitErr
+	}
+	return &gateway.SubmitResponse{}, nil
+}
+
+func (g *fakeGateway) CommitStatus(ctx context.Context, req *gateway.SignedCommitStatusRequest) (*gateway.CommitStatusResponse, error) {
+	if g.commitStatusErr != nil {
+		return nil, g.commitStatusErr
+	}
+	// Never answer, so the client gives up waiting for the commit
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// submitThroughFakeGateway submits a transaction through a gateway that fails as configured, returning the error
+// the gateway client reports
+func submitThroughFakeGateway(t *testing.T, fake *fakeGateway) error {
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	gateway.RegisterGatewayServer(server, fake)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user1"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := identity.NewX509Identity("OEMMSP", cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw, err := client.Connect(id,
+		client.WithSign(func(digest []byte) ([]byte, error) { return []byte("signature"), nil }),
+		client.WithClientConnection(conn),
+		client.WithCommitStatusTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Close()
+
+	_, commit, err := gw.GetNetwork("mychannel").GetContract("oemContract").SubmitAsync("TransferAsset")
+	if err != nil {
+		return err
+	}
+	_, err = commit.Status()
+	return err
+}
+
+func TestClassifyGatewayErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		fake       *fakeGateway
+		wantStatus int
+		wantCode   string
+	}{
+		{"endorse contract error", &fakeGateway{endorseErr: chaincodeError(codes.Aborted, "NOT_CLEARED: station 40 has open inspections")}, http.StatusConflict, "NOT_CLEARED"},
+		{"endorse unavailable", &fakeGateway{endorseErr: status.Error(codes.Unavailable, "no peers available")}, http.StatusServiceUnavailable, "ENDORSE_FAILED"},
+		{"submit unavailable", &fakeGateway{submitErr: status.Error(codes.Unavailable, "orderer unavailable")}, http.StatusServiceUnavailable, "SUBMIT_FAILED"},
+		{"submit failed", &fakeGateway{submitErr: status.Error(codes.Aborted, "rejected by orderer")}, http.StatusBadGateway, "SUBMIT_FAILED"},
+		{"commit status failed", &fakeGateway{commitStatusErr: status.Error(codes.Internal, "ledger error")}, http.StatusBadGateway, "COMMIT_STATUS_FAILED"},
+		{"commit status unavailable", &fakeGateway{commitStatusErr: status.Error(codes.Unavailable, "peer unavailable")}, http.StatusServiceUnavailable, "COMMIT_STATUS_FAILED"},
+		{"commit status timeout", &fakeGateway{}, http.StatusGatewayTimeout, "COMMIT_STATUS_TIMEOUT"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := submitThroughFakeGateway(t, test.fake)
+			if err == nil {
+				t.Fatal("expected the transaction to fail")
+			}
+			statusCode, body := classifyError(err)
+			if statusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", statusCode, test.wantStatus)
+			}
+			if body.Code != test.wantCode {
+				t.Errorf("code = %s, want %s", body.Code, test.wantCode)
+			}
+			if body.TransactionID == "" {
+				t.Error("transaction ID is empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// identities holds the gateway connections of every configured identity. Callers authenticate with the API token
+// of an identity, so a request can only be sent with an identity whose token the caller holds.
+type identities struct {
+	setups []*OrgSetup
+	single *OrgSetup // The only identity, when it is configured without a token
+}
+
+// newIdentities checks that every identity can be told apart by its API token. A single identity may go without a
+// token, in which case every request is sent with it and access must be restricted in front of the server.
+func newIdentities(setups []OrgSetup) (identities, error) {
+	var ids identities
+	for i := range setups {
+		setup := &setups[i]
+		if setup.APIToken == "" {
+			if len(setups) > 1 {
+				return identities{}, fmt.Errorf("identity %s has no API token, which is required when more than one identity is configured", setup.OrgName)
+			}
+			ids.single = setup
+		}
+		for _, other := range ids.setups {
+			if other.APIToken == setup.APIToken {
+				return identities{}, fmt.Errorf("identities %s and %s have the same API token", other.OrgName, setup.OrgName)
+			}
+		}
+		ids.setups = append(ids.setups, setup)
+	}
+	return ids, nil
+}
+
+// authenticate returns the identity whose API token the request carries as bearer token.
+func (ids identities) authenticate(r *http.Request) *OrgSetup {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ids.single
+	}
+	var found *OrgSetup
+	for _, setup := range ids.setups {
+		if setup.APIToken != "" && subtle.ConstantTimeCompare([]byte(setup.APIToken), []byte(token)) == 1 {
+			found = setup
+		}
+	}
+	return found
+}
+
+// handle wraps a handler that needs an identity, answering 401 unless the request authenticates as one.
+func (ids identities) handle(handler func(setup *OrgSetup, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setup := ids.authenticate(r)
+		if setup == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, apiError{Code: "UNAUTHORIZED", Message: "the request must carry the API token of a configured identity as bearer token"})
+			return
+		}
+		handler(setup, w, r)
+	}
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveAs sends a request through the identity middleware, returning the status and the identity it was sent with
+func serveAs(ids identities, header http.Header) (int, string) {
+	var orgName string
+	handler := ids.handle(func(setup *OrgSetup, w http.ResponseWriter, r *http.Request) {
+		orgName = setup.OrgName
+		w.WriteHeader(http.StatusOK)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/aircraft/MSN001/history", nil)
+	request.Header = header
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	return recorder.Code, orgName
+}
+
+func TestIdentitiesAuthenticate(t *testing.T) {
+	ids, err := newIdentities([]OrgSetup{
+		{OrgName: "OEM", APIToken: "oem-token"},
+		{OrgName: "Airline", APIToken: "airline-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		status  int
+		orgName string
+	}{
+		{"OEM token", http.Header{"Authorization": {"Bearer oem-token"}}, http.StatusOK, "OEM"},
+		{"airline token", http.Header{"Authorization": {"Bearer airline-token"}}, http.StatusOK, "Airline"},
+		{"unknown token", http.Header{"Authorization": {"Bearer guess"}}, http.StatusUnauthorized, ""},
+		{"no token", http.Header{}, http.StatusUnauthorized, ""},
+		{"not a bearer token", http.Header{"Authorization": {"Basic b2VtLXRva2Vu"}}, http.StatusUnauthorized, ""},
+		// The organization name a client claims does not choose the identity
+		{"org header", http.Header{"X-Org": {"OEM"}}, http.StatusUnauthorized, ""},
+		{"org header with other token", http.Header{"X-Org": {"OEM"}, "Authorization": {"Bearer airline-token"}}, http.StatusOK, "Airline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, orgName := serveAs(ids, tt.header)
+			if status != tt.status || orgName != tt.orgName {
+				t.Errorf("got %d with identity %q, want %d with identity %q", status, orgName, tt.status, tt.orgName)
+			}
+		})
+	}
+}
+
+func TestIdentitiesSingleWithoutToken(t *testing.T) {
+	ids, err := newIdentities([]OrgSetup{{OrgName: "OEM"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, orgName := serveAs(ids, http.Header{}); status != http.StatusOK || orgName != "OEM" {
+		t.Errorf("got %d with identity %q, want the only identity", status, orgName)
+	}
+	if status, _ := serveAs(ids, http.Header{"Authorization": {"Bearer guess"}}); status != http.StatusUnauthorized {
+		t.Errorf("got %d for an unknown token, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestNewIdentitiesInvalid(t *testing.T) {
+	if _, err := newIdentities([]OrgSetup{{OrgName: "OEM", APIToken: "oem-token"}, {OrgName: "Airline"}}); err == nil {
+		t.Error("expected an error for an identity without a token among several")
+	}
+	if _, err := newIdentities([]OrgSetup{{OrgName: "OEM", APIToken: "token"}, {OrgName: "Airline", APIToken: "token"}}); err == nil {
+		t.Error("expected an error for identities sharing a token")
+	}
+}
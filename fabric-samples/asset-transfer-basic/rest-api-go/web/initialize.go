@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"path"
 	"time"
 
 	"github.com/hyperledger/fabric-gateway/pkg/client"
@@ -17,9 +16,19 @@ import (
 // Initialize the setup for the organization.
 func Initialize(setup OrgSetup) (*OrgSetup, error) {
 	log.Printf("Initializing connection for %s...\n", setup.OrgName)
+	certificate, err := loadCertificate(setup.CertPath)
+	if err != nil {
+		return nil, err
+	}
+	id, err := identity.NewX509Identity(setup.MSPID, certificate)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := setup.newSign(certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s signer: %w", setup.OrgName, err)
+	}
 	clientConnection := setup.newGrpcConnection()
-	id := setup.newIdentity()
-	sign := setup.newSign()
 
 	gateway, err := client.Connect(
 		id,
@@ -57,46 +66,6 @@ func (setup OrgSetup) newGrpcConnection() *grpc.ClientConn {
 	return connection
 }
 
-// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
-func (setup OrgSetup) newIdentity() *identity.X509Identity {
-	certificate, err := loadCertificate(setup.CertPath)
-	if err != nil {
-		panic(err)
-	}
-
-	id, err := identity.NewX509Identity(setup.MSPID, certificate)
-	if err != nil {
-		panic(err)
-	}
-
-	return id
-}
-
-// newSign creates a function that generates a digital signature from a message digest using a private key.
-func (setup OrgSetup) newSign() identity.Sign {
-	files, err := ioutil.ReadDir(setup.KeyPath)
-	if err != nil {
-		panic(fmt.Errorf("failed to read private key directory: %w", err))
-	}
-	privateKeyPEM, err := ioutil.ReadFile(path.Join(setup.KeyPath, files[0].Name()))
-
-	if err != nil {
-		panic(fmt.Errorf("failed to read private key file: %w", err))
-	}
-
-	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
-	if err != nil {
-		panic(err)
-	}
-
-	sign, err := identity.NewPrivateKeySign(privateKey)
-	if err != nil {
-		panic(err)
-	}
-
-	return sign
-}
-
 func loadCertificate(filename string) (*x509.Certificate, error) {
 	certificatePEM, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -0,0 +1,15 @@
+package web
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// serveOpenAPI serves the OpenAPI document of the aircraft endpoints.
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPIDocument)
+}
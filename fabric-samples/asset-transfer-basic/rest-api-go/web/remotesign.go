@@ -0,0 +1,107 @@
+package web
+
+// The remote signer protocol and the low-S normalization live in this file only. The oem-gateway-go application
+// in test-network/application keeps a verbatim copy of it, so change this file first and copy it over.
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// remoteSignRequest is the body posted to the remote signer: the base64 encoded SHA-256 digest to sign, and the
+// base64 encoded DER client certificate naming the key to sign with.
+type remoteSignRequest struct {
+	Digest      string `json:"digest"`
+	Certificate string `json:"certificate"`
+}
+
+// remoteSignResponse is the remote signer's answer: a base64 encoded ASN.1 DER ECDSA signature.
+type remoteSignResponse struct {
+	Signature string `json:"signature"`
+}
+
+// newRemoteSign creates a signing function that delegates to the signing service at url, sending token as a bearer
+// token if it is not empty. Signatures are checked against the certificate's public key and normalized to the low-S
+// form Fabric requires.
+func newRemoteSign(certificate *x509.Certificate, url string, token string) (identity.Sign, error) {
+	if url == "" {
+		return nil, errors.New("a remote signer URL is required")
+	}
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("remote signer requires an ECDSA certificate, got %T", certificate.PublicKey)
+	}
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	encodedCertificate := base64.StdEncoding.EncodeToString(certificate.Raw)
+
+	return func(digest []byte) ([]byte, error) {
+		body, err := json.Marshal(remoteSignRequest{
+			Digest:      base64.StdEncoding.EncodeToString(digest),
+			Certificate: encodedCertificate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote sign request: %w", err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response, err := httpClient.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("remote signer request failed: %w", err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("remote signer answered %s", response.Status)
+		}
+
+		var result remoteSignResponse
+		if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode remote signer response: %w", err)
+		}
+		signature, err := base64.StdEncoding.DecodeString(result.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode remote signature: %w", err)
+		}
+		if !ecdsa.VerifyASN1(publicKey, digest, signature) {
+			return nil, errors.New("remote signature does not match the client certificate")
+		}
+
+		return toLowS(publicKey, signature)
+	}, nil
+}
+
+// ecdsaSignature is the ASN.1 structure of an ECDSA signature
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// toLowS rewrites an ECDSA signature with S in the lower half of the curve order, as Fabric rejects high-S signatures.
+func toLowS(publicKey *ecdsa.PublicKey, signature []byte) ([]byte, error) {
+	var sig ecdsaSignature
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+	order := publicKey.Curve.Params().N
+	if sig.S.Cmp(new(big.Int).Rsh(order, 1)) <= 0 {
+		return signature, nil
+	}
+	sig.S.Sub(order, sig.S)
+	return asn1.Marshal(sig)
+}
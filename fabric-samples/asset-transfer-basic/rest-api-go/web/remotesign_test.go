@@ -0,0 +1,120 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestCertificate returns a self-signed certificate for a new P-256 key, and the key
+func newTestCertificate(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "user1"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// highS returns a signature of the digest with S in the upper half of the curve order
+func highS(t *testing.T, key *ecdsa.PrivateKey, digest []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := key.Curve.Params().N
+	if s.Cmp(new(big.Int).Rsh(order, 1)) <= 0 {
+		s.Sub(order, s)
+	}
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func TestRemoteSignNormalizesHighS(t *testing.T) {
+	cert, key := newTestCertificate(t)
+	digest := sha256.Sum256([]byte("proposal"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token1" {
+			t.Errorf("authorization = %q, want bearer token", got)
+		}
+		var request remoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatal(err)
+		}
+		if request.Certificate != base64.StdEncoding.EncodeToString(cert.Raw) {
+			t.Error("request does not carry the client certificate")
+		}
+		requestDigest, err := base64.StdEncoding.DecodeString(request.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = json.NewEncoder(w).Encode(remoteSignResponse{Signature: base64.StdEncoding.EncodeToString(highS(t, key, requestDigest))})
+	}))
+	defer server.Close()
+
+	sign, err := newRemoteSign(cert, server.URL, "token1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := sign(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sig ecdsaSignature
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+		t.Fatal(err)
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(key.Curve.Params().N, 1)) > 0 {
+		t.Error("signature was not normalized to low S")
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Error("normalized signature does not verify")
+	}
+}
+
+func TestRemoteSignRejectsForeignSignature(t *testing.T) {
+	cert, _ := newTestCertificate(t)
+	_, otherKey := newTestCertificate(t)
+	digest := sha256.Sum256([]byte("proposal"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(remoteSignResponse{Signature: base64.StdEncoding.EncodeToString(highS(t, otherKey, digest[:]))})
+	}))
+	defer server.Close()
+
+	sign, err := newRemoteSign(cert, server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sign(digest[:]); err == nil || err.Error() != "remote signature does not match the client certificate" {
+		t.Errorf("err = %v, want a certificate mismatch", err)
+	}
+
+	if _, err := newRemoteSign(cert, "", ""); err == nil {
+		t.Error("expected an error without a remote signer URL")
+	}
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// Signer types selectable in SignerSetup.
+const (
+	SignerFile   = "file"
+	SignerPKCS11 = "pkcs11"
+	SignerRemote = "remote"
+)
+
+// SignerSetup selects where the private key of an organization's identity lives. The zero value reads the key
+// file found in OrgSetup.KeyPath.
+type SignerSetup struct {
+	Type string // One of SignerFile (default), SignerPKCS11 or SignerRemote
+
+	// PKCS#11 settings, e.g. for SoftHSM as in the hardware-security-module sample. The key is found by the subject
+	// key identifier of the identity's certificate. The pkcs11 signer needs a binary built with -tags pkcs11.
+	PKCS11Library string // Defaults to the first SoftHSM library found in the usual install locations
+	PKCS11Label   string
+	PKCS11Pin     string
+
+	// Remote signer settings. Each digest is posted as {"digest":"...","certificate":"..."}, both base64 encoded,
+	// and the service answers {"signature":"..."} with a base64 encoded ASN.1 DER ECDSA signature.
+	RemoteURL   string
+	RemoteToken string // Sent as a bearer token, if set
+}
+
+// SignerSetupFromEnv reads a SignerSetup from environment variables with the given prefix, e.g. OEM_SIGNER,
+// OEM_PKCS11_LIB, OEM_PKCS11_LABEL, OEM_PKCS11_PIN, OEM_REMOTE_SIGNER_URL and OEM_REMOTE_SIGNER_TOKEN.
+func SignerSetupFromEnv(prefix string) SignerSetup {
+	return SignerSetup{
+		Type:          os.Getenv(prefix + "SIGNER"),
+		PKCS11Library: os.Getenv(prefix + "PKCS11_LIB"),
+		PKCS11Label:   os.Getenv(prefix + "PKCS11_LABEL"),
+		PKCS11Pin:     os.Getenv(prefix + "PKCS11_PIN"),
+		RemoteURL:     os.Getenv(prefix + "REMOTE_SIGNER_URL"),
+		RemoteToken:   os.Getenv(prefix + "REMOTE_SIGNER_TOKEN"),
+	}
+}
+
+// newSign creates a function that generates a digital signature from a message digest with the configured signer.
+func (setup OrgSetup) newSign(certificate *x509.Certificate) (identity.Sign, error) {
+	switch setup.Signer.Type {
+	case "", SignerFile:
+		return setup.newFileSign()
+	case SignerPKCS11:
+		return setup.Signer.newHSMSign(certificate)
+	case SignerRemote:
+		return newRemoteSign(certificate, setup.Signer.RemoteURL, setup.Signer.RemoteToken)
+	default:
+		return nil, fmt.Errorf("unknown signer %q, expected %s, %s or %s", setup.Signer.Type, SignerFile, SignerPKCS11, SignerRemote)
+	}
+}
+
+// newFileSign creates a signing function using the private key file found in KeyPath.
+func (setup OrgSetup) newFileSign() (identity.Sign, error) {
+	files, err := os.ReadDir(setup.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no private key files found in directory %s", setup.KeyPath)
+	}
+	privateKeyPEM, err := os.ReadFile(path.Join(setup.KeyPath, files[0].Name()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewPrivateKeySign(privateKey)
+}
@@ -0,0 +1,15 @@
+//go:build !pkcs11
+
+package web
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// newHSMSign is only available in binaries built with -tags pkcs11, which need cgo.
+func (signer SignerSetup) newHSMSign(certificate *x509.Certificate) (identity.Sign, error) {
+	return nil, errors.New("the pkcs11 signer needs a binary built with -tags pkcs11")
+}
@@ -0,0 +1,62 @@
+//go:build pkcs11
+
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// newHSMSign creates a signing function backed by the HSM key matching the certificate's subject key identifier.
+// The HSM session stays open for the lifetime of the server.
+func (signer SignerSetup) newHSMSign(certificate *x509.Certificate) (identity.Sign, error) {
+	library := signer.PKCS11Library
+	if library == "" {
+		var err error
+		if library, err = findSoftHSMLibrary(); err != nil {
+			return nil, err
+		}
+	}
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("HSM signer requires an ECDSA certificate, got %T", certificate.PublicKey)
+	}
+
+	factory, err := identity.NewHSMSignerFactory(library)
+	if err != nil {
+		return nil, err
+	}
+	ski := sha256.Sum256(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+	sign, _, err := factory.NewHSMSigner(identity.HSMSignerOptions{
+		Label:      signer.PKCS11Label,
+		Pin:        signer.PKCS11Pin,
+		Identifier: string(ski[:]),
+	})
+	if err != nil {
+		factory.Dispose()
+		return nil, err
+	}
+	return sign, nil
+}
+
+func findSoftHSMLibrary() (string, error) {
+	libraryLocations := []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	}
+	for _, libraryLocation := range libraryLocations {
+		if _, err := os.Stat(libraryLocation); !errors.Is(err, os.ErrNotExist) {
+			return libraryLocation, nil
+		}
+	}
+	return "", errors.New("no SoftHSM library found, set the PKCS#11 library path")
+}
@@ -0,0 +1,60 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command offChainData copies the aircraft, activities and inspections written by the oemContract chaincode into
+// a local SQLite database, so that reporting can run off-chain without loading the peers.
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+var (
+	channelName   = envOrDefault("CHANNEL_NAME", "oemchannel")
+	chaincodeName = envOrDefault("CHAINCODE_NAME", "oemChaincode")
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	clientConnection, err := newGrpcConnection()
+	if err != nil {
+		return err
+	}
+	defer clientConnection.Close()
+
+	id, err := newIdentity()
+	if err != nil {
+		return err
+	}
+	sign, err := newSign()
+	if err != nil {
+		return err
+	}
+
+	gw, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(clientConnection),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+
+	return listen(gw.GetNetwork(channelName))
+}
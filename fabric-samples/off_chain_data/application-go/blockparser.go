@@ -0,0 +1,117 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// transaction is an endorser transaction of a block together with its validation result
+type transaction struct {
+	ChannelHeader  *common.ChannelHeader
+	ValidationCode peer.TxValidationCode
+	payload        *common.Payload
+}
+
+// namespaceReadWriteSet is the read/write set of one chaincode namespace within a transaction
+type namespaceReadWriteSet struct {
+	Namespace    string
+	ReadWriteSet *kvrwset.KVRWSet
+}
+
+// IsValid reports whether the transaction was committed as valid, so its writes were applied to the ledger
+func (t *transaction) IsValid() bool {
+	return t.ValidationCode == peer.TxValidationCode_VALID
+}
+
+// parseBlock returns the endorser transactions of a block, skipping config and other transaction types
+func parseBlock(block *common.Block) ([]*transaction, error) {
+	if block.GetHeader() == nil || block.GetData() == nil {
+		return nil, errors.New("missing block header or data")
+	}
+	validationCodes := block.GetMetadata().GetMetadata()
+	if len(validationCodes) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return nil, fmt.Errorf("missing transaction validation codes in block %d", block.GetHeader().GetNumber())
+	}
+	transactionsFilter := validationCodes[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+
+	var transactions []*transaction
+	for i, envelopeBytes := range block.GetData().GetData() {
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
+		}
+		payload := &common.Payload{}
+		if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+		channelHeader := &common.ChannelHeader{}
+		if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal channel header: %w", err)
+		}
+		if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+			continue
+		}
+		if i >= len(transactionsFilter) {
+			return nil, fmt.Errorf("missing validation code for transaction %s", channelHeader.GetTxId())
+		}
+
+		transactions = append(transactions, &transaction{
+			ChannelHeader:  channelHeader,
+			ValidationCode: peer.TxValidationCode(transactionsFilter[i]),
+			payload:        payload,
+		})
+	}
+
+	return transactions, nil
+}
+
+// NamespaceReadWriteSets returns the read/write sets of every chaincode the transaction invoked
+func (t *transaction) NamespaceReadWriteSets() ([]*namespaceReadWriteSet, error) {
+	endorserTransaction := &peer.Transaction{}
+	if err := proto.Unmarshal(t.payload.GetData(), endorserTransaction); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transaction: %w", err)
+	}
+
+	var results []*namespaceReadWriteSet
+	for _, action := range endorserTransaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.GetPayload(), actionPayload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal chaincode action payload: %w", err)
+		}
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal proposal response payload: %w", err)
+		}
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal chaincode action: %w", err)
+		}
+		readWriteSet := &rwset.TxReadWriteSet{}
+		if err := proto.Unmarshal(chaincodeAction.GetResults(), readWriteSet); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal read/write set: %w", err)
+		}
+		if readWriteSet.GetDataModel() != rwset.TxReadWriteSet_KV {
+			return nil, fmt.Errorf("unexpected read/write set data model: %v", readWriteSet.GetDataModel())
+		}
+
+		for _, nsReadWriteSet := range readWriteSet.GetNsRwset() {
+			kvReadWriteSet := &kvrwset.KVRWSet{}
+			if err := proto.Unmarshal(nsReadWriteSet.GetRwset(), kvReadWriteSet); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %s read/write set: %w", nsReadWriteSet.GetNamespace(), err)
+			}
+			results = append(results, &namespaceReadWriteSet{Namespace: nsReadWriteSet.GetNamespace(), ReadWriteSet: kvReadWriteSet})
+		}
+	}
+
+	return results, nil
+}
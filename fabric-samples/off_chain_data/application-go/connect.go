@@ -0,0 +1,94 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Connection settings default to User1 of the OEM organization on the SW1.1 peer of the test network and can be
+// overridden from the environment.
+var (
+	mspID        = envOrDefault("MSP_ID", "OEMMSP")
+	cryptoPath   = envOrDefault("CRYPTO_PATH", "../../test-network/organizations/peerOrganizations/oem.example.com")
+	certPath     = envOrDefault("CERT_PATH", cryptoPath+"/users/User1@oem.example.com/msp/signcerts/cert.pem")
+	keyPath      = envOrDefault("KEY_DIRECTORY_PATH", cryptoPath+"/users/User1@oem.example.com/msp/keystore/")
+	tlsCertPath  = envOrDefault("TLS_CERT_PATH", cryptoPath+"/peers/SW1.1.oem.example.com/tls/ca.crt")
+	peerEndpoint = envOrDefault("PEER_ENDPOINT", "localhost:7051")
+	gatewayPeer  = envOrDefault("PEER_HOST_ALIAS", "SW1.1.oem.example.com")
+)
+
+// newGrpcConnection creates a gRPC connection to the Gateway server.
+func newGrpcConnection() (*grpc.ClientConn, error) {
+	certificate, err := loadCertificate(tlsCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(certificate)
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, gatewayPeer)
+
+	connection, err := grpc.Dial(peerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	return connection, nil
+}
+
+// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
+func newIdentity() (*identity.X509Identity, error) {
+	certificate, err := loadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewX509Identity(mspID, certificate)
+}
+
+func loadCertificate(filename string) (*x509.Certificate, error) {
+	certificatePEM, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	return identity.CertificateFromPEM(certificatePEM)
+}
+
+// newSign creates a function that generates a digital signature from a message digest using a private key.
+func newSign() (identity.Sign, error) {
+	files, err := os.ReadDir(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no private key files found in directory %s", keyPath)
+	}
+	privateKeyPEM, err := os.ReadFile(path.Join(keyPath, files[0].Name()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewPrivateKeySign(privateKey)
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,145 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+)
+
+var (
+	checkpointFile = envOrDefault("CHECKPOINT_FILE", "checkpoint.json")
+	storeFile      = envOrDefault("STORE_FILE", "oem.db")
+)
+
+// startBlock is used only if there is no checkpoint block number
+const startBlock uint64 = 0
+
+// listen copies the oemContract writes of every valid transaction into the SQL store. The last processed block
+// and transaction are saved to the checkpoint file after each one is stored, so that a restarted listener resumes
+// where it stopped. A transaction stored just before a crash, but not yet checkpointed, is applied again on resume,
+// which the store tolerates as it is keyed by ledger key.
+func listen(network *client.Network) error {
+	store, err := openStore(storeFile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	checkpointer, err := client.NewFileCheckpointer(checkpointFile)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	defer checkpointer.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	fmt.Printf("Starting event listening from block %d\n", max(checkpointer.BlockNumber(), startBlock))
+	fmt.Println("Last processed transaction ID within block:", checkpointer.TransactionID())
+
+	blocks, err := network.BlockEvents(ctx, client.WithCheckpoint(checkpointer), client.WithStartBlock(startBlock))
+	if err != nil {
+		return fmt.Errorf("failed to start block event listening: %w", err)
+	}
+
+	for block := range blocks {
+		processor := &blockProcessor{block: block, checkpointer: checkpointer, store: store}
+		if err := processor.process(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blockProcessor applies the new transactions of one block to the store
+type blockProcessor struct {
+	block        *common.Block
+	checkpointer *client.FileCheckpointer
+	store        *sqlStore
+}
+
+func (p *blockProcessor) process() error {
+	blockNumber := p.block.GetHeader().GetNumber()
+	fmt.Printf("\nReceived block %d\n", blockNumber)
+
+	transactions, err := p.newTransactions()
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		if transaction.IsValid() {
+			if err := p.processTransaction(blockNumber, transaction); err != nil {
+				return err
+			}
+		}
+		if err := p.checkpointer.CheckpointTransaction(blockNumber, transaction.ChannelHeader.GetTxId()); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+	}
+
+	return p.checkpointer.CheckpointBlock(blockNumber)
+}
+
+func (p *blockProcessor) processTransaction(blockNumber uint64, transaction *transaction) error {
+	transactionID := transaction.ChannelHeader.GetTxId()
+
+	readWriteSets, err := transaction.NamespaceReadWriteSets()
+	if err != nil {
+		return fmt.Errorf("failed to parse transaction %s: %w", transactionID, err)
+	}
+
+	update := &ledgerUpdate{BlockNumber: blockNumber, TransactionID: transactionID}
+	for _, readWriteSet := range readWriteSets {
+		if readWriteSet.Namespace != chaincodeName {
+			continue
+		}
+		for _, kvWrite := range readWriteSet.ReadWriteSet.GetWrites() {
+			update.Writes = append(update.Writes, write{Key: kvWrite.GetKey(), IsDelete: kvWrite.GetIsDelete(), Value: kvWrite.GetValue()})
+		}
+	}
+	if len(update.Writes) == 0 {
+		fmt.Printf("Skipping transaction %s with no %s writes\n", transactionID, chaincodeName)
+		return nil
+	}
+
+	fmt.Printf("Process transaction %s\n", transactionID)
+	return p.store.Apply(update)
+}
+
+// newTransactions returns the transactions of the block after the last one processed
+func (p *blockProcessor) newTransactions() ([]*transaction, error) {
+	transactions, err := parseBlock(p.block)
+	if err != nil {
+		return nil, err
+	}
+
+	lastTransactionID := p.checkpointer.TransactionID()
+	if lastTransactionID == "" {
+		// No previously processed transactions within this block so all are new
+		return transactions, nil
+	}
+
+	// Ignore transactions up to the last processed transaction ID
+	var blockTransactionIDs []string
+	for i, transaction := range transactions {
+		transactionID := transaction.ChannelHeader.GetTxId()
+		if transactionID == lastTransactionID {
+			return transactions[i+1:], nil
+		}
+		blockTransactionIDs = append(blockTransactionIDs, transactionID)
+	}
+
+	return nil, fmt.Errorf("checkpoint transaction ID %s not found in block %d containing transactions: %s",
+		lastTransactionID, p.block.GetHeader().GetNumber(), strings.Join(blockTransactionIDs, ", "))
+}
@@ -0,0 +1,186 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// The tables mirror the oemContract records, keyed by the ledger key they are stored under, so that
+// re-applying a transaction after a restart overwrites the rows it wrote the first time.
+const schema = `
+CREATE TABLE IF NOT EXISTS aircraft (
+	ledger_key       TEXT PRIMARY KEY,
+	ac_number        TEXT NOT NULL,
+	model            TEXT,
+	variant          TEXT,
+	customer_airline TEXT,
+	status           TEXT,
+	current_station  TEXT,
+	created_at       TEXT,
+	updated_at       TEXT,
+	block_number     INTEGER NOT NULL,
+	transaction_id   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS activities (
+	ledger_key       TEXT PRIMARY KEY,
+	ac_number        TEXT NOT NULL,
+	activity_id      TEXT NOT NULL,
+	station_number   INTEGER,
+	start_time       TEXT,
+	end_time         TEXT,
+	machine_id       TEXT,
+	tools_or_drill   TEXT,
+	parts            TEXT,
+	previous_station TEXT,
+	next_station     TEXT,
+	rework_of        TEXT,
+	block_number     INTEGER NOT NULL,
+	transaction_id   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS activities_ac_number ON activities (ac_number);
+CREATE TABLE IF NOT EXISTS inspections (
+	ledger_key        TEXT PRIMARY KEY,
+	ac_number         TEXT NOT NULL,
+	station           TEXT,
+	inspection_id     TEXT NOT NULL,
+	activity_id       TEXT,
+	result            TEXT,
+	defect_codes      TEXT,
+	inspector_msp     TEXT,
+	inspected_at      TEXT,
+	countersignatures TEXT,
+	block_number      INTEGER NOT NULL,
+	transaction_id    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS inspections_ac_number ON inspections (ac_number);
+`
+
+// ledgerUpdate is the set of oemContract writes made by one valid transaction
+type ledgerUpdate struct {
+	BlockNumber   uint64
+	TransactionID string
+	Writes        []write
+}
+
+// write is a single ledger write that can be applied to the off-chain store
+type write struct {
+	Key      string
+	IsDelete bool
+	Value    []byte
+}
+
+// record holds the fields of the oemContract records the store keeps. Which ones are set depends on DocType.
+type record struct {
+	DocType           string          `json:"docType"`
+	ACNumber          string          `json:"acNumber"`
+	Model             string          `json:"model"`
+	Variant           string          `json:"variant"`
+	CustomerAirline   string          `json:"customerAirline"`
+	Status            string          `json:"status"`
+	CurrentStation    string          `json:"currentStation"`
+	CreatedAt         string          `json:"createdAt"`
+	UpdatedAt         string          `json:"updatedAt"`
+	ActivityID        string          `json:"activityID"`
+	StationNumber     int             `json:"stationNumber"`
+	StartTime         string          `json:"startTime"`
+	EndTime           string          `json:"endTime"`
+	MachineID         string          `json:"machineID"`
+	ToolsOrDrill      string          `json:"toolsOrDrill"`
+	Parts             json.RawMessage `json:"parts"`
+	PreviousStation   string          `json:"previousStation"`
+	NextStation       string          `json:"nextStation"`
+	ReworkOf          string          `json:"reworkOf"`
+	Station           string          `json:"station"`
+	InspectionID      string          `json:"inspectionID"`
+	Result            string          `json:"result"`
+	DefectCodes       json.RawMessage `json:"defectCodes"`
+	InspectorMSP      string          `json:"inspectorMSP"`
+	InspectedAt       string          `json:"inspectedAt"`
+	Countersignatures json.RawMessage `json:"countersignatures"`
+}
+
+// sqlStore keeps aircraft, activities and inspections in a SQLite database
+type sqlStore struct {
+	db *sql.DB
+}
+
+func openStore(filename string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create store schema: %w", err)
+	}
+	return &sqlStore{db: db}, nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// Apply writes all the changes of one transaction in a single database transaction, so that a failure leaves the
+// store as it was before the ledger transaction.
+func (s *sqlStore) Apply(update *ledgerUpdate) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, w := range update.Writes {
+		if err := applyWrite(tx, update, w); err != nil {
+			return fmt.Errorf("failed to apply write to key %q: %w", w.Key, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func applyWrite(tx *sql.Tx, update *ledgerUpdate, w write) error {
+	if w.IsDelete {
+		for _, table := range []string{"aircraft", "activities", "inspections"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE ledger_key = ?", w.Key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Index entries and other records with no JSON document are not exported
+	var r record
+	if err := json.Unmarshal(w.Value, &r); err != nil {
+		return nil
+	}
+
+	var err error
+	switch r.DocType {
+	case "asset":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO aircraft
+			(ledger_key, ac_number, model, variant, customer_airline, status, current_station, created_at, updated_at, block_number, transaction_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			w.Key, r.ACNumber, r.Model, r.Variant, r.CustomerAirline, r.Status, r.CurrentStation, r.CreatedAt, r.UpdatedAt,
+			update.BlockNumber, update.TransactionID)
+	case "activity":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO activities
+			(ledger_key, ac_number, activity_id, station_number, start_time, end_time, machine_id, tools_or_drill, parts, previous_station, next_station, rework_of, block_number, transaction_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			w.Key, r.ACNumber, r.ActivityID, r.StationNumber, r.StartTime, r.EndTime, r.MachineID, r.ToolsOrDrill, string(r.Parts),
+			r.PreviousStation, r.NextStation, r.ReworkOf, update.BlockNumber, update.TransactionID)
+	case "inspection":
+		_, err = tx.Exec(`INSERT OR REPLACE INTO inspections
+			(ledger_key, ac_number, station, inspection_id, activity_id, result, defect_codes, inspector_msp, inspected_at, countersignatures, block_number, transaction_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			w.Key, r.ACNumber, r.Station, r.InspectionID, r.ActivityID, r.Result, string(r.DefectCodes), r.InspectorMSP, r.InspectedAt,
+			string(r.Countersignatures), update.BlockNumber, update.TransactionID)
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command oem-gateway is the shop-floor client of the oemContract chaincode. It replaces hand written
+// `peer chaincode invoke` strings with one subcommand per assembly line operation:
+//
+//	go run . register -ac MSN001 -model A320 -variant neo -airline "Airline A"
+//	go run . worker -id W1 -name "Worker One" -skills riveting -certs RIV-2=2025-06-30T00:00:00Z
+//	go run . activity -ac MSN001 -id ACT1 -station 40 -start 2024-03-07T08:00:00Z -end 2024-03-07T09:30:00Z -machine M1 -tool D1 -worker W1 -next 35
+//	go run . transfer -ac MSN001 -to 35
+//	go run . history -ac MSN001
+//	go run . listen
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	channelName   = envOrDefault("CHANNEL_NAME", "oemchannel")
+	chaincodeName = envOrDefault("CHAINCODE_NAME", "oemChaincode")
+)
+
+// command runs one subcommand against the network with the remaining command line arguments
+type command func(network *client.Network, args []string) error
+
+var allCommands = map[string]command{
+	"register": registerAircraft,
+	"worker":   registerWorker,
+	"activity": recordActivity,
+	"transfer": transferAircraft,
+	"history":  printHistory,
+	"listen":   listen,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	cmd, ok := allCommands[os.Args[1]]
+	if !ok {
+		printUsage()
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+		os.Exit(2)
+	}
+
+	if err := run(cmd, os.Args[2:]); err != nil {
+		printError(err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd command, args []string) error {
+	// The gRPC client connection should be shared by all Gateway connections to this endpoint
+	clientConnection, err := newGrpcConnection()
+	if err != nil {
+		return err
+	}
+	defer clientConnection.Close()
+
+	certificate, err := loadCertificate(certPath)
+	if err != nil {
+		return err
+	}
+	id, err := newIdentity(certificate)
+	if err != nil {
+		return err
+	}
+	sign, closeSign, err := newSign(certificate)
+	if err != nil {
+		return err
+	}
+	defer closeSign()
+
+	// Create a Gateway connection for a specific client identity
+	gw, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(clientConnection),
+		// Default timeouts for different gRPC calls
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+
+	return cmd(gw.GetNetwork(channelName), args)
+}
+
+func printUsage() {
+	names := make([]string, 0, len(allCommands))
+	for name := range allCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Arguments: <command> [<flags>]")
+	fmt.Fprintln(os.Stderr, "Available commands:", names)
+	fmt.Fprintln(os.Stderr, "Run <command> -h for the flags of a command")
+}
+
+// printError prints a transaction failure together with the details of any error responses from the peers,
+// which carry the chaincode's error message, e.g. "NOT_CLEARED: mandatory activity ...".
+func printError(err error) {
+	switch err := err.(type) {
+	case *client.EndorseError:
+		fmt.Fprintf(os.Stderr, "Endorse error for transaction %s with gRPC status %v: %s\n", err.TransactionID, status.Code(err), err)
+	case *client.SubmitError:
+		fmt.Fprintf(os.Stderr, "Submit error for transaction %s with gRPC status %v: %s\n", err.TransactionID, status.Code(err), err)
+	case *client.CommitStatusError:
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "Timeout waiting for transaction %s commit status: %s\n", err.TransactionID, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error obtaining commit status for transaction %s with gRPC status %v: %s\n", err.TransactionID, status.Code(err), err)
+		}
+	case *client.CommitError:
+		fmt.Fprintf(os.Stderr, "Transaction %s failed to commit with status %d: %s\n", err.TransactionID, int32(err.Code), err)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return
+	}
+
+	// Any error that originates from a peer or orderer node external to the gateway will have its details
+	// embedded within the gRPC status error.
+	for _, detail := range status.Convert(err).Details() {
+		if detail, ok := detail.(*gateway.ErrorDetail); ok {
+			fmt.Fprintf(os.Stderr, "- address: %s, mspId: %s, message: %s\n", detail.Address, detail.MspId, detail.Message)
+		}
+	}
+}
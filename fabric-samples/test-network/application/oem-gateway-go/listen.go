@@ -0,0 +1,64 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// listen prints the chaincode events emitted by oemContract until interrupted. The position of the last
+// processed event is saved to a checkpoint file, so that a restarted listener resumes where it stopped
+// instead of missing or replaying events.
+func listen(network *client.Network, args []string) error {
+	flags := flag.NewFlagSet("listen", flag.ExitOnError)
+	checkpointFile := flags.String("checkpoint", envOrDefault("CHECKPOINT_FILE", "checkpoint.json"), "file to store the listening position in")
+	startBlock := flags.Uint64("start", 0, "block to start from when there is no checkpoint")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	checkpointer, err := client.NewFileCheckpointer(*checkpointFile)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	defer checkpointer.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	fmt.Printf("\n*** Start chaincode event listening from block %d\n", max(checkpointer.BlockNumber(), *startBlock))
+	fmt.Println("*** Last processed transaction ID within block:", checkpointer.TransactionID())
+
+	events, err := network.ChaincodeEvents(
+		ctx,
+		chaincodeName,
+		client.WithCheckpoint(checkpointer),
+		client.WithStartBlock(*startBlock), // Used only if there is no checkpoint block number
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start chaincode event listening: %w", err)
+	}
+
+	for event := range events {
+		payload, err := formatJSON(event.Payload)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n<-- Chaincode event received in block %d, transaction %s: %s - %s\n", event.BlockNumber, event.TransactionID, event.EventName, payload)
+
+		if err := checkpointer.CheckpointChaincodeEvent(event); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+	}
+
+	fmt.Println("\n*** Chaincode event listening stopped")
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// The signer that holds the client's private key is chosen with SIGNER:
+//
+//   - file (default) reads the private key from KEY_DIRECTORY_PATH.
+//   - pkcs11 signs with a key kept in an HSM, e.g. SoftHSM as in the hardware-security-module sample. The key is
+//     found by the subject key identifier of the client certificate, in the token labelled PKCS11_LABEL, opened
+//     with PKCS11_PIN using the PKCS11_LIB library. It needs a binary built with -tags pkcs11.
+//   - remote sends each digest to a signing service at REMOTE_SIGNER_URL, so that terminals never hold a key.
+//
+// The signers mirror the SignerSetup of the REST API in asset-transfer-basic/rest-api-go, configured from the
+// environment instead. The remote signer itself is shared with it through remotesign.go.
+var (
+	signerType        = envOrDefault("SIGNER", "file")
+	pkcs11Label       = envOrDefault("PKCS11_LABEL", "ForFabric")
+	pkcs11Pin         = envOrDefault("PKCS11_PIN", "98765432")
+	remoteSignerURL   = os.Getenv("REMOTE_SIGNER_URL")
+	remoteSignerToken = os.Getenv("REMOTE_SIGNER_TOKEN")
+)
+
+// newSign creates a function that generates a digital signature from a message digest with the configured signer,
+// and a function releasing the signer's resources.
+func newSign(certificate *x509.Certificate) (identity.Sign, func(), error) {
+	switch signerType {
+	case "file":
+		sign, err := newFileSign()
+		return sign, func() {}, err
+	case "pkcs11":
+		return newHSMSign(certificate)
+	case "remote":
+		if remoteSignerURL == "" {
+			return nil, nil, errors.New("REMOTE_SIGNER_URL must be set for the remote signer")
+		}
+		sign, err := newRemoteSign(certificate, remoteSignerURL, remoteSignerToken)
+		return sign, func() {}, err
+	default:
+		return nil, nil, fmt.Errorf("unknown signer %q, expected file, pkcs11 or remote", signerType)
+	}
+}
+
+// newFileSign creates a signing function using the private key file found in KEY_DIRECTORY_PATH.
+func newFileSign() (identity.Sign, error) {
+	files, err := os.ReadDir(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key directory: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no private key files found in directory %s", keyPath)
+	}
+	privateKeyPEM, err := os.ReadFile(path.Join(keyPath, files[0].Name()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity.NewPrivateKeySign(privateKey)
+}
@@ -0,0 +1,19 @@
+//go:build !pkcs11
+
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// newHSMSign is only available in binaries built with -tags pkcs11, which need cgo.
+func newHSMSign(certificate *x509.Certificate) (identity.Sign, func(), error) {
+	return nil, nil, errors.New("the pkcs11 signer needs a binary built with -tags pkcs11")
+}
@@ -0,0 +1,70 @@
+//go:build pkcs11
+
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// newHSMSign creates a signing function backed by the HSM key matching the certificate's subject key identifier.
+func newHSMSign(certificate *x509.Certificate) (identity.Sign, func(), error) {
+	library, err := findPKCS11Library()
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("HSM signer requires an ECDSA certificate, got %T", certificate.PublicKey)
+	}
+
+	factory, err := identity.NewHSMSignerFactory(library)
+	if err != nil {
+		return nil, nil, err
+	}
+	ski := sha256.Sum256(elliptic.Marshal(publicKey.Curve, publicKey.X, publicKey.Y))
+	sign, signClose, err := factory.NewHSMSigner(identity.HSMSignerOptions{
+		Label:      pkcs11Label,
+		Pin:        pkcs11Pin,
+		Identifier: string(ski[:]),
+	})
+	if err != nil {
+		factory.Dispose()
+		return nil, nil, err
+	}
+
+	return sign, func() {
+		signClose()
+		factory.Dispose()
+	}, nil
+}
+
+// findPKCS11Library returns PKCS11_LIB, or the first SoftHSM library found in the usual install locations.
+func findPKCS11Library() (string, error) {
+	if library := os.Getenv("PKCS11_LIB"); library != "" {
+		return library, nil
+	}
+	libraryLocations := []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	}
+	for _, libraryLocation := range libraryLocations {
+		if _, err := os.Stat(libraryLocation); !errors.Is(err, os.ErrNotExist) {
+			return libraryLocation, nil
+		}
+	}
+	return "", errors.New("no PKCS#11 library found, set PKCS11_LIB")
+}
@@ -0,0 +1,288 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// partRef mirrors the PartRef argument of the CreateActivity transaction
+type partRef struct {
+	PartNumber   string `json:"partNumber"`
+	SerialNumber string `json:"serialNumber"`
+}
+
+// activityWorker is passed to CreateActivity in the transient map, so that worker identities only reach the
+// OEM private data collection
+type activityWorker struct {
+	WorkerID           string `json:"workerID"`
+	StationResponsible string `json:"stationResponsible"`
+	Salt               string `json:"salt"`
+}
+
+// worker mirrors the Worker record of the oemContract worker registry
+type worker struct {
+	WorkerID       string          `json:"workerID"`
+	Name           string          `json:"name"`
+	Skills         []string        `json:"skills"`
+	Certifications []certification `json:"certifications"`
+}
+
+// certification mirrors a Certification held by a worker
+type certification struct {
+	Code      string `json:"code"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// registerAircraft submits CreateAsset for a new aircraft, which enters the first station of the routing
+func registerAircraft(network *client.Network, args []string) error {
+	flags := flag.NewFlagSet("register", flag.ExitOnError)
+	acNumber := flags.String("ac", "", "aircraft number, e.g. MSN001")
+	model := flags.String("model", "", "aircraft model, e.g. A320")
+	variant := flags.String("variant", "", "model variant, e.g. neo")
+	airline := flags.String("airline", "", "customer airline")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *acNumber == "" {
+		return errors.New("-ac is required")
+	}
+
+	fmt.Printf("\n--> Submit Transaction: CreateAsset, %s %s%s for %s\n", *acNumber, *model, *variant, *airline)
+
+	contract := network.GetContract(chaincodeName)
+	if _, err := contract.SubmitTransaction("CreateAsset", *acNumber, *model, *variant, *airline); err != nil {
+		return err
+	}
+
+	fmt.Println("*** Transaction committed successfully")
+	return nil
+}
+
+// recordActivity submits CreateActivity. The worker identity is sent in the transient map with a random salt,
+// and the transaction is endorsed by the client's own organization, which is the only holder of that data.
+func recordActivity(network *client.Network, args []string) error {
+	flags := flag.NewFlagSet("activity", flag.ExitOnError)
+	acNumber := flags.String("ac", "", "aircraft number")
+	activityID := flags.String("id", "", "activity ID")
+	station := flags.Int("station", 0, "station the activity was performed at")
+	start := flags.String("start", "", "RFC3339 start time")
+	end := flags.String("end", "", "RFC3339 end time")
+	machineID := flags.String("machine", "", "machine used, if any")
+	tool := flags.String("tool", "", "tool or drill used, if any")
+	parts := flags.String("parts", "", "comma separated P/N:S/N of the parts installed, e.g. P100:S1,P200:S7")
+	previous := flags.String("prev", "", "previous station")
+	next := flags.String("next", "", "next station")
+	worker := flags.String("worker", "", "ID of the worker who performed the activity")
+	responsible := flags.String("responsible", "", "ID of the station responsible")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *acNumber == "" || *activityID == "" || *worker == "" {
+		return errors.New("-ac, -id and -worker are required")
+	}
+
+	partRefs, err := parsePartRefs(*parts)
+	if err != nil {
+		return err
+	}
+	partsJSON, err := json.Marshal(partRefs)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	workerJSON, err := json.Marshal(activityWorker{
+		WorkerID:           *worker,
+		StationResponsible: *responsible,
+		Salt:               base64.StdEncoding.EncodeToString(salt),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n--> Submit Transaction: CreateActivity, %s on %s at station %d\n", *activityID, *acNumber, *station)
+
+	contract := network.GetContract(chaincodeName)
+	_, err = contract.Submit(
+		"CreateActivity",
+		client.WithArguments(*acNumber, *activityID, *start, *end, strconv.Itoa(*station), *machineID, *tool, string(partsJSON), *previous, *next),
+		client.WithTransient(map[string][]byte{"activity_worker": workerJSON}),
+		client.WithEndorsingOrganizations(mspID),
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("*** Transaction committed successfully")
+	return nil
+}
+
+// registerWorker submits SetWorker to register a worker, or replace their skills and certifications. The worker
+// record is sent in the transient map and endorsed by the client's own organization only, like activity workers.
+func registerWorker(network *client.Network, args []string) error {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	workerID := flags.String("id", "", "worker ID")
+	name := flags.String("name", "", "worker name")
+	skills := flags.String("skills", "", "comma separated skills, e.g. riveting,sealing")
+	certs := flags.String("certs", "", "comma separated CODE=expiry certifications, e.g. RIV-2=2025-06-30T00:00:00Z")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *workerID == "" {
+		return errors.New("-id is required")
+	}
+
+	certifications, err := parseCertifications(*certs)
+	if err != nil {
+		return err
+	}
+	workerSkills := []string{}
+	if *skills != "" {
+		workerSkills = strings.Split(*skills, ",")
+	}
+	workerJSON, err := json.Marshal(worker{
+		WorkerID:       *workerID,
+		Name:           *name,
+		Skills:         workerSkills,
+		Certifications: certifications,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n--> Submit Transaction: SetWorker, %s with %d certifications\n", *workerID, len(certifications))
+
+	contract := network.GetContract(chaincodeName)
+	_, err = contract.Submit(
+		"SetWorker",
+		client.WithTransient(map[string][]byte{"worker": workerJSON}),
+		client.WithEndorsingOrganizations(mspID),
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("*** Transaction committed successfully")
+	return nil
+}
+
+// transferAircraft submits TransferAsset to hand an aircraft over to the next station of the routing
+func transferAircraft(network *client.Network, args []string) error {
+	flags := flag.NewFlagSet("transfer", flag.ExitOnError)
+	acNumber := flags.String("ac", "", "aircraft number")
+	nextStation := flags.String("to", "", "station to hand the aircraft over to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *acNumber == "" || *nextStation == "" {
+		return errors.New("-ac and -to are required")
+	}
+
+	fmt.Printf("\n--> Async Submit Transaction: TransferAsset, %s to station %s\n", *acNumber, *nextStation)
+
+	contract := network.GetContract(chaincodeName)
+	_, commit, err := contract.SubmitAsync("TransferAsset", client.WithArguments(*acNumber, *nextStation))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("*** Waiting for transaction commit.")
+
+	status, err := commit.Status()
+	if err != nil {
+		return err
+	}
+	if !status.Successful {
+		return fmt.Errorf("transaction %s failed to commit with status: %d", status.TransactionID, int32(status.Code))
+	}
+
+	fmt.Printf("*** Transaction committed successfully in block %d\n", status.BlockNumber)
+	return nil
+}
+
+// printHistory evaluates the ledger history of an aircraft together with its activities and inspections
+func printHistory(network *client.Network, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	acNumber := flags.String("ac", "", "aircraft number")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *acNumber == "" {
+		return errors.New("-ac is required")
+	}
+
+	contract := network.GetContract(chaincodeName)
+	for _, transaction := range []string{"GetAssetHistory", "GetActivitiesForAsset", "GetInspectionsForAsset"} {
+		fmt.Printf("\n--> Evaluate Transaction: %s, %s\n", transaction, *acNumber)
+
+		evaluateResult, err := contract.EvaluateTransaction(transaction, *acNumber)
+		if err != nil {
+			return err
+		}
+		result, err := formatJSON(evaluateResult)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("*** Result:%s\n", result)
+	}
+
+	return nil
+}
+
+// parsePartRefs parses a comma separated list of P/N:S/N pairs
+func parsePartRefs(value string) ([]partRef, error) {
+	parts := []partRef{}
+	if value == "" {
+		return parts, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		partNumber, serialNumber, ok := strings.Cut(item, ":")
+		if !ok || partNumber == "" || serialNumber == "" {
+			return nil, fmt.Errorf("invalid part %q, expected P/N:S/N", item)
+		}
+		parts = append(parts, partRef{PartNumber: partNumber, SerialNumber: serialNumber})
+	}
+	return parts, nil
+}
+
+// parseCertifications parses a comma separated list of CODE=expiry certifications
+func parseCertifications(value string) ([]certification, error) {
+	certifications := []certification{}
+	if value == "" {
+		return certifications, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		code, expiresAt, ok := strings.Cut(item, "=")
+		if !ok || code == "" || expiresAt == "" {
+			return nil, fmt.Errorf("invalid certification %q, expected CODE=expiry", item)
+		}
+		certifications = append(certifications, certification{Code: code, ExpiresAt: expiresAt})
+	}
+	return certifications, nil
+}
+
+// formatJSON indents JSON data for printing
+func formatJSON(data []byte) (string, error) {
+	var prettyJSON bytes.Buffer
+	if err := json.Indent(&prettyJSON, data, "", "  "); err != nil {
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return prettyJSON.String(), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Access control is based on the MSP ID of the invoking client and on attributes
+embedded in its X.509 certificate when the identity is enrolled with the CA, e.g.
+
+	fabric-ca-client register --id.name worker1 --id.attrs 'oem.role=worker:ecert,oem.stations=40,35:ecert,oem.workerID=W1:ecert'
+	fabric-ca-client register --id.name qa1 --id.attrs 'oem.role=qa:ecert'
+
+oem.role is one of the Role* values below. oem.stations is the comma separated
+list of stations a worker is responsible for. oem.workerID is the ID the worker
+is registered under with SetWorker, and ties the activities a client records to
+the worker it enrolled as.
+*/
+
+const (
+	OEMMSP      = "OEMMSP"
+	SupplierMSP = "SupplierMSP"
+	AirlineMSP  = "AirlineMSP"
+
+	roleAttribute     = "oem.role"
+	stationsAttribute = "oem.stations"
+	workerIDAttribute = "oem.workerID"
+
+	RoleWorker = "worker"
+	RoleQA     = "qa"
+)
+
+// qaMSPs are the organizations running a QA peer (QA1 at the OEM, QA2 at the supplier, QA3 at the airline)
+var qaMSPs = []string{OEMMSP, SupplierMSP, AirlineMSP}
+
+// clientMSPID returns the MSP ID of the invoking client
+func clientMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	return mspID, nil
+}
+
+// assertOEM checks that the invoking client belongs to the OEM organization
+func assertOEM(ctx contractapi.TransactionContextInterface) error {
+	return assertMSP(ctx, OEMMSP)
+}
+
+// assertMSP checks that the invoking client belongs to one of the given organizations
+func assertMSP(ctx contractapi.TransactionContextInterface, mspIDs ...string) error {
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if !containsString(mspIDs, mspID) {
+		return newContractError(ErrForbidden, "client from %s is not authorized, only %s may perform this operation", mspID, strings.Join(mspIDs, " or "))
+	}
+	return nil
+}
+
+// assertRole checks that the invoking client has the given oem.role attribute
+func assertRole(ctx contractapi.TransactionContextInterface, role string) error {
+	if err := ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, role); err != nil {
+		return newContractError(ErrForbidden, "client does not have the %s role", role)
+	}
+	return nil
+}
+
+// assertWorkerID checks that the invoking client is enrolled as the given worker through its oem.workerID attribute
+func assertWorkerID(ctx contractapi.TransactionContextInterface, workerID string) error {
+	clientWorkerID, found, err := ctx.GetClientIdentity().GetAttributeValue(workerIDAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read %s attribute: %v", workerIDAttribute, err)
+	}
+	if !found {
+		return newContractError(ErrForbidden, "client does not have the %s attribute", workerIDAttribute)
+	}
+	if clientWorkerID != workerID {
+		return newContractError(ErrForbidden, "client is enrolled as worker %s and cannot record work of worker %s", clientWorkerID, workerID)
+	}
+	return nil
+}
+
+// assertQA checks that the invoking client has the QA role and belongs to one of the QA organizations
+func assertQA(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if !containsString(qaMSPs, mspID) {
+		return newContractError(ErrForbidden, "client from %s is not a QA organization", mspID)
+	}
+	return assertRole(ctx, RoleQA)
+}
+
+// assertStationResponsible checks that the invoking client is a worker responsible for the station
+func assertStationResponsible(ctx contractapi.TransactionContextInterface, station string) error {
+	if err := assertRole(ctx, RoleWorker); err != nil {
+		return err
+	}
+
+	stations, found, err := ctx.GetClientIdentity().GetAttributeValue(stationsAttribute)
+	if err != nil {
+		return fmt.Errorf("failed to read %s attribute: %v", stationsAttribute, err)
+	}
+	if !found || !containsString(strings.Split(stations, ","), station) {
+		return newContractError(ErrForbidden, "client is not responsible for station %s", station)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Activities are stored under the composite key activity~acNumber~station~activityID,
+so that the full build history of an aircraft, or of one station of an aircraft,
+is a single partial composite key range query.
+
+The station, worker and machine queries are rich queries and are only supported
+when CouchDB is used as state database. The indexes backing them are packaged in
+META-INF/statedb/couchdb/indexes, and in META-INF/statedb/couchdb/collections for
+the worker query, which runs against the OEM private data collection.
+*/
+
+const activityDocType = "activity"
+
+// PaginatedActivityResult is used for returning paginated activity query results and metadata
+type PaginatedActivityResult struct {
+	Records             []*Activity `json:"records"`
+	FetchedRecordsCount int32       `json:"fetchedRecordsCount"`
+	Bookmark            string      `json:"bookmark"`
+}
+
+// GetActivitiesForAsset returns every activity recorded on an aircraft, ordered by station and activity ID
+func (s *SmartContract) GetActivitiesForAsset(ctx contractapi.TransactionContextInterface, acNumber string) ([]*Activity, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(activityDocType, []string{acNumber})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructActivitiesFromIterator(resultsIterator)
+}
+
+// GetActivitiesByStation returns a page of the activities recorded at a station, across all aircraft
+func (s *SmartContract) GetActivitiesByStation(ctx contractapi.TransactionContextInterface, stationNumber int, pageSize int, bookmark string) (*PaginatedActivityResult, error) {
+	return queryActivitiesWithPagination(ctx, "stationNumber", stationNumber, pageSize, bookmark)
+}
+
+// GetActivitiesByWorker returns the activities performed by a worker. Worker identities are private to the OEM,
+// so only OEM clients may run this query, from an OEM peer. Queries on private data do not support pagination.
+func (s *SmartContract) GetActivitiesByWorker(ctx contractapi.TransactionContextInterface, workerID string) ([]*Activity, error) {
+	return queryActivitiesByWorker(ctx, map[string]interface{}{
+		"workerID": workerID,
+	})
+}
+
+// queryActivitiesByWorker runs a rich query on the worker identities in the OEM collection and returns the public
+// activities they belong to. Only OEM clients may run it, from an OEM peer.
+func queryActivitiesByWorker(ctx contractapi.TransactionContextInterface, selector map[string]interface{}) ([]*Activity, error) {
+	if err := assertOEM(ctx); err != nil {
+		return nil, err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return nil, err
+	}
+
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build worker query: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(oemCollection, string(queryJSON))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	activities := []*Activity{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		activityJSON, err := ctx.GetStub().GetState(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read activity: %v", err)
+		}
+		if activityJSON == nil {
+			continue
+		}
+		var activity Activity
+		if err := json.Unmarshal(activityJSON, &activity); err != nil {
+			return nil, err
+		}
+		activities = append(activities, &activity)
+	}
+
+	return activities, nil
+}
+
+// GetActivitiesByMachine returns a page of the activities performed with a machine
+func (s *SmartContract) GetActivitiesByMachine(ctx contractapi.TransactionContextInterface, machineID string, pageSize int, bookmark string) (*PaginatedActivityResult, error) {
+	return queryActivitiesWithPagination(ctx, "machineID", machineID, pageSize, bookmark)
+}
+
+// GetActivitiesForStation returns the activities recorded on an aircraft at one station
+func (s *SmartContract) GetActivitiesForStation(ctx contractapi.TransactionContextInterface, acNumber string, station string) ([]*Activity, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(activityDocType, []string{acNumber, station})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructActivitiesFromIterator(resultsIterator)
+}
+
+// activityKey builds the composite key an activity is stored under
+func activityKey(ctx contractapi.TransactionContextInterface, acNumber string, station string, activityID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(activityDocType, []string{acNumber, station, activityID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create activity key: %v", err)
+	}
+	return key, nil
+}
+
+// queryActivitiesWithPagination runs a parameterized rich query selecting activities on a single field
+func queryActivitiesWithPagination(ctx contractapi.TransactionContextInterface, field string, value interface{}, pageSize int, bookmark string) (*PaginatedActivityResult, error) {
+	return queryActivitiesPage(ctx, map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": activityDocType,
+			field:     value,
+		},
+	}, pageSize, bookmark)
+}
+
+// constructActivitiesFromIterator constructs a slice of activities from the resultsIterator
+func constructActivitiesFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Activity, error) {
+	activities := []*Activity{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var activity Activity
+		if err := json.Unmarshal(queryResult.Value, &activity); err != nil {
+			return nil, err
+		}
+		activities = append(activities, &activity)
+	}
+
+	return activities, nil
+}
+
+// validateActivityTimes checks that both times are RFC3339 timestamps and that the activity ends after it starts.
+// It returns them in UTC, so that the stored times of all activities sort chronologically as text.
+func validateActivityTimes(startTime string, endTime string) (string, string, error) {
+	start, err := time.Parse(time.RFC3339, startTime)
+	if err != nil {
+		return "", "", newContractError(ErrInvalidTimestamp, "start time %q is not an RFC3339 timestamp", startTime)
+	}
+	end, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return "", "", newContractError(ErrInvalidTimestamp, "end time %q is not an RFC3339 timestamp", endTime)
+	}
+	if !end.After(start) {
+		return "", "", newContractError(ErrInvalidTimestamp, "end time %s must be after start time %s", endTime, startTime)
+	}
+	return start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339), nil
+}
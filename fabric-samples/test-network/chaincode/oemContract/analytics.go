@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Lead-time analytics are computed from the StartTime and EndTime of activities:
+
+  - the cycle time of an aircraft at a station runs from the start of its first
+    activity there to the end of its last one, the work time is the sum of the
+    activity durations;
+  - the queue time at a station runs from the end of the last activity at the
+    previous station of the routing to the start of the first one at this station;
+  - the utilization of a worker or machine is the share of a date range it spent
+    on activities. Activities that overlap in time count once, so a worker
+    recorded on two activities at the same time is not more than fully busy.
+
+The station and machine functions run paginated rich queries and need CouchDB.
+Each page carries the figures of the activities it fetched, so a client reading
+several pages adds up the busy minutes of the utilization pages, and keeps the
+earliest start and the latest end of an aircraft that appears on two station
+pages. Overlaps are only merged within a page. Date ranges are compared as RFC3339
+text, so activity times are stored in UTC and the from and to of a query are
+converted to UTC before they are compared.
+*/
+
+// StationVisit is the time an aircraft spent at one station
+type StationVisit struct {
+	ACNumber      string  `json:"acNumber"`
+	Station       string  `json:"station"`
+	FirstStart    string  `json:"firstStart"`
+	LastEnd       string  `json:"lastEnd"`
+	CycleMinutes  float64 `json:"cycleMinutes"`
+	WorkMinutes   float64 `json:"workMinutes"`
+	QueueMinutes  float64 `json:"queueMinutes"` // Only set by GetAircraftCycleTimes
+	ActivityCount int     `json:"activityCount"`
+}
+
+// AircraftCycleTime is the lead time of an aircraft through the stations it has visited, in routing order
+type AircraftCycleTime struct {
+	ACNumber     string          `json:"acNumber"`
+	Stations     []*StationVisit `json:"stations"`
+	LeadMinutes  float64         `json:"leadMinutes"` // From the first activity start to the last activity end
+	WorkMinutes  float64         `json:"workMinutes"`
+	QueueMinutes float64         `json:"queueMinutes"`
+}
+
+// PaginatedStationVisits is used for returning a page of station cycle times and metadata
+type PaginatedStationVisits struct {
+	Records             []*StationVisit `json:"records"`
+	AverageCycleMinutes float64         `json:"averageCycleMinutes"` // Average over the records of this page
+	FetchedRecordsCount int32           `json:"fetchedRecordsCount"`
+	Bookmark            string          `json:"bookmark"`
+}
+
+// Utilization is the share of a date range a worker or machine spent on activities
+type Utilization struct {
+	ID                  string  `json:"id"`
+	From                string  `json:"from"`
+	To                  string  `json:"to"`
+	PeriodMinutes       float64 `json:"periodMinutes"`
+	BusyMinutes         float64 `json:"busyMinutes"`
+	Utilization         float64 `json:"utilization"` // BusyMinutes / PeriodMinutes
+	ActivityCount       int     `json:"activityCount"`
+	FetchedRecordsCount int32   `json:"fetchedRecordsCount"`
+	Bookmark            string  `json:"bookmark"`
+}
+
+// GetAircraftCycleTimes returns the cycle, work and queue time of an aircraft at every station it has activities at
+func (s *SmartContract) GetAircraftCycleTimes(ctx contractapi.TransactionContextInterface, acNumber string) (*AircraftCycleTime, error) {
+	activities, err := s.GetActivitiesForAsset(ctx, acNumber)
+	if err != nil {
+		return nil, err
+	}
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	visits, err := stationVisits(activities)
+	if err != nil {
+		return nil, err
+	}
+	byStation := make(map[string]*StationVisit, len(visits))
+	for _, visit := range visits {
+		byStation[visit.Station] = visit
+	}
+
+	result := &AircraftCycleTime{ACNumber: acNumber, Stations: []*StationVisit{}}
+	var previous *StationVisit
+	for _, station := range routing.Stations {
+		visit, ok := byStation[station]
+		if !ok {
+			continue
+		}
+		if previous != nil {
+			visit.QueueMinutes, err = minutesBetween(previous.LastEnd, visit.FirstStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.Stations = append(result.Stations, visit)
+		result.WorkMinutes += visit.WorkMinutes
+		result.QueueMinutes += visit.QueueMinutes
+		previous = visit
+	}
+	if len(result.Stations) > 0 {
+		result.LeadMinutes, err = minutesBetween(result.Stations[0].FirstStart, previous.LastEnd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// GetStationCycleTimes returns a page of the cycle times of the aircraft at a station, counting the activities
+// that started in [from, to)
+func (s *SmartContract) GetStationCycleTimes(ctx contractapi.TransactionContextInterface, stationNumber int, from string, to string, pageSize int, bookmark string) (*PaginatedStationVisits, error) {
+	from, to, err := validateDateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := queryActivitiesPage(ctx, map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":       activityDocType,
+			"stationNumber": stationNumber,
+			"startTime":     map[string]interface{}{"$gte": from, "$lt": to},
+		},
+		"sort": []map[string]string{{"docType": "asc"}, {"stationNumber": "asc"}, {"acNumber": "asc"}},
+	}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	visits, err := stationVisits(page.Records)
+	if err != nil {
+		return nil, err
+	}
+	result := &PaginatedStationVisits{
+		Records:             visits,
+		FetchedRecordsCount: page.FetchedRecordsCount,
+		Bookmark:            page.Bookmark,
+	}
+	for _, visit := range visits {
+		result.AverageCycleMinutes += visit.CycleMinutes / float64(len(visits))
+	}
+
+	return result, nil
+}
+
+// GetMachineUtilization returns the share of [from, to) a machine spent on the activities of one page
+func (s *SmartContract) GetMachineUtilization(ctx contractapi.TransactionContextInterface, machineID string, from string, to string, pageSize int, bookmark string) (*Utilization, error) {
+	from, to, err := validateDateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := queryActivitiesPage(ctx, map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":   activityDocType,
+			"machineID": machineID,
+			"startTime": map[string]interface{}{"$lt": to},
+			"endTime":   map[string]interface{}{"$gt": from},
+		},
+	}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := utilization(machineID, from, to, page.Records)
+	if err != nil {
+		return nil, err
+	}
+	result.FetchedRecordsCount = page.FetchedRecordsCount
+	result.Bookmark = page.Bookmark
+
+	return result, nil
+}
+
+// GetWorkerUtilization returns the share of [from, to) a worker spent on activities. Worker identities are private
+// to the OEM, so only OEM clients may run this query, from an OEM peer.
+func (s *SmartContract) GetWorkerUtilization(ctx contractapi.TransactionContextInterface, workerID string, from string, to string) (*Utilization, error) {
+	from, to, err := validateDateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := queryActivitiesByWorker(ctx, map[string]interface{}{
+		"workerID":  workerID,
+		"startTime": map[string]interface{}{"$lt": to},
+		"endTime":   map[string]interface{}{"$gt": from},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return utilization(workerID, from, to, activities)
+}
+
+// stationVisits groups activities by aircraft and station, in the order the groups first appear
+func stationVisits(activities []*Activity) ([]*StationVisit, error) {
+	visits := []*StationVisit{}
+	index := make(map[[2]string]*StationVisit)
+	for _, activity := range activities {
+		work, err := minutesBetween(activity.StartTime, activity.EndTime)
+		if err != nil {
+			return nil, err
+		}
+
+		station := strconv.Itoa(activity.StationNumber)
+		visit, ok := index[[2]string{activity.ACNumber, station}]
+		if !ok {
+			visit = &StationVisit{ACNumber: activity.ACNumber, Station: station, FirstStart: activity.StartTime, LastEnd: activity.EndTime}
+			index[[2]string{activity.ACNumber, station}] = visit
+			visits = append(visits, visit)
+		}
+		if earlier, err := isBefore(activity.StartTime, visit.FirstStart); err != nil {
+			return nil, err
+		} else if earlier {
+			visit.FirstStart = activity.StartTime
+		}
+		if later, err := isBefore(visit.LastEnd, activity.EndTime); err != nil {
+			return nil, err
+		} else if later {
+			visit.LastEnd = activity.EndTime
+		}
+		visit.WorkMinutes += work
+		visit.ActivityCount++
+	}
+
+	for _, visit := range visits {
+		cycle, err := minutesBetween(visit.FirstStart, visit.LastEnd)
+		if err != nil {
+			return nil, err
+		}
+		visit.CycleMinutes = cycle
+	}
+
+	return visits, nil
+}
+
+// utilization adds up the time within [from, to) covered by at least one of the activities
+func utilization(id string, from string, to string, activities []*Activity) (*Utilization, error) {
+	fromTime, toTime, err := parseTimeRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Utilization{ID: id, From: from, To: to, PeriodMinutes: toTime.Sub(fromTime).Minutes()}
+	busy := make([][2]time.Time, 0, len(activities))
+	for _, activity := range activities {
+		start, err := time.Parse(time.RFC3339, activity.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.Parse(time.RFC3339, activity.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if start.Before(fromTime) {
+			start = fromTime
+		}
+		if end.After(toTime) {
+			end = toTime
+		}
+		if !end.After(start) {
+			continue
+		}
+		busy = append(busy, [2]time.Time{start, end})
+		result.ActivityCount++
+	}
+
+	sort.Slice(busy, func(i, j int) bool { return busy[i][0].Before(busy[j][0]) })
+	var covered time.Time
+	for _, interval := range busy {
+		if interval[0].Before(covered) {
+			interval[0] = covered
+		}
+		if interval[1].After(interval[0]) {
+			result.BusyMinutes += interval[1].Sub(interval[0]).Minutes()
+			covered = interval[1]
+		}
+	}
+	result.Utilization = result.BusyMinutes / result.PeriodMinutes
+
+	return result, nil
+}
+
+// queryActivitiesPage runs a rich query for activities and returns one page of the results
+func queryActivitiesPage(ctx contractapi.TransactionContextInterface, query map[string]interface{}, pageSize int, bookmark string) (*PaginatedActivityResult, error) {
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build activity query: %v", err)
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryJSON), int32(pageSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	activities, err := constructActivitiesFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedActivityResult{
+		Records:             activities,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// validateDateRange checks that from and to are RFC3339 timestamps and that to is after from, and returns them in UTC
+func validateDateRange(from string, to string) (string, string, error) {
+	if from == "" || to == "" {
+		return "", "", newContractError(ErrInvalidArgument, "from and to must both be given")
+	}
+	fromTime, toTime, err := parseTimeRange(from, to)
+	if err != nil {
+		return "", "", err
+	}
+	if !toTime.After(fromTime) {
+		return "", "", newContractError(ErrInvalidTimestamp, "to %s must be after from %s", to, from)
+	}
+	return fromTime.UTC().Format(time.RFC3339), toTime.UTC().Format(time.RFC3339), nil
+}
+
+// minutesBetween returns the minutes from one RFC3339 timestamp to another
+func minutesBetween(from string, to string) (float64, error) {
+	fromTime, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return 0, err
+	}
+	toTime, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		return 0, err
+	}
+	return toTime.Sub(fromTime).Minutes(), nil
+}
+
+// isBefore reports whether one RFC3339 timestamp is before another
+func isBefore(a string, b string) (bool, error) {
+	minutes, err := minutesBetween(a, b)
+	if err != nil {
+		return false, err
+	}
+	return minutes > 0, nil
+}
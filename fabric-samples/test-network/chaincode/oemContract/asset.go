@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CreateAsset registers a new aircraft at the first station of the routing. Only the OEM may create aircraft.
+func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, acNumber string, model string, variant string, customerAirline string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if acNumber == "" {
+		return newContractError(ErrInvalidArgument, "aircraft number must not be empty")
+	}
+
+	exists, err := s.AssetExists(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return newContractError(ErrAlreadyExists, "the asset %s already exists", acNumber)
+	}
+	if acNumber == routingKey || acNumber == unplannedRequirementKey {
+		return newContractError(ErrInvalidArgument, "%s is reserved and cannot be used as an aircraft number", acNumber)
+	}
+
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset := Asset{
+		DocType:         assetDocType,
+		ACNumber:        acNumber,
+		Model:           model,
+		Variant:         variant,
+		CustomerAirline: customerAirline,
+		OwnerMSP:        OEMMSP,
+		Status:          AssetStatusInAssembly,
+		CurrentStation:  routing.Stations[0],
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := putAsset(ctx, &asset); err != nil {
+		return err
+	}
+
+	if err := s.setAssetStateBasedEndorsement(ctx, acNumber, asset.CurrentStation); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventAssetCreated, AssetCreatedEvent{
+		ACNumber:        acNumber,
+		Model:           model,
+		Variant:         variant,
+		CustomerAirline: customerAirline,
+		Station:         asset.CurrentStation,
+		CreatedAt:       now,
+	})
+}
+
+// ReadAsset returns the aircraft stored under the given aircraft number
+func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, acNumber string) (*Asset, error) {
+	assetJSON, err := ctx.GetStub().GetState(acNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset %s: %v", acNumber, err)
+	}
+	if assetJSON == nil {
+		return nil, newContractError(ErrNotFound, "the asset %s does not exist", acNumber)
+	}
+
+	var asset Asset
+	if err := json.Unmarshal(assetJSON, &asset); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal asset %s: %v", acNumber, err)
+	}
+	if asset.DocType != assetDocType {
+		return nil, newContractError(ErrNotFound, "the asset %s does not exist", acNumber)
+	}
+
+	return &asset, nil
+}
+
+// AssetExists returns true when an aircraft with the given number exists in world state. Other records stored
+// under a simple key, such as the routing, are not aircraft.
+func (s *SmartContract) AssetExists(ctx contractapi.TransactionContextInterface, acNumber string) (bool, error) {
+	assetJSON, err := ctx.GetStub().GetState(acNumber)
+	if err != nil {
+		return false, fmt.Errorf("failed to read asset %s: %v", acNumber, err)
+	}
+	if assetJSON == nil {
+		return false, nil
+	}
+
+	var doc struct {
+		DocType string `json:"docType"`
+	}
+	if err := json.Unmarshal(assetJSON, &doc); err != nil {
+		return false, fmt.Errorf("failed to unmarshal asset %s: %v", acNumber, err)
+	}
+	return doc.DocType == assetDocType, nil
+}
+
+// GetAllAssets returns every aircraft found in world state, including retired ones
+func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface) ([]*Asset, error) {
+	// range query with empty string for startKey and endKey does an open-ended
+	// query of all simple keys in the chaincode namespace; composite keys are not
+	// returned, and the routing record is skipped by its docType.
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets := []*Asset{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset Asset
+		if err := json.Unmarshal(queryResponse.Value, &asset); err != nil {
+			return nil, err
+		}
+		if asset.DocType != assetDocType {
+			continue
+		}
+		assets = append(assets, &asset)
+	}
+
+	return assets, nil
+}
+
+// RetireAsset takes an aircraft off the assembly line. The record is kept so that its history stays queryable.
+// Only the OEM may retire aircraft, and only while they are in assembly: a delivered aircraft belongs to its airline.
+func (s *SmartContract) RetireAsset(ctx contractapi.TransactionContextInterface, acNumber string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	asset, err := s.ReadAsset(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if asset.Status == AssetStatusRetired {
+		return fmt.Errorf("the asset %s is already retired", acNumber)
+	}
+	if asset.Status != AssetStatusInAssembly {
+		return fmt.Errorf("cannot retire aircraft %s with status %s", acNumber, asset.Status)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset.Status = AssetStatusRetired
+	asset.UpdatedAt = now
+	if err := putAsset(ctx, asset); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventAssetRetired, AssetRetiredEvent{
+		ACNumber:  acNumber,
+		Station:   asset.CurrentStation,
+		RetiredAt: now,
+	})
+}
+
+// putAsset writes the aircraft to world state under its aircraft number
+func putAsset(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+	assetJSON, err := json.Marshal(asset)
+	if err != nil {
+		return fmt.Errorf("failed to marshal asset: %v", err)
+	}
+	if err := ctx.GetStub().PutState(asset.ACNumber, assetJSON); err != nil {
+		return fmt.Errorf("failed to put asset %s: %v", asset.ACNumber, err)
+	}
+	return nil
+}
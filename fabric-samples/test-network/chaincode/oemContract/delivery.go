@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Delivery hands a completed aircraft over to its airline, following the
+asset-transfer-secured-agreement sample:
+
+ 1. The OEM calls ProposeDelivery on an OEM peer, with the delivery terms in the
+    transient map under "delivery_terms". The terms bundle the hashes of the
+    delivery documents (certificate of airworthiness, weight and balance
+    report, ...) and are kept in the OEM's implicit private data collection.
+    The proposal itself is public, under delivery~acNumber.
+ 2. The airline calls AgreeToDelivery on one of its own peers with the same
+    terms, which are kept in the airline's implicit collection.
+ 3. The OEM calls CompleteDelivery with the terms. The aircraft changes owner
+    only if their hash matches the hashes of both private copies. The aircraft
+    key-level endorsement policy then requires the airline.
+
+Private data never leaves the organization that wrote it, so the terms are
+compared by hash and are stored as the bytes passed in, to avoid any marshaling
+differences. Proposing and completing a delivery are refused while the aircraft
+has an open NCR, or an inspection whose latest result is not PASS.
+*/
+
+const (
+	deliveryDocType             = "delivery"
+	deliveryTermsObjectType     = "deliveryTerms"
+	deliveryTermsTransientKey   = "delivery_terms"
+	implicitCollectionNamespace = "_implicit_org_"
+
+	DeliveryStatusProposed  = "PROPOSED"
+	DeliveryStatusDelivered = "DELIVERED"
+)
+
+// Delivery is the public record of the handover of an aircraft to an airline
+type Delivery struct {
+	DocType     string `json:"docType"`
+	ACNumber    string `json:"acNumber"`
+	BuyerMSP    string `json:"buyerMSP"` // Organization the aircraft is delivered to
+	Status      string `json:"status"`   // One of the DeliveryStatus* values
+	ProposedBy  string `json:"proposedBy"`
+	ProposedAt  string `json:"proposedAt"`
+	TermsHash   string `json:"termsHash"` // Hash of the agreed terms, set once delivered
+	DeliveredAt string `json:"deliveredAt"`
+}
+
+// DeliveryTerms is the document bundle both organizations agree on, passed in the transient map as
+// {"acNumber":"...","documents":{"airworthinessCertificate":"sha256:...",...}}
+type DeliveryTerms struct {
+	ACNumber  string            `json:"acNumber"`
+	Documents map[string]string `json:"documents"` // Hash of each delivery document, by document name
+}
+
+// ProposeDelivery proposes to hand a completed aircraft over to buyerMSP, which must be the airline organization the
+// customer airline belongs to, with the delivery terms passed in the transient map. The aircraft must be at the last station of the routing, with that station cleared.
+// Only OEM clients may propose deliveries, from an OEM peer.
+func (s *SmartContract) ProposeDelivery(ctx contractapi.TransactionContextInterface, acNumber string, buyerMSP string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return err
+	}
+	if buyerMSP != AirlineMSP {
+		return newContractError(ErrInvalidArgument, "aircraft can only be delivered to the airline organization %s, not %q", AirlineMSP, buyerMSP)
+	}
+
+	asset, err := s.ReadAsset(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if asset.Status != AssetStatusInAssembly {
+		return fmt.Errorf("cannot deliver aircraft %s with status %s", acNumber, asset.Status)
+	}
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return err
+	}
+	if last := routing.Stations[len(routing.Stations)-1]; asset.CurrentStation != last {
+		return newContractError(ErrNotCleared, "aircraft %s is at station %s, not at the last station %s", acNumber, asset.CurrentStation, last)
+	}
+	if err := s.assertStationCleared(ctx, acNumber, asset.CurrentStation); err != nil {
+		return err
+	}
+	if err := s.assertNoOpenFindings(ctx, acNumber); err != nil {
+		return err
+	}
+
+	key, err := deliveryKey(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read delivery of aircraft %s: %v", acNumber, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "delivery of aircraft %s is already proposed", acNumber)
+	}
+
+	if err := putDeliveryTerms(ctx, acNumber, OEMMSP); err != nil {
+		return err
+	}
+
+	proposedBy, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+	proposedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	return putDelivery(ctx, key, &Delivery{
+		DocType:    deliveryDocType,
+		ACNumber:   acNumber,
+		BuyerMSP:   buyerMSP,
+		Status:     DeliveryStatusProposed,
+		ProposedBy: proposedBy,
+		ProposedAt: proposedAt,
+	})
+}
+
+// AgreeToDelivery records the buyer's agreement to the delivery terms passed in the transient map, in the buyer's
+// implicit private data collection. Only clients of the buyer organization may agree, from one of its peers.
+func (s *SmartContract) AgreeToDelivery(ctx contractapi.TransactionContextInterface, acNumber string) error {
+	delivery, err := s.ReadDelivery(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != DeliveryStatusProposed {
+		return newContractError(ErrInvalidArgument, "delivery of aircraft %s is %s", acNumber, delivery.Status)
+	}
+	if err := assertMSP(ctx, delivery.BuyerMSP); err != nil {
+		return err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return err
+	}
+
+	return putDeliveryTerms(ctx, acNumber, delivery.BuyerMSP)
+}
+
+// CompleteDelivery transfers ownership of the aircraft to the buyer if the delivery terms passed in the transient
+// map are those both the OEM and the buyer agreed to. Only the OEM may complete deliveries.
+func (s *SmartContract) CompleteDelivery(ctx contractapi.TransactionContextInterface, acNumber string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	delivery, err := s.ReadDelivery(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != DeliveryStatusProposed {
+		return newContractError(ErrInvalidArgument, "delivery of aircraft %s is %s", acNumber, delivery.Status)
+	}
+	asset, err := s.ReadAsset(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if asset.Status != AssetStatusInAssembly {
+		return fmt.Errorf("cannot deliver aircraft %s with status %s", acNumber, asset.Status)
+	}
+	if err := s.assertNoOpenFindings(ctx, acNumber); err != nil {
+		return err
+	}
+
+	termsJSON, _, err := readDeliveryTermsTransient(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	termsHash := sha256.Sum256(termsJSON)
+	for _, mspID := range []string{OEMMSP, delivery.BuyerMSP} {
+		if err := verifyDeliveryTermsHash(ctx, acNumber, mspID, termsHash[:]); err != nil {
+			return err
+		}
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	asset.OwnerMSP = delivery.BuyerMSP
+	asset.Status = AssetStatusDelivered
+	asset.UpdatedAt = now
+	if err := putAsset(ctx, asset); err != nil {
+		return err
+	}
+	if err := setStateBasedEndorsement(ctx, acNumber, delivery.BuyerMSP); err != nil {
+		return err
+	}
+
+	delivery.Status = DeliveryStatusDelivered
+	delivery.TermsHash = hex.EncodeToString(termsHash[:])
+	delivery.DeliveredAt = now
+	key, err := deliveryKey(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if err := putDelivery(ctx, key, delivery); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventAircraftDelivered, AircraftDeliveredEvent{
+		ACNumber:    acNumber,
+		FromMSP:     OEMMSP,
+		ToMSP:       delivery.BuyerMSP,
+		TermsHash:   delivery.TermsHash,
+		DeliveredAt: now,
+	})
+}
+
+// ReadDelivery returns the delivery record of an aircraft
+func (s *SmartContract) ReadDelivery(ctx contractapi.TransactionContextInterface, acNumber string) (*Delivery, error) {
+	key, err := deliveryKey(ctx, acNumber)
+	if err != nil {
+		return nil, err
+	}
+	deliveryJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delivery of aircraft %s: %v", acNumber, err)
+	}
+	if deliveryJSON == nil {
+		return nil, newContractError(ErrNotFound, "no delivery is proposed for aircraft %s", acNumber)
+	}
+
+	var delivery Delivery
+	if err := json.Unmarshal(deliveryJSON, &delivery); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal delivery: %v", err)
+	}
+	return &delivery, nil
+}
+
+// ReadDeliveryTerms returns the delivery terms the client's organization agreed to, from its implicit collection.
+// It must be called on a peer of the client's organization.
+func (s *SmartContract) ReadDeliveryTerms(ctx contractapi.TransactionContextInterface, acNumber string) (string, error) {
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return "", err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(deliveryTermsObjectType, []string{acNumber})
+	if err != nil {
+		return "", fmt.Errorf("failed to create delivery terms key: %v", err)
+	}
+	termsJSON, err := ctx.GetStub().GetPrivateData(implicitCollection(mspID), key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read delivery terms: %v", err)
+	}
+	if termsJSON == nil {
+		return "", newContractError(ErrNotFound, "%s has not agreed to delivery terms for aircraft %s", mspID, acNumber)
+	}
+	return string(termsJSON), nil
+}
+
+// assertNoOpenFindings checks that the aircraft has no open NCR, whatever its severity, and that the latest
+// inspection of every activity and station exit passed
+func (s *SmartContract) assertNoOpenFindings(ctx contractapi.TransactionContextInterface, acNumber string) error {
+	ncrs, err := s.getNonConformancesForAsset(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	for _, ncr := range ncrs {
+		if ncr.Status == NCRStatusOpen {
+			return newContractError(ErrNotCleared, "NCR %s of aircraft %s is open", ncr.NCRID, acNumber)
+		}
+	}
+
+	inspections, err := getInspections(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	latest := make(map[string]*Inspection)
+	for _, inspection := range inspections {
+		key := inspection.Station + "/" + inspection.ActivityID
+		if previous, ok := latest[key]; !ok || supersedes(inspection, previous) {
+			latest[key] = inspection
+		}
+	}
+	for _, inspection := range latest {
+		if inspection.Result != InspectionResultPass {
+			return newContractError(ErrNotCleared, "inspection %s of aircraft %s at station %s has result %s", inspection.InspectionID, acNumber, inspection.Station, inspection.Result)
+		}
+	}
+	return nil
+}
+
+// putDeliveryTerms stores the delivery terms passed in the transient map in the implicit collection of mspID
+func putDeliveryTerms(ctx contractapi.TransactionContextInterface, acNumber string, mspID string) error {
+	termsJSON, key, err := readDeliveryTermsTransient(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	// the terms hash is verified later, so the bytes are stored as passed in
+	if err := ctx.GetStub().PutPrivateData(implicitCollection(mspID), key, termsJSON); err != nil {
+		return fmt.Errorf("failed to put delivery terms: %v", err)
+	}
+	return nil
+}
+
+// readDeliveryTermsTransient reads and validates the delivery terms passed in the transient map, and returns them
+// with the key they are stored under
+func readDeliveryTermsTransient(ctx contractapi.TransactionContextInterface, acNumber string) ([]byte, string, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting transient: %v", err)
+	}
+	termsJSON, ok := transientMap[deliveryTermsTransientKey]
+	if !ok {
+		return nil, "", newContractError(ErrInvalidArgument, "%s not found in the transient map input", deliveryTermsTransientKey)
+	}
+
+	var terms DeliveryTerms
+	if err := json.Unmarshal(termsJSON, &terms); err != nil {
+		return nil, "", newContractError(ErrInvalidArgument, "failed to unmarshal delivery terms: %v", err)
+	}
+	if terms.ACNumber != acNumber {
+		return nil, "", newContractError(ErrInvalidArgument, "delivery terms are for aircraft %q, not %s", terms.ACNumber, acNumber)
+	}
+	if len(terms.Documents) == 0 {
+		return nil, "", newContractError(ErrInvalidArgument, "delivery terms must list at least one document")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(deliveryTermsObjectType, []string{acNumber})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create delivery terms key: %v", err)
+	}
+	return termsJSON, key, nil
+}
+
+// verifyDeliveryTermsHash checks that the terms an organization agreed to have the given hash
+func verifyDeliveryTermsHash(ctx contractapi.TransactionContextInterface, acNumber string, mspID string, termsHash []byte) error {
+	key, err := ctx.GetStub().CreateCompositeKey(deliveryTermsObjectType, []string{acNumber})
+	if err != nil {
+		return fmt.Errorf("failed to create delivery terms key: %v", err)
+	}
+	agreedHash, err := ctx.GetStub().GetPrivateDataHash(implicitCollection(mspID), key)
+	if err != nil {
+		return fmt.Errorf("failed to read delivery terms hash of %s: %v", mspID, err)
+	}
+	if agreedHash == nil {
+		return newContractError(ErrNotCleared, "%s has not agreed to the delivery of aircraft %s", mspID, acNumber)
+	}
+	if !bytes.Equal(agreedHash, termsHash) {
+		return newContractError(ErrInvalidArgument, "delivery terms hash %x does not match the terms %s agreed to", termsHash, mspID)
+	}
+	return nil
+}
+
+// implicitCollection returns the name of the implicit private data collection of an organization
+func implicitCollection(mspID string) string {
+	return implicitCollectionNamespace + mspID
+}
+
+// deliveryKey builds the composite key the delivery of an aircraft is stored under
+func deliveryKey(ctx contractapi.TransactionContextInterface, acNumber string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(deliveryDocType, []string{acNumber})
+	if err != nil {
+		return "", fmt.Errorf("failed to create delivery key: %v", err)
+	}
+	return key, nil
+}
+
+// putDelivery writes a delivery record to world state
+func putDelivery(ctx contractapi.TransactionContextInterface, key string, delivery *Delivery) error {
+	deliveryJSON, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery: %v", err)
+	}
+	return ctx.GetStub().PutState(key, deliveryJSON)
+}
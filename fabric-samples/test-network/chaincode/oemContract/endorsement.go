@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Each aircraft carries a key-level endorsement policy, following the
+asset-transfer-sbe sample, so that the chaincode endorsement policy of
+oemchannel no longer lets any majority of organizations rewrite it. The policy
+is set whenever the aircraft enters a station and requires a peer of the
+organization responsible for that station, and at a quality gate also a peer of
+the QA organization guarding the gate. Moving the aircraft out of the station,
+or retiring it, therefore needs those endorsements.
+
+Stations without a StationEndorsement are the responsibility of the OEM.
+*/
+
+const stationEndorsementType = "stationEndorsement"
+
+// StationEndorsement names the organizations that must endorse changes to an aircraft while it is in a station
+type StationEndorsement struct {
+	Station        string `json:"station"`
+	ResponsibleMSP string `json:"responsibleMSP"`
+	QualityGateMSP string `json:"qualityGateMSP"` // QA organization guarding the station, empty if the station is not a quality gate
+}
+
+// SetStationEndorsement configures which organization is responsible for a station and, if qualityGateMSP is not
+// empty, makes the station a quality gate guarded by that QA organization. It applies to aircraft entering the
+// station from then on. Only the OEM may configure stations.
+func (s *SmartContract) SetStationEndorsement(ctx contractapi.TransactionContextInterface, station string, responsibleMSP string, qualityGateMSP string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if station == "" {
+		return newContractError(ErrInvalidArgument, "station must not be empty")
+	}
+	if !containsString([]string{OEMMSP, SupplierMSP, AirlineMSP}, responsibleMSP) {
+		return newContractError(ErrInvalidArgument, "unknown organization %s", responsibleMSP)
+	}
+	if qualityGateMSP != "" && !containsString(qaMSPs, qualityGateMSP) {
+		return newContractError(ErrInvalidArgument, "%s is not a QA organization", qualityGateMSP)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(stationEndorsementType, []string{station})
+	if err != nil {
+		return fmt.Errorf("failed to create station endorsement key: %v", err)
+	}
+	endorsementJSON, err := json.Marshal(StationEndorsement{
+		Station:        station,
+		ResponsibleMSP: responsibleMSP,
+		QualityGateMSP: qualityGateMSP,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal station endorsement: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, endorsementJSON)
+}
+
+// GetStationEndorsement returns the organizations that must endorse changes to an aircraft in a station
+func (s *SmartContract) GetStationEndorsement(ctx contractapi.TransactionContextInterface, station string) (*StationEndorsement, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(stationEndorsementType, []string{station})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create station endorsement key: %v", err)
+	}
+	endorsementJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read station endorsement: %v", err)
+	}
+	if endorsementJSON == nil {
+		return &StationEndorsement{Station: station, ResponsibleMSP: OEMMSP}, nil
+	}
+
+	var endorsement StationEndorsement
+	if err := json.Unmarshal(endorsementJSON, &endorsement); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal station endorsement: %v", err)
+	}
+
+	return &endorsement, nil
+}
+
+// setAssetStateBasedEndorsement sets the endorsement policy of an aircraft entering a station
+func (s *SmartContract) setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, acNumber string, station string) error {
+	stationEndorsement, err := s.GetStationEndorsement(ctx, station)
+	if err != nil {
+		return err
+	}
+	orgs := []string{stationEndorsement.ResponsibleMSP}
+	if stationEndorsement.QualityGateMSP != "" && stationEndorsement.QualityGateMSP != stationEndorsement.ResponsibleMSP {
+		orgs = append(orgs, stationEndorsement.QualityGateMSP)
+	}
+
+	return setStateBasedEndorsement(ctx, acNumber, orgs...)
+}
+
+// setStateBasedEndorsement sets a key-level endorsement policy requiring a peer of each of the given organizations
+func setStateBasedEndorsement(ctx contractapi.TransactionContextInterface, key string, orgs ...string) error {
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = endorsementPolicy.AddOrgs(statebased.RoleTypePeer, orgs...)
+	if err != nil {
+		return fmt.Errorf("failed to add org to endorsement policy: %v", err)
+	}
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return fmt.Errorf("failed to create endorsement policy bytes from org: %v", err)
+	}
+	err = ctx.GetStub().SetStateValidationParameter(key, policy)
+	if err != nil {
+		return fmt.Errorf("failed to set validation parameter on %s: %v", key, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Machines and tools are registered as equipment, stored under the composite key
+equipment~kind~equipmentID, with the date their calibration falls due. Every
+calibration is kept as its own record under calibration~kind~equipmentID~calibratedAt.
+
+CreateActivity only accepts a machine or tool that is in service and whose
+calibration is still valid at the end of the activity. An activity recorded after
+the fact, starting before the last calibration, must instead end before the due
+date of the calibration in force when it started, or of the registration when it
+started before the first calibration. It also writes the index
+entry equipmentUse~kind~equipmentID~startTime~acNumber~station~activityID, so an
+auditor can list every activity an item was used for between two calibrations.
+*/
+
+const (
+	equipmentDocType   = "equipment"
+	calibrationDocType = "calibration"
+	equipmentUseIndex  = "equipmentUse"
+
+	EquipmentKindMachine = "MACHINE"
+	EquipmentKindTool    = "TOOL"
+
+	EquipmentStatusInService = "IN_SERVICE"
+	EquipmentStatusGrounded  = "GROUNDED"
+)
+
+// Equipment is a machine or tool used by activities
+type Equipment struct {
+	DocType          string           `json:"docType"`
+	Kind             string           `json:"kind"` // One of the EquipmentKind* values
+	EquipmentID      string           `json:"equipmentID"`
+	Description      string           `json:"description"`
+	Status           string           `json:"status"` // One of the EquipmentStatus* values
+	StatusReason     string           `json:"statusReason"`
+	LastCalibratedAt string           `json:"lastCalibratedAt"`
+	CalibrationDue   string           `json:"calibrationDue"`        // RFC3339 time after which the item must not be used
+	RegisteredDue    string           `json:"registeredDue"`         // Calibration due date given at registration, before any calibration
+	UsageLimits      map[string]int64 `json:"usageLimits,omitempty"` // Maintenance limit per usage counter, see usage.go
+	UpdatedAt        string           `json:"updatedAt"`
+}
+
+// Calibration records one calibration of a machine or tool
+type Calibration struct {
+	DocType         string `json:"docType"`
+	Kind            string `json:"kind"`
+	EquipmentID     string `json:"equipmentID"`
+	CalibratedAt    string `json:"calibratedAt"`
+	CalibrationDue  string `json:"calibrationDue"`
+	CertificateHash string `json:"certificateHash"`
+	CalibratedBy    string `json:"calibratedBy"` // Hash of the identity that recorded the calibration
+}
+
+// RegisterEquipment registers a machine or tool with the date its calibration falls due. Only the OEM may register equipment.
+func (s *SmartContract) RegisterEquipment(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, description string, calibrationDue string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if err := validateEquipmentKind(kind); err != nil {
+		return err
+	}
+	if equipmentID == "" {
+		return newContractError(ErrInvalidArgument, "equipment ID must not be empty")
+	}
+	if _, err := time.Parse(time.RFC3339, calibrationDue); err != nil {
+		return newContractError(ErrInvalidTimestamp, "calibration due date %q is not an RFC3339 timestamp", calibrationDue)
+	}
+
+	key, err := equipmentKey(ctx, kind, equipmentID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s %s: %v", kind, equipmentID, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "%s %s already exists", kind, equipmentID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	equipment := Equipment{
+		DocType:        equipmentDocType,
+		Kind:           kind,
+		EquipmentID:    equipmentID,
+		Description:    description,
+		Status:         EquipmentStatusInService,
+		CalibrationDue: calibrationDue,
+		RegisteredDue:  calibrationDue,
+		UpdatedAt:      now,
+	}
+
+	return putEquipment(ctx, &equipment)
+}
+
+// CalibrateEquipment records a calibration of a machine or tool and its next due date. Only the OEM may record calibrations.
+func (s *SmartContract) CalibrateEquipment(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, calibrationDue string, certificateHash string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	equipment, err := s.ReadEquipment(ctx, kind, equipmentID)
+	if err != nil {
+		return err
+	}
+
+	nowTime, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	now := nowTime.Format(time.RFC3339)
+	due, err := time.Parse(time.RFC3339, calibrationDue)
+	if err != nil {
+		return newContractError(ErrInvalidTimestamp, "calibration due date %q is not an RFC3339 timestamp", calibrationDue)
+	}
+	if !due.After(nowTime) {
+		return newContractError(ErrInvalidTimestamp, "calibration due date %s must be in the future", calibrationDue)
+	}
+	if certificateHash == "" {
+		return newContractError(ErrInvalidArgument, "calibration certificate hash must not be empty")
+	}
+
+	calibratedBy, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+
+	calibrationJSON, err := json.Marshal(Calibration{
+		DocType:         calibrationDocType,
+		Kind:            kind,
+		EquipmentID:     equipmentID,
+		CalibratedAt:    now,
+		CalibrationDue:  calibrationDue,
+		CertificateHash: certificateHash,
+		CalibratedBy:    calibratedBy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal calibration: %v", err)
+	}
+	calibrationKey, err := ctx.GetStub().CreateCompositeKey(calibrationDocType, []string{kind, equipmentID, now})
+	if err != nil {
+		return fmt.Errorf("failed to create calibration key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(calibrationKey, calibrationJSON); err != nil {
+		return fmt.Errorf("failed to put calibration: %v", err)
+	}
+
+	equipment.LastCalibratedAt = now
+	equipment.CalibrationDue = calibrationDue
+	equipment.UpdatedAt = now
+
+	return putEquipment(ctx, equipment)
+}
+
+// GroundEquipment takes a machine or tool out of service. Only the OEM may ground equipment.
+func (s *SmartContract) GroundEquipment(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, reason string) error {
+	return s.setEquipmentStatus(ctx, kind, equipmentID, EquipmentStatusGrounded, reason)
+}
+
+// ReturnEquipmentToService puts a grounded machine or tool back into service. Only the OEM may do so.
+func (s *SmartContract) ReturnEquipmentToService(ctx contractapi.TransactionContextInterface, kind string, equipmentID string) error {
+	return s.setEquipmentStatus(ctx, kind, equipmentID, EquipmentStatusInService, "")
+}
+
+// ReadEquipment returns a single machine or tool
+func (s *SmartContract) ReadEquipment(ctx contractapi.TransactionContextInterface, kind string, equipmentID string) (*Equipment, error) {
+	key, err := equipmentKey(ctx, kind, equipmentID)
+	if err != nil {
+		return nil, err
+	}
+	equipmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s: %v", kind, equipmentID, err)
+	}
+	if equipmentJSON == nil {
+		return nil, newContractError(ErrNotFound, "%s %s does not exist", kind, equipmentID)
+	}
+
+	var equipment Equipment
+	if err := json.Unmarshal(equipmentJSON, &equipment); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s %s: %v", kind, equipmentID, err)
+	}
+
+	return &equipment, nil
+}
+
+// GetCalibrations returns every calibration of a machine or tool, oldest first
+func (s *SmartContract) GetCalibrations(ctx contractapi.TransactionContextInterface, kind string, equipmentID string) ([]*Calibration, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(calibrationDocType, []string{kind, equipmentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	calibrations := []*Calibration{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var calibration Calibration
+		if err := json.Unmarshal(queryResult.Value, &calibration); err != nil {
+			return nil, err
+		}
+		calibrations = append(calibrations, &calibration)
+	}
+
+	return calibrations, nil
+}
+
+// GetEquipmentActivities returns the activities a machine or tool was used for that started in [from, to),
+// e.g. between two calibrations. An empty bound is open.
+func (s *SmartContract) GetEquipmentActivities(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, from string, to string) ([]*Activity, error) {
+	fromTime, toTime, err := parseTimeRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(equipmentUseIndex, []string{kind, equipmentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	activities := []*Activity{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(compositeKeyParts) < 6 {
+			continue
+		}
+
+		startTime, err := time.Parse(time.RFC3339, compositeKeyParts[2])
+		if err != nil {
+			return nil, err
+		}
+		if (!fromTime.IsZero() && startTime.Before(fromTime)) || (!toTime.IsZero() && !startTime.Before(toTime)) {
+			continue
+		}
+
+		key, err := activityKey(ctx, compositeKeyParts[3], compositeKeyParts[4], compositeKeyParts[5])
+		if err != nil {
+			return nil, err
+		}
+		activityJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read activity: %v", err)
+		}
+		if activityJSON == nil {
+			continue
+		}
+		var activity Activity
+		if err := json.Unmarshal(activityJSON, &activity); err != nil {
+			return nil, err
+		}
+		activities = append(activities, &activity)
+	}
+
+	return activities, nil
+}
+
+// useEquipment checks that a machine or tool may be used for an activity, and records the use
+func (s *SmartContract) useEquipment(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, startTime string, endTime string, acNumber string, station string, activityID string) error {
+	if equipmentID == "" {
+		return nil
+	}
+
+	equipment, err := s.ReadEquipment(ctx, kind, equipmentID)
+	if err != nil {
+		return err
+	}
+	if equipment.Status != EquipmentStatusInService {
+		return newContractError(ErrEquipmentUnusable, "%s %s is %s: %s", kind, equipmentID, equipment.Status, equipment.StatusReason)
+	}
+	due, err := time.Parse(time.RFC3339, equipment.CalibrationDue)
+	if err != nil {
+		return fmt.Errorf("invalid calibration due date on %s %s: %v", kind, equipmentID, err)
+	}
+	end, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return newContractError(ErrInvalidTimestamp, "end time %q is not an RFC3339 timestamp", endTime)
+	}
+	if !end.Before(due) {
+		return newContractError(ErrEquipmentUnusable, "%s %s is out of calibration since %s", kind, equipmentID, equipment.CalibrationDue)
+	}
+
+	start, err := time.Parse(time.RFC3339, startTime)
+	if err != nil {
+		return newContractError(ErrInvalidTimestamp, "start time %q is not an RFC3339 timestamp", startTime)
+	}
+	if err := s.assertCalibratedAt(ctx, equipment, start, end); err != nil {
+		return err
+	}
+	// normalize to UTC so that index keys sort chronologically
+	useKey, err := ctx.GetStub().CreateCompositeKey(equipmentUseIndex, []string{kind, equipmentID, start.UTC().Format(time.RFC3339), acNumber, station, activityID})
+	if err != nil {
+		return fmt.Errorf("failed to create equipment use key: %v", err)
+	}
+	return ctx.GetStub().PutState(useKey, []byte{0x00})
+}
+
+// assertCalibratedAt checks an activity that started before the last calibration of a machine or tool against
+// the calibration in force when it started, so that recalibrating an item does not cover earlier lapses
+func (s *SmartContract) assertCalibratedAt(ctx contractapi.TransactionContextInterface, equipment *Equipment, start time.Time, end time.Time) error {
+	if equipment.LastCalibratedAt == "" {
+		return nil
+	}
+	lastCalibrated, err := time.Parse(time.RFC3339, equipment.LastCalibratedAt)
+	if err != nil {
+		return fmt.Errorf("invalid calibration date on %s %s: %v", equipment.Kind, equipment.EquipmentID, err)
+	}
+	if !start.Before(lastCalibrated) {
+		return nil
+	}
+
+	calibrations, err := s.GetCalibrations(ctx, equipment.Kind, equipment.EquipmentID)
+	if err != nil {
+		return err
+	}
+	due := equipment.RegisteredDue
+	for _, calibration := range calibrations {
+		calibratedAt, err := time.Parse(time.RFC3339, calibration.CalibratedAt)
+		if err != nil {
+			return fmt.Errorf("invalid calibration date on %s %s: %v", equipment.Kind, equipment.EquipmentID, err)
+		}
+		if calibratedAt.After(start) {
+			break
+		}
+		due = calibration.CalibrationDue
+	}
+	if due == "" {
+		return newContractError(ErrEquipmentUnusable, "%s %s has no calibration covering %s", equipment.Kind, equipment.EquipmentID, start.UTC().Format(time.RFC3339))
+	}
+	dueTime, err := time.Parse(time.RFC3339, due)
+	if err != nil {
+		return fmt.Errorf("invalid calibration due date on %s %s: %v", equipment.Kind, equipment.EquipmentID, err)
+	}
+	if !end.Before(dueTime) {
+		return newContractError(ErrEquipmentUnusable, "%s %s was out of calibration before the end of the activity, its calibration fell due at %s", equipment.Kind, equipment.EquipmentID, due)
+	}
+	return nil
+}
+
+// setEquipmentStatus changes whether a machine or tool is in service
+func (s *SmartContract) setEquipmentStatus(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, status string, reason string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	equipment, err := s.ReadEquipment(ctx, kind, equipmentID)
+	if err != nil {
+		return err
+	}
+	if equipment.Status == status {
+		return newContractError(ErrInvalidArgument, "%s %s is already %s", kind, equipmentID, status)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	equipment.Status = status
+	equipment.StatusReason = reason
+	equipment.UpdatedAt = now
+
+	return putEquipment(ctx, equipment)
+}
+
+func validateEquipmentKind(kind string) error {
+	if kind != EquipmentKindMachine && kind != EquipmentKindTool {
+		return newContractError(ErrInvalidArgument, "equipment kind %q must be %s or %s", kind, EquipmentKindMachine, EquipmentKindTool)
+	}
+	return nil
+}
+
+// parseTimeRange parses optional RFC3339 bounds, returning the zero time for an empty bound
+func parseTimeRange(from string, to string) (time.Time, time.Time, error) {
+	var fromTime, toTime time.Time
+	var err error
+	if from != "" {
+		if fromTime, err = time.Parse(time.RFC3339, from); err != nil {
+			return fromTime, toTime, newContractError(ErrInvalidTimestamp, "from %q is not an RFC3339 timestamp", from)
+		}
+	}
+	if to != "" {
+		if toTime, err = time.Parse(time.RFC3339, to); err != nil {
+			return fromTime, toTime, newContractError(ErrInvalidTimestamp, "to %q is not an RFC3339 timestamp", to)
+		}
+	}
+	return fromTime, toTime, nil
+}
+
+// equipmentKey builds the composite key a machine or tool is stored under
+func equipmentKey(ctx contractapi.TransactionContextInterface, kind string, equipmentID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(equipmentDocType, []string{kind, equipmentID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create equipment key: %v", err)
+	}
+	return key, nil
+}
+
+// putEquipment writes a machine or tool to world state
+func putEquipment(ctx contractapi.TransactionContextInterface, equipment *Equipment) error {
+	key, err := equipmentKey(ctx, equipment.Kind, equipment.EquipmentID)
+	if err != nil {
+		return err
+	}
+	equipmentJSON, err := json.Marshal(equipment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal equipment: %v", err)
+	}
+	return ctx.GetStub().PutState(key, equipmentJSON)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+// ErrorCode classifies a contract failure. The code is the first part of the error
+// message returned to clients, e.g. "ALREADY_EXISTS: activity ACT1 ...", so that
+// gateway applications can tell failures apart without matching on free text.
+type ErrorCode string
+
+const (
+	ErrInvalidArgument   ErrorCode = "INVALID_ARGUMENT"
+	ErrInvalidTimestamp  ErrorCode = "INVALID_TIMESTAMP"
+	ErrNotFound          ErrorCode = "NOT_FOUND"
+	ErrAlreadyExists     ErrorCode = "ALREADY_EXISTS"
+	ErrForbidden         ErrorCode = "FORBIDDEN"
+	ErrNotCleared        ErrorCode = "NOT_CLEARED"
+	ErrEquipmentUnusable ErrorCode = "EQUIPMENT_UNUSABLE"
+	ErrNotCertified      ErrorCode = "NOT_CERTIFIED"
+)
+
+// ContractError is an error carrying an ErrorCode
+type ContractError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *ContractError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// newContractError returns a ContractError with a formatted message
+func newContractError(code ErrorCode, format string, args ...interface{}) error {
+	return &ContractError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
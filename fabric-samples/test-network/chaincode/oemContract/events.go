@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Each state change of an aircraft emits a chaincode event named after it, with a
+JSON payload of the matching *Event struct. Gateway applications and FireFly
+contract listeners subscribe to these events instead of polling world state.
+
+Fabric delivers only the last event set by a transaction, so every transaction
+function emits at most one event, as its final step.
+*/
+
+const (
+	EventAssetCreated            = "AssetCreated"
+	EventAssetRetired            = "AssetRetired"
+	EventActivityCreated         = "ActivityCreated"
+	EventAssetTransferred        = "AssetTransferred"
+	EventInspectionRecorded      = "InspectionRecorded"
+	EventInspectionCountersigned = "InspectionCountersigned"
+	EventAircraftDelivered       = "AircraftDelivered"
+
+	EventEquipmentMaintenanceDue = "EquipmentMaintenanceDue"
+)
+
+// AssetCreatedEvent is the payload of the event emitted when an aircraft is registered on the assembly line
+type AssetCreatedEvent struct {
+	ACNumber        string `json:"acNumber"`
+	Model           string `json:"model"`
+	Variant         string `json:"variant"`
+	CustomerAirline string `json:"customerAirline"`
+	Station         string `json:"station"` // First station of the routing
+	CreatedAt       string `json:"createdAt"`
+}
+
+// AssetRetiredEvent is the payload of the event emitted when an aircraft is taken off the assembly line
+type AssetRetiredEvent struct {
+	ACNumber  string `json:"acNumber"`
+	Station   string `json:"station"` // Station the aircraft was at when it was retired
+	RetiredAt string `json:"retiredAt"`
+}
+
+// ActivityCreatedEvent is the payload of the event emitted when an activity is recorded
+type ActivityCreatedEvent struct {
+	ACNumber      string    `json:"acNumber"`
+	ActivityID    string    `json:"activityID"`
+	StationNumber int       `json:"stationNumber"`
+	StartTime     string    `json:"startTime"`
+	EndTime       string    `json:"endTime"`
+	MachineID     string    `json:"machineID"`
+	ToolsOrDrill  string    `json:"toolsOrDrill"`
+	Parts         []PartRef `json:"parts"`
+	ReworkOf      string    `json:"reworkOf,omitempty"`
+}
+
+// AssetTransferredEvent is the payload of the event emitted when an aircraft changes station
+type AssetTransferredEvent struct {
+	ACNumber    string `json:"acNumber"`
+	FromStation string `json:"fromStation"`
+	ToStation   string `json:"toStation"`
+	MovedBy     string `json:"movedBy"`
+	MovedAt     string `json:"movedAt"`
+}
+
+// InspectionRecordedEvent is the payload of the event emitted when a QA inspection is recorded
+type InspectionRecordedEvent struct {
+	ACNumber     string   `json:"acNumber"`
+	Station      string   `json:"station"`
+	InspectionID string   `json:"inspectionID"`
+	ActivityID   string   `json:"activityID"` // Empty for a station exit inspection
+	Result       string   `json:"result"`
+	DefectCodes  []string `json:"defectCodes"`
+	InspectorMSP string   `json:"inspectorMSP"`
+	InspectedAt  string   `json:"inspectedAt"`
+}
+
+// InspectionCountersignedEvent is the payload of the event emitted when a QA inspection is countersigned
+type InspectionCountersignedEvent struct {
+	ACNumber     string `json:"acNumber"`
+	Station      string `json:"station"`
+	InspectionID string `json:"inspectionID"`
+	MSPID        string `json:"mspID"` // Organization of the countersigning inspector
+	SignedAt     string `json:"signedAt"`
+}
+
+// AircraftDeliveredEvent is the payload of the event emitted when an aircraft is handed over to its airline
+type AircraftDeliveredEvent struct {
+	ACNumber    string `json:"acNumber"`
+	FromMSP     string `json:"fromMSP"`
+	ToMSP       string `json:"toMSP"`
+	TermsHash   string `json:"termsHash"` // Hash of the delivery terms both organizations agreed to
+	DeliveredAt string `json:"deliveredAt"`
+}
+
+// EquipmentMaintenanceDueEvent is the payload of the event emitted when pruning finds a usage counter at its limit
+type EquipmentMaintenanceDueEvent struct {
+	Kind        string          `json:"kind"`
+	EquipmentID string          `json:"equipmentID"`
+	Counters    []*UsageCounter `json:"counters"` // Counters that reached their limit
+	GroundedAt  string          `json:"groundedAt"`
+}
+
+// setEvent marshals an event payload and sets it as the chaincode event of the transaction
+func setEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	eventJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %v", name, err)
+	}
+	return ctx.GetStub().SetEvent(name, eventJSON)
+}
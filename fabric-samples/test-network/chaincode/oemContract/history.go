@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AssetHistoryRecord is one entry of the history of an aircraft
+type AssetHistoryRecord struct {
+	Record    *Asset    `json:"record"`
+	TxId      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// ActivityHistoryRecord is one entry of the history of an activity
+type ActivityHistoryRecord struct {
+	Record    *Activity `json:"record"`
+	TxId      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// GetAssetHistory returns every state an aircraft has been in, from its registration onwards
+func (s *SmartContract) GetAssetHistory(ctx contractapi.TransactionContextInterface, acNumber string) ([]AssetHistoryRecord, error) {
+	log.Printf("GetAssetHistory: AC %v", acNumber)
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(acNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []AssetHistoryRecord{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		asset := Asset{ACNumber: acNumber}
+		if len(response.Value) > 0 {
+			if err := json.Unmarshal(response.Value, &asset); err != nil {
+				return nil, err
+			}
+		}
+
+		records = append(records, AssetHistoryRecord{
+			Record:    &asset,
+			TxId:      response.TxId,
+			Timestamp: response.Timestamp.AsTime(),
+			IsDelete:  response.IsDelete,
+		})
+	}
+
+	return records, nil
+}
+
+// GetActivityHistory returns every version of an activity recorded on the ledger
+func (s *SmartContract) GetActivityHistory(ctx contractapi.TransactionContextInterface, acNumber string, station string, activityID string) ([]ActivityHistoryRecord, error) {
+	log.Printf("GetActivityHistory: AC %v station %v activity %v", acNumber, station, activityID)
+
+	key, err := activityKey(ctx, acNumber, station, activityID)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []ActivityHistoryRecord{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		activity := Activity{ACNumber: acNumber, ActivityID: activityID}
+		if len(response.Value) > 0 {
+			if err := json.Unmarshal(response.Value, &activity); err != nil {
+				return nil, err
+			}
+		}
+
+		records = append(records, ActivityHistoryRecord{
+			Record:    &activity,
+			TxId:      response.TxId,
+			Timestamp: response.Timestamp.AsTime(),
+			IsDelete:  response.IsDelete,
+		})
+	}
+
+	return records, nil
+}
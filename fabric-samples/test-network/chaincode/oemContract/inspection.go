@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Inspections are QA records attached either to an activity or, when no activity
+ID is given, to the exit of a station. They are stored under the composite key
+inspection~acNumber~station~inspectionID.
+
+An aircraft may only leave a station once every mandatory activity of that
+station has been performed and its latest inspection passed, and the latest
+station exit inspection, if any, passed as well. Rework is recorded as a new
+inspection of the same activity. Each inspection carries a sequence number per
+aircraft and station, so the latest one is known even when several share the
+same transaction timestamp.
+*/
+
+const (
+	inspectionDocType       = "inspection"
+	stationRequirementsType = "stationRequirements"
+
+	InspectionResultPass   = "PASS"
+	InspectionResultFail   = "FAIL"
+	InspectionResultRework = "REWORK"
+)
+
+// Inspection records the outcome of a QA check
+type Inspection struct {
+	DocType           string             `json:"docType"`
+	InspectionID      string             `json:"inspectionID"`
+	ACNumber          string             `json:"acNumber"`
+	Station           string             `json:"station"`
+	ActivityID        string             `json:"activityID"` // Empty for a station exit inspection
+	Inspector         string             `json:"inspector"`  // Hash of the inspector's identity
+	InspectorMSP      string             `json:"inspectorMSP"`
+	Result            string             `json:"result"` // One of the InspectionResult* values
+	DefectCodes       []string           `json:"defectCodes"`
+	EvidenceHash      string             `json:"evidenceHash"` // Hash of the off-chain evidence (photos, measurement reports)
+	InspectedAt       string             `json:"inspectedAt"`
+	Sequence          int                `json:"sequence"` // Position of the inspection among those of the aircraft at the station
+	Countersignatures []Countersignature `json:"countersignatures"`
+}
+
+// Countersignature records that a QA inspector of another organization agrees with an inspection
+type Countersignature struct {
+	MSPID    string `json:"mspID"`
+	SignedBy string `json:"signedBy"` // Hash of the countersigning inspector's identity
+	SignedAt string `json:"signedAt"`
+}
+
+// StationRequirements lists the activities that must pass inspection before an aircraft leaves a station
+type StationRequirements struct {
+	Station             string   `json:"station"`
+	MandatoryActivities []string `json:"mandatoryActivities"`
+}
+
+// SetMandatoryActivities configures the activities that must pass inspection at a station. Only the OEM may change them.
+func (s *SmartContract) SetMandatoryActivities(ctx contractapi.TransactionContextInterface, station string, activityIDs []string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return err
+	}
+	if !routing.contains(station) {
+		return newContractError(ErrNotFound, "station %s is not part of the routing", station)
+	}
+
+	requirementsJSON, err := json.Marshal(StationRequirements{Station: station, MandatoryActivities: activityIDs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal station requirements: %v", err)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(stationRequirementsType, []string{station})
+	if err != nil {
+		return fmt.Errorf("failed to create station requirements key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, requirementsJSON)
+}
+
+// GetMandatoryActivities returns the activities that must pass inspection at a station
+func (s *SmartContract) GetMandatoryActivities(ctx contractapi.TransactionContextInterface, station string) ([]string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(stationRequirementsType, []string{station})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create station requirements key: %v", err)
+	}
+	requirementsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read station requirements: %v", err)
+	}
+	if requirementsJSON == nil {
+		return []string{}, nil
+	}
+
+	var requirements StationRequirements
+	if err := json.Unmarshal(requirementsJSON, &requirements); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal station requirements: %v", err)
+	}
+
+	return requirements.MandatoryActivities, nil
+}
+
+// RecordInspection records a QA inspection of an activity, or of the station exit when activityID is empty.
+// Only QA inspectors may record inspections, and a failed or rework result needs at least one defect code.
+func (s *SmartContract) RecordInspection(ctx contractapi.TransactionContextInterface, acNumber string, station string, inspectionID string, activityID string, result string, defectCodes []string, evidenceHash string) error {
+	if err := assertQA(ctx); err != nil {
+		return err
+	}
+	if inspectionID == "" {
+		return newContractError(ErrInvalidArgument, "inspection ID must not be empty")
+	}
+	switch result {
+	case InspectionResultPass:
+	case InspectionResultFail, InspectionResultRework:
+		if len(defectCodes) == 0 {
+			return newContractError(ErrInvalidArgument, "an inspection with result %s needs at least one defect code", result)
+		}
+	default:
+		return newContractError(ErrInvalidArgument, "inspection result %q must be one of %s, %s or %s", result, InspectionResultPass, InspectionResultFail, InspectionResultRework)
+	}
+	if evidenceHash == "" {
+		return newContractError(ErrInvalidArgument, "evidence hash must not be empty")
+	}
+
+	exists, err := s.AssetExists(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return newContractError(ErrNotFound, "the asset %s does not exist", acNumber)
+	}
+
+	if activityID != "" {
+		key, err := activityKey(ctx, acNumber, station, activityID)
+		if err != nil {
+			return err
+		}
+		activityJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return fmt.Errorf("failed to read activity %s: %v", activityID, err)
+		}
+		if activityJSON == nil {
+			return newContractError(ErrNotFound, "activity %s does not exist for aircraft %s at station %s", activityID, acNumber, station)
+		}
+	}
+
+	key, err := inspectionKey(ctx, acNumber, station, inspectionID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read inspection %s: %v", inspectionID, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "inspection %s already exists for aircraft %s at station %s", inspectionID, acNumber, station)
+	}
+
+	previous, err := getInspections(ctx, acNumber, station)
+	if err != nil {
+		return err
+	}
+
+	inspector, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+	inspectorMSP, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	inspectedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	if defectCodes == nil {
+		defectCodes = []string{}
+	}
+	inspection := Inspection{
+		DocType:           inspectionDocType,
+		InspectionID:      inspectionID,
+		ACNumber:          acNumber,
+		Station:           station,
+		ActivityID:        activityID,
+		Inspector:         inspector,
+		InspectorMSP:      inspectorMSP,
+		Result:            result,
+		DefectCodes:       defectCodes,
+		EvidenceHash:      evidenceHash,
+		InspectedAt:       inspectedAt,
+		Sequence:          len(previous) + 1,
+		Countersignatures: []Countersignature{},
+	}
+	if err := putInspection(ctx, key, &inspection); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventInspectionRecorded, InspectionRecordedEvent{
+		ACNumber:     acNumber,
+		Station:      station,
+		InspectionID: inspectionID,
+		ActivityID:   activityID,
+		Result:       result,
+		DefectCodes:  defectCodes,
+		InspectorMSP: inspectorMSP,
+		InspectedAt:  inspectedAt,
+	})
+}
+
+// CountersignInspection lets a QA inspector of the supplier or airline organization countersign an inspection.
+// Each organization countersigns at most once, and never its own inspections.
+func (s *SmartContract) CountersignInspection(ctx contractapi.TransactionContextInterface, acNumber string, station string, inspectionID string) error {
+	if err := assertMSP(ctx, SupplierMSP, AirlineMSP); err != nil {
+		return err
+	}
+	if err := assertRole(ctx, RoleQA); err != nil {
+		return err
+	}
+
+	inspection, err := s.ReadInspection(ctx, acNumber, station, inspectionID)
+	if err != nil {
+		return err
+	}
+
+	mspID, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID == inspection.InspectorMSP {
+		return newContractError(ErrForbidden, "inspection %s was recorded by %s and cannot be countersigned by the same organization", inspectionID, mspID)
+	}
+	for _, countersignature := range inspection.Countersignatures {
+		if countersignature.MSPID == mspID {
+			return newContractError(ErrAlreadyExists, "inspection %s is already countersigned by %s", inspectionID, mspID)
+		}
+	}
+
+	signedBy, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+	signedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	inspection.Countersignatures = append(inspection.Countersignatures, Countersignature{
+		MSPID:    mspID,
+		SignedBy: signedBy,
+		SignedAt: signedAt,
+	})
+
+	key, err := inspectionKey(ctx, acNumber, station, inspectionID)
+	if err != nil {
+		return err
+	}
+	if err := putInspection(ctx, key, inspection); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventInspectionCountersigned, InspectionCountersignedEvent{
+		ACNumber:     acNumber,
+		Station:      station,
+		InspectionID: inspectionID,
+		MSPID:        mspID,
+		SignedAt:     signedAt,
+	})
+}
+
+// ReadInspection returns a single inspection
+func (s *SmartContract) ReadInspection(ctx contractapi.TransactionContextInterface, acNumber string, station string, inspectionID string) (*Inspection, error) {
+	key, err := inspectionKey(ctx, acNumber, station, inspectionID)
+	if err != nil {
+		return nil, err
+	}
+	inspectionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inspection %s: %v", inspectionID, err)
+	}
+	if inspectionJSON == nil {
+		return nil, newContractError(ErrNotFound, "inspection %s does not exist for aircraft %s at station %s", inspectionID, acNumber, station)
+	}
+
+	var inspection Inspection
+	if err := json.Unmarshal(inspectionJSON, &inspection); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal inspection %s: %v", inspectionID, err)
+	}
+
+	return &inspection, nil
+}
+
+// GetInspectionsForAsset returns every inspection recorded on an aircraft, ordered by station and inspection ID
+func (s *SmartContract) GetInspectionsForAsset(ctx contractapi.TransactionContextInterface, acNumber string) ([]*Inspection, error) {
+	return getInspections(ctx, acNumber)
+}
+
+// assertStationCleared checks that every mandatory activity of the station passed its latest inspection,
+// and that the latest station exit inspection, if any, passed
+func (s *SmartContract) assertStationCleared(ctx contractapi.TransactionContextInterface, acNumber string, station string) error {
+	mandatory, err := s.GetMandatoryActivities(ctx, station)
+	if err != nil {
+		return err
+	}
+
+	inspections, err := getInspections(ctx, acNumber, station)
+	if err != nil {
+		return err
+	}
+
+	// keep only the latest inspection of each activity, the station exit is keyed by the empty activity ID
+	latest := make(map[string]*Inspection)
+	for _, inspection := range inspections {
+		if previous, ok := latest[inspection.ActivityID]; !ok || supersedes(inspection, previous) {
+			latest[inspection.ActivityID] = inspection
+		}
+	}
+
+	for _, activityID := range mandatory {
+		inspection, ok := latest[activityID]
+		if !ok {
+			return newContractError(ErrNotCleared, "mandatory activity %s of aircraft %s at station %s has no inspection", activityID, acNumber, station)
+		}
+		if inspection.Result != InspectionResultPass {
+			return newContractError(ErrNotCleared, "mandatory activity %s of aircraft %s at station %s has inspection result %s", activityID, acNumber, station, inspection.Result)
+		}
+	}
+	if exit, ok := latest[""]; ok && exit.Result != InspectionResultPass {
+		return newContractError(ErrNotCleared, "station %s exit inspection of aircraft %s has result %s", station, acNumber, exit.Result)
+	}
+
+	return nil
+}
+
+// supersedes reports whether inspection a replaces inspection b as the latest one of an activity. Inspections
+// are ordered by sequence number. When that does not tell them apart the one that did not pass wins, so a
+// failure is never hidden.
+func supersedes(a *Inspection, b *Inspection) bool {
+	if a.Sequence != b.Sequence {
+		return a.Sequence > b.Sequence
+	}
+	return a.Result != InspectionResultPass
+}
+
+// inspectionKey builds the composite key an inspection is stored under
+func inspectionKey(ctx contractapi.TransactionContextInterface, acNumber string, station string, inspectionID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(inspectionDocType, []string{acNumber, station, inspectionID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create inspection key: %v", err)
+	}
+	return key, nil
+}
+
+// putInspection writes an inspection to world state
+func putInspection(ctx contractapi.TransactionContextInterface, key string, inspection *Inspection) error {
+	inspectionJSON, err := json.Marshal(inspection)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inspection: %v", err)
+	}
+	return ctx.GetStub().PutState(key, inspectionJSON)
+}
+
+// getInspections returns the inspections matching a partial inspection key, e.g. acNumber or acNumber and station
+func getInspections(ctx contractapi.TransactionContextInterface, attributes ...string) ([]*Inspection, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(inspectionDocType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructInspectionsFromIterator(resultsIterator)
+}
+
+// constructInspectionsFromIterator constructs a slice of inspections from the resultsIterator
+func constructInspectionsFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*Inspection, error) {
+	inspections := []*Inspection{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var inspection Inspection
+		if err := json.Unmarshal(queryResult.Value, &inspection); err != nil {
+			return nil, err
+		}
+		inspections = append(inspections, &inspection)
+	}
+
+	return inspections, nil
+}
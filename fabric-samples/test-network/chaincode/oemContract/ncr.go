@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Non-conformance reports (NCRs) are stored under the composite key ncr~ncrID and
+follow the material review loop:
+
+	OPEN --DispositionNonConformance--> OPEN (dispositioned) --CloseNonConformance--> CLOSED
+
+An NCR raised against an aircraft, one of its activities or an installed part is
+also indexed under ncrAircraft~acNumber~station~ncrID. TransferAsset uses that
+index to refuse moving an aircraft out of a station while a major NCR raised
+there, or at any earlier station of the routing, is open. A SCRAP or
+RETURN_TO_SUPPLIER disposition of an NCR against a part takes the part off the
+aircraft it is installed on. A REWORK disposition is worked off with RecordReworkActivity,
+which records activities linked to the NCR.
+
+The open NCR queries by station and by supplier are rich queries and need
+CouchDB, like the activity queries.
+*/
+
+const (
+	ncrDocType       = "ncr"
+	ncrAircraftIndex = "ncrAircraft"
+
+	NCRSeverityMinor = "MINOR"
+	NCRSeverityMajor = "MAJOR"
+
+	NCRDispositionUseAsIs          = "USE_AS_IS"
+	NCRDispositionRework           = "REWORK"
+	NCRDispositionScrap            = "SCRAP"
+	NCRDispositionReturnToSupplier = "RETURN_TO_SUPPLIER"
+
+	NCRStatusOpen   = "OPEN"
+	NCRStatusClosed = "CLOSED"
+)
+
+// NonConformance is a non-conformance report raised against an aircraft, an activity or a part
+type NonConformance struct {
+	DocType          string   `json:"docType"`
+	NCRID            string   `json:"ncrID"`
+	ACNumber         string   `json:"acNumber"`   // Empty for a part that is not installed
+	Station          string   `json:"station"`    // Station the NCR blocks, empty for a part that is not installed
+	ActivityID       string   `json:"activityID"` // Empty unless raised against an activity
+	PartNumber       string   `json:"partNumber"` // Empty unless raised against a part
+	SerialNumber     string   `json:"serialNumber"`
+	Supplier         string   `json:"supplier"` // Supplier of the part, if any
+	Severity         string   `json:"severity"` // One of the NCRSeverity* values
+	Description      string   `json:"description"`
+	Disposition      string   `json:"disposition"` // One of the NCRDisposition* values, empty until dispositioned
+	Owner            string   `json:"owner"`       // Person or department accountable for resolving the NCR
+	Status           string   `json:"status"`      // One of the NCRStatus* values
+	ReworkActivities []string `json:"reworkActivities"`
+	ClosureEvidence  string   `json:"closureEvidence"` // Hash of the evidence the NCR was closed on
+	RaisedBy         string   `json:"raisedBy"`        // Hash of the identity that raised the NCR
+	RaisedByMSP      string   `json:"raisedByMSP"`
+	RaisedAt         string   `json:"raisedAt"`
+	DispositionedAt  string   `json:"dispositionedAt"`
+	ClosedAt         string   `json:"closedAt"`
+}
+
+// PaginatedNonConformanceResult is used for returning paginated NCR query results and metadata
+type PaginatedNonConformanceResult struct {
+	Records             []*NonConformance `json:"records"`
+	FetchedRecordsCount int32             `json:"fetchedRecordsCount"`
+	Bookmark            string            `json:"bookmark"`
+}
+
+// RaiseNonConformance records an NCR. It is raised against an aircraft at a station, against one of its activities
+// when activityID is given, or against a part when partNumber and serialNumber are given. An NCR against an installed
+// part without an aircraft is attached to the aircraft and station the part was installed at, and the station
+// defaults to the current station of the aircraft. Only QA inspectors may raise NCRs.
+func (s *SmartContract) RaiseNonConformance(ctx contractapi.TransactionContextInterface, ncrID string, acNumber string, station string, activityID string, partNumber string, serialNumber string, severity string, description string, owner string) error {
+	if err := assertQA(ctx); err != nil {
+		return err
+	}
+	if ncrID == "" {
+		return newContractError(ErrInvalidArgument, "NCR ID must not be empty")
+	}
+	if severity != NCRSeverityMinor && severity != NCRSeverityMajor {
+		return newContractError(ErrInvalidArgument, "NCR severity must be %s or %s", NCRSeverityMinor, NCRSeverityMajor)
+	}
+	if description == "" {
+		return newContractError(ErrInvalidArgument, "NCR description must not be empty")
+	}
+
+	key, err := ncrKey(ctx, ncrID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read NCR %s: %v", ncrID, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "NCR %s already exists", ncrID)
+	}
+
+	supplier := ""
+	if partNumber != "" {
+		part, err := s.ReadPart(ctx, partNumber, serialNumber)
+		if err != nil {
+			return err
+		}
+		supplier = part.Supplier
+		if acNumber == "" {
+			acNumber = part.InstalledOn
+			station = part.InstalledStation
+		}
+	}
+	if acNumber == "" && partNumber == "" {
+		return newContractError(ErrInvalidArgument, "an NCR must be raised against an aircraft, an activity or a part")
+	}
+
+	if acNumber != "" {
+		asset, err := s.ReadAsset(ctx, acNumber)
+		if err != nil {
+			return err
+		}
+		if station == "" {
+			station = asset.CurrentStation
+		}
+	}
+	if activityID != "" {
+		if acNumber == "" {
+			return newContractError(ErrInvalidArgument, "an NCR against an activity needs the aircraft number")
+		}
+		activityKey, err := activityKey(ctx, acNumber, station, activityID)
+		if err != nil {
+			return err
+		}
+		activityJSON, err := ctx.GetStub().GetState(activityKey)
+		if err != nil {
+			return fmt.Errorf("failed to read activity %s: %v", activityID, err)
+		}
+		if activityJSON == nil {
+			return newContractError(ErrNotFound, "activity %s does not exist for aircraft %s at station %s", activityID, acNumber, station)
+		}
+	}
+
+	raisedBy, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+	raisedByMSP, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	ncr := NonConformance{
+		DocType:          ncrDocType,
+		NCRID:            ncrID,
+		ACNumber:         acNumber,
+		Station:          station,
+		ActivityID:       activityID,
+		PartNumber:       partNumber,
+		SerialNumber:     serialNumber,
+		Supplier:         supplier,
+		Severity:         severity,
+		Description:      description,
+		Owner:            owner,
+		Status:           NCRStatusOpen,
+		ReworkActivities: []string{},
+		RaisedBy:         raisedBy,
+		RaisedByMSP:      raisedByMSP,
+		RaisedAt:         now,
+	}
+	if err := putNonConformance(ctx, &ncr); err != nil {
+		return err
+	}
+
+	if acNumber == "" {
+		return nil
+	}
+	//  Save the aircraft index entry. Only the key is needed, so the value is a null character, as a nil value would delete the key.
+	indexKey, err := ctx.GetStub().CreateCompositeKey(ncrAircraftIndex, []string{acNumber, station, ncrID})
+	if err != nil {
+		return fmt.Errorf("failed to create NCR aircraft key: %v", err)
+	}
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+// DispositionNonConformance records the decision of the material review on an open NCR and, if owner is not empty,
+// hands the NCR over to a new owner. Only QA inspectors may disposition NCRs.
+func (s *SmartContract) DispositionNonConformance(ctx contractapi.TransactionContextInterface, ncrID string, disposition string, owner string) error {
+	if err := assertQA(ctx); err != nil {
+		return err
+	}
+	switch disposition {
+	case NCRDispositionUseAsIs, NCRDispositionRework, NCRDispositionScrap, NCRDispositionReturnToSupplier:
+	default:
+		return newContractError(ErrInvalidArgument, "NCR disposition must be one of %s, %s, %s or %s",
+			NCRDispositionUseAsIs, NCRDispositionRework, NCRDispositionScrap, NCRDispositionReturnToSupplier)
+	}
+
+	ncr, err := s.readOpenNonConformance(ctx, ncrID)
+	if err != nil {
+		return err
+	}
+	if len(ncr.ReworkActivities) > 0 && disposition != NCRDispositionRework {
+		return newContractError(ErrInvalidArgument, "NCR %s already has rework activities", ncrID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	ncr.Disposition = disposition
+	ncr.DispositionedAt = now
+	if owner != "" {
+		ncr.Owner = owner
+	}
+
+	if ncr.PartNumber != "" {
+		switch disposition {
+		case NCRDispositionScrap:
+			if err := s.scrapPart(ctx, ncr.PartNumber, ncr.SerialNumber); err != nil {
+				return err
+			}
+		case NCRDispositionReturnToSupplier:
+			if err := s.returnPart(ctx, ncr.PartNumber, ncr.SerialNumber); err != nil {
+				return err
+			}
+		}
+	}
+
+	return putNonConformance(ctx, ncr)
+}
+
+// RecordReworkActivity records an activity that reworks an NCR with a REWORK disposition, at the station the NCR
+// was raised at, and links it to the NCR. It takes the same worker identities in the transient map as CreateActivity.
+func (s *SmartContract) RecordReworkActivity(ctx contractapi.TransactionContextInterface, ncrID string, activityID string, startTime string, endTime string, machineID string, toolsOrDrill string, parts []PartRef) error {
+	ncr, err := s.readOpenNonConformance(ctx, ncrID)
+	if err != nil {
+		return err
+	}
+	if ncr.Disposition != NCRDispositionRework {
+		return newContractError(ErrInvalidArgument, "NCR %s does not have disposition %s", ncrID, NCRDispositionRework)
+	}
+	stationNumber, err := strconv.Atoi(ncr.Station)
+	if err != nil {
+		return newContractError(ErrInvalidArgument, "NCR %s is not raised at an assembly station", ncrID)
+	}
+
+	if err := s.createActivity(ctx, ncr.ACNumber, activityID, startTime, endTime, stationNumber, machineID, toolsOrDrill, parts, "", "", ncrID); err != nil {
+		return err
+	}
+
+	ncr.ReworkActivities = append(ncr.ReworkActivities, activityID)
+	return putNonConformance(ctx, ncr)
+}
+
+// CloseNonConformance closes a dispositioned NCR on the given evidence. An NCR with a REWORK disposition needs at
+// least one rework activity. Only QA inspectors may close NCRs.
+func (s *SmartContract) CloseNonConformance(ctx contractapi.TransactionContextInterface, ncrID string, closureEvidence string) error {
+	if err := assertQA(ctx); err != nil {
+		return err
+	}
+	if closureEvidence == "" {
+		return newContractError(ErrInvalidArgument, "closure evidence must not be empty")
+	}
+
+	ncr, err := s.readOpenNonConformance(ctx, ncrID)
+	if err != nil {
+		return err
+	}
+	if ncr.Disposition == "" {
+		return newContractError(ErrInvalidArgument, "NCR %s cannot be closed before it is dispositioned", ncrID)
+	}
+	if ncr.Disposition == NCRDispositionRework && len(ncr.ReworkActivities) == 0 {
+		return newContractError(ErrInvalidArgument, "NCR %s cannot be closed before it is reworked", ncrID)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	ncr.Status = NCRStatusClosed
+	ncr.ClosureEvidence = closureEvidence
+	ncr.ClosedAt = now
+
+	return putNonConformance(ctx, ncr)
+}
+
+// ReadNonConformance returns a single NCR
+func (s *SmartContract) ReadNonConformance(ctx contractapi.TransactionContextInterface, ncrID string) (*NonConformance, error) {
+	key, err := ncrKey(ctx, ncrID)
+	if err != nil {
+		return nil, err
+	}
+	ncrJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NCR %s: %v", ncrID, err)
+	}
+	if ncrJSON == nil {
+		return nil, newContractError(ErrNotFound, "NCR %s does not exist", ncrID)
+	}
+
+	var ncr NonConformance
+	if err := json.Unmarshal(ncrJSON, &ncr); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal NCR %s: %v", ncrID, err)
+	}
+
+	return &ncr, nil
+}
+
+// GetNonConformancesForAsset returns every NCR raised on an aircraft, ordered by station and NCR ID
+func (s *SmartContract) GetNonConformancesForAsset(ctx contractapi.TransactionContextInterface, acNumber string) ([]*NonConformance, error) {
+	return s.getNonConformancesForAsset(ctx, acNumber)
+}
+
+// GetOpenNonConformancesByStation returns a page of the open NCRs raised at a station, across all aircraft
+func (s *SmartContract) GetOpenNonConformancesByStation(ctx contractapi.TransactionContextInterface, station string, pageSize int, bookmark string) (*PaginatedNonConformanceResult, error) {
+	return queryOpenNonConformancesWithPagination(ctx, "station", station, pageSize, bookmark)
+}
+
+// GetOpenNonConformancesBySupplier returns a page of the open NCRs raised against the parts of a supplier
+func (s *SmartContract) GetOpenNonConformancesBySupplier(ctx contractapi.TransactionContextInterface, supplier string, pageSize int, bookmark string) (*PaginatedNonConformanceResult, error) {
+	return queryOpenNonConformancesWithPagination(ctx, "supplier", supplier, pageSize, bookmark)
+}
+
+// assertNoOpenMajorNonConformance checks that no major NCR raised on the aircraft at the station, or at any station
+// before it in the routing, is still open. NCRs raised at a station the routing does not know also block.
+func (s *SmartContract) assertNoOpenMajorNonConformance(ctx contractapi.TransactionContextInterface, acNumber string, routing *Routing, station string) error {
+	ncrs, err := s.getNonConformancesForAsset(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	later := make(map[string]bool, len(routing.Stations))
+	for i := len(routing.Stations) - 1; i >= 0 && routing.Stations[i] != station; i-- {
+		later[routing.Stations[i]] = true
+	}
+	for _, ncr := range ncrs {
+		if ncr.Severity == NCRSeverityMajor && ncr.Status == NCRStatusOpen && !later[ncr.Station] {
+			return newContractError(ErrNotCleared, "major NCR %s of aircraft %s at station %s is open", ncr.NCRID, acNumber, ncr.Station)
+		}
+	}
+	return nil
+}
+
+// getNonConformancesForAsset returns the NCRs matching a partial aircraft index key, e.g. acNumber or acNumber and station
+func (s *SmartContract) getNonConformancesForAsset(ctx contractapi.TransactionContextInterface, attributes ...string) ([]*NonConformance, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(ncrAircraftIndex, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ncrs := []*NonConformance{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(compositeKeyParts) < 3 {
+			continue
+		}
+
+		ncr, err := s.ReadNonConformance(ctx, compositeKeyParts[2])
+		if err != nil {
+			return nil, err
+		}
+		ncrs = append(ncrs, ncr)
+	}
+
+	return ncrs, nil
+}
+
+// readOpenNonConformance returns an NCR, failing if it is closed
+func (s *SmartContract) readOpenNonConformance(ctx contractapi.TransactionContextInterface, ncrID string) (*NonConformance, error) {
+	ncr, err := s.ReadNonConformance(ctx, ncrID)
+	if err != nil {
+		return nil, err
+	}
+	if ncr.Status != NCRStatusOpen {
+		return nil, newContractError(ErrInvalidArgument, "NCR %s is already closed", ncrID)
+	}
+	return ncr, nil
+}
+
+// queryOpenNonConformancesWithPagination runs a parameterized rich query selecting open NCRs on a single field
+func queryOpenNonConformancesWithPagination(ctx contractapi.TransactionContextInterface, field string, value string, pageSize int, bookmark string) (*PaginatedNonConformanceResult, error) {
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": ncrDocType,
+			"status":  NCRStatusOpen,
+			field:     value,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build NCR query: %v", err)
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryJSON), int32(pageSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	ncrs, err := constructNonConformancesFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedNonConformanceResult{
+		Records:             ncrs,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// constructNonConformancesFromIterator constructs a slice of NCRs from the resultsIterator
+func constructNonConformancesFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*NonConformance, error) {
+	ncrs := []*NonConformance{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var ncr NonConformance
+		if err := json.Unmarshal(queryResult.Value, &ncr); err != nil {
+			return nil, err
+		}
+		ncrs = append(ncrs, &ncr)
+	}
+
+	return ncrs, nil
+}
+
+// ncrKey builds the composite key an NCR is stored under
+func ncrKey(ctx contractapi.TransactionContextInterface, ncrID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(ncrDocType, []string{ncrID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create NCR key: %v", err)
+	}
+	return key, nil
+}
+
+// putNonConformance writes an NCR to world state
+func putNonConformance(ctx contractapi.TransactionContextInterface, ncr *NonConformance) error {
+	key, err := ncrKey(ctx, ncr.NCRID)
+	if err != nil {
+		return err
+	}
+	ncrJSON, err := json.Marshal(ncr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal NCR: %v", err)
+	}
+	return ctx.GetStub().PutState(key, ncrJSON)
+}
@@ -2,8 +2,11 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -11,22 +14,45 @@ import (
 // Step 2: Define the Asset and Activity Structs
 // Asset represents the aircraft being assembled
 type Asset struct {
-	ACNumber string `json:"acNumber"` // Aircraft number
+	DocType         string `json:"docType"`         // docType is used to distinguish the various types of objects in state database
+	ACNumber        string `json:"acNumber"`        // Aircraft number
+	Model           string `json:"model"`           // Aircraft model, e.g. A320
+	Variant         string `json:"variant"`         // Model variant, e.g. neo
+	CustomerAirline string `json:"customerAirline"` // Airline the aircraft is built for
+	OwnerMSP        string `json:"ownerMSP"`        // Organization owning the aircraft, the OEM until it is delivered
+	Status          string `json:"status"`          // One of the AssetStatus* values
+	CurrentStation  string `json:"currentStation"`  // Station the aircraft is currently in
+	LastMovedBy     string `json:"lastMovedBy"`     // Hash of the identity that performed the last station handover
+	LastMovedAt     string `json:"lastMovedAt"`     // RFC3339 time of the last station handover
+	CreatedAt       string `json:"createdAt"`       // RFC3339 time the aircraft was registered
+	UpdatedAt       string `json:"updatedAt"`       // RFC3339 time of the last change to the aircraft
 }
 
+const (
+	assetDocType = "asset"
+
+	AssetStatusInAssembly = "IN_ASSEMBLY"
+	AssetStatusRetired    = "RETIRED"
+	AssetStatusDelivered  = "DELIVERED"
+)
+
 // Activity represents an activity in the assembly line
 type Activity struct {
-	ActivityID         string `json:"activityID"`
-	StartTime          string `json:"startTime"`
-	EndTime            string `json:"endTime"`
-	StationNumber      int    `json:"stationNumber"`
-	MachineID          string `json:"machineID"`
-	ToolsOrDrill       string `json:"toolsOrDrill"`
-	PartsID            string `json:"partsID"` // Part Number (P/N)
-	WorkerID           string `json:"workerID"`
-	StationResponsible string `json:"stationResponsible"`
-	PreviousStation    string `json:"previousStation"`
-	NextStation        string `json:"nextStation"`
+	DocType         string    `json:"docType"`  // docType is used to distinguish the various types of objects in state database
+	ACNumber        string    `json:"acNumber"` // Aircraft the activity was performed on
+	ActivityID      string    `json:"activityID"`
+	StartTime       string    `json:"startTime"`
+	EndTime         string    `json:"endTime"`
+	StationNumber   int       `json:"stationNumber"`
+	MachineID       string    `json:"machineID"`
+	ToolsOrDrill    string    `json:"toolsOrDrill"`
+	Parts           []PartRef `json:"parts"`      // Serialized parts installed by the activity
+	WorkerHash      string    `json:"workerHash"` // Hash of the ActivityPrivateDetails kept in the OEM collection
+	PreviousStation string    `json:"previousStation"`
+	NextStation     string    `json:"nextStation"`
+	ReworkOf        string    `json:"reworkOf,omitempty"`      // Non-conformance the activity reworks
+	WorkPackageID   string    `json:"workPackageID,omitempty"` // Work package the activity was planned in
+	ActivityType    string    `json:"activityType,omitempty"`
 }
 
 //Step 3: Implement the Smart Contract
@@ -36,35 +62,220 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
-// CreateActivity records a new activity in the assembly line
-func (s *SmartContract) CreateActivity(ctx contractapi.TransactionContextInterface, activityID string, startTime string, endTime string, stationNumber int, machineID string, toolsOrDrill string, partsID string, workerID string, stationResponsible string, previousStation string, nextStation string) error {
+// CreateActivity records a new activity performed on an aircraft in the assembly line.
+// Start and end times are RFC3339 timestamps, and the stations must be part of the routing.
+// The machine and tool used, when given, must be registered, in service and in calibration.
+// Only a worker responsible for the station may record activities for it. The worker identities are passed in the
+// transient map under "activity_worker" as {"workerID":"...","stationResponsible":"...","salt":"..."}, and only their
+// hash is recorded on the activity. Both must be registered workers, the worker must be the one the client is enrolled
+// as, and the worker must hold the certifications the activity type requires when the activity is planned in a work
+// package, or the unplanned activity requirement when it is not.
+func (s *SmartContract) CreateActivity(ctx contractapi.TransactionContextInterface, acNumber string, activityID string, startTime string, endTime string, stationNumber int, machineID string, toolsOrDrill string, parts []PartRef, previousStation string, nextStation string) error {
+	return s.createActivity(ctx, acNumber, activityID, startTime, endTime, stationNumber, machineID, toolsOrDrill, parts, previousStation, nextStation, "")
+}
+
+// createActivity validates and stores an activity. reworkOf is the ID of the non-conformance the activity reworks, if any.
+func (s *SmartContract) createActivity(ctx contractapi.TransactionContextInterface, acNumber string, activityID string, startTime string, endTime string, stationNumber int, machineID string, toolsOrDrill string, parts []PartRef, previousStation string, nextStation string, reworkOf string) error {
+	if err := assertStationResponsible(ctx, strconv.Itoa(stationNumber)); err != nil {
+		return err
+	}
+	if activityID == "" {
+		return newContractError(ErrInvalidArgument, "activity ID must not be empty")
+	}
+	startTime, endTime, err := validateActivityTimes(startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.AssetExists(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return newContractError(ErrNotFound, "the asset %s does not exist", acNumber)
+	}
+
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return err
+	}
+	if err := routing.validateActivityStations(stationNumber, previousStation, nextStation); err != nil {
+		return err
+	}
+
+	activityKey, err := activityKey(ctx, acNumber, strconv.Itoa(stationNumber), activityID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(activityKey)
+	if err != nil {
+		return fmt.Errorf("failed to read activity %s: %v", activityID, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "activity %s already exists for aircraft %s at station %d", activityID, acNumber, stationNumber)
+	}
+
+	station := strconv.Itoa(stationNumber)
+	if err := s.useEquipment(ctx, EquipmentKindMachine, machineID, startTime, endTime, acNumber, station, activityID); err != nil {
+		return err
+	}
+	if err := s.useEquipment(ctx, EquipmentKindTool, toolsOrDrill, startTime, endTime, acNumber, station, activityID); err != nil {
+		return err
+	}
+
+	worker, err := readActivityWorker(ctx)
+	if err != nil {
+		return err
+	}
+	workPackageID, activityType, err := s.assertWorkerCertified(ctx, worker, acNumber, station, activityID, endTime)
+	if err != nil {
+		return err
+	}
+	workerHash, err := putActivityPrivateDetails(ctx, activityKey, worker, acNumber, station, activityID, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	if parts == nil {
+		parts = []PartRef{}
+	}
+	if err := s.installParts(ctx, parts, acNumber, station, activityID); err != nil {
+		return err
+	}
+
 	activity := Activity{
-		ActivityID:         activityID,
-		StartTime:          startTime,
-		EndTime:            endTime,
-		StationNumber:      stationNumber,
-		MachineID:          machineID,
-		ToolsOrDrill:       toolsOrDrill,
-		PartsID:            partsID,
-		WorkerID:           workerID,
-		StationResponsible: stationResponsible,
-		PreviousStation:    previousStation,
-		NextStation:        nextStation,
+		DocType:         activityDocType,
+		ACNumber:        acNumber,
+		ActivityID:      activityID,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		StationNumber:   stationNumber,
+		MachineID:       machineID,
+		ToolsOrDrill:    toolsOrDrill,
+		Parts:           parts,
+		WorkerHash:      workerHash,
+		PreviousStation: previousStation,
+		NextStation:     nextStation,
+		ReworkOf:        reworkOf,
+		WorkPackageID:   workPackageID,
+		ActivityType:    activityType,
 	}
 
 	activityJSON, err := json.Marshal(activity)
 	if err != nil {
 		return fmt.Errorf("failed to marshal activity: %v", err)
 	}
+	if err := ctx.GetStub().PutState(activityKey, activityJSON); err != nil {
+		return err
+	}
 
-	return ctx.GetStub().PutState(activityID, activityJSON)
+	return setEvent(ctx, EventActivityCreated, ActivityCreatedEvent{
+		ACNumber:      acNumber,
+		ActivityID:    activityID,
+		StationNumber: stationNumber,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		MachineID:     machineID,
+		ToolsOrDrill:  toolsOrDrill,
+		Parts:         parts,
+		ReworkOf:      reworkOf,
+	})
 }
 
-// TransferAsset updates the asset's current station
+// TransferAsset moves the aircraft to the station that follows its current one in the routing.
+// Skipped and backwards moves are refused. Only a worker responsible for the current station may hand the aircraft over,
+// and the move must be endorsed by the organizations set by SetStationEndorsement for the current station.
 func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, acNumber string, nextStation string) error {
-	// Implementation for transferring the asset and validation
-	// This is a placeholder for the actual implementation
-	return nil
+	asset, err := s.ReadAsset(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if asset.Status != AssetStatusInAssembly {
+		return fmt.Errorf("cannot transfer aircraft %s with status %s", acNumber, asset.Status)
+	}
+	if err := assertStationResponsible(ctx, asset.CurrentStation); err != nil {
+		return err
+	}
+
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected, err := routing.stationAfter(asset.CurrentStation)
+	if err != nil {
+		return fmt.Errorf("cannot transfer aircraft %s: %v", acNumber, err)
+	}
+	if nextStation != expected {
+		return fmt.Errorf("cannot transfer aircraft %s from station %s to station %s: next station in the routing is %s", acNumber, asset.CurrentStation, nextStation, expected)
+	}
+	if err := s.assertStationCleared(ctx, acNumber, asset.CurrentStation); err != nil {
+		return err
+	}
+	if err := s.assertNoOpenMajorNonConformance(ctx, acNumber, routing, asset.CurrentStation); err != nil {
+		return err
+	}
+
+	movedBy, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+	movedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	fromStation := asset.CurrentStation
+	asset.CurrentStation = nextStation
+	asset.LastMovedBy = movedBy
+	asset.LastMovedAt = movedAt
+	asset.UpdatedAt = movedAt
+
+	if err := putAsset(ctx, asset); err != nil {
+		return err
+	}
+	if err := s.setAssetStateBasedEndorsement(ctx, acNumber, nextStation); err != nil {
+		return err
+	}
+
+	return setEvent(ctx, EventAssetTransferred, AssetTransferredEvent{
+		ACNumber:    acNumber,
+		FromStation: fromStation,
+		ToStation:   nextStation,
+		MovedBy:     movedBy,
+		MovedAt:     movedAt,
+	})
+}
+
+// submittingClientID returns the decoded X.509 identity of the invoking client
+func submittingClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+	b64ID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read clientID: %v", err)
+	}
+	decodeID, err := base64.StdEncoding.DecodeString(b64ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to base64 decode clientID: %v", err)
+	}
+	return string(decodeID), nil
+}
+
+// txTime returns the transaction timestamp in UTC, so that all endorsers agree on it
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	return ts.AsTime().UTC(), nil
+}
+
+// txTimestamp returns the transaction timestamp as an RFC3339 string
+func txTimestamp(ctx contractapi.TransactionContextInterface) (string, error) {
+	t, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
 }
 
 //Step 4: Main Function
@@ -0,0 +1,1106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+/*
+These unit tests drive the contract against the in-memory shimtest.MockStub.
+Rich (CouchDB) queries are not supported by the mock stub, so only key and
+composite-key based behaviour is covered here.
+*/
+
+// fakeClientIdentity is a minimal cid.ClientIdentity for invoking the contract as a given user
+type fakeClientIdentity struct {
+	id    string
+	mspID string
+	attrs map[string]string
+}
+
+func (f *fakeClientIdentity) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(f.id)), nil
+}
+
+func (f *fakeClientIdentity) GetMSPID() (string, error) {
+	return f.mspID, nil
+}
+
+func (f *fakeClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := f.attrs[attrName]
+	return value, found, nil
+}
+
+func (f *fakeClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	if value, found := f.attrs[attrName]; !found || value != attrValue {
+		return fmt.Errorf("attribute %s does not have value %s", attrName, attrValue)
+	}
+	return nil
+}
+
+func (f *fakeClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+const (
+	testStart = "2024-03-07T08:00:00Z"
+	testEnd   = "2024-03-07T09:30:00Z"
+)
+
+var (
+	oemWorker = &fakeClientIdentity{
+		id:    "x509::CN=worker1::CN=ca.oem.example.com",
+		mspID: OEMMSP,
+		attrs: map[string]string{roleAttribute: RoleWorker, stationsAttribute: "40,35,30,20,50,99", workerIDAttribute: "W1"},
+	}
+	oemWorkerStation40 = &fakeClientIdentity{
+		id:    "x509::CN=worker2::CN=ca.oem.example.com",
+		mspID: OEMMSP,
+		attrs: map[string]string{roleAttribute: RoleWorker, stationsAttribute: "40", workerIDAttribute: "W2"},
+	}
+	oemQA = &fakeClientIdentity{
+		id:    "x509::CN=qa1::CN=ca.oem.example.com",
+		mspID: OEMMSP,
+		attrs: map[string]string{roleAttribute: RoleQA},
+	}
+	airlineQA = &fakeClientIdentity{
+		id:    "x509::CN=qa3::CN=ca.airline.example.com",
+		mspID: AirlineMSP,
+		attrs: map[string]string{roleAttribute: RoleQA},
+	}
+)
+
+// newTestContext returns a transaction context backed by a fresh mock stub with an open transaction
+func newTestContext(t *testing.T, identity *fakeClientIdentity) (*contractapi.TransactionContext, *shimtest.MockStub) {
+	t.Setenv("CORE_PEER_LOCALMSPID", OEMMSP)
+	stub := shimtest.NewMockStub("oemContract", nil)
+	stub.MockTransactionStart("tx1")
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		activityWorkerTransientKey: []byte(`{"workerID":"W1","stationResponsible":"R1","salt":"c2FsdA=="}`),
+	}))
+	putTestWorker(t, stub, Worker{WorkerID: "W1"})
+	putTestWorker(t, stub, Worker{WorkerID: "R1"})
+	// most tests record activities that are not planned in a work package and need no certification
+	require.NoError(t, stub.PutState(unplannedRequirementKey, []byte(`{"activityType":"UNPLANNED","certifications":[]}`)))
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(identity)
+	return ctx, stub
+}
+
+func putTestWorker(t *testing.T, stub *shimtest.MockStub, worker Worker) {
+	workerJSON, err := json.Marshal(worker)
+	require.NoError(t, err)
+	key, err := stub.CreateCompositeKey(workerObjectType, []string{worker.WorkerID})
+	require.NoError(t, err)
+	require.NoError(t, stub.PutPrivateData(oemCollection, key, workerJSON))
+}
+
+// privateDataHashStub adds GetPrivateDataHash, which the mock stub does not implement
+type privateDataHashStub struct {
+	*shimtest.MockStub
+}
+
+func (s *privateDataHashStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+func putTestAsset(t *testing.T, stub *shimtest.MockStub, asset Asset) {
+	assetJSON, err := json.Marshal(asset)
+	require.NoError(t, err)
+	require.NoError(t, stub.PutState(asset.ACNumber, assetJSON))
+}
+
+func TestChaincodeMetadata(t *testing.T) {
+	_, err := contractapi.NewChaincode(new(SmartContract))
+	require.NoError(t, err)
+}
+
+func TestTransferAsset(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+
+	err := cc.TransferAsset(ctx, "MSN001", "35")
+	require.EqualError(t, err, "NOT_FOUND: the asset MSN001 does not exist")
+
+	putTestAsset(t, stub, Asset{DocType: assetDocType, ACNumber: "MSN001", Status: AssetStatusInAssembly, CurrentStation: "40"})
+	err = cc.TransferAsset(ctx, "MSN001", "35")
+	require.EqualError(t, err, "no routing has been configured")
+
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35", "30", "20"}))
+
+	err = cc.TransferAsset(ctx, "MSN001", "30")
+	require.EqualError(t, err, "cannot transfer aircraft MSN001 from station 40 to station 30: next station in the routing is 35")
+
+	require.NoError(t, cc.TransferAsset(ctx, "MSN001", "35"))
+	event := <-stub.ChaincodeEventsChannel
+	require.Equal(t, "AssetTransferred", event.EventName)
+
+	asset, err := cc.ReadAsset(ctx, "MSN001")
+	require.NoError(t, err)
+	require.Equal(t, "35", asset.CurrentStation)
+	require.NotContains(t, asset.LastMovedBy, "worker1")
+	require.Len(t, asset.LastMovedBy, 64)
+	require.NotEmpty(t, asset.LastMovedAt)
+
+	err = cc.TransferAsset(ctx, "MSN001", "40")
+	require.EqualError(t, err, "cannot transfer aircraft MSN001 from station 35 to station 40: next station in the routing is 30")
+}
+
+func TestTransferAssetEndOfRouting(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+
+	putTestAsset(t, stub, Asset{DocType: assetDocType, ACNumber: "MSN002", Status: AssetStatusInAssembly, CurrentStation: "35"})
+	err := cc.TransferAsset(ctx, "MSN002", "30")
+	require.EqualError(t, err, "cannot transfer aircraft MSN002: station 35 is the last station in the routing")
+
+	putTestAsset(t, stub, Asset{DocType: assetDocType, ACNumber: "MSN003", Status: AssetStatusInAssembly, CurrentStation: "99"})
+	err = cc.TransferAsset(ctx, "MSN003", "40")
+	require.EqualError(t, err, "cannot transfer aircraft MSN003: station 99 is not part of the routing")
+}
+
+func TestSetRoutingValidation(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+
+	require.EqualError(t, cc.SetRouting(ctx, []string{"40"}), "a routing needs at least two stations")
+	require.EqualError(t, cc.SetRouting(ctx, []string{"40", ""}), "station names in the routing must not be empty")
+	require.EqualError(t, cc.SetRouting(ctx, []string{"40", "35", "40"}), "station 40 appears more than once in the routing")
+}
+
+func TestAssetLifecycle(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+
+	err := cc.CreateAsset(ctx, "MSN010", "A320", "neo", "Airline A")
+	require.EqualError(t, err, "no routing has been configured")
+
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35", "30"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN010", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN011", "A321", "neo", "Airline B"))
+
+	err = cc.CreateAsset(ctx, "MSN010", "A320", "neo", "Airline A")
+	require.EqualError(t, err, "ALREADY_EXISTS: the asset MSN010 already exists")
+
+	exists, err := cc.AssetExists(ctx, "MSN010")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	asset, err := cc.ReadAsset(ctx, "MSN010")
+	require.NoError(t, err)
+	require.Equal(t, "40", asset.CurrentStation)
+	require.Equal(t, AssetStatusInAssembly, asset.Status)
+	require.Equal(t, "Airline A", asset.CustomerAirline)
+	require.NotEmpty(t, asset.CreatedAt)
+
+	assets, err := cc.GetAllAssets(ctx)
+	require.NoError(t, err)
+	require.Len(t, assets, 2)
+
+	// The routing is stored under a simple key too, but it is not an aircraft
+	exists, err = cc.AssetExists(ctx, routingKey)
+	require.NoError(t, err)
+	require.False(t, exists)
+	_, err = cc.ReadAsset(ctx, routingKey)
+	require.EqualError(t, err, "NOT_FOUND: the asset routing does not exist")
+	err = cc.CreateAsset(ctx, routingKey, "A320", "neo", "Airline A")
+	require.EqualError(t, err, "INVALID_ARGUMENT: routing is reserved and cannot be used as an aircraft number")
+	require.NoError(t, cc.SetUnplannedActivityRequirement(ctx, []string{"GEN-01"}))
+	exists, err = cc.AssetExists(ctx, unplannedRequirementKey)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, cc.RetireAsset(ctx, "MSN010"))
+	require.EqualError(t, cc.RetireAsset(ctx, "MSN010"), "the asset MSN010 is already retired")
+	require.EqualError(t, cc.TransferAsset(ctx, "MSN010", "35"), "cannot transfer aircraft MSN010 with status RETIRED")
+}
+
+func TestActivitiesForAsset(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+
+	err := cc.CreateActivity(ctx, "MSN020", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_FOUND: the asset MSN020 does not exist")
+
+	require.NoError(t, cc.CreateAsset(ctx, "MSN020", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN021", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN020", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN020", "ACT2", testStart, testEnd, 35, "", "", nil, "40", ""))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN021", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+
+	activities, err := cc.GetActivitiesForAsset(ctx, "MSN020")
+	require.NoError(t, err)
+	require.Len(t, activities, 2)
+	require.Equal(t, "ACT2", activities[0].ActivityID) // "35" sorts before "40"
+	require.Equal(t, "MSN020", activities[1].ACNumber)
+}
+
+func TestCreateActivityValidation(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN030", "A320", "neo", "Airline A"))
+
+	err := cc.CreateActivity(ctx, "MSN030", "", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "INVALID_ARGUMENT: activity ID must not be empty")
+
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", "07/03/2024 08:00", testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, `INVALID_TIMESTAMP: start time "07/03/2024 08:00" is not an RFC3339 timestamp`)
+	var contractErr *ContractError
+	require.ErrorAs(t, err, &contractErr)
+	require.Equal(t, ErrInvalidTimestamp, contractErr.Code)
+
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", testStart, "", 40, "", "", nil, "", "35")
+	require.EqualError(t, err, `INVALID_TIMESTAMP: end time "" is not an RFC3339 timestamp`)
+
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", testEnd, testStart, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "INVALID_TIMESTAMP: end time 2024-03-07T08:00:00Z must be after start time 2024-03-07T09:30:00Z")
+
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", testStart, testEnd, 50, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_FOUND: station 50 is not part of the routing")
+
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", testStart, testEnd, 40, "", "", nil, "45", "35")
+	require.EqualError(t, err, "NOT_FOUND: previous station 45 is not part of the routing")
+
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", testStart, testEnd, 40, "", "", nil, "", "30")
+	require.EqualError(t, err, "NOT_FOUND: next station 30 is not part of the routing")
+
+	require.NoError(t, cc.CreateActivity(ctx, "MSN030", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+	err = cc.CreateActivity(ctx, "MSN030", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "ALREADY_EXISTS: activity ACT1 already exists for aircraft MSN030 at station 40")
+}
+
+func TestAccessControl(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN040", "A320", "neo", "Airline A"))
+
+	ctx.SetClientIdentity(airlineQA)
+	require.EqualError(t, cc.CreateAsset(ctx, "MSN041", "A320", "neo", "Airline A"), "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP may perform this operation")
+	require.EqualError(t, cc.RetireAsset(ctx, "MSN040"), "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP may perform this operation")
+	require.EqualError(t, cc.SetRouting(ctx, []string{"40", "30"}), "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP may perform this operation")
+	err := cc.CreateActivity(ctx, "MSN040", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "FORBIDDEN: client does not have the worker role")
+	require.NoError(t, assertQA(ctx))
+
+	ctx.SetClientIdentity(oemWorker)
+	require.EqualError(t, assertQA(ctx), "FORBIDDEN: client does not have the qa role")
+
+	ctx.SetClientIdentity(oemWorkerStation40)
+	err = cc.CreateActivity(ctx, "MSN040", "ACT1", testStart, testEnd, 35, "", "", nil, "40", "")
+	require.EqualError(t, err, "FORBIDDEN: client is not responsible for station 35")
+	err = cc.CreateActivity(ctx, "MSN040", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "FORBIDDEN: client is enrolled as worker W2 and cannot record work of worker W1")
+
+	putTestWorker(t, stub, Worker{WorkerID: "W2"})
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		activityWorkerTransientKey: []byte(`{"workerID":"W2","stationResponsible":"R1","salt":"c2FsdA=="}`),
+	}))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN040", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+	require.NoError(t, cc.TransferAsset(ctx, "MSN040", "35"))
+}
+
+func TestInspectionWorkflow(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.SetMandatoryActivities(ctx, "40", []string{"ACT1"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN050", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN050", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+
+	err := cc.TransferAsset(ctx, "MSN050", "35")
+	require.EqualError(t, err, "NOT_CLEARED: mandatory activity ACT1 of aircraft MSN050 at station 40 has no inspection")
+
+	err = cc.RecordInspection(ctx, "MSN050", "40", "INS1", "ACT1", InspectionResultPass, nil, "sha256:abc")
+	require.EqualError(t, err, "FORBIDDEN: client does not have the qa role")
+
+	ctx.SetClientIdentity(oemQA)
+	err = cc.RecordInspection(ctx, "MSN050", "40", "INS1", "ACT1", InspectionResultFail, nil, "sha256:abc")
+	require.EqualError(t, err, "INVALID_ARGUMENT: an inspection with result FAIL needs at least one defect code")
+	err = cc.RecordInspection(ctx, "MSN050", "40", "INS1", "ACT9", InspectionResultPass, nil, "sha256:abc")
+	require.EqualError(t, err, "NOT_FOUND: activity ACT9 does not exist for aircraft MSN050 at station 40")
+	require.NoError(t, cc.RecordInspection(ctx, "MSN050", "40", "INS1", "ACT1", InspectionResultRework, []string{"D-101"}, "sha256:abc"))
+
+	ctx.SetClientIdentity(oemWorker)
+	err = cc.TransferAsset(ctx, "MSN050", "35")
+	require.EqualError(t, err, "NOT_CLEARED: mandatory activity ACT1 of aircraft MSN050 at station 40 has inspection result REWORK")
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RecordInspection(ctx, "MSN050", "40", "INS2", "ACT1", InspectionResultPass, nil, "sha256:def"))
+	require.NoError(t, cc.RecordInspection(ctx, "MSN050", "40", "INS3", "", InspectionResultFail, []string{"D-200"}, "sha256:123"))
+	err = cc.CountersignInspection(ctx, "MSN050", "40", "INS2")
+	require.EqualError(t, err, "FORBIDDEN: client from OEMMSP is not authorized, only SupplierMSP or AirlineMSP may perform this operation")
+
+	ctx.SetClientIdentity(airlineQA)
+	require.NoError(t, cc.CountersignInspection(ctx, "MSN050", "40", "INS2"))
+	err = cc.CountersignInspection(ctx, "MSN050", "40", "INS2")
+	require.EqualError(t, err, "ALREADY_EXISTS: inspection INS2 is already countersigned by AirlineMSP")
+
+	ctx.SetClientIdentity(&fakeClientIdentity{id: "x509::CN=worker9::CN=ca.airline.example.com", mspID: AirlineMSP, attrs: map[string]string{roleAttribute: RoleWorker}})
+	err = cc.CountersignInspection(ctx, "MSN050", "40", "INS1")
+	require.EqualError(t, err, "FORBIDDEN: client does not have the qa role")
+
+	inspection, err := cc.ReadInspection(ctx, "MSN050", "40", "INS2")
+	require.NoError(t, err)
+	require.Len(t, inspection.Countersignatures, 1)
+	require.Equal(t, AirlineMSP, inspection.Countersignatures[0].MSPID)
+
+	ctx.SetClientIdentity(oemWorker)
+	err = cc.TransferAsset(ctx, "MSN050", "35")
+	require.EqualError(t, err, "NOT_CLEARED: station 40 exit inspection of aircraft MSN050 has result FAIL")
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RecordInspection(ctx, "MSN050", "40", "INS4", "", InspectionResultPass, nil, "sha256:456"))
+
+	ctx.SetClientIdentity(oemWorker)
+	require.NoError(t, cc.TransferAsset(ctx, "MSN050", "35"))
+
+	inspections, err := cc.GetInspectionsForAsset(ctx, "MSN050")
+	require.NoError(t, err)
+	require.Len(t, inspections, 4)
+	require.Equal(t, 4, inspections[3].Sequence)
+}
+
+func TestInspectionSameOrganizationCountersign(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN051", "A320", "neo", "Airline A"))
+	<-stub.ChaincodeEventsChannel
+
+	ctx.SetClientIdentity(airlineQA)
+	require.NoError(t, cc.RecordInspection(ctx, "MSN051", "40", "INS1", "", InspectionResultPass, nil, "sha256:abc"))
+	<-stub.ChaincodeEventsChannel
+	err := cc.CountersignInspection(ctx, "MSN051", "40", "INS1")
+	require.EqualError(t, err, "FORBIDDEN: inspection INS1 was recorded by AirlineMSP and cannot be countersigned by the same organization")
+
+	ctx.SetClientIdentity(&fakeClientIdentity{id: "x509::CN=qa2::CN=ca.supplier.example.com", mspID: SupplierMSP, attrs: map[string]string{roleAttribute: RoleQA}})
+	require.NoError(t, cc.CountersignInspection(ctx, "MSN051", "40", "INS1"))
+	event := <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventInspectionCountersigned, event.EventName)
+	var countersigned InspectionCountersignedEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &countersigned))
+	require.Equal(t, InspectionCountersignedEvent{ACNumber: "MSN051", Station: "40", InspectionID: "INS1", MSPID: SupplierMSP, SignedAt: countersigned.SignedAt}, countersigned)
+	require.NotEmpty(t, countersigned.SignedAt)
+}
+
+func TestInspectionSupersedes(t *testing.T) {
+	pass := &Inspection{Result: InspectionResultPass, InspectedAt: "2024-03-07T08:00:00Z"}
+	fail := &Inspection{Result: InspectionResultFail, InspectedAt: "2024-03-07T08:00:00Z"}
+
+	// Inspections with the same sequence number resolve to the failure, whatever the order
+	require.True(t, supersedes(fail, pass))
+	require.False(t, supersedes(pass, fail))
+
+	// The sequence number orders inspections that share a timestamp
+	pass.Sequence, fail.Sequence = 2, 1
+	require.True(t, supersedes(pass, fail))
+	require.False(t, supersedes(fail, pass))
+
+	// The timestamp does not order inspections, so a later one with a lower sequence number does not win
+	later := &Inspection{Result: InspectionResultPass, InspectedAt: "2024-03-07T08:00:01Z"}
+	require.False(t, supersedes(later, fail))
+	require.True(t, supersedes(fail, later))
+}
+
+func TestActivityPrivateDetails(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN060", "A320", "neo", "Airline A"))
+
+	require.NoError(t, stub.SetTransient(map[string][]byte{}))
+	err := cc.CreateActivity(ctx, "MSN060", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "INVALID_ARGUMENT: activity_worker not found in the transient map input")
+
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		activityWorkerTransientKey: []byte(`{"workerID":"W7","stationResponsible":"R7","salt":"c2FsdA=="}`),
+	}))
+	err = cc.CreateActivity(ctx, "MSN060", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "FORBIDDEN: client is enrolled as worker W1 and cannot record work of worker W7")
+
+	ctx.SetClientIdentity(&fakeClientIdentity{id: "x509::CN=worker6::CN=ca.oem.example.com", mspID: OEMMSP, attrs: map[string]string{roleAttribute: RoleWorker, stationsAttribute: "40"}})
+	err = cc.CreateActivity(ctx, "MSN060", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "FORBIDDEN: client does not have the oem.workerID attribute")
+
+	ctx.SetClientIdentity(&fakeClientIdentity{id: "x509::CN=worker7::CN=ca.oem.example.com", mspID: OEMMSP, attrs: map[string]string{roleAttribute: RoleWorker, stationsAttribute: "40", workerIDAttribute: "W7"}})
+	err = cc.CreateActivity(ctx, "MSN060", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_FOUND: worker W7 is not registered")
+
+	putTestWorker(t, stub, Worker{WorkerID: "W7"})
+	putTestWorker(t, stub, Worker{WorkerID: "R7"})
+	require.NoError(t, cc.CreateActivity(ctx, "MSN060", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+
+	activities, err := cc.GetActivitiesForAsset(ctx, "MSN060")
+	require.NoError(t, err)
+	require.Len(t, activities, 1)
+	activityJSON, err := json.Marshal(activities[0])
+	require.NoError(t, err)
+	require.NotContains(t, string(activityJSON), "W7")
+
+	details, err := cc.ReadActivityPrivateDetails(ctx, "MSN060", "40", "ACT1")
+	require.NoError(t, err)
+	require.Equal(t, "W7", details.WorkerID)
+	require.Equal(t, "R7", details.StationResponsible)
+	require.Equal(t, testStart, details.StartTime)
+	require.Equal(t, testEnd, details.EndTime)
+
+	ctx.SetClientIdentity(airlineQA)
+	_, err = cc.ReadActivityPrivateDetails(ctx, "MSN060", "40", "ACT1")
+	require.EqualError(t, err, "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP may perform this operation")
+}
+
+func TestWorkPackageCertification(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN065", "A320", "neo", "Airline A"))
+
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		workerTransientKey: []byte(`{"workerID":"W1","name":"Worker One","skills":["riveting"],"certifications":[{"code":"RIV-2","expiresAt":"2024-03-07T09:00:00Z"}]}`),
+	}))
+	require.NoError(t, cc.SetWorker(ctx))
+	worker, err := cc.ReadWorker(ctx, "W1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"riveting"}, worker.Skills)
+
+	requirements := []ActivityTypeRequirement{
+		{ActivityType: "RIVETING", Certifications: []string{"RIV-2"}},
+		{ActivityType: "SEALING", Certifications: []string{"SEAL-1"}},
+	}
+	err = cc.CreateWorkPackage(ctx, "WP1", "MSN065", "40", requirements, []PlannedActivity{{ActivityID: "ACT1", ActivityType: "PAINTING"}})
+	require.EqualError(t, err, `INVALID_ARGUMENT: activity ACT1 has type "PAINTING", which is not listed in the requirements`)
+	require.NoError(t, cc.CreateWorkPackage(ctx, "WP1", "MSN065", "40", requirements, []PlannedActivity{
+		{ActivityID: "ACT1", ActivityType: "RIVETING"},
+		{ActivityID: "ACT2", ActivityType: "SEALING"},
+	}))
+	err = cc.CreateWorkPackage(ctx, "WP2", "MSN065", "40", requirements, []PlannedActivity{{ActivityID: "ACT1", ActivityType: "RIVETING"}})
+	require.EqualError(t, err, "ALREADY_EXISTS: activity ACT1 of aircraft MSN065 at station 40 is already planned in work package WP1")
+
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		activityWorkerTransientKey: []byte(`{"workerID":"W1","stationResponsible":"R1","salt":"c2FsdA=="}`),
+	}))
+	err = cc.CreateActivity(ctx, "MSN065", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_CERTIFIED: certification RIV-2 of worker W1 expired at 2024-03-07T09:00:00Z")
+	err = cc.CreateActivity(ctx, "MSN065", "ACT2", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_CERTIFIED: worker W1 does not hold certification SEAL-1")
+
+	require.NoError(t, cc.CreateActivity(ctx, "MSN065", "ACT1", testStart, "2024-03-07T08:45:00Z", 40, "", "", nil, "", "35"))
+	activity, err := cc.GetActivitiesForStation(ctx, "MSN065", "40")
+	require.NoError(t, err)
+	require.Equal(t, "WP1", activity[0].WorkPackageID)
+	require.Equal(t, "RIVETING", activity[0].ActivityType)
+
+	// activities that are not planned need the unplanned activity requirement, and are refused while it is not set
+	require.NoError(t, stub.DelState(unplannedRequirementKey))
+	err = cc.CreateActivity(ctx, "MSN065", "ACT3", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_CERTIFIED: activity ACT3 of aircraft MSN065 at station 40 is not planned in a work package and no requirement for unplanned activities has been set")
+	_, err = cc.GetUnplannedActivityRequirement(ctx)
+	require.EqualError(t, err, "NOT_FOUND: no requirement for unplanned activities has been set")
+
+	err = cc.SetUnplannedActivityRequirement(ctx, []string{"GEN-1", ""})
+	require.EqualError(t, err, "INVALID_ARGUMENT: certification code must not be empty")
+	require.NoError(t, cc.SetUnplannedActivityRequirement(ctx, []string{"GEN-1"}))
+	err = cc.CreateActivity(ctx, "MSN065", "ACT3", testStart, testEnd, 40, "", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_CERTIFIED: worker W1 does not hold certification GEN-1")
+
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		workerTransientKey: []byte(`{"workerID":"W1","certifications":[{"code":"GEN-1","expiresAt":"2025-01-01T00:00:00Z"}]}`),
+	}))
+	require.NoError(t, cc.SetWorker(ctx))
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		activityWorkerTransientKey: []byte(`{"workerID":"W1","stationResponsible":"R1","salt":"c2FsdA=="}`),
+	}))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN065", "ACT3", testStart, testEnd, 40, "", "", nil, "", "35"))
+	activity, err = cc.GetActivitiesForStation(ctx, "MSN065", "40")
+	require.NoError(t, err)
+	require.Empty(t, activity[1].WorkPackageID)
+
+	ctx.SetClientIdentity(airlineQA)
+	err = cc.SetUnplannedActivityRequirement(ctx, []string{})
+	require.EqualError(t, err, "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP may perform this operation")
+}
+
+func TestPartTerms(t *testing.T) {
+	supplierBuyer := &fakeClientIdentity{id: "x509::CN=buyer::CN=ca.supplier.example.com", mspID: SupplierMSP}
+	ctx, stub := newTestContext(t, supplierBuyer)
+	cc := new(SmartContract)
+
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		partTermsTransientKey: []byte(`{"partNumber":"D5381000","supplier":"Supplier A","unitPrice":"120.50","currency":"EUR","contractRef":"C-1"}`),
+	}))
+	err := cc.SetPartTerms(ctx)
+	require.EqualError(t, err, "FORBIDDEN: client from org SupplierMSP is not authorized to read or write private data from an org OEMMSP peer")
+
+	t.Setenv("CORE_PEER_LOCALMSPID", SupplierMSP)
+	require.NoError(t, cc.SetPartTerms(ctx))
+	terms, err := cc.ReadPartTerms(ctx, "D5381000")
+	require.NoError(t, err)
+	require.Equal(t, "120.50", terms.UnitPrice)
+
+	ctx.SetClientIdentity(airlineQA)
+	_, err = cc.ReadPartTerms(ctx, "D5381000")
+	require.EqualError(t, err, "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP or SupplierMSP may perform this operation")
+}
+
+func TestPartGenealogy(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN070", "A320", "neo", "Airline A"))
+
+	require.NoError(t, cc.RegisterPart(ctx, "D5381000", "SN1", "LOT-A", "Supplier A", "sha256:coc1"))
+	require.NoError(t, cc.RegisterPart(ctx, "D5381000", "SN2", "LOT-A", "Supplier A", "sha256:coc2"))
+	require.NoError(t, cc.RegisterPart(ctx, "D5381000", "SN3", "LOT-B", "Supplier A", "sha256:coc3"))
+	err := cc.RegisterPart(ctx, "D5381000", "SN1", "LOT-A", "Supplier A", "sha256:coc1")
+	require.EqualError(t, err, "ALREADY_EXISTS: part D5381000/SN1 already exists")
+
+	sn1 := PartRef{PartNumber: "D5381000", SerialNumber: "SN1"}
+	sn3 := PartRef{PartNumber: "D5381000", SerialNumber: "SN3"}
+	err = cc.CreateActivity(ctx, "MSN070", "ACT1", testStart, testEnd, 40, "", "", []PartRef{sn1}, "", "35")
+	require.EqualError(t, err, "INVALID_ARGUMENT: part D5381000/SN1 cannot be installed in state AT_SUPPLIER")
+
+	require.NoError(t, cc.ReceivePart(ctx, "D5381000", "SN1"))
+	require.NoError(t, cc.ReceivePart(ctx, "D5381000", "SN3"))
+	err = cc.CreateActivity(ctx, "MSN070", "ACT1", testStart, testEnd, 40, "", "", []PartRef{sn1, sn1}, "", "35")
+	require.EqualError(t, err, "INVALID_ARGUMENT: part D5381000/SN1 is listed more than once")
+	require.NoError(t, cc.CreateActivity(ctx, "MSN070", "ACT1", testStart, testEnd, 40, "", "", []PartRef{sn1, sn3}, "", "35"))
+
+	part, err := cc.ReadPart(ctx, "D5381000", "SN1")
+	require.NoError(t, err)
+	require.Equal(t, PartStateInstalled, part.State)
+	require.Equal(t, "MSN070", part.InstalledOn)
+	require.Equal(t, "ACT1", part.InstalledActivity)
+
+	used, err := cc.WhereUsed(ctx, "D5381000", "LOT-A")
+	require.NoError(t, err)
+	require.Len(t, used, 1)
+	require.Equal(t, "SN1", used[0].SerialNumber)
+
+	used, err = cc.WhereUsed(ctx, "D5381000", "")
+	require.NoError(t, err)
+	require.Len(t, used, 2)
+
+	require.NoError(t, cc.RemovePart(ctx, "D5381000", "SN1"))
+	used, err = cc.WhereUsed(ctx, "D5381000", "LOT-A")
+	require.NoError(t, err)
+	require.Empty(t, used)
+}
+
+func TestEquipmentCalibration(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN080", "A320", "neo", "Airline A"))
+
+	err := cc.CreateActivity(ctx, "MSN080", "ACT1", testStart, testEnd, 40, "M1", "", nil, "", "35")
+	require.EqualError(t, err, "NOT_FOUND: MACHINE M1 does not exist")
+
+	require.NoError(t, cc.RegisterEquipment(ctx, EquipmentKindMachine, "M1", "Drilling robot", "2024-03-07T09:00:00Z"))
+	require.NoError(t, cc.RegisterEquipment(ctx, EquipmentKindTool, "D1", "Torque wrench", "2024-06-01T00:00:00Z"))
+	err = cc.RegisterEquipment(ctx, "ROBOT", "R1", "", "2024-06-01T00:00:00Z")
+	require.EqualError(t, err, `INVALID_ARGUMENT: equipment kind "ROBOT" must be MACHINE or TOOL`)
+
+	err = cc.CreateActivity(ctx, "MSN080", "ACT1", testStart, testEnd, 40, "M1", "D1", nil, "", "35")
+	require.EqualError(t, err, "EQUIPMENT_UNUSABLE: MACHINE M1 is out of calibration since 2024-03-07T09:00:00Z")
+
+	require.NoError(t, cc.CreateActivity(ctx, "MSN080", "ACT1", testStart, testEnd, 40, "", "D1", nil, "", "35"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN080", "ACT2", "2024-03-08T08:00:00Z", "2024-03-08T09:00:00Z", 40, "", "D1", nil, "", "35"))
+
+	require.NoError(t, cc.GroundEquipment(ctx, EquipmentKindTool, "D1", "dropped"))
+	err = cc.CreateActivity(ctx, "MSN080", "ACT3", testStart, testEnd, 40, "", "D1", nil, "", "35")
+	require.EqualError(t, err, "EQUIPMENT_UNUSABLE: TOOL D1 is GROUNDED: dropped")
+	require.NoError(t, cc.ReturnEquipmentToService(ctx, EquipmentKindTool, "D1"))
+
+	due := stub.TxTimestamp.AsTime().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	require.NoError(t, cc.CalibrateEquipment(ctx, EquipmentKindMachine, "M1", due, "sha256:cert"))
+	calibrations, err := cc.GetCalibrations(ctx, EquipmentKindMachine, "M1")
+	require.NoError(t, err)
+	require.Len(t, calibrations, 1)
+
+	activities, err := cc.GetEquipmentActivities(ctx, EquipmentKindTool, "D1", "", "")
+	require.NoError(t, err)
+	require.Len(t, activities, 2)
+
+	activities, err = cc.GetEquipmentActivities(ctx, EquipmentKindTool, "D1", "2024-03-08T00:00:00Z", "")
+	require.NoError(t, err)
+	require.Len(t, activities, 1)
+	require.Equal(t, "ACT2", activities[0].ActivityID)
+}
+
+func TestEquipmentRecalibrationBackdated(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN082", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.RegisterEquipment(ctx, EquipmentKindMachine, "M1", "Drilling robot", "2024-03-07T12:00:00Z"))
+
+	// The calibration lapses on 7 March and is renewed on 9 March, then renewed again early on 15 March
+	calibrateAt := func(txID string, at string, due string) {
+		stub.MockTransactionStart(txID)
+		calibratedAt, err := time.Parse(time.RFC3339, at)
+		require.NoError(t, err)
+		stub.TxTimestamp = timestamppb.New(calibratedAt)
+		require.NoError(t, cc.CalibrateEquipment(ctx, EquipmentKindMachine, "M1", due, "sha256:"+txID))
+	}
+	calibrateAt("cal1", "2024-03-09T00:00:00Z", "2024-03-20T00:00:00Z")
+	calibrateAt("cal2", "2024-03-15T00:00:00Z", "2024-06-01T00:00:00Z")
+
+	require.NoError(t, cc.CreateActivity(ctx, "MSN082", "ACT1", "2024-03-16T08:00:00Z", "2024-03-16T09:00:00Z", 40, "M1", "", nil, "", "35"))
+
+	// Activities recorded after the fact are checked against the calibration in force when they started
+	require.NoError(t, cc.CreateActivity(ctx, "MSN082", "ACT2", "2024-03-10T08:00:00Z", "2024-03-10T09:00:00Z", 40, "M1", "", nil, "", "35"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN082", "ACT3", testStart, testEnd, 40, "M1", "", nil, "", "35"))
+
+	err := cc.CreateActivity(ctx, "MSN082", "ACT4", "2024-03-08T08:00:00Z", "2024-03-08T09:00:00Z", 40, "M1", "", nil, "", "35")
+	require.EqualError(t, err, "EQUIPMENT_UNUSABLE: MACHINE M1 was out of calibration before the end of the activity, its calibration fell due at 2024-03-07T12:00:00Z")
+	err = cc.CreateActivity(ctx, "MSN082", "ACT4", "2024-03-07T11:00:00Z", "2024-03-07T13:00:00Z", 40, "M1", "", nil, "", "35")
+	require.EqualError(t, err, "EQUIPMENT_UNUSABLE: MACHINE M1 was out of calibration before the end of the activity, its calibration fell due at 2024-03-07T12:00:00Z")
+}
+
+func TestEquipmentUsage(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN085", "A320", "neo", "Airline A"))
+	<-stub.ChaincodeEventsChannel
+	require.NoError(t, cc.RegisterEquipment(ctx, EquipmentKindTool, "D1", "Drill", "2030-01-01T00:00:00Z"))
+
+	err := cc.RecordEquipmentUsage(ctx, EquipmentKindTool, "D2", "cycles", 10)
+	require.EqualError(t, err, "NOT_FOUND: TOOL D2 does not exist")
+	err = cc.RecordEquipmentUsage(ctx, EquipmentKindTool, "D1", "cycles", 0)
+	require.EqualError(t, err, "INVALID_ARGUMENT: usage delta must be positive, got 0")
+
+	for i, delta := range []int64{400, 350, 300} {
+		stub.MockTransactionStart(fmt.Sprintf("usage%d", i))
+		require.NoError(t, cc.RecordEquipmentUsage(ctx, EquipmentKindTool, "D1", "cycles", delta))
+	}
+	require.NoError(t, cc.RecordEquipmentUsage(ctx, EquipmentKindTool, "D1", "torque", 5))
+	require.NoError(t, cc.SetEquipmentUsageLimit(ctx, EquipmentKindTool, "D1", "cycles", 1000))
+
+	usage, err := cc.GetEquipmentUsage(ctx, EquipmentKindTool, "D1")
+	require.NoError(t, err)
+	require.Equal(t, []*UsageCounter{
+		{Counter: "cycles", Total: 1050, Limit: 1000, LimitReached: true, Deltas: 3},
+		{Counter: "torque", Total: 5, Deltas: 1},
+	}, usage.Counters)
+
+	stub.MockTransactionStart("prune")
+	usage, err = cc.PruneEquipmentUsage(ctx, EquipmentKindTool, "D1")
+	require.NoError(t, err)
+	require.Equal(t, int64(1050), usage.Counters[0].Total)
+	event := <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventEquipmentMaintenanceDue, event.EventName)
+
+	usage, err = cc.GetEquipmentUsage(ctx, EquipmentKindTool, "D1")
+	require.NoError(t, err)
+	require.Equal(t, 1, usage.Counters[0].Deltas)
+	require.Equal(t, int64(1050), usage.Counters[0].Total)
+
+	err = cc.CreateActivity(ctx, "MSN085", "ACT1", testStart, testEnd, 40, "", "D1", nil, "", "35")
+	require.EqualError(t, err, "EQUIPMENT_UNUSABLE: TOOL D1 is GROUNDED: maintenance due: cycles reached 1050 of limit 1000")
+
+	require.NoError(t, cc.ResetEquipmentUsage(ctx, EquipmentKindTool, "D1", "cycles"))
+	require.NoError(t, cc.ReturnEquipmentToService(ctx, EquipmentKindTool, "D1"))
+	usage, err = cc.GetEquipmentUsage(ctx, EquipmentKindTool, "D1")
+	require.NoError(t, err)
+	require.Equal(t, []*UsageCounter{{Counter: "torque", Total: 5, Deltas: 1}}, usage.Counters)
+	require.NoError(t, cc.CreateActivity(ctx, "MSN085", "ACT1", testStart, testEnd, 40, "", "D1", nil, "", "35"))
+}
+
+func TestChaincodeEvents(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN090", "A320", "neo", "Airline A"))
+	event := <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventAssetCreated, event.EventName)
+	var assetCreated AssetCreatedEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &assetCreated))
+	require.Equal(t, AssetCreatedEvent{ACNumber: "MSN090", Model: "A320", Variant: "neo", CustomerAirline: "Airline A", Station: "40", CreatedAt: assetCreated.CreatedAt}, assetCreated)
+	require.NotEmpty(t, assetCreated.CreatedAt)
+
+	require.NoError(t, cc.CreateActivity(ctx, "MSN090", "ACT1", testStart, testEnd, 40, "", "", nil, "", "35"))
+	event = <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventActivityCreated, event.EventName)
+	var created ActivityCreatedEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &created))
+	require.Equal(t, ActivityCreatedEvent{ACNumber: "MSN090", ActivityID: "ACT1", StationNumber: 40, StartTime: testStart, EndTime: testEnd, Parts: []PartRef{}}, created)
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RecordInspection(ctx, "MSN090", "40", "INS1", "", InspectionResultPass, nil, "sha256:abc"))
+	event = <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventInspectionRecorded, event.EventName)
+	var inspected InspectionRecordedEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &inspected))
+	require.Equal(t, "INS1", inspected.InspectionID)
+	require.Equal(t, InspectionResultPass, inspected.Result)
+	require.Equal(t, OEMMSP, inspected.InspectorMSP)
+
+	ctx.SetClientIdentity(oemWorker)
+	require.NoError(t, cc.TransferAsset(ctx, "MSN090", "35"))
+	event = <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventAssetTransferred, event.EventName)
+	var transferred AssetTransferredEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &transferred))
+	require.Equal(t, "40", transferred.FromStation)
+	require.Equal(t, "35", transferred.ToStation)
+
+	require.NoError(t, cc.RetireAsset(ctx, "MSN090"))
+	event = <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventAssetRetired, event.EventName)
+	var retired AssetRetiredEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &retired))
+	require.Equal(t, AssetRetiredEvent{ACNumber: "MSN090", Station: "35", RetiredAt: retired.RetiredAt}, retired)
+	require.NotEmpty(t, retired.RetiredAt)
+}
+
+func TestStateBasedEndorsement(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+
+	err := cc.SetStationEndorsement(ctx, "35", "Org1MSP", "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: unknown organization Org1MSP")
+	err = cc.SetStationEndorsement(ctx, "35", SupplierMSP, "Org1MSP")
+	require.EqualError(t, err, "INVALID_ARGUMENT: Org1MSP is not a QA organization")
+	require.NoError(t, cc.SetStationEndorsement(ctx, "35", SupplierMSP, AirlineMSP))
+
+	ctx.SetClientIdentity(airlineQA)
+	err = cc.SetStationEndorsement(ctx, "35", AirlineMSP, "")
+	require.EqualError(t, err, "FORBIDDEN: client from AirlineMSP is not authorized, only OEMMSP may perform this operation")
+	ctx.SetClientIdentity(oemWorker)
+
+	endorsingOrgs := func() []string {
+		policy, err := stub.GetStateValidationParameter("MSN100")
+		require.NoError(t, err)
+		ep, err := statebased.NewStateEP(policy)
+		require.NoError(t, err)
+		return ep.ListOrgs()
+	}
+
+	require.NoError(t, cc.CreateAsset(ctx, "MSN100", "A320", "neo", "Airline A"))
+	require.Equal(t, []string{OEMMSP}, endorsingOrgs())
+
+	require.NoError(t, cc.TransferAsset(ctx, "MSN100", "35"))
+	require.ElementsMatch(t, []string{SupplierMSP, AirlineMSP}, endorsingOrgs())
+}
+
+func TestNonConformanceWorkflow(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN110", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.RegisterPart(ctx, "D5381000", "SN1", "LOT-A", "Supplier A", "sha256:coc1"))
+	require.NoError(t, cc.ReceivePart(ctx, "D5381000", "SN1"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN110", "ACT1", testStart, testEnd, 40, "", "",
+		[]PartRef{{PartNumber: "D5381000", SerialNumber: "SN1"}}, "", "35"))
+
+	err := cc.RaiseNonConformance(ctx, "NCR1", "MSN110", "", "", "", "", NCRSeverityMajor, "scratch", "")
+	require.EqualError(t, err, "FORBIDDEN: client does not have the qa role")
+
+	ctx.SetClientIdentity(oemQA)
+	err = cc.RaiseNonConformance(ctx, "NCR1", "", "", "", "", "", NCRSeverityMajor, "scratch", "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: an NCR must be raised against an aircraft, an activity or a part")
+	err = cc.RaiseNonConformance(ctx, "NCR1", "MSN110", "", "", "", "", "CRITICAL", "scratch", "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: NCR severity must be MINOR or MAJOR")
+	err = cc.RaiseNonConformance(ctx, "NCR1", "MSN110", "40", "ACT9", "", "", NCRSeverityMajor, "scratch", "")
+	require.EqualError(t, err, "NOT_FOUND: activity ACT9 does not exist for aircraft MSN110 at station 40")
+
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR1", "", "", "", "D5381000", "SN1", NCRSeverityMajor, "bracket cracked", "Structures"))
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR2", "MSN110", "", "ACT1", "", "", NCRSeverityMinor, "paint run", "Paint shop"))
+	err = cc.RaiseNonConformance(ctx, "NCR2", "MSN110", "", "", "", "", NCRSeverityMinor, "paint run", "")
+	require.EqualError(t, err, "ALREADY_EXISTS: NCR NCR2 already exists")
+
+	ncr, err := cc.ReadNonConformance(ctx, "NCR1")
+	require.NoError(t, err)
+	require.Equal(t, "MSN110", ncr.ACNumber)
+	require.Equal(t, "40", ncr.Station)
+	require.Equal(t, "Supplier A", ncr.Supplier)
+	require.Equal(t, NCRStatusOpen, ncr.Status)
+
+	ncrs, err := cc.GetNonConformancesForAsset(ctx, "MSN110")
+	require.NoError(t, err)
+	require.Len(t, ncrs, 2)
+
+	ctx.SetClientIdentity(oemWorker)
+	err = cc.TransferAsset(ctx, "MSN110", "35")
+	require.EqualError(t, err, "NOT_CLEARED: major NCR NCR1 of aircraft MSN110 at station 40 is open")
+
+	ctx.SetClientIdentity(oemQA)
+	err = cc.CloseNonConformance(ctx, "NCR1", "sha256:evidence")
+	require.EqualError(t, err, "INVALID_ARGUMENT: NCR NCR1 cannot be closed before it is dispositioned")
+	err = cc.DispositionNonConformance(ctx, "NCR1", "REPAIR", "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: NCR disposition must be one of USE_AS_IS, REWORK, SCRAP or RETURN_TO_SUPPLIER")
+	require.NoError(t, cc.DispositionNonConformance(ctx, "NCR1", NCRDispositionRework, "Structures rework team"))
+	err = cc.CloseNonConformance(ctx, "NCR1", "sha256:evidence")
+	require.EqualError(t, err, "INVALID_ARGUMENT: NCR NCR1 cannot be closed before it is reworked")
+
+	ctx.SetClientIdentity(oemWorker)
+	err = cc.RecordReworkActivity(ctx, "NCR2", "RW1", testStart, testEnd, "", "", nil)
+	require.EqualError(t, err, "INVALID_ARGUMENT: NCR NCR2 does not have disposition REWORK")
+	require.NoError(t, cc.RecordReworkActivity(ctx, "NCR1", "RW1", "2024-03-08T08:00:00Z", "2024-03-08T09:00:00Z", "", "", nil))
+
+	activities, err := cc.GetActivitiesForStation(ctx, "MSN110", "40")
+	require.NoError(t, err)
+	require.Len(t, activities, 2)
+	require.Equal(t, "RW1", activities[1].ActivityID)
+	require.Equal(t, "NCR1", activities[1].ReworkOf)
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.CloseNonConformance(ctx, "NCR1", "sha256:evidence"))
+	ncr, err = cc.ReadNonConformance(ctx, "NCR1")
+	require.NoError(t, err)
+	require.Equal(t, NCRStatusClosed, ncr.Status)
+	require.Equal(t, []string{"RW1"}, ncr.ReworkActivities)
+	require.Equal(t, "Structures rework team", ncr.Owner)
+	err = cc.DispositionNonConformance(ctx, "NCR1", NCRDispositionScrap, "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: NCR NCR1 is already closed")
+
+	// the open minor NCR does not block the move
+	ctx.SetClientIdentity(oemWorker)
+	require.NoError(t, cc.TransferAsset(ctx, "MSN110", "35"))
+}
+
+func TestNonConformanceEarlierStation(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35", "30", "25"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN111", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.TransferAsset(ctx, "MSN111", "35"))
+
+	// a finding on work done at an earlier station blocks every later move until it is closed
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR1", "MSN111", "40", "", "", "", NCRSeverityMajor, "missing fastener", ""))
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR2", "MSN111", "25", "", "", "", NCRSeverityMajor, "harness routing", ""))
+
+	ctx.SetClientIdentity(oemWorker)
+	err := cc.TransferAsset(ctx, "MSN111", "30")
+	require.EqualError(t, err, "NOT_CLEARED: major NCR NCR1 of aircraft MSN111 at station 40 is open")
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.DispositionNonConformance(ctx, "NCR1", NCRDispositionUseAsIs, ""))
+	require.NoError(t, cc.CloseNonConformance(ctx, "NCR1", "sha256:evidence"))
+
+	// the open major NCR at a later station does not block the move
+	ctx.SetClientIdentity(oemWorker)
+	require.NoError(t, cc.TransferAsset(ctx, "MSN111", "30"))
+	require.NoError(t, cc.TransferAsset(ctx, "MSN111", "25"))
+}
+
+func TestNonConformancePartDisposition(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN112", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.RegisterPart(ctx, "D5381000", "SN1", "LOT-A", "Supplier A", "sha256:coc1"))
+	require.NoError(t, cc.RegisterPart(ctx, "D5381000", "SN2", "LOT-A", "Supplier A", "sha256:coc2"))
+	require.NoError(t, cc.ReceivePart(ctx, "D5381000", "SN1"))
+	require.NoError(t, cc.ReceivePart(ctx, "D5381000", "SN2"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN112", "ACT1", testStart, testEnd, 40, "", "",
+		[]PartRef{{PartNumber: "D5381000", SerialNumber: "SN1"}, {PartNumber: "D5381000", SerialNumber: "SN2"}}, "", "35"))
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR1", "", "", "", "D5381000", "SN1", NCRSeverityMajor, "bracket cracked", ""))
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR2", "", "", "", "D5381000", "SN2", NCRSeverityMinor, "wrong finish", ""))
+	require.NoError(t, cc.DispositionNonConformance(ctx, "NCR1", NCRDispositionScrap, ""))
+	require.NoError(t, cc.DispositionNonConformance(ctx, "NCR2", NCRDispositionReturnToSupplier, ""))
+
+	part, err := cc.ReadPart(ctx, "D5381000", "SN1")
+	require.NoError(t, err)
+	require.Equal(t, PartStateScrapped, part.State)
+	require.Empty(t, part.InstalledOn)
+	require.Empty(t, part.InstalledStation)
+	require.Empty(t, part.InstalledActivity)
+
+	part, err = cc.ReadPart(ctx, "D5381000", "SN2")
+	require.NoError(t, err)
+	require.Equal(t, PartStateAtSupplier, part.State)
+	require.Empty(t, part.InstalledOn)
+
+	used, err := cc.WhereUsed(ctx, "D5381000", "")
+	require.NoError(t, err)
+	require.Empty(t, used)
+
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR3", "", "", "", "D5381000", "SN1", NCRSeverityMinor, "found in stores", ""))
+	err = cc.DispositionNonConformance(ctx, "NCR3", NCRDispositionReturnToSupplier, "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: part D5381000/SN1 is scrapped")
+	err = cc.DispositionNonConformance(ctx, "NCR3", NCRDispositionScrap, "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: part D5381000/SN1 is already scrapped")
+
+	// a returned part can be shipped again and reinstalled
+	ctx.SetClientIdentity(oemWorker)
+	require.NoError(t, cc.ReceivePart(ctx, "D5381000", "SN2"))
+	err = cc.ReceivePart(ctx, "D5381000", "SN1")
+	require.EqualError(t, err, "INVALID_ARGUMENT: part D5381000/SN1 cannot be received in state SCRAPPED")
+}
+
+func TestDelivery(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	ctx.SetStub(&privateDataHashStub{stub})
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN115", "A320", "neo", "Airline A"))
+	<-stub.ChaincodeEventsChannel
+
+	terms := []byte(`{"acNumber":"MSN115","documents":{"airworthinessCertificate":"sha256:coa","weightAndBalance":"sha256:wb"}}`)
+	require.NoError(t, stub.SetTransient(map[string][]byte{deliveryTermsTransientKey: terms}))
+	err := cc.ProposeDelivery(ctx, "MSN115", AirlineMSP)
+	require.EqualError(t, err, "NOT_CLEARED: aircraft MSN115 is at station 40, not at the last station 35")
+	require.NoError(t, cc.TransferAsset(ctx, "MSN115", "35"))
+	<-stub.ChaincodeEventsChannel
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RecordInspection(ctx, "MSN115", "35", "INS1", "", InspectionResultFail, []string{"D01"}, "sha256:abc"))
+	<-stub.ChaincodeEventsChannel
+	err = cc.ProposeDelivery(ctx, "MSN115", AirlineMSP)
+	require.EqualError(t, err, "NOT_CLEARED: station 35 exit inspection of aircraft MSN115 has result FAIL")
+	require.NoError(t, cc.RaiseNonConformance(ctx, "NCR1", "MSN115", "35", "", "", "", NCRSeverityMinor, "paint run", ""))
+	stub.TxTimestamp.Seconds++
+	require.NoError(t, cc.RecordInspection(ctx, "MSN115", "35", "INS2", "", InspectionResultPass, nil, "sha256:def"))
+	<-stub.ChaincodeEventsChannel
+	err = cc.ProposeDelivery(ctx, "MSN115", AirlineMSP)
+	require.EqualError(t, err, "NOT_CLEARED: NCR NCR1 of aircraft MSN115 is open")
+	require.NoError(t, cc.DispositionNonConformance(ctx, "NCR1", NCRDispositionUseAsIs, ""))
+	require.NoError(t, cc.CloseNonConformance(ctx, "NCR1", "sha256:evidence"))
+
+	err = cc.ProposeDelivery(ctx, "MSN115", SupplierMSP)
+	require.EqualError(t, err, `INVALID_ARGUMENT: aircraft can only be delivered to the airline organization AirlineMSP, not "SupplierMSP"`)
+	err = cc.ProposeDelivery(ctx, "MSN115", OEMMSP)
+	require.EqualError(t, err, `INVALID_ARGUMENT: aircraft can only be delivered to the airline organization AirlineMSP, not "OEMMSP"`)
+	require.NoError(t, cc.ProposeDelivery(ctx, "MSN115", AirlineMSP))
+	err = cc.CompleteDelivery(ctx, "MSN115")
+	require.EqualError(t, err, "NOT_CLEARED: AirlineMSP has not agreed to the delivery of aircraft MSN115")
+
+	ctx.SetClientIdentity(oemWorker)
+	err = cc.AgreeToDelivery(ctx, "MSN115")
+	require.EqualError(t, err, "FORBIDDEN: client from OEMMSP is not authorized, only AirlineMSP may perform this operation")
+	ctx.SetClientIdentity(airlineQA)
+	t.Setenv("CORE_PEER_LOCALMSPID", AirlineMSP)
+	require.NoError(t, stub.SetTransient(map[string][]byte{
+		deliveryTermsTransientKey: []byte(`{"acNumber":"MSN115","documents":{"airworthinessCertificate":"sha256:other"}}`),
+	}))
+	require.NoError(t, cc.AgreeToDelivery(ctx, "MSN115"))
+
+	ctx.SetClientIdentity(oemQA)
+	t.Setenv("CORE_PEER_LOCALMSPID", OEMMSP)
+	require.NoError(t, stub.SetTransient(map[string][]byte{deliveryTermsTransientKey: terms}))
+	err = cc.CompleteDelivery(ctx, "MSN115")
+	require.ErrorContains(t, err, "does not match the terms AirlineMSP agreed to")
+
+	ctx.SetClientIdentity(airlineQA)
+	t.Setenv("CORE_PEER_LOCALMSPID", AirlineMSP)
+	require.NoError(t, cc.AgreeToDelivery(ctx, "MSN115"))
+	agreed, err := cc.ReadDeliveryTerms(ctx, "MSN115")
+	require.NoError(t, err)
+	require.Equal(t, string(terms), agreed)
+
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.CompleteDelivery(ctx, "MSN115"))
+	event := <-stub.ChaincodeEventsChannel
+	require.Equal(t, EventAircraftDelivered, event.EventName)
+
+	asset, err := cc.ReadAsset(ctx, "MSN115")
+	require.NoError(t, err)
+	require.Equal(t, AssetStatusDelivered, asset.Status)
+	require.Equal(t, AirlineMSP, asset.OwnerMSP)
+	delivery, err := cc.ReadDelivery(ctx, "MSN115")
+	require.NoError(t, err)
+	require.Equal(t, DeliveryStatusDelivered, delivery.Status)
+
+	policy, err := stub.GetStateValidationParameter("MSN115")
+	require.NoError(t, err)
+	ep, err := statebased.NewStateEP(policy)
+	require.NoError(t, err)
+	require.Equal(t, []string{AirlineMSP}, ep.ListOrgs())
+
+	require.EqualError(t, cc.RetireAsset(ctx, "MSN115"), "cannot retire aircraft MSN115 with status DELIVERED")
+}
+
+func TestDeliveryFindingsSameSecond(t *testing.T) {
+	ctx, stub := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN116", "A320", "neo", "Airline A"))
+	<-stub.ChaincodeEventsChannel
+
+	// Both inspections share the transaction timestamp, and the failed one sorts last by ID, so only the
+	// sequence number shows that the pass came after it
+	ctx.SetClientIdentity(oemQA)
+	require.NoError(t, cc.RecordInspection(ctx, "MSN116", "40", "INS9", "", InspectionResultFail, []string{"D01"}, "sha256:abc"))
+	<-stub.ChaincodeEventsChannel
+	require.EqualError(t, cc.assertNoOpenFindings(ctx, "MSN116"), "NOT_CLEARED: inspection INS9 of aircraft MSN116 at station 40 has result FAIL")
+	require.NoError(t, cc.RecordInspection(ctx, "MSN116", "40", "INS1", "", InspectionResultPass, nil, "sha256:def"))
+	<-stub.ChaincodeEventsChannel
+	require.NoError(t, cc.assertNoOpenFindings(ctx, "MSN116"))
+}
+
+func TestCycleTimeAnalytics(t *testing.T) {
+	ctx, _ := newTestContext(t, oemWorker)
+	cc := new(SmartContract)
+	require.NoError(t, cc.SetRouting(ctx, []string{"40", "35", "30"}))
+	require.NoError(t, cc.CreateAsset(ctx, "MSN120", "A320", "neo", "Airline A"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN120", "ACT1", "2024-03-07T08:00:00Z", "2024-03-07T09:30:00Z", 40, "", "", nil, "", "35"))
+	require.NoError(t, cc.CreateActivity(ctx, "MSN120", "ACT2", "2024-03-07T09:00:00Z", "2024-03-07T10:00:00Z", 40, "", "", nil, "", "35"))
+	// Times given with an offset are stored in UTC, so that they compare with the others as text
+	require.NoError(t, cc.CreateActivity(ctx, "MSN120", "ACT3", "2024-03-07T13:00:00+02:00", "2024-03-07T14:00:00+02:00", 35, "", "", nil, "40", "30"))
+
+	cycle, err := cc.GetAircraftCycleTimes(ctx, "MSN120")
+	require.NoError(t, err)
+	require.Len(t, cycle.Stations, 2)
+	require.Equal(t, &StationVisit{ACNumber: "MSN120", Station: "40", FirstStart: "2024-03-07T08:00:00Z", LastEnd: "2024-03-07T10:00:00Z",
+		CycleMinutes: 120, WorkMinutes: 150, ActivityCount: 2}, cycle.Stations[0])
+	require.Equal(t, float64(60), cycle.Stations[1].QueueMinutes)
+	require.Equal(t, float64(240), cycle.LeadMinutes)
+	require.Equal(t, float64(210), cycle.WorkMinutes)
+	require.Equal(t, float64(60), cycle.QueueMinutes)
+
+	activities, err := cc.GetActivitiesForAsset(ctx, "MSN120")
+	require.NoError(t, err)
+	require.Equal(t, "ACT3", activities[0].ActivityID)
+	require.Equal(t, "2024-03-07T11:00:00Z", activities[0].StartTime)
+	require.Equal(t, "2024-03-07T12:00:00Z", activities[0].EndTime)
+	busy, err := utilization("W1", "2024-03-07T09:00:00Z", "2024-03-07T11:30:00Z", activities)
+	require.NoError(t, err)
+	require.Equal(t, float64(150), busy.PeriodMinutes)
+	// ACT1 and ACT2 overlap from 09:00 to 09:30, which counts once
+	require.Equal(t, float64(90), busy.BusyMinutes)
+	require.Equal(t, 3, busy.ActivityCount)
+	require.InDelta(t, 0.6, busy.Utilization, 1e-9)
+
+	// the same work recorded twice cannot make a worker more than fully busy
+	busy, err = utilization("W1", "2024-03-07T08:00:00Z", "2024-03-07T10:00:00Z", append(activities, activities...))
+	require.NoError(t, err)
+	require.Equal(t, float64(120), busy.BusyMinutes)
+	require.Equal(t, float64(1), busy.Utilization)
+
+	_, err = cc.GetStationCycleTimes(ctx, 40, "2024-03-08T00:00:00Z", "2024-03-07T00:00:00Z", 10, "")
+	require.EqualError(t, err, "INVALID_TIMESTAMP: to 2024-03-07T00:00:00Z must be after from 2024-03-08T00:00:00Z")
+	_, err = cc.GetMachineUtilization(ctx, "M1", "", "2024-03-07T00:00:00Z", 10, "")
+	require.EqualError(t, err, "INVALID_ARGUMENT: from and to must both be given")
+
+	from, to, err := validateDateRange("2024-03-07T10:00:00+02:00", "2024-03-07T05:00:00-05:00")
+	require.NoError(t, err)
+	require.Equal(t, "2024-03-07T08:00:00Z", from)
+	require.Equal(t, "2024-03-07T10:00:00Z", to)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Parts are serialized items stored under the composite key part~partNumber~serialNumber.
+A part is registered at the supplier, received by the OEM and installed on an
+aircraft by the activity that references it:
+
+	AT_SUPPLIER --ReceivePart--> AT_OEM --CreateActivity--> INSTALLED
+	                               ^                            |
+	                               +--------RemovePart----------+
+
+The material review of an NCR raised against a part can also send it back to
+AT_SUPPLIER with a RETURN_TO_SUPPLIER disposition, or end its life as SCRAPPED
+with a SCRAP disposition, from any state. Either way the part is no longer
+installed on an aircraft.
+
+The index partLot~partNumber~batchLot~serialNumber lets WhereUsed answer recall
+questions such as "which aircraft contain lot X of P/N Y" with a range query.
+A scrapped part is dropped from the index.
+*/
+
+const (
+	partDocType  = "part"
+	partLotIndex = "partLot"
+
+	PartStateAtSupplier = "AT_SUPPLIER"
+	PartStateAtOEM      = "AT_OEM"
+	PartStateInstalled  = "INSTALLED"
+	PartStateScrapped   = "SCRAPPED"
+)
+
+// Part is a serialized part that can be installed on an aircraft
+type Part struct {
+	DocType           string `json:"docType"`
+	PartNumber        string `json:"partNumber"`   // P/N
+	SerialNumber      string `json:"serialNumber"` // S/N
+	BatchLot          string `json:"batchLot"`
+	Supplier          string `json:"supplier"`
+	CoCHash           string `json:"cocHash"` // Hash of the certificate of conformity
+	State             string `json:"state"`   // One of the PartState* values
+	InstalledOn       string `json:"installedOn"`
+	InstalledStation  string `json:"installedStation"`
+	InstalledActivity string `json:"installedActivity"`
+	CreatedAt         string `json:"createdAt"`
+	UpdatedAt         string `json:"updatedAt"`
+}
+
+// PartRef identifies a serialized part referenced by an activity
+type PartRef struct {
+	PartNumber   string `json:"partNumber"`
+	SerialNumber string `json:"serialNumber"`
+}
+
+// PartHistoryRecord is one entry of the history of a part
+type PartHistoryRecord struct {
+	Record    *Part     `json:"record"`
+	TxId      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// RegisterPart registers a part produced by a supplier. Only supplier and OEM clients may register parts.
+func (s *SmartContract) RegisterPart(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string, batchLot string, supplier string, cocHash string) error {
+	if err := assertMSP(ctx, SupplierMSP, OEMMSP); err != nil {
+		return err
+	}
+	if partNumber == "" || serialNumber == "" {
+		return newContractError(ErrInvalidArgument, "part number and serial number must not be empty")
+	}
+	if cocHash == "" {
+		return newContractError(ErrInvalidArgument, "certificate of conformity hash must not be empty")
+	}
+
+	key, err := partKey(ctx, partNumber, serialNumber)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read part %s/%s: %v", partNumber, serialNumber, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "part %s/%s already exists", partNumber, serialNumber)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	part := Part{
+		DocType:      partDocType,
+		PartNumber:   partNumber,
+		SerialNumber: serialNumber,
+		BatchLot:     batchLot,
+		Supplier:     supplier,
+		CoCHash:      cocHash,
+		State:        PartStateAtSupplier,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := putPart(ctx, &part); err != nil {
+		return err
+	}
+
+	//  Save the lot index entry. Only the key is needed, so the value is a null character, as a nil value would delete the key.
+	lotKey, err := ctx.GetStub().CreateCompositeKey(partLotIndex, []string{partNumber, batchLot, serialNumber})
+	if err != nil {
+		return fmt.Errorf("failed to create part lot key: %v", err)
+	}
+	return ctx.GetStub().PutState(lotKey, []byte{0x00})
+}
+
+// ReceivePart records the goods receipt of a part at the OEM. Only OEM clients may receive parts.
+func (s *SmartContract) ReceivePart(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	part, err := s.ReadPart(ctx, partNumber, serialNumber)
+	if err != nil {
+		return err
+	}
+	if part.State != PartStateAtSupplier {
+		return newContractError(ErrInvalidArgument, "part %s/%s cannot be received in state %s", partNumber, serialNumber, part.State)
+	}
+
+	return updatePart(ctx, part, PartStateAtOEM, "", "", "")
+}
+
+// RemovePart takes an installed part off its aircraft and back into OEM stock. Only OEM clients may remove parts.
+func (s *SmartContract) RemovePart(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	part, err := s.ReadPart(ctx, partNumber, serialNumber)
+	if err != nil {
+		return err
+	}
+	if part.State != PartStateInstalled {
+		return newContractError(ErrInvalidArgument, "part %s/%s is not installed", partNumber, serialNumber)
+	}
+
+	return updatePart(ctx, part, PartStateAtOEM, "", "", "")
+}
+
+// scrapPart takes a part out of service for good, following a SCRAP disposition of an NCR raised against it
+func (s *SmartContract) scrapPart(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) error {
+	part, err := s.ReadPart(ctx, partNumber, serialNumber)
+	if err != nil {
+		return err
+	}
+	if part.State == PartStateScrapped {
+		return newContractError(ErrInvalidArgument, "part %s/%s is already scrapped", partNumber, serialNumber)
+	}
+	if err := updatePart(ctx, part, PartStateScrapped, "", "", ""); err != nil {
+		return err
+	}
+
+	lotKey, err := ctx.GetStub().CreateCompositeKey(partLotIndex, []string{partNumber, part.BatchLot, serialNumber})
+	if err != nil {
+		return fmt.Errorf("failed to create part lot key: %v", err)
+	}
+	return ctx.GetStub().DelState(lotKey)
+}
+
+// returnPart sends a part back to its supplier, following a RETURN_TO_SUPPLIER disposition of an NCR raised against it
+func (s *SmartContract) returnPart(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) error {
+	part, err := s.ReadPart(ctx, partNumber, serialNumber)
+	if err != nil {
+		return err
+	}
+	if part.State == PartStateScrapped {
+		return newContractError(ErrInvalidArgument, "part %s/%s is scrapped", partNumber, serialNumber)
+	}
+
+	return updatePart(ctx, part, PartStateAtSupplier, "", "", "")
+}
+
+// ReadPart returns a single part
+func (s *SmartContract) ReadPart(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) (*Part, error) {
+	key, err := partKey(ctx, partNumber, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	partJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read part %s/%s: %v", partNumber, serialNumber, err)
+	}
+	if partJSON == nil {
+		return nil, newContractError(ErrNotFound, "part %s/%s does not exist", partNumber, serialNumber)
+	}
+
+	var part Part
+	if err := json.Unmarshal(partJSON, &part); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal part %s/%s: %v", partNumber, serialNumber, err)
+	}
+
+	return &part, nil
+}
+
+// GetPartHistory returns every state a part has been in, from registration at the supplier onwards
+func (s *SmartContract) GetPartHistory(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) ([]PartHistoryRecord, error) {
+	log.Printf("GetPartHistory: P/N %v S/N %v", partNumber, serialNumber)
+
+	key, err := partKey(ctx, partNumber, serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []PartHistoryRecord{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		part := Part{PartNumber: partNumber, SerialNumber: serialNumber}
+		if len(response.Value) > 0 {
+			if err := json.Unmarshal(response.Value, &part); err != nil {
+				return nil, err
+			}
+		}
+
+		records = append(records, PartHistoryRecord{
+			Record:    &part,
+			TxId:      response.TxId,
+			Timestamp: response.Timestamp.AsTime(),
+			IsDelete:  response.IsDelete,
+		})
+	}
+
+	return records, nil
+}
+
+// WhereUsed returns the parts of a part number, optionally restricted to one batch/lot, that are currently installed,
+// together with the aircraft they are installed on
+func (s *SmartContract) WhereUsed(ctx contractapi.TransactionContextInterface, partNumber string, batchLot string) ([]*Part, error) {
+	attributes := []string{partNumber}
+	if batchLot != "" {
+		attributes = append(attributes, batchLot)
+	}
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(partLotIndex, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	parts := []*Part{}
+	for resultsIterator.HasNext() {
+		responseRange, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(responseRange.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(compositeKeyParts) < 3 {
+			continue
+		}
+
+		part, err := s.ReadPart(ctx, compositeKeyParts[0], compositeKeyParts[2])
+		if err != nil {
+			return nil, err
+		}
+		if part.State == PartStateInstalled {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts, nil
+}
+
+// installParts marks the parts referenced by an activity as installed on the aircraft
+func (s *SmartContract) installParts(ctx contractapi.TransactionContextInterface, parts []PartRef, acNumber string, station string, activityID string) error {
+	// reads do not see the writes of the same transaction, so a part listed twice would pass the state check twice
+	seen := make(map[PartRef]bool, len(parts))
+	for _, ref := range parts {
+		if seen[ref] {
+			return newContractError(ErrInvalidArgument, "part %s/%s is listed more than once", ref.PartNumber, ref.SerialNumber)
+		}
+		seen[ref] = true
+	}
+
+	for _, ref := range parts {
+		part, err := s.ReadPart(ctx, ref.PartNumber, ref.SerialNumber)
+		if err != nil {
+			return err
+		}
+		if part.State != PartStateAtOEM {
+			return newContractError(ErrInvalidArgument, "part %s/%s cannot be installed in state %s", ref.PartNumber, ref.SerialNumber, part.State)
+		}
+		if err := updatePart(ctx, part, PartStateInstalled, acNumber, station, activityID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePart moves a part to a new state and records where it is installed, if anywhere
+func updatePart(ctx contractapi.TransactionContextInterface, part *Part, state string, acNumber string, station string, activityID string) error {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	part.State = state
+	part.InstalledOn = acNumber
+	part.InstalledStation = station
+	part.InstalledActivity = activityID
+	part.UpdatedAt = now
+
+	return putPart(ctx, part)
+}
+
+// partKey builds the composite key a part is stored under
+func partKey(ctx contractapi.TransactionContextInterface, partNumber string, serialNumber string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(partDocType, []string{partNumber, serialNumber})
+	if err != nil {
+		return "", fmt.Errorf("failed to create part key: %v", err)
+	}
+	return key, nil
+}
+
+// putPart writes a part to world state
+func putPart(ctx contractapi.TransactionContextInterface, part *Part) error {
+	key, err := partKey(ctx, part.PartNumber, part.SerialNumber)
+	if err != nil {
+		return err
+	}
+	partJSON, err := json.Marshal(part)
+	if err != nil {
+		return fmt.Errorf("failed to marshal part: %v", err)
+	}
+	return ctx.GetStub().PutState(key, partJSON)
+}
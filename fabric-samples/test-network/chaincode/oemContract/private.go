@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Personal and commercial data is kept in the private data collections declared
+in collections_config.json, following the asset-transfer-private-data sample:
+
+  - OEMPrivateCollection holds the worker registry and the worker identities
+    behind each activity, and is only disseminated to OEM peers.
+  - OEMSupplierCollection holds the commercial terms agreed with suppliers for a
+    part number and is disseminated to OEM and supplier peers.
+
+The private values are passed in the transient map, so that they never appear in
+the transaction proposal, and only their hashes reach the channel ledger. Deploy
+the chaincode with
+
+	./network.sh deployCC -ccn oemChaincode -ccp ./chaincode/oemContract/ -ccl go -cccg ./chaincode/oemContract/collections_config.json
+*/
+
+const (
+	oemCollection         = "OEMPrivateCollection"
+	oemSupplierCollection = "OEMSupplierCollection"
+
+	activityWorkerTransientKey = "activity_worker"
+	partTermsTransientKey      = "part_terms"
+
+	partTermsObjectType = "partTerms"
+)
+
+// ActivityPrivateDetails holds the identities of the staff behind an activity. It is visible to the OEM only.
+type ActivityPrivateDetails struct {
+	ACNumber           string `json:"acNumber"`
+	Station            string `json:"station"`
+	ActivityID         string `json:"activityID"`
+	WorkerID           string `json:"workerID"`
+	StationResponsible string `json:"stationResponsible"`
+	StartTime          string `json:"startTime"` // Copied from the activity, so that worker queries can select a date range
+	EndTime            string `json:"endTime"`
+	Salt               string `json:"salt"` // Random value chosen by the client, so the public hash cannot be matched against guessed worker IDs
+}
+
+// PartTerms holds the commercial terms agreed with a supplier for a part number
+type PartTerms struct {
+	PartNumber  string `json:"partNumber"`
+	Supplier    string `json:"supplier"`
+	UnitPrice   string `json:"unitPrice"` // Decimal string, to avoid floating point rounding differences between endorsers
+	Currency    string `json:"currency"`
+	ContractRef string `json:"contractRef"`
+}
+
+// ReadActivityPrivateDetails returns the worker identities behind an activity. Only OEM clients may read them, from an OEM peer.
+func (s *SmartContract) ReadActivityPrivateDetails(ctx contractapi.TransactionContextInterface, acNumber string, station string, activityID string) (*ActivityPrivateDetails, error) {
+	if err := assertOEM(ctx); err != nil {
+		return nil, err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := activityKey(ctx, acNumber, station, activityID)
+	if err != nil {
+		return nil, err
+	}
+	detailsJSON, err := ctx.GetStub().GetPrivateData(oemCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activity private details: %v", err)
+	}
+	if detailsJSON == nil {
+		return nil, newContractError(ErrNotFound, "no private details for activity %s of aircraft %s at station %s", activityID, acNumber, station)
+	}
+
+	var details ActivityPrivateDetails
+	if err := json.Unmarshal(detailsJSON, &details); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal activity private details: %v", err)
+	}
+
+	return &details, nil
+}
+
+// SetPartTerms stores the commercial terms for a part number, passed in the transient map under "part_terms".
+// Only OEM and supplier clients may set them, from a peer of their own organization.
+func (s *SmartContract) SetPartTerms(ctx contractapi.TransactionContextInterface) error {
+	if err := assertMSP(ctx, OEMMSP, SupplierMSP); err != nil {
+		return err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return err
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+	termsJSON, ok := transientMap[partTermsTransientKey]
+	if !ok {
+		return newContractError(ErrInvalidArgument, "%s not found in the transient map input", partTermsTransientKey)
+	}
+
+	var terms PartTerms
+	if err := json.Unmarshal(termsJSON, &terms); err != nil {
+		return newContractError(ErrInvalidArgument, "failed to unmarshal part terms: %v", err)
+	}
+	if terms.PartNumber == "" {
+		return newContractError(ErrInvalidArgument, "partNumber field must be a non-empty string")
+	}
+	if terms.Supplier == "" {
+		return newContractError(ErrInvalidArgument, "supplier field must be a non-empty string")
+	}
+
+	termsJSON, err = json.Marshal(terms)
+	if err != nil {
+		return fmt.Errorf("failed to marshal part terms: %v", err)
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(partTermsObjectType, []string{terms.PartNumber})
+	if err != nil {
+		return fmt.Errorf("failed to create part terms key: %v", err)
+	}
+
+	return ctx.GetStub().PutPrivateData(oemSupplierCollection, key, termsJSON)
+}
+
+// ReadPartTerms returns the commercial terms for a part number. Only OEM and supplier clients may read them, from a peer of their own organization.
+func (s *SmartContract) ReadPartTerms(ctx contractapi.TransactionContextInterface, partNumber string) (*PartTerms, error) {
+	if err := assertMSP(ctx, OEMMSP, SupplierMSP); err != nil {
+		return nil, err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(partTermsObjectType, []string{partNumber})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create part terms key: %v", err)
+	}
+	termsJSON, err := ctx.GetStub().GetPrivateData(oemSupplierCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read part terms: %v", err)
+	}
+	if termsJSON == nil {
+		return nil, newContractError(ErrNotFound, "no terms for part %s", partNumber)
+	}
+
+	var terms PartTerms
+	if err := json.Unmarshal(termsJSON, &terms); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal part terms: %v", err)
+	}
+
+	return &terms, nil
+}
+
+// readActivityWorker reads the worker identities of a new activity from the transient map. The worker must be the one
+// the invoking client is enrolled as.
+func readActivityWorker(ctx contractapi.TransactionContextInterface) (*ActivityPrivateDetails, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+	workerJSON, ok := transientMap[activityWorkerTransientKey]
+	if !ok {
+		return nil, newContractError(ErrInvalidArgument, "%s not found in the transient map input", activityWorkerTransientKey)
+	}
+
+	var details ActivityPrivateDetails
+	if err := json.Unmarshal(workerJSON, &details); err != nil {
+		return nil, newContractError(ErrInvalidArgument, "failed to unmarshal activity worker: %v", err)
+	}
+	if details.WorkerID == "" {
+		return nil, newContractError(ErrInvalidArgument, "workerID field must be a non-empty string")
+	}
+	if details.Salt == "" {
+		return nil, newContractError(ErrInvalidArgument, "salt field must be a non-empty string")
+	}
+	if err := assertWorkerID(ctx, details.WorkerID); err != nil {
+		return nil, err
+	}
+
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// putActivityPrivateDetails stores the worker identities of a new activity in the OEM collection and returns the
+// hex encoded hash of the stored value, which is what the channel ledger sees
+func putActivityPrivateDetails(ctx contractapi.TransactionContextInterface, key string, details *ActivityPrivateDetails, acNumber string, station string, activityID string, startTime string, endTime string) (string, error) {
+	details.ACNumber = acNumber
+	details.Station = station
+	details.ActivityID = activityID
+	details.StartTime = startTime
+	details.EndTime = endTime
+
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal activity private details: %v", err)
+	}
+	if err := ctx.GetStub().PutPrivateData(oemCollection, key, detailsJSON); err != nil {
+		return "", fmt.Errorf("failed to put activity private details: %v", err)
+	}
+
+	hash := sha256.Sum256(detailsJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// staffRef returns the hash of the invoking client's identity. It is recorded on public records instead of the
+// identity itself, so that other organizations cannot read OEM staff identities, while the OEM can still match it
+// against its own staff.
+func staffRef(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientID, err := submittingClientID(ctx)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(clientID))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// verifyClientOrgMatchesPeerOrg checks that the client submits to a peer of its own organization, so that a
+// client from another organization cannot read or write private data through this peer
+func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface) error {
+	clientMSPID, err := clientMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	peerMSPID, err := shim.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the peer's MSPID: %v", err)
+	}
+
+	if clientMSPID != peerMSPID {
+		return newContractError(ErrForbidden, "client from org %s is not authorized to read or write private data from an org %s peer", clientMSPID, peerMSPID)
+	}
+
+	return nil
+}
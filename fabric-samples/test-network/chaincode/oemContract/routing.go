@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const routingKey = "routing"
+
+// Routing is the ordered list of stations an aircraft goes through on the assembly line
+type Routing struct {
+	Stations []string `json:"stations"`
+}
+
+// SetRouting configures the station sequence that TransferAsset enforces. Only the OEM may change the routing.
+func (s *SmartContract) SetRouting(ctx contractapi.TransactionContextInterface, stations []string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if len(stations) < 2 {
+		return fmt.Errorf("a routing needs at least two stations")
+	}
+	seen := make(map[string]bool, len(stations))
+	for _, station := range stations {
+		if station == "" {
+			return fmt.Errorf("station names in the routing must not be empty")
+		}
+		if seen[station] {
+			return fmt.Errorf("station %s appears more than once in the routing", station)
+		}
+		seen[station] = true
+	}
+
+	routingJSON, err := json.Marshal(Routing{Stations: stations})
+	if err != nil {
+		return fmt.Errorf("failed to marshal routing: %v", err)
+	}
+
+	return ctx.GetStub().PutState(routingKey, routingJSON)
+}
+
+// GetRouting returns the configured station sequence
+func (s *SmartContract) GetRouting(ctx contractapi.TransactionContextInterface) (*Routing, error) {
+	routingJSON, err := ctx.GetStub().GetState(routingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing: %v", err)
+	}
+	if routingJSON == nil {
+		return nil, fmt.Errorf("no routing has been configured")
+	}
+
+	var routing Routing
+	if err := json.Unmarshal(routingJSON, &routing); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal routing: %v", err)
+	}
+
+	return &routing, nil
+}
+
+// stationAfter returns the station that follows the given one in the routing
+func (r *Routing) stationAfter(station string) (string, error) {
+	for i, s := range r.Stations {
+		if s != station {
+			continue
+		}
+		if i == len(r.Stations)-1 {
+			return "", fmt.Errorf("station %s is the last station in the routing", station)
+		}
+		return r.Stations[i+1], nil
+	}
+	return "", fmt.Errorf("station %s is not part of the routing", station)
+}
+
+// contains returns true when the station is part of the routing
+func (r *Routing) contains(station string) bool {
+	for _, s := range r.Stations {
+		if s == station {
+			return true
+		}
+	}
+	return false
+}
+
+// validateActivityStations checks that the activity's station and, when given, its previous and next stations are part of the routing
+func (r *Routing) validateActivityStations(stationNumber int, previousStation string, nextStation string) error {
+	if station := strconv.Itoa(stationNumber); !r.contains(station) {
+		return newContractError(ErrNotFound, "station %s is not part of the routing", station)
+	}
+	if previousStation != "" && !r.contains(previousStation) {
+		return newContractError(ErrNotFound, "previous station %s is not part of the routing", previousStation)
+	}
+	if nextStation != "" && !r.contains(nextStation) {
+		return newContractError(ErrNotFound, "next station %s is not part of the routing", nextStation)
+	}
+	return nil
+}
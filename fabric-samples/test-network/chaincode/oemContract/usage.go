@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Machine and tool telemetry, such as drill cycles or torque counts, is recorded with
+the delta technique of the high-throughput sample. Every reading is written as its
+own key usage~kind~equipmentID~counter~delta~txID with an empty value, and no key is
+read or updated in place, so any number of stations can log usage of the same item
+in the same block without MVCC conflicts.
+
+A counter's value is the sum of its deltas. PruneEquipmentUsage replaces the deltas
+of an item with a single row per counter, and grounds the item when a counter has
+reached the maintenance limit set with SetEquipmentUsageLimit. Pruning reads the
+whole range of deltas, so it fails phantom read validation if usage is recorded in
+the same block, and should be run periodically rather than after every reading.
+*/
+
+const usageDeltaIndex = "usage"
+
+// UsageCounter is the aggregated value of one usage counter of a machine or tool
+type UsageCounter struct {
+	Counter      string `json:"counter"`
+	Total        int64  `json:"total"`
+	Limit        int64  `json:"limit,omitempty"` // Maintenance limit, zero when none is set
+	LimitReached bool   `json:"limitReached"`
+	Deltas       int    `json:"deltas"` // Number of delta rows summed, a hint for when to prune
+}
+
+// EquipmentUsage holds the usage counters of a machine or tool
+type EquipmentUsage struct {
+	Kind        string          `json:"kind"`
+	EquipmentID string          `json:"equipmentID"`
+	Counters    []*UsageCounter `json:"counters"`
+}
+
+// RecordEquipmentUsage adds a usage delta, e.g. 12 drill cycles, to a counter of a registered machine or tool.
+// It only writes a new delta row, so concurrent readings of the same counter do not conflict.
+func (s *SmartContract) RecordEquipmentUsage(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, counter string, delta int64) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if counter == "" {
+		return newContractError(ErrInvalidArgument, "usage counter must not be empty")
+	}
+	if delta <= 0 {
+		return newContractError(ErrInvalidArgument, "usage delta must be positive, got %d", delta)
+	}
+	// the equipment record only changes on calibration or grounding, so reading it does not make readings conflict
+	if _, err := s.ReadEquipment(ctx, kind, equipmentID); err != nil {
+		return err
+	}
+
+	return putUsageDelta(ctx, kind, equipmentID, counter, delta)
+}
+
+// GetEquipmentUsage returns the usage counters of a machine or tool, summed over their deltas
+func (s *SmartContract) GetEquipmentUsage(ctx contractapi.TransactionContextInterface, kind string, equipmentID string) (*EquipmentUsage, error) {
+	equipment, err := s.ReadEquipment(ctx, kind, equipmentID)
+	if err != nil {
+		return nil, err
+	}
+	counters, _, err := aggregateUsage(ctx, equipment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EquipmentUsage{Kind: kind, EquipmentID: equipmentID, Counters: counters}, nil
+}
+
+// SetEquipmentUsageLimit sets the value of a usage counter at which a machine or tool is due for maintenance.
+// A limit of zero removes it. Only the OEM may set limits.
+func (s *SmartContract) SetEquipmentUsageLimit(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, counter string, limit int64) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if counter == "" {
+		return newContractError(ErrInvalidArgument, "usage counter must not be empty")
+	}
+	if limit < 0 {
+		return newContractError(ErrInvalidArgument, "usage limit must not be negative, got %d", limit)
+	}
+	equipment, err := s.ReadEquipment(ctx, kind, equipmentID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if limit == 0 {
+		delete(equipment.UsageLimits, counter)
+	} else {
+		if equipment.UsageLimits == nil {
+			equipment.UsageLimits = map[string]int64{}
+		}
+		equipment.UsageLimits[counter] = limit
+	}
+	equipment.UpdatedAt = now
+
+	return putEquipment(ctx, equipment)
+}
+
+// PruneEquipmentUsage replaces the usage deltas of a machine or tool with one row per counter holding its total.
+// If a counter has reached its limit, the item is grounded for maintenance and an EquipmentMaintenanceDue event is emitted.
+// Only the OEM may prune usage.
+func (s *SmartContract) PruneEquipmentUsage(ctx contractapi.TransactionContextInterface, kind string, equipmentID string) (*EquipmentUsage, error) {
+	if err := assertOEM(ctx); err != nil {
+		return nil, err
+	}
+	equipment, err := s.ReadEquipment(ctx, kind, equipmentID)
+	if err != nil {
+		return nil, err
+	}
+	counters, deltaKeys, err := aggregateUsage(ctx, equipment)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range deltaKeys {
+		if err := ctx.GetStub().DelState(key); err != nil {
+			return nil, fmt.Errorf("failed to delete usage delta: %v", err)
+		}
+	}
+	due := []*UsageCounter{}
+	for _, counter := range counters {
+		if err := putUsageDelta(ctx, kind, equipmentID, counter.Counter, counter.Total); err != nil {
+			return nil, err
+		}
+		counter.Deltas = 1
+		if counter.LimitReached {
+			due = append(due, counter)
+		}
+	}
+	usage := &EquipmentUsage{Kind: kind, EquipmentID: equipmentID, Counters: counters}
+
+	if len(due) == 0 || equipment.Status != EquipmentStatusInService {
+		return usage, nil
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	equipment.Status = EquipmentStatusGrounded
+	equipment.StatusReason = fmt.Sprintf("maintenance due: %s reached %d of limit %d", due[0].Counter, due[0].Total, due[0].Limit)
+	equipment.UpdatedAt = now
+	if err := putEquipment(ctx, equipment); err != nil {
+		return nil, err
+	}
+
+	return usage, setEvent(ctx, EventEquipmentMaintenanceDue, EquipmentMaintenanceDueEvent{
+		Kind:        kind,
+		EquipmentID: equipmentID,
+		Counters:    due,
+		GroundedAt:  now,
+	})
+}
+
+// ResetEquipmentUsage deletes every delta of a usage counter, typically after the maintenance it triggered.
+// Only the OEM may reset usage.
+func (s *SmartContract) ResetEquipmentUsage(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, counter string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if counter == "" {
+		return newContractError(ErrInvalidArgument, "usage counter must not be empty")
+	}
+	if _, err := s.ReadEquipment(ctx, kind, equipmentID); err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(usageDeltaIndex, []string{kind, equipmentID, counter})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if err := ctx.GetStub().DelState(queryResult.Key); err != nil {
+			return fmt.Errorf("failed to delete usage delta: %v", err)
+		}
+	}
+	return nil
+}
+
+// aggregateUsage sums the deltas of every usage counter of an item, in counter order, and returns the delta keys read
+func aggregateUsage(ctx contractapi.TransactionContextInterface, equipment *Equipment) ([]*UsageCounter, []string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(usageDeltaIndex, []string{equipment.Kind, equipment.EquipmentID})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultsIterator.Close()
+
+	counters := []*UsageCounter{}
+	keys := []string{}
+	var current *UsageCounter
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(keyParts) != 5 {
+			return nil, nil, fmt.Errorf("invalid usage delta key %q", queryResult.Key)
+		}
+		delta, err := strconv.ParseInt(keyParts[3], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid usage delta %q: %v", keyParts[3], err)
+		}
+
+		// keys sort by counter, so all deltas of a counter are adjacent
+		if current == nil || current.Counter != keyParts[2] {
+			current = &UsageCounter{Counter: keyParts[2]}
+			counters = append(counters, current)
+		}
+		current.Total += delta
+		current.Deltas++
+		keys = append(keys, queryResult.Key)
+	}
+
+	for _, counter := range counters {
+		counter.Limit = equipment.UsageLimits[counter.Counter]
+		counter.LimitReached = counter.Limit > 0 && counter.Total >= counter.Limit
+	}
+	return counters, keys, nil
+}
+
+// putUsageDelta writes a usage delta row, keyed by the transaction ID so that every transaction writes a distinct key
+func putUsageDelta(ctx contractapi.TransactionContextInterface, kind string, equipmentID string, counter string, delta int64) error {
+	key, err := ctx.GetStub().CreateCompositeKey(usageDeltaIndex, []string{kind, equipmentID, counter, strconv.FormatInt(delta, 10), ctx.GetStub().GetTxID()})
+	if err != nil {
+		return fmt.Errorf("failed to create usage delta key: %v", err)
+	}
+	return ctx.GetStub().PutState(key, []byte{0x00})
+}
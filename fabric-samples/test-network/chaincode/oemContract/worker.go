@@ -0,0 +1,470 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Workers are registered in the OEM private data collection under worker~workerID,
+with their skills and the certifications they hold, each with an expiry date.
+Like the activity worker identities, worker records are passed in the transient
+map and never reach the channel ledger.
+
+A work package plans the activities to perform on an aircraft at a station. It is
+stored on the channel ledger under workPackage~workPackageID and lists, for each
+activity type, the certifications a worker needs. Every planned activity is also
+indexed under workPackageActivity~acNumber~station~activityID~workPackageID.
+
+CreateActivity only accepts a worker and station responsible that are registered.
+When the activity is planned in a work package, the worker must also hold every
+certification its activity type requires, valid until the end of the activity.
+An activity that is not planned, such as a rework activity, needs the
+certifications the OEM set with SetUnplannedActivityRequirement, and is refused
+until that requirement has been set.
+*/
+
+const (
+	workerObjectType         = "worker"
+	workPackageDocType       = "workPackage"
+	workPackageActivityIndex = "workPackageActivity"
+
+	unplannedRequirementKey = "unplannedActivityRequirement"
+	UnplannedActivityType   = "UNPLANNED"
+
+	workerTransientKey = "worker"
+)
+
+// Certification is a qualification held by a worker, e.g. a riveting or composite repair certificate
+type Certification struct {
+	Code      string `json:"code"`
+	ExpiresAt string `json:"expiresAt"` // RFC3339 time after which the certification is no longer valid
+}
+
+// Worker is an OEM worker with the skills and certifications they hold. It is visible to the OEM only.
+type Worker struct {
+	WorkerID       string          `json:"workerID"`
+	Name           string          `json:"name"`
+	Skills         []string        `json:"skills"`
+	Certifications []Certification `json:"certifications"`
+}
+
+// ActivityTypeRequirement lists the certifications a worker needs to perform an activity type
+type ActivityTypeRequirement struct {
+	ActivityType   string   `json:"activityType"`
+	Certifications []string `json:"certifications"`
+}
+
+// PlannedActivity is an activity planned in a work package
+type PlannedActivity struct {
+	ActivityID   string `json:"activityID"`
+	ActivityType string `json:"activityType"`
+}
+
+// WorkPackage plans the activities to perform on an aircraft at a station
+type WorkPackage struct {
+	DocType       string                    `json:"docType"`
+	WorkPackageID string                    `json:"workPackageID"`
+	ACNumber      string                    `json:"acNumber"`
+	Station       string                    `json:"station"`
+	Requirements  []ActivityTypeRequirement `json:"requirements"`
+	Activities    []PlannedActivity         `json:"activities"`
+	CreatedBy     string                    `json:"createdBy"` // Hash of the identity that created the work package
+	CreatedAt     string                    `json:"createdAt"`
+}
+
+// SetWorker registers a worker, or replaces their skills and certifications, from the transient map under "worker"
+// as {"workerID":"...","name":"...","skills":["..."],"certifications":[{"code":"...","expiresAt":"..."}]}.
+// Only OEM clients may set workers, from an OEM peer.
+func (s *SmartContract) SetWorker(ctx contractapi.TransactionContextInterface) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return err
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+	workerJSON, ok := transientMap[workerTransientKey]
+	if !ok {
+		return newContractError(ErrInvalidArgument, "%s not found in the transient map input", workerTransientKey)
+	}
+
+	var worker Worker
+	if err := json.Unmarshal(workerJSON, &worker); err != nil {
+		return newContractError(ErrInvalidArgument, "failed to unmarshal worker: %v", err)
+	}
+	if worker.WorkerID == "" {
+		return newContractError(ErrInvalidArgument, "workerID field must be a non-empty string")
+	}
+	if worker.Skills == nil {
+		worker.Skills = []string{}
+	}
+	if worker.Certifications == nil {
+		worker.Certifications = []Certification{}
+	}
+	for _, certification := range worker.Certifications {
+		if certification.Code == "" {
+			return newContractError(ErrInvalidArgument, "certification code must not be empty")
+		}
+		if _, err := time.Parse(time.RFC3339, certification.ExpiresAt); err != nil {
+			return newContractError(ErrInvalidTimestamp, "expiry %q of certification %s is not an RFC3339 timestamp", certification.ExpiresAt, certification.Code)
+		}
+	}
+
+	workerJSON, err = json.Marshal(worker)
+	if err != nil {
+		return fmt.Errorf("failed to marshal worker: %v", err)
+	}
+	key, err := workerKey(ctx, worker.WorkerID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(oemCollection, key, workerJSON)
+}
+
+// ReadWorker returns a registered worker. Only OEM clients may read workers, from an OEM peer.
+func (s *SmartContract) ReadWorker(ctx contractapi.TransactionContextInterface, workerID string) (*Worker, error) {
+	if err := assertOEM(ctx); err != nil {
+		return nil, err
+	}
+	if err := verifyClientOrgMatchesPeerOrg(ctx); err != nil {
+		return nil, err
+	}
+
+	return readWorker(ctx, workerID)
+}
+
+// CreateWorkPackage plans activities on an aircraft at a station, with the certifications each activity type requires.
+// Every planned activity must have a type listed in the requirements, and may only be planned in one work package.
+// Only the OEM may create work packages.
+func (s *SmartContract) CreateWorkPackage(ctx contractapi.TransactionContextInterface, workPackageID string, acNumber string, station string, requirements []ActivityTypeRequirement, activities []PlannedActivity) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if workPackageID == "" {
+		return newContractError(ErrInvalidArgument, "work package ID must not be empty")
+	}
+
+	exists, err := s.AssetExists(ctx, acNumber)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return newContractError(ErrNotFound, "the asset %s does not exist", acNumber)
+	}
+	routing, err := s.GetRouting(ctx)
+	if err != nil {
+		return err
+	}
+	if !routing.contains(station) {
+		return newContractError(ErrNotFound, "station %s is not part of the routing", station)
+	}
+
+	key, err := workPackageKey(ctx, workPackageID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read work package %s: %v", workPackageID, err)
+	}
+	if existing != nil {
+		return newContractError(ErrAlreadyExists, "work package %s already exists", workPackageID)
+	}
+
+	if requirements == nil {
+		requirements = []ActivityTypeRequirement{}
+	}
+	activityTypes := map[string]bool{}
+	for _, requirement := range requirements {
+		if requirement.ActivityType == "" {
+			return newContractError(ErrInvalidArgument, "activity type must not be empty")
+		}
+		if activityTypes[requirement.ActivityType] {
+			return newContractError(ErrInvalidArgument, "activity type %s is listed more than once", requirement.ActivityType)
+		}
+		activityTypes[requirement.ActivityType] = true
+	}
+	if activities == nil {
+		activities = []PlannedActivity{}
+	}
+	// reads do not see the writes of the same transaction, so duplicates within the package are checked here
+	plannedIDs := map[string]bool{}
+	for _, activity := range activities {
+		if activity.ActivityID == "" {
+			return newContractError(ErrInvalidArgument, "planned activity ID must not be empty")
+		}
+		if plannedIDs[activity.ActivityID] {
+			return newContractError(ErrInvalidArgument, "activity %s is planned more than once", activity.ActivityID)
+		}
+		plannedIDs[activity.ActivityID] = true
+		if !activityTypes[activity.ActivityType] {
+			return newContractError(ErrInvalidArgument, "activity %s has type %q, which is not listed in the requirements", activity.ActivityID, activity.ActivityType)
+		}
+		planned, err := findWorkPackageActivity(ctx, acNumber, station, activity.ActivityID)
+		if err != nil {
+			return err
+		}
+		if planned != "" {
+			return newContractError(ErrAlreadyExists, "activity %s of aircraft %s at station %s is already planned in work package %s", activity.ActivityID, acNumber, station, planned)
+		}
+		indexKey, err := ctx.GetStub().CreateCompositeKey(workPackageActivityIndex, []string{acNumber, station, activity.ActivityID, workPackageID})
+		if err != nil {
+			return fmt.Errorf("failed to create work package activity key: %v", err)
+		}
+		if err := ctx.GetStub().PutState(indexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+
+	createdBy, err := staffRef(ctx)
+	if err != nil {
+		return err
+	}
+	createdAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	workPackage := WorkPackage{
+		DocType:       workPackageDocType,
+		WorkPackageID: workPackageID,
+		ACNumber:      acNumber,
+		Station:       station,
+		Requirements:  requirements,
+		Activities:    activities,
+		CreatedBy:     createdBy,
+		CreatedAt:     createdAt,
+	}
+	workPackageJSON, err := json.Marshal(workPackage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal work package: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, workPackageJSON)
+}
+
+// ReadWorkPackage returns the work package stored in the world state with the given ID
+func (s *SmartContract) ReadWorkPackage(ctx contractapi.TransactionContextInterface, workPackageID string) (*WorkPackage, error) {
+	key, err := workPackageKey(ctx, workPackageID)
+	if err != nil {
+		return nil, err
+	}
+	workPackageJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read work package %s: %v", workPackageID, err)
+	}
+	if workPackageJSON == nil {
+		return nil, newContractError(ErrNotFound, "work package %s does not exist", workPackageID)
+	}
+
+	var workPackage WorkPackage
+	if err := json.Unmarshal(workPackageJSON, &workPackage); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal work package: %v", err)
+	}
+	return &workPackage, nil
+}
+
+// SetUnplannedActivityRequirement sets the certifications a worker needs to record an activity that is not planned in
+// a work package. An empty list lets any registered worker record unplanned activities. Only the OEM may set it.
+func (s *SmartContract) SetUnplannedActivityRequirement(ctx contractapi.TransactionContextInterface, certifications []string) error {
+	if err := assertOEM(ctx); err != nil {
+		return err
+	}
+	if certifications == nil {
+		certifications = []string{}
+	}
+	for _, code := range certifications {
+		if code == "" {
+			return newContractError(ErrInvalidArgument, "certification code must not be empty")
+		}
+	}
+
+	requirementJSON, err := json.Marshal(ActivityTypeRequirement{ActivityType: UnplannedActivityType, Certifications: certifications})
+	if err != nil {
+		return fmt.Errorf("failed to marshal unplanned activity requirement: %v", err)
+	}
+
+	return ctx.GetStub().PutState(unplannedRequirementKey, requirementJSON)
+}
+
+// GetUnplannedActivityRequirement returns the certifications a worker needs to record an activity that is not planned
+// in a work package
+func (s *SmartContract) GetUnplannedActivityRequirement(ctx contractapi.TransactionContextInterface) (*ActivityTypeRequirement, error) {
+	requirement, err := readUnplannedActivityRequirement(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if requirement == nil {
+		return nil, newContractError(ErrNotFound, "no requirement for unplanned activities has been set")
+	}
+	return requirement, nil
+}
+
+// readUnplannedActivityRequirement reads the unplanned activity requirement, or returns nil when it has not been set
+func readUnplannedActivityRequirement(ctx contractapi.TransactionContextInterface) (*ActivityTypeRequirement, error) {
+	requirementJSON, err := ctx.GetStub().GetState(unplannedRequirementKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unplanned activity requirement: %v", err)
+	}
+	if requirementJSON == nil {
+		return nil, nil
+	}
+
+	var requirement ActivityTypeRequirement
+	if err := json.Unmarshal(requirementJSON, &requirement); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal unplanned activity requirement: %v", err)
+	}
+	return &requirement, nil
+}
+
+// assertWorkerCertified checks that the staff behind a new activity are registered and that the worker holds, until
+// endTime, the certifications the activity type requires when the activity is planned in a work package, or the
+// unplanned activity requirement when it is not. It returns the work package and the type of the activity, both
+// empty when it is not planned.
+func (s *SmartContract) assertWorkerCertified(ctx contractapi.TransactionContextInterface, details *ActivityPrivateDetails, acNumber string, station string, activityID string, endTime string) (string, string, error) {
+	worker, err := readWorker(ctx, details.WorkerID)
+	if err != nil {
+		return "", "", err
+	}
+	if details.StationResponsible != "" {
+		if _, err := readWorker(ctx, details.StationResponsible); err != nil {
+			return "", "", err
+		}
+	}
+
+	end, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return "", "", newContractError(ErrInvalidTimestamp, "end time %q is not an RFC3339 timestamp", endTime)
+	}
+
+	workPackageID, err := findWorkPackageActivity(ctx, acNumber, station, activityID)
+	if err != nil {
+		return "", "", err
+	}
+	if workPackageID == "" {
+		requirement, err := readUnplannedActivityRequirement(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		if requirement == nil {
+			return "", "", newContractError(ErrNotCertified, "activity %s of aircraft %s at station %s is not planned in a work package and no requirement for unplanned activities has been set", activityID, acNumber, station)
+		}
+		for _, code := range requirement.Certifications {
+			if err := worker.assertCertified(code, end); err != nil {
+				return "", "", err
+			}
+		}
+		return "", "", nil
+	}
+
+	workPackage, err := s.ReadWorkPackage(ctx, workPackageID)
+	if err != nil {
+		return "", "", err
+	}
+	var activityType string
+	for _, activity := range workPackage.Activities {
+		if activity.ActivityID == activityID {
+			activityType = activity.ActivityType
+		}
+	}
+
+	for _, requirement := range workPackage.Requirements {
+		if requirement.ActivityType != activityType {
+			continue
+		}
+		for _, code := range requirement.Certifications {
+			if err := worker.assertCertified(code, end); err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	return workPackageID, activityType, nil
+}
+
+// assertCertified checks that the worker holds a certification that is still valid at the given time
+func (w *Worker) assertCertified(code string, at time.Time) error {
+	for _, certification := range w.Certifications {
+		if certification.Code != code {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, certification.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("invalid expiry on certification %s of worker %s: %v", code, w.WorkerID, err)
+		}
+		if at.Before(expiresAt) {
+			return nil
+		}
+		return newContractError(ErrNotCertified, "certification %s of worker %s expired at %s", code, w.WorkerID, certification.ExpiresAt)
+	}
+	return newContractError(ErrNotCertified, "worker %s does not hold certification %s", w.WorkerID, code)
+}
+
+// findWorkPackageActivity returns the ID of the work package an activity is planned in, or an empty string
+func findWorkPackageActivity(ctx contractapi.TransactionContextInterface, acNumber string, station string, activityID string) (string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(workPackageActivityIndex, []string{acNumber, station, activityID})
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	if !resultsIterator.HasNext() {
+		return "", nil
+	}
+	queryResult, err := resultsIterator.Next()
+	if err != nil {
+		return "", err
+	}
+	_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+	if err != nil {
+		return "", err
+	}
+	return keyParts[3], nil
+}
+
+// readWorker reads a worker from the OEM collection
+func readWorker(ctx contractapi.TransactionContextInterface, workerID string) (*Worker, error) {
+	key, err := workerKey(ctx, workerID)
+	if err != nil {
+		return nil, err
+	}
+	workerJSON, err := ctx.GetStub().GetPrivateData(oemCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worker %s: %v", workerID, err)
+	}
+	if workerJSON == nil {
+		return nil, newContractError(ErrNotFound, "worker %s is not registered", workerID)
+	}
+
+	var worker Worker
+	if err := json.Unmarshal(workerJSON, &worker); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal worker: %v", err)
+	}
+	return &worker, nil
+}
+
+// workerKey builds the composite key a worker is stored under in the OEM collection
+func workerKey(ctx contractapi.TransactionContextInterface, workerID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(workerObjectType, []string{workerID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create worker key: %v", err)
+	}
+	return key, nil
+}
+
+// workPackageKey builds the composite key a work package is stored under
+func workPackageKey(ctx contractapi.TransactionContextInterface, workPackageID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(workPackageDocType, []string{workPackageID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create work package key: %v", err)
+	}
+	return key, nil
+}
@@ -30,6 +30,8 @@ const (
 	defaultBackgroundInitialDelay = "5s"
 	defaultBackgroundRetryFactor  = 2.0
 	defaultBackgroundMaxDelay     = "1m"
+
+	defaultListenerStatusInterval = "1m"
 )
 
 const (
@@ -61,6 +63,8 @@ const (
 	FabconnectBackgroundStartMaxDelay = "backgroundStart.maxDelay"
 	// FabconnectBackgroundStartFactor is to set the factor by which the delay increases when retrying
 	FabconnectBackgroundStartFactor = "backgroundStart.factor"
+	// FabconnectConfigListenerStatusInterval is how often to query the channel height of contract listeners, to report how far behind they are
+	FabconnectConfigListenerStatusInterval = "listenerStatus.interval"
 )
 
 func (f *Fabric) InitConfig(config config.Section) {
@@ -78,4 +82,5 @@ func (f *Fabric) InitConfig(config config.Section) {
 	f.fabconnectConf.AddKnownKey(FabconnectBackgroundStartFactor, defaultBackgroundRetryFactor)
 	f.fabconnectConf.AddKnownKey(FabconnectBackgroundStartInitialDelay, defaultBackgroundInitialDelay)
 	f.fabconnectConf.AddKnownKey(FabconnectBackgroundStartMaxDelay, defaultBackgroundMaxDelay)
+	f.fabconnectConf.AddKnownKey(FabconnectConfigListenerStatusInterval, defaultListenerStatusInterval)
 }
@@ -24,6 +24,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/hyperledger/firefly-common/pkg/config"
@@ -68,6 +70,13 @@ type Fabric struct {
 	cache           cache.CInterface
 	backgroundRetry *retry.Retry
 	backgroundStart bool
+
+	listenerMux            sync.Mutex
+	listeners              map[string]*listenerProgress
+	listenerStatusInterval time.Duration
+
+	deployMux   sync.Mutex
+	deployments map[string]bool
 }
 
 type eventStreamWebsocket struct {
@@ -223,6 +232,7 @@ func (f *Fabric) Init(ctx context.Context, cancelCtx context.CancelFunc, conf co
 	}
 	f.prefixShort = fabconnectConf.GetString(FabconnectPrefixShort)
 	f.prefixLong = fabconnectConf.GetString(FabconnectPrefixLong)
+	f.listenerStatusInterval = fabconnectConf.GetDuration(FabconnectConfigListenerStatusInterval)
 
 	if wsConfig.WSKeyPath == "" {
 		wsConfig.WSKeyPath = "/ws"
@@ -302,6 +312,9 @@ func (f *Fabric) backgroundStartLoop() {
 }
 
 func (f *Fabric) Start() (err error) {
+	if f.listenerStatusInterval > 0 {
+		go f.listenerStatusLoop()
+	}
 	if f.backgroundStart {
 		go f.backgroundStartLoop()
 		return nil
@@ -413,6 +426,7 @@ func (f *Fabric) processContractEvent(ctx context.Context, events common.EventsT
 		return err // this is a problem - we should be able to find the listener that dispatched this to us
 	}
 	namespace := common.GetNamespaceFromSubName(subName)
+	f.listenerEventDelivered(subID, subName, uint64(msgJSON.GetInt64("blockNumber")), msgJSON.GetString("transactionId"))
 	event := f.parseBlockchainEvent(ctx, msgJSON)
 	if event != nil {
 		f.callbacks.PrepareBlockchainEvent(ctx, events, namespace, &blockchain.EventForListener{
@@ -461,7 +475,10 @@ func (f *Fabric) RemoveFireflySubscription(ctx context.Context, subID string) {
 	f.subs.RemoveSubscription(ctx, subID)
 }
 
-func (f *Fabric) handleMessageBatch(ctx context.Context, messages []interface{}) error {
+func (f *Fabric) handleMessageBatch(ctx context.Context, messages []interface{}) (err error) {
+	// Whatever happens to the batch, the listeners with events in it need to know
+	defer func() { f.listenerBatchComplete(err) }()
+
 	// Build the set of events that need handling
 	events := make(common.EventsToDispatch)
 	count := len(messages)
@@ -759,6 +776,10 @@ func (f *Fabric) buildFabconnectRequestBody(ctx context.Context, channel, chainc
 		"func": methodName,
 		"args": args,
 	}
+	return applyOptions(ctx, body, options)
+}
+
+func applyOptions(ctx context.Context, body, options map[string]interface{}) (map[string]interface{}, error) {
 	for k, v := range options {
 		// Set the new field if it's not already set. Do not allow overriding of existing fields
 		if _, ok := body[k]; !ok {
@@ -770,10 +791,6 @@ func (f *Fabric) buildFabconnectRequestBody(ctx context.Context, channel, chainc
 	return body, nil
 }
 
-func (f *Fabric) DeployContract(ctx context.Context, nsOpID, signingKey string, definition, contract *fftypes.JSONAny, input []interface{}, options map[string]interface{}) (submissionRejected bool, err error) {
-	return true, i18n.NewError(ctx, coremsgs.MsgNotSupportedByBlockchainPlugin)
-}
-
 func (f *Fabric) ValidateInvokeRequest(ctx context.Context, parsedMethod interface{}, input map[string]interface{}, hasMessage bool) error {
 	// No additional validation beyond what is enforced by Contract Manager
 	_, _, err := f.recoverFFI(ctx, parsedMethod)
@@ -938,16 +955,16 @@ func (f *Fabric) AddContractListener(ctx context.Context, listener *core.Contrac
 		return err
 	}
 	listener.BackendID = result.ID
+	f.trackListener(result)
 	return nil
 }
 
 func (f *Fabric) DeleteContractListener(ctx context.Context, subscription *core.ContractListener, okNotFound bool) error {
-	return f.streams.deleteSubscription(ctx, subscription.BackendID, okNotFound)
-}
-
-func (f *Fabric) GetContractListenerStatus(ctx context.Context, subID string, okNotFound bool) (bool, interface{}, error) {
-	// Fabconnect does not currently provide any additional status info for listener subscriptions.
-	return true, nil, nil
+	err := f.streams.deleteSubscription(ctx, subscription.BackendID, okNotFound)
+	if err == nil {
+		f.removeListenerProgress(subscription.BackendID)
+	}
+	return err
 }
 
 func (f *Fabric) GetFFIParamValidator(ctx context.Context) (fftypes.FFIParamValidator, error) {
@@ -955,10 +972,6 @@ func (f *Fabric) GetFFIParamValidator(ctx context.Context) (fftypes.FFIParamVali
 	return nil, nil
 }
 
-func (f *Fabric) GenerateFFI(ctx context.Context, generationRequest *fftypes.FFIGenerationRequest) (*fftypes.FFI, error) {
-	return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationUnsupported)
-}
-
 func (f *Fabric) GenerateEventSignature(ctx context.Context, event *fftypes.FFIEventDefinition) string {
 	return event.Name
 }
@@ -1027,39 +1040,3 @@ func (f *Fabric) GetAndConvertDeprecatedContractConfig(ctx context.Context) (loc
 	})
 	return location, fromBlock, err
 }
-
-func (f *Fabric) GetTransactionStatus(ctx context.Context, operation *core.Operation) (interface{}, error) {
-	txHash := operation.Output.GetString("transactionHash")
-
-	defaultChannel := f.fabconnectConf.GetString(FabconnectConfigDefaultChannel)
-	if defaultChannel == "" {
-		return nil, i18n.NewError(ctx, coremsgs.MsgDefaultChannelNotConfigured)
-	}
-	defaultSigner := f.fabconnectConf.GetString(FabconnectConfigSigner)
-	if defaultSigner == "" {
-		return nil, i18n.NewError(ctx, coremsgs.MsgNodeMissingBlockchainKey)
-	}
-
-	transactionRequestPath := fmt.Sprintf("/transactions/%s", txHash)
-	client := f.client
-	var resErr common.BlockchainRESTError
-	var statusResponse fftypes.JSONObject
-	res, err := client.R().
-		SetContext(ctx).
-		SetError(&resErr).
-		SetResult(&statusResponse).
-		SetQueryParam("fly-channel", defaultChannel).
-		SetQueryParam("fly-signer", defaultSigner).
-		Get(transactionRequestPath)
-	if err != nil || !res.IsSuccess() {
-		if res.StatusCode() == 404 {
-			return nil, nil
-		}
-		return nil, common.WrapRESTError(ctx, &resErr, res, err, coremsgs.MsgFabconnectRESTErr)
-	}
-
-	// TODO - could implement the same enhancement ethconnect has, and build a mock WS receipt if an API query
-	// happens to update the status of a pending transaction in our store.
-
-	return statusResponse, nil
-}
@@ -63,8 +63,11 @@ func resetConf(e *Fabric) {
 func newTestFabric() (*Fabric, func()) {
 	ctx, cancel := context.WithCancel(context.Background())
 	wsm := &wsmocks.WSClient{}
+	mmm := &metricsmocks.Manager{}
+	mmm.On("IsMetricsEnabled").Return(false).Maybe()
 	f := &Fabric{
 		ctx:            ctx,
+		metrics:        mmm,
 		cancelCtx:      cancel,
 		client:         resty.New().SetBaseURL("http://localhost:12345"),
 		defaultChannel: "firefly",
@@ -2446,38 +2449,6 @@ func TestInvokeContractWithBatchOK(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestDeployContractOK(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-	signingKey := fftypes.NewRandB32().String()
-	input := []interface{}{
-		float64(1),
-		"1000000000000000000000000",
-	}
-	options := map[string]interface{}{
-		"contract": "not really a contract",
-	}
-	definitionBytes, err := json.Marshal([]interface{}{})
-	contractBytes, err := json.Marshal("0x123456")
-	assert.NoError(t, err)
-	httpmock.RegisterResponder("POST", `http://localhost:12345/`,
-		func(req *http.Request) (*http.Response, error) {
-			var body map[string]interface{}
-			json.NewDecoder(req.Body).Decode(&body)
-			params := body["params"].([]interface{})
-			headers := body["headers"].(map[string]interface{})
-			assert.Equal(t, "DeployContract", headers["type"])
-			assert.Equal(t, float64(1), params[0])
-			assert.Equal(t, "1000000000000000000000000", params[1])
-			assert.Equal(t, body["customOption"].(string), "customValue")
-			return httpmock.NewJsonResponderOrPanic(400, "pop")(req)
-		})
-	_, err = e.DeployContract(context.Background(), "", signingKey, fftypes.JSONAnyPtrBytes(definitionBytes), fftypes.JSONAnyPtrBytes(contractBytes), input, options)
-	assert.Regexp(t, "FF10429", err)
-}
-
 func TestInvokeContractBadSchema(t *testing.T) {
 	e, cancel := newTestFabric()
 	defer cancel()
@@ -2806,17 +2777,6 @@ func TestGetFFIParamValidator(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestGenerateFFI(t *testing.T) {
-	e, _ := newTestFabric()
-	_, err := e.GenerateFFI(context.Background(), &fftypes.FFIGenerationRequest{
-		Name:        "Simple",
-		Version:     "v0.0.1",
-		Description: "desc",
-		Input:       fftypes.JSONAnyPtr(`[]`),
-	})
-	assert.Regexp(t, "FF10347", err)
-}
-
 func TestGenerateEventSignature(t *testing.T) {
 	e, _ := newTestFabric()
 	signature := e.GenerateEventSignature(context.Background(), &fftypes.FFIEventDefinition{Name: "Changed"})
@@ -3183,135 +3143,6 @@ func TestSubmitNetworkActionVersionError(t *testing.T) {
 	assert.Regexp(t, "FF10284", err)
 }
 
-func TestGetContractListenerStatus(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-
-	_, status, err := e.GetContractListenerStatus(context.Background(), "id", true)
-	assert.Nil(t, status)
-	assert.NoError(t, err)
-}
-
-func TestGetTransactionStatus(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-	resetConf(e)
-
-	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
-	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
-
-	output := make(map[string]interface{}, 0)
-	output["transactionHash"] = "7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a"
-	op := &core.Operation{
-		Output: output,
-	}
-
-	httpmock.RegisterResponder("GET", `http://localhost:12345/transactions/7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a?fly-channel=firefly&fly-signer=signer001`,
-		func(req *http.Request) (*http.Response, error) {
-			return httpmock.NewJsonResponderOrPanic(200, make(map[string]interface{}))(req)
-		})
-
-	status, err := e.GetTransactionStatus(context.Background(), op)
-	assert.NotNil(t, status)
-	assert.NoError(t, err)
-}
-
-func TestGetTransactionStatusNoDefaultChannel(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-	resetConf(e)
-
-	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "")
-
-	output := make(map[string]interface{}, 0)
-	output["transactionHash"] = "7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a"
-	op := &core.Operation{
-		Output: output,
-	}
-
-	_, err := e.GetTransactionStatus(context.Background(), op)
-	assert.Error(t, err)
-	assert.ErrorContains(t, err, "FF10440")
-}
-
-func TestGetTransactionStatusNoDefaultSigner(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-	resetConf(e)
-
-	utFabconnectConf.Set(FabconnectConfigSigner, "")
-	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
-
-	output := make(map[string]interface{}, 0)
-	output["transactionHash"] = "7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a"
-	op := &core.Operation{
-		Output: output,
-	}
-
-	_, err := e.GetTransactionStatus(context.Background(), op)
-	assert.Error(t, err)
-	assert.ErrorContains(t, err, "FF10354")
-}
-
-func TestGetTransactionStatusNoResult(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-	resetConf(e)
-
-	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
-	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
-
-	output := make(map[string]interface{}, 0)
-	output["transactionHash"] = "7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a"
-	op := &core.Operation{
-		Output: output,
-	}
-
-	httpmock.RegisterResponder("GET", `http://localhost:12345/transactions/7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a?fly-channel=firefly&fly-signer=signer001`,
-		func(req *http.Request) (*http.Response, error) {
-			return httpmock.NewJsonResponderOrPanic(404, make(map[string]interface{}))(req)
-		})
-
-	status, err := e.GetTransactionStatus(context.Background(), op)
-	assert.Nil(t, status)
-	assert.Nil(t, err)
-}
-
-func TestGetTransactionStatusBadResult(t *testing.T) {
-	e, cancel := newTestFabric()
-	defer cancel()
-	httpmock.ActivateNonDefault(e.client.GetClient())
-	defer httpmock.DeactivateAndReset()
-	resetConf(e)
-
-	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
-	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
-
-	op := &core.Operation{
-		Namespace: "ns1",
-		ID:        fftypes.MustParseUUID("9ffc50ff-6bfe-4502-adc7-93aea54cc059"),
-	}
-
-	httpmock.RegisterResponder("GET", `http://localhost:12345/transactions/ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059`,
-		func(req *http.Request) (*http.Response, error) {
-			return httpmock.NewJsonResponderOrPanic(500, make(map[string]interface{}))(req)
-		})
-
-	status, err := e.GetTransactionStatus(context.Background(), op)
-	assert.Nil(t, status)
-	assert.NotNil(t, err)
-}
-
 func TestValidateInvokeRequest(t *testing.T) {
 	e, cancel := newTestFabric()
 	defer cancel()
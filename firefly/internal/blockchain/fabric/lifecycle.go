@@ -0,0 +1,462 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly/internal/blockchain/common"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/pkg/core"
+)
+
+const (
+	lifecyclePhaseInstall = "install"
+	lifecyclePhaseApprove = "approve"
+	lifecyclePhaseCommit  = "commit"
+
+	packageMetadataFile = "metadata.json"
+	packageCodeFile     = "code.tar.gz"
+	connectionFile      = "connection.json"
+)
+
+// ChaincodeDefinition is the "definition" of a Fabric contract deployment, describing the
+// chaincode definition to approve and commit on the channel
+type ChaincodeDefinition struct {
+	Channel           string `json:"channel,omitempty"`
+	Chaincode         string `json:"chaincode"`
+	Label             string `json:"label,omitempty"`
+	Version           string `json:"version,omitempty"`
+	Sequence          int64  `json:"sequence"`
+	EndorsementPolicy string `json:"endorsementPolicy,omitempty"`
+	ApproveOnly       bool   `json:"approveOnly,omitempty"`
+}
+
+// ChaincodeContract is the "contract" of a Fabric contract deployment. It is either a chaincode
+// package built with "peer lifecycle chaincode package", or the connection details of a
+// chaincode running as an external service, from which the package is built.
+type ChaincodeContract struct {
+	Package    []byte               `json:"package,omitempty"`
+	Connection *ChaincodeConnection `json:"connection,omitempty"`
+}
+
+// ChaincodeConnection is the connection.json of a chaincode-as-a-service package
+type ChaincodeConnection struct {
+	Address            string `json:"address"`
+	DialTimeout        string `json:"dial_timeout,omitempty"`
+	TLSRequired        bool   `json:"tls_required"`
+	ClientAuthRequired bool   `json:"client_auth_required,omitempty"`
+	ClientKey          string `json:"client_key,omitempty"`
+	ClientCert         string `json:"client_cert,omitempty"`
+	RootCert           string `json:"root_cert,omitempty"`
+}
+
+type chaincodePackageMetadata struct {
+	Path  string `json:"path,omitempty"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+type chaincodeDeployment struct {
+	definition *ChaincodeDefinition
+	pkg        []byte
+	packageID  string
+	signer     string
+	options    map[string]interface{}
+	phases     []*LifecyclePhase
+}
+
+// LifecyclePhase is the status of one phase of a chaincode deployment, as recorded in the output of the operation
+type LifecyclePhase struct {
+	Phase         string        `json:"phase"`
+	Status        core.OpStatus `json:"status"`
+	TransactionID string        `json:"transactionId,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// DeploymentStatus is the progress of a chaincode deployment, as returned in the detail of an operation
+type DeploymentStatus struct {
+	PackageID string            `json:"packageId,omitempty"`
+	Phases    []*LifecyclePhase `json:"phases"`
+}
+
+type fabLifecycleResponse struct {
+	PackageID     string `json:"packageId,omitempty"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// DeployContract installs, approves and commits a chaincode definition. The request is validated, and
+// the package built if needed, before returning. The lifecycle then runs in the background, reporting
+// the status of each phase as a pending update of the operation, until it succeeds or fails.
+// A deployment interrupted by a restart is resumed from the recorded phases by GetTransactionStatus.
+func (f *Fabric) DeployContract(ctx context.Context, nsOpID, signingKey string, definition, contract *fftypes.JSONAny, input []interface{}, options map[string]interface{}) (submissionRejected bool, err error) {
+	if f.metrics.IsMetricsEnabled() {
+		f.metrics.BlockchainContractDeployment()
+	}
+	deployment, err := f.prepareChaincodeDeployment(ctx, signingKey, definition, contract, input, options)
+	if err != nil {
+		return true, err
+	}
+	log.L(ctx).Infof("Deploying chaincode '%s' sequence %d with package '%s' on channel '%s'", deployment.definition.Chaincode, deployment.definition.Sequence, deployment.packageID, deployment.definition.Channel)
+	f.startChaincodeLifecycle(nsOpID, deployment)
+	return false, nil
+}
+
+// startChaincodeLifecycle runs the lifecycle of a deployment in the background, unless it is already running
+func (f *Fabric) startChaincodeLifecycle(nsOpID string, deployment *chaincodeDeployment) bool {
+	f.deployMux.Lock()
+	defer f.deployMux.Unlock()
+	if f.deployments == nil {
+		f.deployments = make(map[string]bool)
+	}
+	if f.deployments[nsOpID] {
+		return false
+	}
+	f.deployments[nsOpID] = true
+	go f.runChaincodeLifecycle(nsOpID, deployment)
+	return true
+}
+
+func (f *Fabric) chaincodeLifecycleDone(nsOpID string) {
+	f.deployMux.Lock()
+	defer f.deployMux.Unlock()
+	delete(f.deployments, nsOpID)
+}
+
+func deploymentStatus(output fftypes.JSONObject) *DeploymentStatus {
+	status := &DeploymentStatus{Phases: []*LifecyclePhase{}}
+	b, _ := json.Marshal(output)
+	_ = json.Unmarshal(b, status)
+	return status
+}
+
+// getDeploymentStatus returns the phases recorded for a chaincode deployment. If the deployment is still
+// pending but not running, for example because FireFly restarted part way through, it is resumed after
+// the last phase that succeeded. Each phase tolerates having been completed already, so it is safe to
+// repeat a phase that succeeded without its status being recorded.
+func (f *Fabric) getDeploymentStatus(ctx context.Context, operation *core.Operation) (interface{}, error) {
+	status := deploymentStatus(operation.Output)
+	if !isPendingOperation(operation) {
+		return status, nil
+	}
+
+	var input []interface{}
+	if inputArray, ok := operation.Input["input"].([]interface{}); ok {
+		input = inputArray
+	}
+	deployment, err := f.prepareChaincodeDeployment(ctx,
+		operation.Input.GetString("key"),
+		fftypes.JSONAnyPtr(operation.Input.GetObject("definition").String()),
+		fftypes.JSONAnyPtr(operation.Input.GetObject("contract").String()),
+		input,
+		operation.Input.GetObject("options"))
+	if err != nil {
+		return nil, err
+	}
+	for _, phase := range deployment.phases {
+		for _, recorded := range status.Phases {
+			if recorded.Phase == phase.Phase && recorded.Status == core.OpStatusSucceeded {
+				phase.Status = core.OpStatusSucceeded
+				phase.TransactionID = recorded.TransactionID
+			}
+		}
+	}
+	if status.PackageID != "" {
+		deployment.packageID = status.PackageID
+	}
+
+	nsOpID := (&core.PreparedOperation{ID: operation.ID, Namespace: operation.Namespace}).NamespacedIDString()
+	if f.startChaincodeLifecycle(nsOpID, deployment) {
+		log.L(ctx).Infof("Resuming deployment of chaincode '%s' sequence %d for operation %s", deployment.definition.Chaincode, deployment.definition.Sequence, nsOpID)
+	}
+	return status, nil
+}
+
+func (f *Fabric) prepareChaincodeDeployment(ctx context.Context, signingKey string, definition, contract *fftypes.JSONAny, input []interface{}, options map[string]interface{}) (*chaincodeDeployment, error) {
+	var def ChaincodeDefinition
+	if err := json.Unmarshal(definition.Bytes(), &def); err != nil {
+		return nil, i18n.WrapError(ctx, err, coremsgs.MsgInvalidChaincodeDeployment, "unable to parse definition")
+	}
+	var cc ChaincodeContract
+	if err := json.Unmarshal(contract.Bytes(), &cc); err != nil {
+		return nil, i18n.WrapError(ctx, err, coremsgs.MsgInvalidChaincodeDeployment, "unable to parse contract")
+	}
+	if len(input) > 0 {
+		return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "'input' is not supported, as chaincode initialization is not required")
+	}
+	if def.Channel == "" {
+		def.Channel = f.defaultChannel
+	}
+	if def.Channel == "" || def.Chaincode == "" {
+		return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "'channel' and 'chaincode' must be set in the definition")
+	}
+	if def.Sequence < 1 {
+		return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "'sequence' must be 1 or greater")
+	}
+	if def.Version == "" {
+		def.Version = strconv.FormatInt(def.Sequence, 10)
+	}
+
+	var pkg []byte
+	switch {
+	case cc.Package != nil && cc.Connection != nil:
+		return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "only one of 'package' or 'connection' may be set in the contract")
+	case cc.Package != nil:
+		label, err := readPackageLabel(ctx, cc.Package)
+		if err != nil {
+			return nil, err
+		}
+		if def.Label != "" && def.Label != label {
+			return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, fmt.Sprintf("label '%s' does not match package label '%s'", def.Label, label))
+		}
+		def.Label = label
+		pkg = cc.Package
+	case cc.Connection != nil:
+		if def.Label == "" || cc.Connection.Address == "" {
+			return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "'label' and connection 'address' must be set for chaincode-as-a-service")
+		}
+		pkg = buildServicePackage(def.Label, cc.Connection)
+	default:
+		return nil, i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "one of 'package' or 'connection' must be set in the contract")
+	}
+
+	// The package ID assigned by the peer is the label and the hash of the package
+	hash := sha256.Sum256(pkg)
+	deployment := &chaincodeDeployment{
+		definition: &def,
+		pkg:        pkg,
+		packageID:  def.Label + ":" + hex.EncodeToString(hash[:]),
+		signer:     getUserName(signingKey),
+		options:    options,
+		phases: []*LifecyclePhase{
+			{Phase: lifecyclePhaseInstall, Status: core.OpStatusPending},
+			{Phase: lifecyclePhaseApprove, Status: core.OpStatusPending},
+		},
+	}
+	if !def.ApproveOnly {
+		deployment.phases = append(deployment.phases, &LifecyclePhase{Phase: lifecyclePhaseCommit, Status: core.OpStatusPending})
+	}
+	return deployment, nil
+}
+
+func (f *Fabric) runChaincodeLifecycle(nsOpID string, deployment *chaincodeDeployment) {
+	defer f.chaincodeLifecycleDone(nsOpID)
+	ctx := log.WithLogField(f.ctx, "opid", nsOpID)
+	var txID string
+	for _, phase := range deployment.phases {
+		if phase.Status == core.OpStatusSucceeded {
+			// Completed before the deployment was resumed
+			if phase.TransactionID != "" {
+				txID = phase.TransactionID
+			}
+			continue
+		}
+		var err error
+		switch phase.Phase {
+		case lifecyclePhaseInstall:
+			err = f.installChaincode(ctx, nsOpID, deployment)
+		default:
+			phase.TransactionID, err = f.submitChaincodeDefinition(ctx, nsOpID, phase.Phase, deployment)
+		}
+		if phase.TransactionID != "" {
+			txID = phase.TransactionID
+		}
+		if err != nil {
+			log.L(ctx).Errorf("Chaincode %s failed: %s", phase.Phase, err)
+			phase.Status = core.OpStatusFailed
+			phase.Error = err.Error()
+			f.callbacks.OperationUpdate(ctx, f, nsOpID, core.OpStatusFailed, txID, err.Error(), deployment.output())
+			return
+		}
+		phase.Status = core.OpStatusSucceeded
+		if phase != deployment.phases[len(deployment.phases)-1] {
+			f.callbacks.OperationUpdate(ctx, f, nsOpID, core.OpStatusPending, txID, "", deployment.output())
+		}
+	}
+	f.callbacks.OperationUpdate(ctx, f, nsOpID, core.OpStatusSucceeded, txID, "", deployment.output())
+}
+
+func (f *Fabric) installChaincode(ctx context.Context, nsOpID string, deployment *chaincodeDeployment) error {
+	body := map[string]interface{}{
+		"headers": &fabTxInputHeaders{
+			ID:      nsOpID,
+			Signer:  deployment.signer,
+			Channel: deployment.definition.Channel,
+		},
+		"label":   deployment.definition.Label,
+		"package": base64.StdEncoding.EncodeToString(deployment.pkg),
+	}
+	var resErr common.BlockchainRESTError
+	var result fabLifecycleResponse
+	res, err := f.client.R().
+		SetContext(ctx).
+		SetBody(body).
+		SetError(&resErr).
+		SetResult(&result).
+		Post("/chaincodes/install")
+	if err == nil && res.StatusCode() == http.StatusConflict {
+		// The peers already have this package installed, for example from an earlier sequence
+		log.L(ctx).Infof("Chaincode package '%s' is already installed", deployment.packageID)
+		return nil
+	}
+	if err != nil || !res.IsSuccess() {
+		return common.WrapRESTError(ctx, &resErr, res, err, coremsgs.MsgFabconnectRESTErr)
+	}
+	if result.PackageID != "" {
+		deployment.packageID = result.PackageID
+	}
+	return nil
+}
+
+// submitChaincodeDefinition approves the chaincode definition for the signer's organization, or commits it
+// to the channel, and returns the ID of the committed transaction
+func (f *Fabric) submitChaincodeDefinition(ctx context.Context, nsOpID, phase string, deployment *chaincodeDeployment) (string, error) {
+	def := deployment.definition
+	body := map[string]interface{}{
+		"headers": &fabTxInputHeaders{
+			ID:      nsOpID,
+			Signer:  deployment.signer,
+			Channel: def.Channel,
+		},
+		"chaincode": def.Chaincode,
+		"version":   def.Version,
+		"sequence":  def.Sequence,
+	}
+	if def.EndorsementPolicy != "" {
+		body["endorsementPolicy"] = def.EndorsementPolicy
+	}
+	if phase == lifecyclePhaseApprove {
+		body["packageId"] = deployment.packageID
+	}
+	body, err := applyOptions(ctx, body, deployment.options)
+	if err != nil {
+		return "", err
+	}
+
+	var resErr common.BlockchainRESTError
+	var result fabLifecycleResponse
+	res, err := f.client.R().
+		SetContext(ctx).
+		SetHeader("x-firefly-sync", "true").
+		SetBody(body).
+		SetError(&resErr).
+		SetResult(&result).
+		Post("/chaincodes/" + phase)
+	if err == nil && res.StatusCode() == http.StatusConflict {
+		// The definition was already approved or committed, for example before a resumed deployment
+		log.L(ctx).Infof("Chaincode '%s' sequence %d has already passed the %s phase", def.Chaincode, def.Sequence, phase)
+		return "", nil
+	}
+	if err != nil || !res.IsSuccess() {
+		return "", common.WrapRESTError(ctx, &resErr, res, err, coremsgs.MsgFabconnectRESTErr)
+	}
+	return result.TransactionID, nil
+}
+
+func (d *chaincodeDeployment) output() fftypes.JSONObject {
+	output := fftypes.JSONObject{
+		"channel":   d.definition.Channel,
+		"chaincode": d.definition.Chaincode,
+		"label":     d.definition.Label,
+		"version":   d.definition.Version,
+		"sequence":  d.definition.Sequence,
+		"packageId": d.packageID,
+		"phases":    d.phases,
+	}
+	if d.phases[len(d.phases)-1].Status == core.OpStatusSucceeded {
+		output["contractLocation"] = &Location{
+			Channel:   d.definition.Channel,
+			Chaincode: d.definition.Chaincode,
+		}
+	}
+	// Round trip through JSON, so the output holds the same types as when read back from the database
+	var result fftypes.JSONObject
+	b, _ := json.Marshal(output)
+	_ = json.Unmarshal(b, &result)
+	return result
+}
+
+// readPackageLabel returns the label in the metadata.json of a chaincode package
+func readPackageLabel(ctx context.Context, pkg []byte) (string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(pkg))
+	if err != nil {
+		return "", i18n.WrapError(ctx, err, coremsgs.MsgInvalidChaincodeDeployment, "package is not a gzipped tar archive")
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return "", i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "package has no "+packageMetadataFile)
+		}
+		if err != nil {
+			return "", i18n.WrapError(ctx, err, coremsgs.MsgInvalidChaincodeDeployment, "package is not a gzipped tar archive")
+		}
+		if header.Name != packageMetadataFile {
+			continue
+		}
+		var metadata chaincodePackageMetadata
+		if err := json.NewDecoder(tr).Decode(&metadata); err != nil || metadata.Label == "" {
+			return "", i18n.NewError(ctx, coremsgs.MsgInvalidChaincodeDeployment, "package "+packageMetadataFile+" has no label")
+		}
+		return metadata.Label, nil
+	}
+}
+
+// buildServicePackage builds a chaincode-as-a-service package, holding the connection.json that
+// tells the peer where to reach the chaincode
+func buildServicePackage(label string, connection *ChaincodeConnection) []byte {
+	connectionJSON, _ := json.Marshal(connection)
+	metadataJSON, _ := json.Marshal(&chaincodePackageMetadata{Type: "ccaas", Label: label})
+	return tarGzip([]*packageFile{
+		{name: packageMetadataFile, content: metadataJSON},
+		{name: packageCodeFile, content: tarGzip([]*packageFile{{name: connectionFile, content: connectionJSON}})},
+	})
+}
+
+type packageFile struct {
+	name    string
+	content []byte
+}
+
+// tarGzip writes the files in order, which Fabric expects to start with the metadata.json.
+// Writing to memory does not fail.
+func tarGzip(files []*packageFile) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		_ = tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content))})
+		_, _ = tw.Write(file.content)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,474 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly/mocks/coremocks"
+	"github.com/hyperledger/firefly/mocks/metricsmocks"
+	"github.com/hyperledger/firefly/pkg/core"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestDeployFabric(t *testing.T) (*Fabric, *coremocks.OperationCallbacks, func()) {
+	e, cancel := newTestFabric()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	mmm := &metricsmocks.Manager{}
+	mmm.On("IsMetricsEnabled").Return(true)
+	mmm.On("BlockchainContractDeployment").Return()
+	e.metrics = mmm
+	em := &coremocks.OperationCallbacks{}
+	e.SetOperationHandler("ns1", em)
+	return e, em, func() {
+		httpmock.DeactivateAndReset()
+		cancel()
+		mmm.AssertExpectations(t)
+		em.AssertExpectations(t)
+	}
+}
+
+func testChaincodePackage(label string) []byte {
+	metadata, _ := json.Marshal(&chaincodePackageMetadata{Path: "oemContract", Type: "golang", Label: label})
+	return tarGzip([]*packageFile{
+		{name: packageMetadataFile, content: metadata},
+		{name: packageCodeFile, content: tarGzip([]*packageFile{{name: "src/oemContract.go", content: []byte("package main")}})},
+	})
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(b)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func phaseStatuses(update *core.OperationUpdate) []string {
+	statuses := []string{}
+	for _, phase := range update.Output.GetObjectArray("phases") {
+		statuses = append(statuses, phase.GetString("phase")+"="+phase.GetString("status"))
+	}
+	return statuses
+}
+
+func TestDeployContractServiceOK(t *testing.T) {
+	e, em, done := newTestDeployFabric(t)
+	defer done()
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/install`,
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			headers := body["headers"].(map[string]interface{})
+			assert.Equal(t, "signer001", headers["signer"])
+			assert.Equal(t, "firefly", headers["channel"])
+			assert.Equal(t, "oem_1", body["label"])
+			pkg, err := base64.StdEncoding.DecodeString(body["package"].(string))
+			assert.NoError(t, err)
+			label, err := readPackageLabel(context.Background(), pkg)
+			assert.NoError(t, err)
+			assert.Equal(t, "oem_1", label)
+			return httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{PackageID: "oem_1:abcd"})(req)
+		})
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/approve`,
+		func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "true", req.Header.Get("x-firefly-sync"))
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			assert.Equal(t, "oemContract", body["chaincode"])
+			assert.Equal(t, "1.0", body["version"])
+			assert.Equal(t, float64(2), body["sequence"])
+			assert.Equal(t, "oem_1:abcd", body["packageId"])
+			assert.Equal(t, "OR('OEMMSP.peer','AirlineMSP.peer')", body["endorsementPolicy"])
+			assert.Equal(t, "customValue", body["customOption"])
+			return httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{TransactionID: "tx1"})(req)
+		})
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/commit`,
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			assert.Equal(t, "oemContract", body["chaincode"])
+			assert.Nil(t, body["packageId"])
+			return httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{TransactionID: "tx2"})(req)
+		})
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID &&
+			update.Status == core.OpStatusPending &&
+			update.BlockchainTXID == "" &&
+			assert.Equal(t, []string{"install=Succeeded", "approve=Pending", "commit=Pending"}, phaseStatuses(update))
+	})).Return().Once()
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusPending &&
+			update.BlockchainTXID == "tx1" &&
+			assert.Equal(t, []string{"install=Succeeded", "approve=Succeeded", "commit=Pending"}, phaseStatuses(update))
+	})).Return().Once()
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusSucceeded &&
+			update.BlockchainTXID == "tx2" &&
+			update.Plugin == "fabric" &&
+			update.Output.GetString("packageId") == "oem_1:abcd" &&
+			update.Output.GetObject("contractLocation").GetString("chaincode") == "oemContract"
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	submissionRejected, err := e.DeployContract(context.Background(), nsOpID, signer,
+		fftypes.JSONAnyPtr(`{"chaincode": "oemContract", "label": "oem_1", "version": "1.0", "sequence": 2, "endorsementPolicy": "OR('OEMMSP.peer','AirlineMSP.peer')"}`),
+		fftypes.JSONAnyPtr(`{"connection": {"address": "oem-contract:9999", "dial_timeout": "10s"}}`),
+		nil, map[string]interface{}{"customOption": "customValue"})
+	assert.NoError(t, err)
+	assert.False(t, submissionRejected)
+	<-finished
+}
+
+func TestDeployContractPackageApproveOnly(t *testing.T) {
+	e, em, done := newTestDeployFabric(t)
+	defer done()
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+	pkg := testChaincodePackage("oem_2")
+	hash := sha256.Sum256(pkg)
+	packageID := "oem_2:" + hex.EncodeToString(hash[:])
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/install`,
+		httpmock.NewJsonResponderOrPanic(409, fftypes.JSONObject{"error": "chaincode already successfully installed"}))
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/approve`,
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			assert.Equal(t, packageID, body["packageId"])
+			assert.Equal(t, "1", body["version"])
+			assert.Nil(t, body["endorsementPolicy"])
+			return httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{TransactionID: "tx1"})(req)
+		})
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusPending
+	})).Return().Once()
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusSucceeded &&
+			update.BlockchainTXID == "tx1" &&
+			assert.Equal(t, []string{"install=Succeeded", "approve=Succeeded"}, phaseStatuses(update))
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	definition, _ := json.Marshal(&ChaincodeDefinition{Chaincode: "oemContract", Sequence: 1, ApproveOnly: true})
+	contract, _ := json.Marshal(&ChaincodeContract{Package: pkg})
+	submissionRejected, err := e.DeployContract(context.Background(), nsOpID, signer, fftypes.JSONAnyPtrBytes(definition), fftypes.JSONAnyPtrBytes(contract), nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, submissionRejected)
+	<-finished
+}
+
+func TestDeployContractCommitFail(t *testing.T) {
+	e, em, done := newTestDeployFabric(t)
+	defer done()
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/install`,
+		httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{}))
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/approve`,
+		httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{TransactionID: "tx1"}))
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/commit`,
+		httpmock.NewJsonResponderOrPanic(500, fftypes.JSONObject{"error": "chaincode definition not agreed to by this org"}))
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusPending
+	})).Return().Twice()
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		phases := update.Output.GetObjectArray("phases")
+		return update.Status == core.OpStatusFailed &&
+			update.BlockchainTXID == "tx1" &&
+			assert.Regexp(t, "FF10284.*not agreed to", update.ErrorMessage) &&
+			assert.Equal(t, []string{"install=Succeeded", "approve=Succeeded", "commit=Failed"}, phaseStatuses(update)) &&
+			assert.Regexp(t, "not agreed to", phases[2].GetString("error")) &&
+			update.Output["contractLocation"] == nil
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	_, err := e.DeployContract(context.Background(), nsOpID, signer,
+		fftypes.JSONAnyPtr(`{"chaincode": "oemContract", "label": "oem_1", "sequence": 1}`),
+		fftypes.JSONAnyPtr(`{"connection": {"address": "oem-contract:9999"}}`),
+		nil, nil)
+	assert.NoError(t, err)
+	<-finished
+}
+
+func TestDeployContractInstallFail(t *testing.T) {
+	e, em, done := newTestDeployFabric(t)
+	defer done()
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/install`,
+		httpmock.NewJsonResponderOrPanic(500, fftypes.JSONObject{"error": "pop"}))
+
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusFailed &&
+			assert.Equal(t, []string{"install=Failed", "approve=Pending", "commit=Pending"}, phaseStatuses(update))
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	_, err := e.DeployContract(context.Background(), nsOpID, signer,
+		fftypes.JSONAnyPtr(`{"chaincode": "oemContract", "label": "oem_1", "sequence": 1}`),
+		fftypes.JSONAnyPtr(`{"connection": {"address": "oem-contract:9999"}}`),
+		nil, nil)
+	assert.NoError(t, err)
+	<-finished
+}
+
+func TestDeployContractBadOption(t *testing.T) {
+	e, em, done := newTestDeployFabric(t)
+	defer done()
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/install`,
+		httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{}))
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusPending
+	})).Return().Once()
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusFailed &&
+			assert.Regexp(t, "FF10398", update.ErrorMessage)
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	_, err := e.DeployContract(context.Background(), nsOpID, signer,
+		fftypes.JSONAnyPtr(`{"chaincode": "oemContract", "label": "oem_1", "sequence": 1}`),
+		fftypes.JSONAnyPtr(`{"connection": {"address": "oem-contract:9999"}}`),
+		nil, map[string]interface{}{"sequence": 3})
+	assert.NoError(t, err)
+	<-finished
+}
+
+func TestDeployContractInvalid(t *testing.T) {
+	e, _, done := newTestDeployFabric(t)
+	defer done()
+
+	validDefinition := `{"chaincode": "oemContract", "label": "oem_1", "sequence": 1}`
+	validContract := `{"connection": {"address": "oem-contract:9999"}}`
+	pkg := func(b []byte) string {
+		contract, _ := json.Marshal(&ChaincodeContract{Package: b})
+		return string(contract)
+	}
+	noLabel, _ := json.Marshal(&chaincodePackageMetadata{Type: "golang"})
+
+	tests := []struct {
+		name       string
+		definition string
+		contract   string
+		input      []interface{}
+		err        string
+	}{
+		{"bad definition", `[]`, validContract, nil, "FF10465.*definition"},
+		{"bad contract", validDefinition, `"not base64"`, nil, "FF10465.*contract"},
+		{"input", validDefinition, validContract, []interface{}{"x"}, "FF10465.*'input'"},
+		{"no chaincode", `{"label": "oem_1", "sequence": 1}`, validContract, nil, "FF10465.*'chaincode'"},
+		{"no sequence", `{"chaincode": "oemContract", "label": "oem_1"}`, validContract, nil, "FF10465.*'sequence'"},
+		{"no package", validDefinition, `{}`, nil, "FF10465.*one of"},
+		{"both", validDefinition, `{"package": "", "connection": {"address": "oem-contract:9999"}}`, nil, "FF10465.*only one of"},
+		{"no label", `{"chaincode": "oemContract", "sequence": 1}`, validContract, nil, "FF10465.*'label'"},
+		{"no address", validDefinition, `{"connection": {}}`, nil, "FF10465.*'address'"},
+		{"label mismatch", validDefinition, pkg(testChaincodePackage("oem_2")), nil, "FF10465.*does not match"},
+		{"not gzip", validDefinition, pkg([]byte("not a package")), nil, "FF10465.*not a gzipped tar"},
+		{"not tar", validDefinition, pkg(gzipped(bytes.Repeat([]byte("not a tar archive"), 50))), nil, "FF10465.*not a gzipped tar"},
+		{"no metadata", validDefinition, pkg(tarGzip([]*packageFile{{name: packageCodeFile}})), nil, "FF10465.*no metadata.json"},
+		{"no package label", validDefinition, pkg(tarGzip([]*packageFile{{name: packageMetadataFile, content: noLabel}})), nil, "FF10465.*no label"},
+	}
+	for _, tc := range tests {
+		submissionRejected, err := e.DeployContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), signer,
+			fftypes.JSONAnyPtr(tc.definition), fftypes.JSONAnyPtr(tc.contract), tc.input, nil)
+		assert.Regexp(t, tc.err, err, tc.name)
+		assert.True(t, submissionRejected, tc.name)
+	}
+}
+
+func TestDeployContractNoChannel(t *testing.T) {
+	e, _, done := newTestDeployFabric(t)
+	defer done()
+	e.defaultChannel = ""
+
+	_, err := e.DeployContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), signer,
+		fftypes.JSONAnyPtr(`{"chaincode": "oemContract", "label": "oem_1", "sequence": 1}`),
+		fftypes.JSONAnyPtr(`{"connection": {"address": "oem-contract:9999"}}`),
+		nil, nil)
+	assert.Regexp(t, "FF10465.*'channel'", err)
+}
+
+func testDeployOperation(t *testing.T, output string) *core.Operation {
+	var input, out fftypes.JSONObject
+	err := json.Unmarshal([]byte(`{
+		"key": "signer001",
+		"definition": {"channel": "firefly", "chaincode": "oemContract", "label": "oem_1", "sequence": 2},
+		"contract": {"connection": {"address": "oem-contract:9999"}},
+		"input": [],
+		"options": {"customOption": "customValue"}
+	}`), &input)
+	assert.NoError(t, err)
+	err = json.Unmarshal([]byte(output), &out)
+	assert.NoError(t, err)
+	return &core.Operation{
+		ID:        fftypes.NewUUID(),
+		Namespace: "ns1",
+		Type:      core.OpTypeBlockchainContractDeploy,
+		Status:    core.OpStatusPending,
+		Input:     input,
+		Output:    out,
+	}
+}
+
+func TestDeployContractResume(t *testing.T) {
+	e, em, done := newTestTxStatusFabric(t)
+	defer done()
+
+	op := testDeployOperation(t, `{
+		"packageId": "oem_1:abcd",
+		"phases": [
+			{"phase": "install", "status": "Succeeded"},
+			{"phase": "approve", "status": "Pending"},
+			{"phase": "commit", "status": "Pending"}
+		]
+	}`)
+	nsOpID := "ns1:" + op.ID.String()
+
+	// The approval went through before FireFly restarted, but was never recorded
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/approve`,
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			assert.Equal(t, "oem_1:abcd", body["packageId"])
+			assert.Equal(t, "customValue", body["customOption"])
+			return httpmock.NewJsonResponderOrPanic(409, fftypes.JSONObject{"error": "attempted to redefine uncommitted sequence (2) with unchanged content"})(req)
+		})
+	httpmock.RegisterResponder("POST", `http://localhost:12345/chaincodes/commit`,
+		httpmock.NewJsonResponderOrPanic(200, &fabLifecycleResponse{TransactionID: "tx2"}))
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID &&
+			update.Status == core.OpStatusPending &&
+			assert.Equal(t, []string{"install=Succeeded", "approve=Succeeded", "commit=Pending"}, phaseStatuses(update))
+	})).Return().Once()
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID &&
+			update.Status == core.OpStatusSucceeded &&
+			update.BlockchainTXID == "tx2" &&
+			update.Output.GetString("packageId") == "oem_1:abcd"
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, &DeploymentStatus{
+		PackageID: "oem_1:abcd",
+		Phases: []*LifecyclePhase{
+			{Phase: lifecyclePhaseInstall, Status: core.OpStatusSucceeded},
+			{Phase: lifecyclePhaseApprove, Status: core.OpStatusPending},
+			{Phase: lifecyclePhaseCommit, Status: core.OpStatusPending},
+		},
+	}, status)
+	<-finished
+	assert.Eventually(t, func() bool {
+		e.deployMux.Lock()
+		defer e.deployMux.Unlock()
+		return len(e.deployments) == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestDeployContractResumeAllPhasesDone(t *testing.T) {
+	e, em, done := newTestTxStatusFabric(t)
+	defer done()
+
+	op := testDeployOperation(t, `{
+		"phases": [
+			{"phase": "install", "status": "Succeeded"},
+			{"phase": "approve", "status": "Succeeded", "transactionId": "tx1"},
+			{"phase": "commit", "status": "Succeeded", "transactionId": "tx2"}
+		]
+	}`)
+	finished := make(chan struct{})
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusSucceeded && update.BlockchainTXID == "tx2"
+	})).Return().Run(func(args mock.Arguments) {
+		close(finished)
+	}).Once()
+
+	_, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	<-finished
+}
+
+func TestDeployContractStatusRunning(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	op := testDeployOperation(t, `{}`)
+	e.deployments = map[string]bool{"ns1:" + op.ID.String(): true}
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, &DeploymentStatus{Phases: []*LifecyclePhase{}}, status)
+}
+
+func TestDeployContractStatusComplete(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	op := testDeployOperation(t, `{"phases": [{"phase": "install", "status": "Failed", "error": "pop"}]}`)
+	op.Status = core.OpStatusFailed
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, &DeploymentStatus{
+		Phases: []*LifecyclePhase{{Phase: lifecyclePhaseInstall, Status: core.OpStatusFailed, Error: "pop"}},
+	}, status)
+}
+
+func TestDeployContractResumeInvalid(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	op := testDeployOperation(t, `{}`)
+	op.Input["contract"] = map[string]interface{}{}
+
+	_, err := e.GetTransactionStatus(context.Background(), op)
+	assert.Regexp(t, "FF10465", err)
+}
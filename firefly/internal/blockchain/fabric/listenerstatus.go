@@ -0,0 +1,241 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly/internal/blockchain/common"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/internal/metrics"
+)
+
+// ListenerCheckpoint identifies an event delivered on a contract listener, by its block and transaction
+type ListenerCheckpoint struct {
+	Block         uint64 `json:"block"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+// ListenerStatus is the progress of a contract listener through the blocks of its channel.
+// ChannelHeight is the number of blocks on the channel, so the last block is ChannelHeight - 1
+type ListenerStatus struct {
+	Checkpoint    ListenerCheckpoint `json:"checkpoint"`
+	LastDelivered ListenerCheckpoint `json:"lastDelivered"`
+	ChannelHeight uint64             `json:"channelHeight"`
+	Error         string             `json:"error,omitempty"`
+}
+
+type fabChainInfoResponse struct {
+	Result struct {
+		Height uint64 `json:"height"`
+	} `json:"result"`
+}
+
+// listenerProgress is tracked for each contract listener subscription, as FabConnect does not
+// report how far through the chain it has delivered events
+type listenerProgress struct {
+	namespace string
+	listener  string
+	channel   string
+	signer    string
+	inFlight  bool
+	status    ListenerStatus
+}
+
+func listenerLabels(subName string) (namespace, listener string) {
+	namespace = common.GetNamespaceFromSubName(subName)
+	listener = strings.TrimPrefix(strings.TrimPrefix(subName, "ff-sub-"), namespace+"-")
+	return namespace, listener
+}
+
+// getListenerProgress must be called with the listener lock held
+func (f *Fabric) getListenerProgress(subID, subName string) *listenerProgress {
+	if f.listeners == nil {
+		f.listeners = make(map[string]*listenerProgress)
+	}
+	progress := f.listeners[subID]
+	if progress == nil {
+		progress = &listenerProgress{}
+		progress.namespace, progress.listener = listenerLabels(subName)
+		f.listeners[subID] = progress
+	}
+	return progress
+}
+
+func (f *Fabric) emitListenerMetrics(progress *listenerProgress) {
+	if f.metrics.IsMetricsEnabled() {
+		f.metrics.BlockchainListenerStatus(progress.namespace, progress.listener, &metrics.BlockchainListenerStatus{
+			DeliveredBlock:  progress.status.LastDelivered.Block,
+			CheckpointBlock: progress.status.Checkpoint.Block,
+			ChainHeight:     progress.status.ChannelHeight,
+			Errored:         progress.status.Error != "",
+		})
+	}
+}
+
+// trackListener records the channel a contract listener subscription follows, so that the height of
+// the channel is reported for it from the start, whether or not any events arrive
+func (f *Fabric) trackListener(sub *subscription) *listenerProgress {
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	progress := f.getListenerProgress(sub.ID, sub.Name)
+	progress.channel = sub.Channel
+	progress.signer = sub.Signer
+	return progress
+}
+
+// listenerEventDelivered records an event from a contract listener that is about to be dispatched
+func (f *Fabric) listenerEventDelivered(subID, subName string, blockNumber uint64, txID string) {
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	progress := f.getListenerProgress(subID, subName)
+	progress.status.LastDelivered = ListenerCheckpoint{Block: blockNumber, TransactionID: txID}
+	progress.inFlight = true
+}
+
+// listenerBatchComplete moves the checkpoint of every listener with events in the batch up to the last
+// delivered event, or records the error if the batch was rejected and will be redelivered.
+// Listeners without events in the batch keep their checkpoint, as FabConnect does not tell us how far
+// through the channel it has read for them.
+func (f *Fabric) listenerBatchComplete(err error) {
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	for _, progress := range f.listeners {
+		if !progress.inFlight {
+			continue
+		}
+		progress.inFlight = false
+		if err == nil {
+			progress.status.Checkpoint = progress.status.LastDelivered
+			progress.status.Error = ""
+		} else {
+			progress.status.Error = err.Error()
+		}
+		f.emitListenerMetrics(progress)
+	}
+}
+
+func (f *Fabric) removeListenerProgress(subID string) {
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	if progress, ok := f.listeners[subID]; ok {
+		delete(f.listeners, subID)
+		if f.metrics.IsMetricsEnabled() {
+			f.metrics.BlockchainListenerRemoved(progress.namespace, progress.listener)
+		}
+	}
+}
+
+func (f *Fabric) getChannelHeight(ctx context.Context, channel, signer string) (uint64, error) {
+	var resErr common.BlockchainRESTError
+	var chainInfo fabChainInfoResponse
+	res, err := f.client.R().
+		SetContext(ctx).
+		SetError(&resErr).
+		SetResult(&chainInfo).
+		SetQueryParam("fly-channel", channel).
+		SetQueryParam("fly-signer", signer).
+		Get("/chaininfo")
+	if err != nil || !res.IsSuccess() {
+		return 0, common.WrapRESTError(ctx, &resErr, res, err, coremsgs.MsgFabconnectRESTErr)
+	}
+	return chainInfo.Result.Height, nil
+}
+
+// refreshListenerStatus queries the height of the channel of every tracked listener, so that
+// listeners that have stalled can be spotted even when no events are arriving for them.
+// Listeners created before FireFly started are picked up from the subscriptions in FabConnect.
+func (f *Fabric) refreshListenerStatus(ctx context.Context) {
+	subs, err := f.streams.getSubscriptions(ctx)
+	if err != nil {
+		log.L(ctx).Warnf("Failed to query listener subscriptions: %s", err)
+	}
+	for _, sub := range subs {
+		if sub.Stream == f.streamID && strings.HasPrefix(sub.Name, "ff-sub-") {
+			f.trackListener(sub)
+		}
+	}
+
+	type channelKey struct{ channel, signer string }
+	f.listenerMux.Lock()
+	channels := make(map[channelKey]uint64)
+	for _, progress := range f.listeners {
+		if progress.channel != "" {
+			channels[channelKey{progress.channel, progress.signer}] = 0
+		}
+	}
+	f.listenerMux.Unlock()
+
+	for key := range channels {
+		height, err := f.getChannelHeight(ctx, key.channel, key.signer)
+		if err != nil {
+			log.L(ctx).Warnf("Failed to query height of channel '%s': %s", key.channel, err)
+			delete(channels, key)
+			continue
+		}
+		channels[key] = height
+	}
+
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	for _, progress := range f.listeners {
+		if height, ok := channels[channelKey{progress.channel, progress.signer}]; ok {
+			progress.status.ChannelHeight = height
+			f.emitListenerMetrics(progress)
+		}
+	}
+}
+
+func (f *Fabric) listenerStatusLoop() {
+	ticker := time.NewTicker(f.listenerStatusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.ctx.Done():
+			log.L(f.ctx).Debugf("Listener status loop exiting")
+			return
+		case <-ticker.C:
+			f.refreshListenerStatus(f.ctx)
+		}
+	}
+}
+
+func (f *Fabric) GetContractListenerStatus(ctx context.Context, subID string, okNotFound bool) (bool, interface{}, error) {
+	sub, err := f.streams.getSubscription(ctx, subID, okNotFound)
+	if err != nil || sub == nil {
+		return false, nil, err
+	}
+
+	// The height is informational, so the status is still returned if it cannot be queried
+	height, err := f.getChannelHeight(ctx, sub.Channel, sub.Signer)
+	if err != nil {
+		log.L(ctx).Warnf("Failed to query height of channel '%s' for listener '%s': %s", sub.Channel, subID, err)
+	}
+
+	progress := f.trackListener(sub)
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	if err == nil {
+		progress.status.ChannelHeight = height
+		f.emitListenerMetrics(progress)
+	}
+	status := progress.status
+	return true, &status, nil
+}
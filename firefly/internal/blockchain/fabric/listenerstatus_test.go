@@ -0,0 +1,366 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly/internal/metrics"
+	"github.com/hyperledger/firefly/mocks/blockchainmocks"
+	"github.com/hyperledger/firefly/mocks/metricsmocks"
+	"github.com/hyperledger/firefly/pkg/core"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testListenerID = "9f2a6c32-8f4b-4d4e-b5e7-5d1f7e3a9c11"
+
+func newTestListenerStatusFabric(t *testing.T) (*Fabric, *metricsmocks.Manager, func()) {
+	e, cancel := newTestFabric()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	e.streams = newTestStreamManager(e.client, e.signer)
+	mmm := &metricsmocks.Manager{}
+	mmm.On("IsMetricsEnabled").Return(true).Maybe()
+	e.metrics = mmm
+	return e, mmm, func() {
+		httpmock.DeactivateAndReset()
+		cancel()
+		mmm.AssertExpectations(t)
+	}
+}
+
+func registerTestListenerSub(subID string) {
+	httpmock.RegisterResponder("GET", fmt.Sprintf("http://localhost:12345/subscriptions/%s", subID),
+		httpmock.NewJsonResponderOrPanic(200, subscription{
+			ID:      subID,
+			Name:    "ff-sub-ns1-" + testListenerID,
+			Channel: "firefly",
+			Signer:  "signer001",
+		}))
+}
+
+func registerTestChainInfo(t *testing.T, height uint64) {
+	httpmock.RegisterResponder("GET", "http://localhost:12345/chaininfo",
+		func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "firefly", req.URL.Query().Get("fly-channel"))
+			assert.Equal(t, "signer001", req.URL.Query().Get("fly-signer"))
+			return httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"result": map[string]interface{}{
+					"height": height,
+				},
+			})(req)
+		})
+}
+
+func testContractEventBatch(t *testing.T, subID string, blockNumber int) []interface{} {
+	var events []interface{}
+	err := json.Unmarshal([]byte(fmt.Sprintf(`[
+		{
+			"chaincodeId": "basic",
+			"blockNumber": %d,
+			"transactionId": "tx%d",
+			"eventName": "AssetCreated",
+			"payload": "eyJJRCI6IjEyMzQifQ==",
+			"subId": "%s"
+		}
+	]`, blockNumber, blockNumber, subID)), &events)
+	assert.NoError(t, err)
+	return events
+}
+
+func TestGetContractListenerStatus(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	registerTestListenerSub("sb-1")
+	registerTestChainInfo(t, 20)
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{ChainHeight: 20}).Return()
+
+	found, status, err := e.GetContractListenerStatus(context.Background(), "sb-1", false)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, &ListenerStatus{ChannelHeight: 20}, status)
+}
+
+func TestGetContractListenerStatusNotFound(t *testing.T) {
+	e, _, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	httpmock.RegisterResponder("GET", "http://localhost:12345/subscriptions/sb-1",
+		httpmock.NewStringResponder(404, "not found"))
+
+	found, status, err := e.GetContractListenerStatus(context.Background(), "sb-1", true)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Nil(t, status)
+
+	_, _, err = e.GetContractListenerStatus(context.Background(), "sb-1", false)
+	assert.Regexp(t, "FF10284", err)
+}
+
+func TestGetContractListenerStatusChainInfoFail(t *testing.T) {
+	e, _, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	registerTestListenerSub("sb-1")
+	httpmock.RegisterResponder("GET", "http://localhost:12345/chaininfo",
+		httpmock.NewStringResponder(500, "pop"))
+
+	found, status, err := e.GetContractListenerStatus(context.Background(), "sb-1", false)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, &ListenerStatus{}, status)
+}
+
+func TestContractListenerProgress(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	em := &blockchainmocks.Callbacks{}
+	e.SetHandler("ns1", em)
+	registerTestListenerSub("sb-1")
+
+	em.On("BlockchainEventBatch", mock.Anything).Return(nil).Once()
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{
+		DeliveredBlock:  10,
+		CheckpointBlock: 10,
+	}).Return().Once()
+	err := e.handleMessageBatch(context.Background(), testContractEventBatch(t, "sb-1", 10))
+	assert.NoError(t, err)
+
+	em.On("BlockchainEventBatch", mock.Anything).Return(fmt.Errorf("pop")).Once()
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{
+		DeliveredBlock:  12,
+		CheckpointBlock: 10,
+		Errored:         true,
+	}).Return().Once()
+	err = e.handleMessageBatch(context.Background(), testContractEventBatch(t, "sb-1", 12))
+	assert.Regexp(t, "pop", err)
+
+	// A batch without events for the listener leaves its status alone
+	err = e.handleMessageBatch(context.Background(), []interface{}{})
+	assert.NoError(t, err)
+
+	registerTestChainInfo(t, 15)
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{
+		DeliveredBlock:  12,
+		CheckpointBlock: 10,
+		ChainHeight:     15,
+		Errored:         true,
+	}).Return().Once()
+	_, status, err := e.GetContractListenerStatus(context.Background(), "sb-1", false)
+	assert.NoError(t, err)
+	assert.Equal(t, &ListenerStatus{
+		Checkpoint:    ListenerCheckpoint{Block: 10, TransactionID: "tx10"},
+		LastDelivered: ListenerCheckpoint{Block: 12, TransactionID: "tx12"},
+		ChannelHeight: 15,
+		Error:         "pop",
+	}, status)
+
+	mmm.On("BlockchainListenerRemoved", "ns1", testListenerID).Return().Once()
+	httpmock.RegisterResponder("DELETE", "http://localhost:12345/subscriptions/sb-1",
+		httpmock.NewStringResponder(204, ""))
+	err = e.DeleteContractListener(context.Background(), &core.ContractListener{BackendID: "sb-1"}, false)
+	assert.NoError(t, err)
+	assert.Empty(t, e.listeners)
+
+	em.AssertExpectations(t)
+}
+
+func TestContractListenerProgressIdleListenersUnchanged(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	em := &blockchainmocks.Callbacks{}
+	e.SetHandler("ns1", em)
+	registerTestListenerSub("sb-1")
+	e.listeners = map[string]*listenerProgress{
+		"sb-1": {namespace: "ns1", listener: testListenerID, channel: "firefly", signer: "signer001"},
+		"sb-2": {namespace: "ns1", listener: "listener2", channel: "firefly", signer: "signer001", status: ListenerStatus{Checkpoint: ListenerCheckpoint{Block: 5}}},
+	}
+
+	em.On("BlockchainEventBatch", mock.Anything).Return(nil).Once()
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{
+		DeliveredBlock:  10,
+		CheckpointBlock: 10,
+	}).Return().Once()
+	err := e.handleMessageBatch(context.Background(), testContractEventBatch(t, "sb-1", 10))
+	assert.NoError(t, err)
+
+	// A listener on the same channel without events in the batch keeps its own checkpoint
+	assert.Equal(t, ListenerCheckpoint{Block: 5}, e.listeners["sb-2"].status.Checkpoint)
+	assert.Equal(t, ListenerCheckpoint{}, e.listeners["sb-2"].status.LastDelivered)
+	em.AssertExpectations(t)
+	mmm.AssertExpectations(t)
+}
+
+func TestAddContractListenerTracksChannel(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	e.streamID = "es-1"
+	httpmock.RegisterResponder("POST", "http://localhost:12345/subscriptions",
+		httpmock.NewJsonResponderOrPanic(200, subscription{
+			ID:      "sb-1",
+			Name:    "ff-sub-ns1-" + testListenerID,
+			Channel: "firefly",
+			Signer:  "signer001",
+			Stream:  "es-1",
+		}))
+	err := e.AddContractListener(context.Background(), &core.ContractListener{
+		Location: fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"basic"}`),
+		Event:    &core.FFISerializedEvent{},
+		Options:  &core.ContractListenerOptions{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &listenerProgress{
+		namespace: "ns1",
+		listener:  testListenerID,
+		channel:   "firefly",
+		signer:    "signer001",
+	}, e.listeners["sb-1"])
+
+	// The new listener reports the height of its channel before any events arrive for it
+	httpmock.RegisterResponder("GET", "http://localhost:12345/subscriptions",
+		httpmock.NewStringResponder(500, "pop"))
+	registerTestChainInfo(t, 20)
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{ChainHeight: 20}).Return().Once()
+	e.refreshListenerStatus(context.Background())
+}
+
+func TestRefreshListenerStatusFromSubscriptions(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	e.streamID = "es-1"
+	httpmock.RegisterResponder("GET", "http://localhost:12345/subscriptions",
+		httpmock.NewJsonResponderOrPanic(200, []*subscription{
+			{ID: "sb-1", Name: "ff-sub-ns1-" + testListenerID, Channel: "firefly", Signer: "signer001", Stream: "es-1"},
+			{ID: "sb-2", Name: "ns1_BatchPin", Channel: "firefly", Signer: "signer001", Stream: "es-1"},
+			{ID: "sb-3", Name: "ff-sub-ns1-" + testListenerID, Channel: "firefly", Signer: "signer001", Stream: "es-2"},
+		}))
+	registerTestChainInfo(t, 20)
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{ChainHeight: 20}).Return().Once()
+
+	e.refreshListenerStatus(context.Background())
+	assert.Len(t, e.listeners, 1)
+	assert.Equal(t, uint64(20), e.listeners["sb-1"].status.ChannelHeight)
+}
+
+func TestContractListenerProgressBatchRejected(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	registerTestListenerSub("sb-1")
+	httpmock.RegisterResponder("GET", "http://localhost:12345/subscriptions/sb-2",
+		httpmock.NewStringResponder(500, "pop"))
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{
+		DeliveredBlock: 10,
+		Errored:        true,
+	}).Return().Once()
+
+	events := append(testContractEventBatch(t, "sb-1", 10), testContractEventBatch(t, "sb-2", 11)...)
+	err := e.handleMessageBatch(context.Background(), events)
+	assert.Regexp(t, "FF10284", err)
+	assert.False(t, e.listeners["sb-1"].inFlight)
+	assert.Regexp(t, "FF10284", e.listeners["sb-1"].status.Error)
+}
+
+func TestRefreshListenerStatus(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	e.listeners = map[string]*listenerProgress{
+		"sb-1": {namespace: "ns1", listener: "listener1", channel: "firefly", signer: "signer001"},
+		"sb-2": {namespace: "ns1", listener: "listener2", channel: "firefly", signer: "signer001"},
+		"sb-3": {namespace: "ns1", listener: "listener3", channel: "other", signer: "signer001"},
+		"sb-4": {namespace: "ns1", listener: "listener4"},
+	}
+	httpmock.RegisterResponder("GET", "http://localhost:12345/chaininfo",
+		func(req *http.Request) (*http.Response, error) {
+			if req.URL.Query().Get("fly-channel") == "other" {
+				return httpmock.NewStringResponse(500, "pop"), nil
+			}
+			return httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+				"result": map[string]interface{}{
+					"height": 30,
+				},
+			})(req)
+		})
+	mmm.On("BlockchainListenerStatus", "ns1", "listener1", &metrics.BlockchainListenerStatus{ChainHeight: 30}).Return().Once()
+	mmm.On("BlockchainListenerStatus", "ns1", "listener2", &metrics.BlockchainListenerStatus{ChainHeight: 30}).Return().Once()
+
+	e.refreshListenerStatus(context.Background())
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["GET http://localhost:12345/chaininfo"])
+	assert.Equal(t, uint64(30), e.listeners["sb-1"].status.ChannelHeight)
+	assert.Equal(t, uint64(0), e.listeners["sb-3"].status.ChannelHeight)
+}
+
+func TestListenerStatusLoop(t *testing.T) {
+	e, mmm, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	e.listenerStatusInterval = 1 * time.Millisecond
+	e.listeners = map[string]*listenerProgress{
+		"sb-1": {namespace: "ns1", listener: testListenerID, channel: "firefly", signer: "signer001"},
+	}
+	registerTestChainInfo(t, 5)
+	refreshed := make(chan struct{}, 1)
+	mmm.On("BlockchainListenerStatus", "ns1", testListenerID, &metrics.BlockchainListenerStatus{ChainHeight: 5}).
+		Run(func(args mock.Arguments) {
+			select {
+			case refreshed <- struct{}{}:
+			default:
+			}
+		}).Return()
+
+	loopDone := make(chan struct{})
+	go func() {
+		e.listenerStatusLoop()
+		close(loopDone)
+	}()
+	<-refreshed
+	e.cancelCtx()
+	<-loopDone
+}
+
+func TestDeleteContractListenerUntracked(t *testing.T) {
+	e, _, done := newTestListenerStatusFabric(t)
+	defer done()
+
+	httpmock.RegisterResponder("DELETE", "http://localhost:12345/subscriptions/sb-1",
+		httpmock.NewStringResponder(204, ""))
+	err := e.DeleteContractListener(context.Background(), &core.ContractListener{BackendID: "sb-1"}, false)
+	assert.NoError(t, err)
+}
+
+func TestListenerLabels(t *testing.T) {
+	namespace, listener := listenerLabels("ff-sub-ns1-" + testListenerID)
+	assert.Equal(t, "ns1", namespace)
+	assert.Equal(t, testListenerID, listener)
+
+	namespace, listener = listenerLabels("ff-sub-" + testListenerID)
+	assert.Equal(t, "", namespace)
+	assert.Equal(t, testListenerID, listener)
+}
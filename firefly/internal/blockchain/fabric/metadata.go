@@ -0,0 +1,350 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+)
+
+const (
+	// Chaincode built with fabric-contract-api exposes its metadata through this system contract
+	systemContractName     = "org.hyperledger.fabric"
+	getMetadataMethodName  = systemContractName + ":GetMetadata"
+	componentSchemasPrefix = "#/components/schemas/"
+)
+
+// FFIGenerationInput is the Fabric specific input to FFI generation. The contract metadata is either
+// supplied inline, or queried from the chaincode at the given location through fabconnect.
+type FFIGenerationInput struct {
+	Metadata *ContractChaincodeMetadata `json:"metadata,omitempty"`
+	Location *Location                  `json:"location,omitempty"`
+	Contract string                     `json:"contract,omitempty"`
+	Events   []*EventMetadata           `json:"events,omitempty"`
+}
+
+// ContractChaincodeMetadata is the output of org.hyperledger.fabric:GetMetadata
+type ContractChaincodeMetadata struct {
+	Info       *InfoMetadata                `json:"info,omitempty"`
+	Contracts  map[string]*ContractMetadata `json:"contracts"`
+	Components ComponentMetadata            `json:"components"`
+}
+
+type InfoMetadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+}
+
+type ContractMetadata struct {
+	Info         *InfoMetadata          `json:"info,omitempty"`
+	Name         string                 `json:"name"`
+	Transactions []*TransactionMetadata `json:"transactions"`
+	Default      bool                   `json:"default"`
+}
+
+type TransactionMetadata struct {
+	Name       string               `json:"name"`
+	Tag        []string             `json:"tag,omitempty"`
+	Parameters []*ParameterMetadata `json:"parameters,omitempty"`
+	Returns    fftypes.JSONObject   `json:"returns,omitempty"`
+}
+
+type ParameterMetadata struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Schema      fftypes.JSONObject `json:"schema"`
+}
+
+type ComponentMetadata struct {
+	Schemas map[string]fftypes.JSONObject `json:"schemas,omitempty"`
+}
+
+// EventMetadata declares an event emitted by the chaincode. Contract metadata does not describe events,
+// so they are listed in the generation input. The schema may refer to the metadata component schemas.
+type EventMetadata struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Schema      fftypes.JSONObject `json:"schema,omitempty"`
+}
+
+// fabMetadataQueryOutput is the fabconnect query output of org.hyperledger.fabric:GetMetadata, with the result kept
+// as raw JSON so that it is decoded once, whether fabconnect returns it as an object or as a string
+type fabMetadataQueryOutput struct {
+	Result json.RawMessage `json:"result"`
+}
+
+func (f *Fabric) GenerateFFI(ctx context.Context, generationRequest *fftypes.FFIGenerationRequest) (*fftypes.FFI, error) {
+	var input FFIGenerationInput
+	err := json.Unmarshal(generationRequest.Input.Bytes(), &input)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, coremsgs.MsgFFIGenerationFailed, "unable to deserialize JSON as contract metadata")
+	}
+	metadata := input.Metadata
+	if metadata == nil {
+		if input.Location == nil {
+			return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, "one of 'metadata' or 'location' must be set")
+		}
+		if metadata, err = f.queryContractMetadata(ctx, input.Location); err != nil {
+			return nil, err
+		}
+	}
+	return convertMetadataToFFI(ctx, generationRequest, metadata, input.Contract, input.Events)
+}
+
+func (f *Fabric) queryContractMetadata(ctx context.Context, location *Location) (*ContractChaincodeMetadata, error) {
+	if location.Channel == "" || location.Chaincode == "" {
+		return nil, i18n.NewError(ctx, coremsgs.MsgContractLocationInvalid, "'channel' and 'chaincode' must be set")
+	}
+	res, err := f.queryContractMethod(ctx, location.Channel, location.Chaincode, getMetadataMethodName, f.signer, "", []*PrefixItem{}, map[string]interface{}{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	output := &fabMetadataQueryOutput{}
+	if err = json.Unmarshal(res.Body(), output); err != nil {
+		return nil, i18n.WrapError(ctx, err, coremsgs.MsgFFIGenerationFailed, "unable to deserialize chaincode metadata query result")
+	}
+
+	// fabconnect returns the result as a JSON object when it parses, and as a string otherwise
+	var metadata ContractChaincodeMetadata
+	var metadataString string
+	if err = json.Unmarshal(output.Result, &metadataString); err == nil {
+		err = json.Unmarshal([]byte(metadataString), &metadata)
+	} else {
+		err = json.Unmarshal(output.Result, &metadata)
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, coremsgs.MsgFFIGenerationFailed, "unable to deserialize chaincode metadata")
+	}
+	return &metadata, nil
+}
+
+func convertMetadataToFFI(ctx context.Context, generationRequest *fftypes.FFIGenerationRequest, metadata *ContractChaincodeMetadata, contractName string, events []*EventMetadata) (*fftypes.FFI, error) {
+	contract, err := selectContract(ctx, metadata, contractName)
+	if err != nil {
+		return nil, err
+	}
+	resolver := &schemaResolver{components: metadata.Components.Schemas, resolving: map[string]bool{}}
+
+	ffi := &fftypes.FFI{
+		Namespace:   generationRequest.Namespace,
+		Name:        generationRequest.Name,
+		Version:     generationRequest.Version,
+		Description: generationRequest.Description,
+		Methods:     make([]*fftypes.FFIMethod, len(contract.Transactions)),
+		Events:      make([]*fftypes.FFIEvent, len(events)),
+	}
+	if ffi.Description == "" {
+		switch {
+		case contract.Info != nil && contract.Info.Description != "":
+			ffi.Description = contract.Info.Description
+		case metadata.Info != nil:
+			ffi.Description = metadata.Info.Description
+		}
+	}
+
+	// Transactions of any contract but the default one are invoked as "contract:transaction"
+	methodPrefix := ""
+	if !contract.Default {
+		methodPrefix = contract.Name + ":"
+	}
+	for i, tx := range contract.Transactions {
+		method := &fftypes.FFIMethod{
+			Name:    methodPrefix + tx.Name,
+			Params:  make(fftypes.FFIParams, len(tx.Parameters)),
+			Returns: fftypes.FFIParams{},
+		}
+		if len(tx.Tag) > 0 {
+			method.Details = fftypes.JSONObject{"tag": tx.Tag}
+		}
+		for j, param := range tx.Parameters {
+			schema, err := resolver.resolve(ctx, param.Schema)
+			if err != nil {
+				return nil, err
+			}
+			method.Params[j] = &fftypes.FFIParam{
+				Name:   param.Name,
+				Schema: fftypes.JSONAnyPtr(schema.String()),
+			}
+		}
+		if tx.Returns != nil {
+			schema, err := resolver.resolve(ctx, tx.Returns)
+			if err != nil {
+				return nil, err
+			}
+			method.Returns = append(method.Returns, &fftypes.FFIParam{
+				Name:   "",
+				Schema: fftypes.JSONAnyPtr(schema.String()),
+			})
+		}
+		ffi.Methods[i] = method
+	}
+
+	for i, event := range events {
+		if event.Name == "" {
+			return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, "event name must be set")
+		}
+		params, err := resolver.eventParams(ctx, event.Schema)
+		if err != nil {
+			return nil, err
+		}
+		ffi.Events[i] = &fftypes.FFIEvent{
+			FFIEventDefinition: fftypes.FFIEventDefinition{
+				Name:        event.Name,
+				Description: event.Description,
+				Params:      params,
+			},
+		}
+	}
+	return ffi, nil
+}
+
+// selectContract picks the named contract, or else the default contract of the chaincode,
+// or else its only contract besides the system contract
+func selectContract(ctx context.Context, metadata *ContractChaincodeMetadata, contractName string) (*ContractMetadata, error) {
+	if contractName != "" {
+		contract := metadata.Contracts[contractName]
+		if contract == nil {
+			return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, fmt.Sprintf("contract '%s' not found in chaincode metadata", contractName))
+		}
+		return contract, nil
+	}
+
+	names := make([]string, 0, len(metadata.Contracts))
+	for name, contract := range metadata.Contracts {
+		if contract.Default {
+			return contract, nil
+		}
+		if name != systemContractName {
+			names = append(names, name)
+		}
+	}
+	switch len(names) {
+	case 0:
+		return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, "chaincode metadata contains no contracts")
+	case 1:
+		return metadata.Contracts[names[0]], nil
+	default:
+		sort.Strings(names)
+		return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, fmt.Sprintf("'contract' must be set to one of: %s", strings.Join(names, ", ")))
+	}
+}
+
+// schemaResolver inlines references to the metadata component schemas, so that each FFI parameter
+// has a self-contained JSON schema
+type schemaResolver struct {
+	components map[string]fftypes.JSONObject
+	resolving  map[string]bool
+}
+
+func (r *schemaResolver) resolve(ctx context.Context, schema fftypes.JSONObject) (fftypes.JSONObject, error) {
+	if schema == nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, "parameter schema must be set")
+	}
+	resolved, err := r.resolveValue(ctx, map[string]interface{}(schema))
+	if err != nil {
+		return nil, err
+	}
+	return fftypes.JSONObject(resolved.(map[string]interface{})), nil
+}
+
+func (r *schemaResolver) resolveValue(ctx context.Context, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			return r.resolveRef(ctx, ref)
+		}
+		resolved := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			if key == "$id" {
+				continue
+			}
+			resolvedChild, err := r.resolveValue(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = resolvedChild
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, child := range v {
+			resolvedChild, err := r.resolveValue(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = resolvedChild
+		}
+		return resolved, nil
+	default:
+		return v, nil
+	}
+}
+
+func (r *schemaResolver) resolveRef(ctx context.Context, ref string) (interface{}, error) {
+	name := strings.TrimPrefix(ref, componentSchemasPrefix)
+	component, ok := r.components[name]
+	if !ok || name == ref {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, fmt.Sprintf("unresolved schema reference '%s'", ref))
+	}
+	if r.resolving[name] {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationFailed, fmt.Sprintf("recursive schema reference '%s'", ref))
+	}
+	r.resolving[name] = true
+	defer delete(r.resolving, name)
+	return r.resolveValue(ctx, map[string]interface{}(component))
+}
+
+// eventParams maps each property of an object event payload to a parameter, in name order,
+// and any other payload to a single "payload" parameter
+func (r *schemaResolver) eventParams(ctx context.Context, schema fftypes.JSONObject) (fftypes.FFIParams, error) {
+	params := fftypes.FFIParams{}
+	if schema == nil {
+		return params, nil
+	}
+	resolved, err := r.resolve(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	properties := resolved.GetObject("properties")
+	if resolved.GetString("type") != "object" || len(properties) == 0 {
+		return append(params, &fftypes.FFIParam{
+			Name:   "payload",
+			Schema: fftypes.JSONAnyPtr(resolved.String()),
+		}), nil
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params = append(params, &fftypes.FFIParam{
+			Name:   name,
+			Schema: fftypes.JSONAnyPtr(properties.GetObject(name).String()),
+		})
+	}
+	return params, nil
+}
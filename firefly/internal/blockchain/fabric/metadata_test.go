@@ -0,0 +1,376 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testContractMetadata = `{
+	"info": {
+		"title": "oemContract",
+		"description": "Aircraft build records",
+		"version": "latest"
+	},
+	"contracts": {
+		"SmartContract": {
+			"info": {
+				"title": "SmartContract",
+				"version": "latest"
+			},
+			"name": "SmartContract",
+			"transactions": [
+				{
+					"name": "ReadAsset",
+					"tag": ["evaluate", "EVALUATE"],
+					"parameters": [
+						{"name": "param0", "schema": {"type": "string"}}
+					],
+					"returns": {"$ref": "#/components/schemas/Asset"}
+				},
+				{
+					"name": "RecordEquipmentUsage",
+					"tag": ["submit", "SUBMIT"],
+					"parameters": [
+						{"name": "param0", "schema": {"type": "string"}},
+						{"name": "param1", "schema": {"type": "string"}},
+						{"name": "param2", "schema": {"type": "string"}},
+						{"name": "param3", "schema": {"type": "integer", "format": "int64"}}
+					]
+				}
+			],
+			"default": true
+		},
+		"org.hyperledger.fabric": {
+			"info": {
+				"title": "org.hyperledger.fabric",
+				"version": "latest"
+			},
+			"name": "org.hyperledger.fabric",
+			"transactions": [
+				{
+					"name": "GetMetadata",
+					"tag": ["evaluate", "EVALUATE"],
+					"returns": {"type": "string"}
+				}
+			],
+			"default": false
+		}
+	},
+	"components": {
+		"schemas": {
+			"Asset": {
+				"$id": "Asset",
+				"type": "object",
+				"properties": {
+					"acNumber": {"type": "string"},
+					"stations": {"type": "array", "items": {"$ref": "#/components/schemas/Station"}}
+				},
+				"required": ["acNumber"],
+				"additionalProperties": false
+			},
+			"Station": {
+				"$id": "Station",
+				"type": "object",
+				"properties": {
+					"station": {"type": "string"}
+				},
+				"required": ["station"],
+				"additionalProperties": false
+			}
+		}
+	}
+}`
+
+func generateTestFFI(t *testing.T, e *Fabric, input string) (*fftypes.FFI, error) {
+	return e.GenerateFFI(context.Background(), &fftypes.FFIGenerationRequest{
+		Namespace: "ns1",
+		Name:      "oem",
+		Version:   "v0.0.1",
+		Input:     fftypes.JSONAnyPtr(input),
+	})
+}
+
+func TestGenerateFFI(t *testing.T) {
+	e, _ := newTestFabric()
+	ffi, err := generateTestFFI(t, e, fmt.Sprintf(`{
+		"metadata": %s,
+		"events": [
+			{"name": "AssetCreated", "schema": {"$ref": "#/components/schemas/Asset"}},
+			{"name": "AssetDeleted", "schema": {"type": "string"}},
+			{"name": "Heartbeat"}
+		]
+	}`, testContractMetadata))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "ns1", ffi.Namespace)
+	assert.Equal(t, "Aircraft build records", ffi.Description)
+	assert.Len(t, ffi.Methods, 2)
+
+	readAsset := ffi.Methods[0]
+	assert.Equal(t, "ReadAsset", readAsset.Name)
+	assert.Equal(t, []string{"evaluate", "EVALUATE"}, readAsset.Details.GetStringArray("tag"))
+	assert.Equal(t, "param0", readAsset.Params[0].Name)
+	assert.JSONEq(t, `{"type": "string"}`, readAsset.Params[0].Schema.String())
+	assert.Len(t, readAsset.Returns, 1)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"acNumber": {"type": "string"},
+			"stations": {"type": "array", "items": {
+				"type": "object",
+				"properties": {"station": {"type": "string"}},
+				"required": ["station"],
+				"additionalProperties": false
+			}}
+		},
+		"required": ["acNumber"],
+		"additionalProperties": false
+	}`, readAsset.Returns[0].Schema.String())
+
+	recordUsage := ffi.Methods[1]
+	assert.Equal(t, "RecordEquipmentUsage", recordUsage.Name)
+	assert.Len(t, recordUsage.Params, 4)
+	assert.JSONEq(t, `{"type": "integer", "format": "int64"}`, recordUsage.Params[3].Schema.String())
+	assert.Empty(t, recordUsage.Returns)
+
+	assert.Len(t, ffi.Events, 3)
+	assert.Equal(t, "AssetCreated", ffi.Events[0].Name)
+	assert.Equal(t, "acNumber", ffi.Events[0].Params[0].Name)
+	assert.Equal(t, "stations", ffi.Events[0].Params[1].Name)
+	assert.Equal(t, "payload", ffi.Events[1].Params[0].Name)
+	assert.Empty(t, ffi.Events[2].Params)
+}
+
+func TestGenerateFFINamedContract(t *testing.T) {
+	e, _ := newTestFabric()
+	ffi, err := generateTestFFI(t, e, fmt.Sprintf(`{
+		"metadata": %s,
+		"contract": "org.hyperledger.fabric"
+	}`, testContractMetadata))
+	assert.NoError(t, err)
+	assert.Equal(t, "org.hyperledger.fabric:GetMetadata", ffi.Methods[0].Name)
+}
+
+func TestGenerateFFIOnlyContract(t *testing.T) {
+	e, _ := newTestFabric()
+	ffi, err := generateTestFFI(t, e, `{"metadata": {
+		"info": {"description": "Asset chaincode"},
+		"contracts": {
+			"AssetContract": {"name": "AssetContract", "info": {"description": "Assets"}, "transactions": [{"name": "GetAllAssets"}]},
+			"org.hyperledger.fabric": {"name": "org.hyperledger.fabric", "transactions": []}
+		}
+	}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "Assets", ffi.Description)
+	assert.Equal(t, "AssetContract:GetAllAssets", ffi.Methods[0].Name)
+	assert.Nil(t, ffi.Methods[0].Details)
+}
+
+func TestGenerateFFIContractRequired(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{"metadata": {
+		"contracts": {
+			"B": {"name": "B", "transactions": []},
+			"A": {"name": "A", "transactions": []}
+		}
+	}}`)
+	assert.Regexp(t, "FF10346.*'contract' must be set to one of: A, B", err)
+}
+
+func TestGenerateFFINoContracts(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{"metadata": {"contracts": {}}}`)
+	assert.Regexp(t, "FF10346.*no contracts", err)
+}
+
+func TestGenerateFFIContractNotFound(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, fmt.Sprintf(`{"metadata": %s, "contract": "Other"}`, testContractMetadata))
+	assert.Regexp(t, "FF10346.*'Other' not found", err)
+}
+
+func TestGenerateFFIBadInput(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `[]`)
+	assert.Regexp(t, "FF10346", err)
+}
+
+func TestGenerateFFIMissingInput(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{}`)
+	assert.Regexp(t, "FF10346.*'metadata' or 'location'", err)
+}
+
+func TestGenerateFFIMissingParamSchema(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{"metadata": {"contracts": {
+		"C": {"name": "C", "default": true, "transactions": [{"name": "Tx", "parameters": [{"name": "param0"}]}]}
+	}}}`)
+	assert.Regexp(t, "FF10346.*schema must be set", err)
+}
+
+func TestGenerateFFIUnresolvedRef(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{"metadata": {"contracts": {
+		"C": {"name": "C", "default": true, "transactions": [{"name": "Tx", "parameters": [
+			{"name": "param0", "schema": {"anyOf": [{"type": "string"}, {"$ref": "#/components/schemas/Missing"}]}}
+		]}]}
+	}}}`)
+	assert.Regexp(t, "FF10346.*unresolved schema reference '#/components/schemas/Missing'", err)
+}
+
+func TestGenerateFFIRecursiveRef(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{"metadata": {
+		"contracts": {
+			"C": {"name": "C", "default": true, "transactions": [{"name": "Tx", "returns": {"$ref": "#/components/schemas/Node"}}]}
+		},
+		"components": {"schemas": {
+			"Node": {"type": "object", "properties": {"next": {"$ref": "#/components/schemas/Node"}}}
+		}}
+	}}`)
+	assert.Regexp(t, "FF10346.*recursive schema reference", err)
+}
+
+func TestGenerateFFIBadEvents(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, fmt.Sprintf(`{"metadata": %s, "events": [{"schema": {"type": "string"}}]}`, testContractMetadata))
+	assert.Regexp(t, "FF10346.*event name must be set", err)
+
+	_, err = generateTestFFI(t, e, fmt.Sprintf(`{"metadata": %s, "events": [{"name": "E", "schema": {"$ref": "Asset"}}]}`, testContractMetadata))
+	assert.Regexp(t, "FF10346.*unresolved schema reference 'Asset'", err)
+}
+
+func TestGenerateFFIFromLocation(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+	e.signer = signer
+
+	var metadata interface{}
+	err := json.Unmarshal([]byte(testContractMetadata), &metadata)
+	assert.NoError(t, err)
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		func(req *http.Request) (*http.Response, error) {
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			assert.Equal(t, "org.hyperledger.fabric:GetMetadata", body["func"])
+			assert.Equal(t, "signer001", body["headers"].(map[string]interface{})["signer"])
+			assert.Equal(t, "firefly", body["headers"].(map[string]interface{})["channel"])
+			assert.Equal(t, "oemContract", body["headers"].(map[string]interface{})["chaincode"])
+			return httpmock.NewJsonResponderOrPanic(200, &fabQueryNamedOutput{Result: metadata})(req)
+		})
+
+	ffi, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.NoError(t, err)
+	assert.Len(t, ffi.Methods, 2)
+}
+
+func TestGenerateFFIFromLocationStringResult(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		httpmock.NewJsonResponderOrPanic(200, &fabQueryNamedOutput{Result: testContractMetadata}))
+
+	ffi, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.NoError(t, err)
+	assert.Len(t, ffi.Methods, 2)
+}
+
+func TestGenerateFFIFromLocationBadMetadata(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		httpmock.NewJsonResponderOrPanic(200, &fabQueryNamedOutput{Result: "not metadata"}))
+
+	_, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.Regexp(t, "FF10346.*chaincode metadata", err)
+}
+
+func TestGenerateFFIFromLocationNoResult(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		httpmock.NewJsonResponderOrPanic(200, &fabQueryNamedOutput{}))
+
+	_, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.Regexp(t, "FF10346.*chaincode metadata", err)
+}
+
+func TestGenerateFFIFromLocationResultNotAnObject(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		httpmock.NewJsonResponderOrPanic(200, &fabQueryNamedOutput{Result: []string{"not", "metadata"}}))
+
+	_, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.Regexp(t, "FF10346.*chaincode metadata", err)
+}
+
+func TestGenerateFFIFromLocationBadResponse(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		httpmock.NewStringResponder(200, "not json"))
+
+	_, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.Regexp(t, "FF10346.*chaincode metadata query result", err)
+}
+
+func TestGenerateFFIFromLocationQueryFail(t *testing.T) {
+	e, cancel := newTestFabric()
+	defer cancel()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", `http://localhost:12345/query`,
+		httpmock.NewJsonResponderOrPanic(500, fftypes.JSONObject{"error": "Function org.hyperledger.fabric:GetMetadata not found"}))
+
+	_, err := generateTestFFI(t, e, `{"location": {"channel": "firefly", "chaincode": "oemContract"}}`)
+	assert.Regexp(t, "FF10284.*GetMetadata not found", err)
+}
+
+func TestGenerateFFIFromLocationChaincodeNotSet(t *testing.T) {
+	e, _ := newTestFabric()
+	_, err := generateTestFFI(t, e, `{"location": {"channel": "firefly"}}`)
+	assert.Regexp(t, "FF10310", err)
+}
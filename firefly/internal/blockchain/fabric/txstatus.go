@@ -0,0 +1,241 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly/internal/blockchain/common"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/pkg/core"
+)
+
+const (
+	fabTxValidationCodeValid = "VALID"
+)
+
+// TransactionStatus is the status of a committed Fabric transaction, as returned in the detail of an operation
+type TransactionStatus struct {
+	TransactionID  string           `json:"transactionId"`
+	Channel        string           `json:"channel"`
+	BlockNumber    uint64           `json:"blockNumber"`
+	ValidationCode string           `json:"validationCode"`
+	EndorsingPeers []*EndorsingPeer `json:"endorsingPeers"`
+}
+
+// EndorsingPeer identifies a peer that endorsed a transaction, by the MSP and common name of its signing certificate
+type EndorsingPeer struct {
+	MSPID string `json:"mspId"`
+	Name  string `json:"name,omitempty"`
+}
+
+type fabBlockByTxIDResponse struct {
+	Result struct {
+		Block *fabBlock `json:"block"`
+	} `json:"result"`
+}
+
+type fabBlock struct {
+	Number       uint64            `json:"block_number"`
+	Transactions []*fabTransaction `json:"transactions"`
+}
+
+type fabTransaction struct {
+	TxID    string                  `json:"tx_id"`
+	Status  string                  `json:"status"`
+	Actions []*fabTransactionAction `json:"actions"`
+}
+
+type fabTransactionAction struct {
+	Endorsements []*fabEndorsement `json:"endorsements"`
+}
+
+type fabEndorsement struct {
+	Signer *fabCreator `json:"signer"`
+}
+
+type fabCreator struct {
+	MSPID string `json:"msp_id"`
+	Cert  string `json:"cert"`
+}
+
+// transactionQueryParams resolves the channel and signer to look up the transaction of an operation,
+// from the location and key it was submitted with where they are available
+func (f *Fabric) transactionQueryParams(ctx context.Context, operation *core.Operation) (channel, signer string, err error) {
+	channel = operation.Input.GetObject("location").GetString("channel")
+	if channel == "" {
+		channel = f.fabconnectConf.GetString(FabconnectConfigDefaultChannel)
+	}
+	if channel == "" {
+		return "", "", i18n.NewError(ctx, coremsgs.MsgDefaultChannelNotConfigured)
+	}
+
+	signer = getUserName(operation.Input.GetString("key"))
+	if signer == "" {
+		signer = f.fabconnectConf.GetString(FabconnectConfigSigner)
+	}
+	if signer == "" {
+		return "", "", i18n.NewError(ctx, coremsgs.MsgNodeMissingBlockchainKey)
+	}
+	return channel, signer, nil
+}
+
+// getReceipt looks up the receipt of an operation in the FabConnect receipt store
+func (f *Fabric) getReceipt(ctx context.Context, nsOpID string) (*common.BlockchainReceiptNotification, error) {
+	var resErr common.BlockchainRESTError
+	var receipt common.BlockchainReceiptNotification
+	res, err := f.client.R().
+		SetContext(ctx).
+		SetError(&resErr).
+		SetResult(&receipt).
+		Get(fmt.Sprintf("/receipts/%s", nsOpID))
+	if err != nil || !res.IsSuccess() {
+		if res.StatusCode() == 404 {
+			return nil, nil
+		}
+		return nil, common.WrapRESTError(ctx, &resErr, res, err, coremsgs.MsgFabconnectRESTErr)
+	}
+	return &receipt, nil
+}
+
+func (f *Fabric) getBlockByTxID(ctx context.Context, channel, signer, txHash string) (*fabBlock, error) {
+	var resErr common.BlockchainRESTError
+	var blockResponse fabBlockByTxIDResponse
+	res, err := f.client.R().
+		SetContext(ctx).
+		SetError(&resErr).
+		SetResult(&blockResponse).
+		SetQueryParam("fly-channel", channel).
+		SetQueryParam("fly-signer", signer).
+		Get(fmt.Sprintf("/blockByTxId/%s", txHash))
+	if err != nil || !res.IsSuccess() {
+		if res.StatusCode() == 404 {
+			return nil, nil
+		}
+		return nil, common.WrapRESTError(ctx, &resErr, res, err, coremsgs.MsgFabconnectRESTErr)
+	}
+	return blockResponse.Result.Block, nil
+}
+
+func endorsingPeers(tx *fabTransaction) []*EndorsingPeer {
+	peers := []*EndorsingPeer{}
+	for _, action := range tx.Actions {
+		for _, endorsement := range action.Endorsements {
+			if endorsement.Signer == nil {
+				continue
+			}
+			peer := &EndorsingPeer{MSPID: endorsement.Signer.MSPID}
+			if block, _ := pem.Decode([]byte(endorsement.Signer.Cert)); block != nil {
+				if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+					peer.Name = cert.Subject.CommonName
+				}
+			}
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func isPendingOperation(operation *core.Operation) bool {
+	return operation.Status == core.OpStatusPending || operation.Status == core.OpStatusInitialized
+}
+
+// isFinalReceipt is true for receipts reporting the outcome of a transaction, rather than its progress
+func isFinalReceipt(receipt *common.BlockchainReceiptNotification) bool {
+	return receipt.Headers.ReplyType != "" && receipt.Headers.ReplyType != "TransactionUpdate"
+}
+
+func (f *Fabric) GetTransactionStatus(ctx context.Context, operation *core.Operation) (interface{}, error) {
+	if operation.Type == core.OpTypeBlockchainContractDeploy {
+		return f.getDeploymentStatus(ctx, operation)
+	}
+
+	nsOpID := (&core.PreparedOperation{ID: operation.ID, Namespace: operation.Namespace}).NamespacedIDString()
+
+	channel, signer, err := f.transactionQueryParams(ctx, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	// The transaction hash is only known once the receipt has been delivered. If we missed it,
+	// FabConnect might still hold the receipt in its receipt store.
+	txHash := operation.Output.GetString("transactionHash")
+	if txHash == "" {
+		receipt, err := f.getReceipt(ctx, nsOpID)
+		if err != nil || receipt == nil {
+			return nil, err
+		}
+		if receipt.TxHash == "" {
+			// A transaction that failed before it reached the ledger has no block to look up,
+			// but its receipt is still the final outcome of the operation
+			if isFinalReceipt(receipt) && isPendingOperation(operation) {
+				_ = common.HandleReceipt(ctx, f, receipt, f.callbacks)
+			}
+			return nil, nil
+		}
+		txHash = receipt.TxHash
+	}
+
+	block, err := f.getBlockByTxID(ctx, channel, signer, txHash)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	var tx *fabTransaction
+	for _, blockTx := range block.Transactions {
+		if blockTx.TxID == txHash {
+			tx = blockTx
+			break
+		}
+	}
+	if tx == nil {
+		log.L(ctx).Warnf("Transaction %s not found in block %d", txHash, block.Number)
+		return nil, nil
+	}
+
+	status := &TransactionStatus{
+		TransactionID:  txHash,
+		Channel:        channel,
+		BlockNumber:    block.Number,
+		ValidationCode: tx.Status,
+		EndorsingPeers: endorsingPeers(tx),
+	}
+
+	// If the transaction has committed since we last heard about it, mock up the receipt
+	// as if we'd received it over the WebSocket
+	if isPendingOperation(operation) {
+		receipt := &common.BlockchainReceiptNotification{
+			Headers: common.BlockchainReceiptHeaders{
+				ReceiptID: nsOpID,
+				ReplyType: "TransactionSuccess",
+			},
+			TxHash:     txHash,
+			ProtocolID: fmt.Sprintf("%.12d/%s", block.Number, txHash),
+		}
+		if tx.Status != fabTxValidationCodeValid {
+			receipt.Headers.ReplyType = "TransactionFailed"
+			receipt.Message = fmt.Sprintf("Transaction %s failed validation with code %s", txHash, tx.Status)
+		}
+		_ = common.HandleReceipt(ctx, f, receipt, f.callbacks)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,366 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabric
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly/mocks/coremocks"
+	"github.com/hyperledger/firefly/pkg/core"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testTxHash = "7cd2549e310898ceb5f8d15112e74e0395c2f7ccd434293cd29cdb6bc358e85a"
+
+func newTestTxStatusFabric(t *testing.T) (*Fabric, *coremocks.OperationCallbacks, func()) {
+	e, cancel := newTestFabric()
+	httpmock.ActivateNonDefault(e.client.GetClient())
+	resetConf(e)
+	em := &coremocks.OperationCallbacks{}
+	e.SetOperationHandler("ns1", em)
+	return e, em, func() {
+		httpmock.DeactivateAndReset()
+		cancel()
+		em.AssertExpectations(t)
+	}
+}
+
+func testPeerCert(cn string) string {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{"peer"}},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func testBlockByTxID(status string) map[string]interface{} {
+	return map[string]interface{}{
+		"result": map[string]interface{}{
+			"block": map[string]interface{}{
+				"block_number": 12,
+				"transactions": []interface{}{
+					map[string]interface{}{
+						"tx_id":  "another",
+						"status": "VALID",
+					},
+					map[string]interface{}{
+						"tx_id":  testTxHash,
+						"status": status,
+						"actions": []interface{}{
+							map[string]interface{}{
+								"endorsements": []interface{}{
+									map[string]interface{}{
+										"signer": map[string]interface{}{
+											"msp_id": "Org1MSP",
+											"cert":   testPeerCert("peer0.org1.example.com"),
+										},
+									},
+									map[string]interface{}{
+										"signer": map[string]interface{}{
+											"msp_id": "Org2MSP",
+											"cert":   "not a cert",
+										},
+									},
+									map[string]interface{}{},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGetTransactionStatusFromLocation(t *testing.T) {
+	e, em, done := newTestTxStatusFabric(t)
+	defer done()
+
+	op := &core.Operation{
+		Namespace: "ns1",
+		ID:        fftypes.MustParseUUID("9ffc50ff-6bfe-4502-adc7-93aea54cc059"),
+		Status:    core.OpStatusPending,
+		Input: fftypes.JSONObject{
+			"key": "Org1MSP::x509::CN=user1,OU=client::CN=fabric-ca-server",
+			"location": map[string]interface{}{
+				"channel":   "mychannel",
+				"chaincode": "oemContract",
+			},
+		},
+		Output: fftypes.JSONObject{
+			"transactionHash": testTxHash,
+		},
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/blockByTxId/`+testTxHash+`?fly-channel=mychannel&fly-signer=user1`,
+		httpmock.NewJsonResponderOrPanic(200, testBlockByTxID("VALID")))
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == "ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059" &&
+			update.Status == core.OpStatusSucceeded &&
+			update.BlockchainTXID == testTxHash &&
+			update.Output.GetString("protocolId") == "000000000012/"+testTxHash &&
+			update.Plugin == "fabric"
+	})).Return(nil)
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, &TransactionStatus{
+		TransactionID:  testTxHash,
+		Channel:        "mychannel",
+		BlockNumber:    12,
+		ValidationCode: "VALID",
+		EndorsingPeers: []*EndorsingPeer{
+			{MSPID: "Org1MSP", Name: "peer0.org1.example.com"},
+			{MSPID: "Org2MSP"},
+		},
+	}, status)
+}
+
+func TestGetTransactionStatusFromReceiptStore(t *testing.T) {
+	e, em, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+
+	op := &core.Operation{
+		Namespace: "ns1",
+		ID:        fftypes.MustParseUUID("9ffc50ff-6bfe-4502-adc7-93aea54cc059"),
+		Status:    core.OpStatusInitialized,
+		Input: fftypes.JSONObject{
+			"location": map[string]interface{}{
+				"channel": "mychannel",
+			},
+		},
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/receipts/ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059`,
+		httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+			"headers": map[string]interface{}{
+				"requestId": "ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059",
+				"type":      "TransactionSuccess",
+			},
+			"transactionHash": testTxHash,
+		}))
+	httpmock.RegisterResponder("GET", `http://localhost:12345/blockByTxId/`+testTxHash+`?fly-channel=mychannel&fly-signer=signer001`,
+		httpmock.NewJsonResponderOrPanic(200, testBlockByTxID("MVCC_READ_CONFLICT")))
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == "ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059" &&
+			update.Status == core.OpStatusFailed &&
+			update.ErrorMessage == "Transaction "+testTxHash+" failed validation with code MVCC_READ_CONFLICT"
+	})).Return(nil)
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, "MVCC_READ_CONFLICT", status.(*TransactionStatus).ValidationCode)
+}
+
+func TestGetTransactionStatusAlreadyComplete(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	op := &core.Operation{
+		Status: core.OpStatusSucceeded,
+		Output: fftypes.JSONObject{
+			"transactionHash": testTxHash,
+		},
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/blockByTxId/`+testTxHash+`?fly-channel=firefly&fly-signer=signer001`,
+		httpmock.NewJsonResponderOrPanic(200, testBlockByTxID("VALID")))
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12), status.(*TransactionStatus).BlockNumber)
+}
+
+func TestGetTransactionStatusNoDefaultChannel(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+
+	_, err := e.GetTransactionStatus(context.Background(), &core.Operation{})
+	assert.Regexp(t, "FF10440", err)
+}
+
+func TestGetTransactionStatusNoDefaultSigner(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	_, err := e.GetTransactionStatus(context.Background(), &core.Operation{})
+	assert.Regexp(t, "FF10354", err)
+}
+
+func TestGetTransactionStatusNoReceipt(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	op := &core.Operation{
+		Namespace: "ns1",
+		ID:        fftypes.MustParseUUID("9ffc50ff-6bfe-4502-adc7-93aea54cc059"),
+		Status:    core.OpStatusPending,
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/receipts/ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059`,
+		httpmock.NewJsonResponderOrPanic(404, map[string]interface{}{}))
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/receipts/ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059`,
+		httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{}))
+	status, err = e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestGetTransactionStatusFailedReceiptNoTxHash(t *testing.T) {
+	e, em, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	op := &core.Operation{
+		Namespace: "ns1",
+		ID:        fftypes.MustParseUUID("9ffc50ff-6bfe-4502-adc7-93aea54cc059"),
+		Status:    core.OpStatusPending,
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/receipts/ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059`,
+		httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+			"headers": map[string]interface{}{
+				"requestId": "ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059",
+				"type":      "TransactionFailed",
+			},
+			"errorMessage": "endorsement failure",
+		}))
+
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == "ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059" &&
+			update.Status == core.OpStatusFailed &&
+			update.ErrorMessage == "endorsement failure"
+	})).Return(nil).Once()
+
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+
+	// An operation that is already complete is left alone
+	op.Status = core.OpStatusFailed
+	status, err = e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestGetTransactionStatusReceiptError(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	op := &core.Operation{
+		Namespace: "ns1",
+		ID:        fftypes.MustParseUUID("9ffc50ff-6bfe-4502-adc7-93aea54cc059"),
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/receipts/ns1:9ffc50ff-6bfe-4502-adc7-93aea54cc059`,
+		httpmock.NewJsonResponderOrPanic(500, map[string]interface{}{"error": "pop"}))
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.Regexp(t, "FF10284.*pop", err)
+	assert.Nil(t, status)
+}
+
+func TestGetTransactionStatusBlockNotFound(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	op := &core.Operation{
+		Status: core.OpStatusPending,
+		Output: fftypes.JSONObject{
+			"transactionHash": testTxHash,
+		},
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/blockByTxId/`+testTxHash+`?fly-channel=firefly&fly-signer=signer001`,
+		httpmock.NewJsonResponderOrPanic(404, map[string]interface{}{}))
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/blockByTxId/`+testTxHash+`?fly-channel=firefly&fly-signer=signer001`,
+		httpmock.NewJsonResponderOrPanic(200, map[string]interface{}{
+			"result": map[string]interface{}{
+				"block": map[string]interface{}{
+					"block_number": 12,
+				},
+			},
+		}))
+	status, err = e.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestGetTransactionStatusBlockError(t *testing.T) {
+	e, _, done := newTestTxStatusFabric(t)
+	defer done()
+
+	utFabconnectConf.Set(FabconnectConfigSigner, "signer001")
+	utFabconnectConf.Set(FabconnectConfigDefaultChannel, "firefly")
+
+	op := &core.Operation{
+		Output: fftypes.JSONObject{
+			"transactionHash": testTxHash,
+		},
+	}
+
+	httpmock.RegisterResponder("GET", `http://localhost:12345/blockByTxId/`+testTxHash+`?fly-channel=firefly&fly-signer=signer001`,
+		httpmock.NewJsonResponderOrPanic(500, map[string]interface{}{"error": "pop"}))
+	status, err := e.GetTransactionStatus(context.Background(), op)
+	assert.Regexp(t, "FF10284.*pop", err)
+	assert.Nil(t, status)
+}
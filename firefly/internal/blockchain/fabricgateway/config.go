@@ -0,0 +1,85 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+)
+
+const (
+	defaultEvaluateTimeout     = "30s"
+	defaultEndorseTimeout      = "30s"
+	defaultSubmitTimeout       = "30s"
+	defaultCommitStatusTimeout = "2m"
+
+	defaultEventsRetryInitialDelay = "1s"
+	defaultEventsRetryMaxDelay     = "30s"
+	defaultEventsRetryFactor       = 2.0
+)
+
+const (
+	// GatewayConfigKey is a sub-key in the config to contain all the Fabric Gateway specific config
+	GatewayConfigKey = "gateway"
+	// GatewayConfigTLS is the sub-section holding the TLS settings used to connect to the gateway peer
+	GatewayConfigTLS = "tls"
+
+	// GatewayConfigAddress is the host:port of the gRPC endpoint of the Fabric Gateway peer
+	GatewayConfigAddress = "address"
+	// GatewayConfigDefaultChannel is the default Fabric channel to use if no "ledger" is specified in requests
+	GatewayConfigDefaultChannel = "channel"
+	// GatewayConfigSigner is the signer identity used to query the FireFly chaincode
+	GatewayConfigSigner = "signer"
+	// GatewayConfigMSPID is the MSP ID of the organization that owns the local signing identities
+	GatewayConfigMSPID = "msp.id"
+	// GatewayConfigMSPPath is a directory containing one MSP directory (signcerts + keystore) per signing identity
+	GatewayConfigMSPPath = "msp.path"
+	// GatewayConfigCheckpointPath is a directory where event checkpoints are persisted. Checkpoints are held in memory if unset
+	GatewayConfigCheckpointPath = "checkpoint.path"
+	// GatewayConfigEvaluateTimeout is the timeout for evaluating (querying) a transaction
+	GatewayConfigEvaluateTimeout = "timeout.evaluate"
+	// GatewayConfigEndorseTimeout is the timeout for collecting endorsements for a transaction
+	GatewayConfigEndorseTimeout = "timeout.endorse"
+	// GatewayConfigSubmitTimeout is the timeout for submitting an endorsed transaction to the orderer
+	GatewayConfigSubmitTimeout = "timeout.submit"
+	// GatewayConfigCommitStatusTimeout is the timeout for waiting for a submitted transaction to be committed
+	GatewayConfigCommitStatusTimeout = "timeout.commitStatus"
+	// GatewayConfigEventsRetryInitialDelay is the initial delay before re-establishing a chaincode event stream
+	GatewayConfigEventsRetryInitialDelay = "events.retry.initialDelay"
+	// GatewayConfigEventsRetryMaxDelay is the max delay between attempts to re-establish a chaincode event stream
+	GatewayConfigEventsRetryMaxDelay = "events.retry.maxDelay"
+	// GatewayConfigEventsRetryFactor is the factor by which the delay increases when re-establishing a chaincode event stream
+	GatewayConfigEventsRetryFactor = "events.retry.factor"
+)
+
+func (f *FabricGateway) InitConfig(config config.Section) {
+	f.gatewayConf = config.SubSection(GatewayConfigKey)
+	fftls.InitTLSConfig(f.gatewayConf.SubSection(GatewayConfigTLS))
+	f.gatewayConf.AddKnownKey(GatewayConfigAddress)
+	f.gatewayConf.AddKnownKey(GatewayConfigDefaultChannel)
+	f.gatewayConf.AddKnownKey(GatewayConfigSigner)
+	f.gatewayConf.AddKnownKey(GatewayConfigMSPID)
+	f.gatewayConf.AddKnownKey(GatewayConfigMSPPath)
+	f.gatewayConf.AddKnownKey(GatewayConfigCheckpointPath)
+	f.gatewayConf.AddKnownKey(GatewayConfigEvaluateTimeout, defaultEvaluateTimeout)
+	f.gatewayConf.AddKnownKey(GatewayConfigEndorseTimeout, defaultEndorseTimeout)
+	f.gatewayConf.AddKnownKey(GatewayConfigSubmitTimeout, defaultSubmitTimeout)
+	f.gatewayConf.AddKnownKey(GatewayConfigCommitStatusTimeout, defaultCommitStatusTimeout)
+	f.gatewayConf.AddKnownKey(GatewayConfigEventsRetryInitialDelay, defaultEventsRetryInitialDelay)
+	f.gatewayConf.AddKnownKey(GatewayConfigEventsRetryMaxDelay, defaultEventsRetryMaxDelay)
+	f.gatewayConf.AddKnownKey(GatewayConfigEventsRetryFactor, defaultEventsRetryFactor)
+}
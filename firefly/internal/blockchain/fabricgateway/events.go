@@ -0,0 +1,416 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly/internal/blockchain/common"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/pkg/blockchain"
+	"github.com/hyperledger/firefly/pkg/core"
+)
+
+type ListenerCheckpoint struct {
+	Block         uint64 `json:"block"`
+	TransactionID string `json:"transactionId,omitempty"`
+}
+
+type ListenerStatus struct {
+	Checkpoint ListenerCheckpoint `json:"checkpoint"`
+}
+
+// eventStream is a single chaincode event stream, feeding either a custom contract listener
+// or a FireFly BatchPin subscription
+type eventStream struct {
+	id         string
+	namespace  string
+	location   *Location
+	eventName  string
+	firstEvent string
+	checkpoint *eventCheckpoint
+	process    func(ctx context.Context, events common.EventsToDispatch, l *eventStream, event *client.ChaincodeEvent)
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// eventCheckpoint records the position after the last event successfully dispatched to FireFly,
+// so that an event stream resumes from there on reconnect (and across restarts, if persisted)
+type eventCheckpoint struct {
+	mux    sync.Mutex
+	file   *client.FileCheckpointer
+	memory client.InMemoryCheckpointer
+}
+
+func (c *eventCheckpoint) BlockNumber() uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.file != nil {
+		return c.file.BlockNumber()
+	}
+	return c.memory.BlockNumber()
+}
+
+func (c *eventCheckpoint) TransactionID() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.file != nil {
+		return c.file.TransactionID()
+	}
+	return c.memory.TransactionID()
+}
+
+func (c *eventCheckpoint) save(event *client.ChaincodeEvent) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.file != nil {
+		return c.file.CheckpointChaincodeEvent(event)
+	}
+	c.memory.CheckpointChaincodeEvent(event)
+	return nil
+}
+
+func (c *eventCheckpoint) close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.file != nil {
+		_ = c.file.Close()
+	}
+}
+
+func (f *FabricGateway) newCheckpoint(ctx context.Context, id string) (*eventCheckpoint, error) {
+	if f.checkpointPath == "" {
+		return &eventCheckpoint{}, nil
+	}
+	file, err := client.NewFileCheckpointer(filepath.Join(f.checkpointPath, id+".json"))
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, coremsgs.MsgFabricGatewayErr, err)
+	}
+	return &eventCheckpoint{file: file}, nil
+}
+
+func (f *FabricGateway) removeCheckpoint(id string) {
+	if f.checkpointPath != "" {
+		_ = os.Remove(filepath.Join(f.checkpointPath, id+".json"))
+	}
+}
+
+// Map FireFly "firstEvent" values to a Fabric start block, where the default is to only
+// deliver events from blocks committed after the stream is established
+func startBlockOptions(ctx context.Context, firstEvent string) ([]client.ChaincodeEventsOption, error) {
+	switch firstEvent {
+	case "", string(core.SubOptsFirstEventNewest):
+		return []client.ChaincodeEventsOption{}, nil
+	case string(core.SubOptsFirstEventOldest):
+		return []client.ChaincodeEventsOption{client.WithStartBlock(0)}, nil
+	}
+	block, err := strconv.ParseUint(firstEvent, 10, 64)
+	if err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgInvalidFirstEvent)
+	}
+	return []client.ChaincodeEventsOption{client.WithStartBlock(block)}, nil
+}
+
+func (f *FabricGateway) startListener(ctx context.Context, l *eventStream) (err error) {
+	if _, err = startBlockOptions(ctx, l.firstEvent); err != nil {
+		return err
+	}
+	if l.checkpoint, err = f.newCheckpoint(ctx, l.id); err != nil {
+		return err
+	}
+	var listenerCtx context.Context
+	listenerCtx, l.cancel = context.WithCancel(log.WithLogField(f.ctx, "listener", l.id))
+	l.done = make(chan struct{})
+	f.listeners[l.id] = l
+	go f.listenerLoop(listenerCtx, l)
+	return nil
+}
+
+func (f *FabricGateway) listenerLoop(ctx context.Context, l *eventStream) {
+	defer close(l.done)
+	defer l.checkpoint.close()
+	_ = f.eventsRetry.Do(ctx, fmt.Sprintf("chaincode event stream %s", l.id), func(attempt int) (retry bool, err error) {
+		err = f.streamEvents(ctx, l)
+		return ctx.Err() == nil, err
+	})
+	log.L(ctx).Debugf("Chaincode event stream exiting")
+}
+
+// streamEvents runs a single chaincode event stream from the last checkpoint, until the
+// stream fails or dispatching an event fails
+func (f *FabricGateway) streamEvents(ctx context.Context, l *eventStream) error {
+	id, err := f.getIdentity(ctx, f.signer)
+	if err != nil {
+		return err
+	}
+	options, _ := startBlockOptions(ctx, l.firstEvent)
+	options = append(options, client.WithCheckpoint(l.checkpoint))
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	events, err := id.gateway.GetNetwork(l.location.Channel).ChaincodeEvents(streamCtx, l.location.Chaincode, options...)
+	if err != nil {
+		cancel()
+		return wrapGatewayError(ctx, err)
+	}
+	defer func() {
+		// The client blocks delivering events until they are read, so drain the channel until it closes
+		cancel()
+		for range events {
+		}
+	}()
+
+	log.L(ctx).Infof("Chaincode event stream started on %s/%s from block %d", l.location.Channel, l.location.Chaincode, l.checkpoint.BlockNumber())
+	// The client closes the channel when the stream ends, including when we are cancelled
+	for event := range events {
+		if err := f.handleChaincodeEvent(ctx, l, event); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return i18n.NewError(ctx, coremsgs.MsgFabricGatewayErr, "chaincode event stream closed")
+}
+
+func (f *FabricGateway) handleChaincodeEvent(ctx context.Context, l *eventStream, event *client.ChaincodeEvent) error {
+	logger := log.L(ctx)
+	logger.Infof("[FabricGateway:%d/%s]: '%s' on '%s'", event.BlockNumber, event.TransactionID, event.EventName, l.id)
+
+	if l.eventName == "" || event.EventName == l.eventName {
+		events := make(common.EventsToDispatch)
+		l.process(ctx, events, l, event)
+		// Dispatch the events that were successfully parsed and routed to namespaces (could be zero - that's ok)
+		if err := f.callbacks.DispatchBlockchainEvents(ctx, events); err != nil {
+			return err
+		}
+	}
+	if err := l.checkpoint.save(event); err != nil {
+		return i18n.WrapError(ctx, err, coremsgs.MsgFabricGatewayErr, err)
+	}
+	return nil
+}
+
+func (f *FabricGateway) parseBlockchainEvent(ctx context.Context, l *eventStream, event *client.ChaincodeEvent) *blockchain.Event {
+	var payload fftypes.JSONObject
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		log.L(ctx).Errorf("Chaincode event is not valid - bad JSON payload: %s", event.Payload)
+		return nil // move on
+	}
+
+	// As Fabric only allows one event per transaction, the block number and transaction ID
+	// uniquely identify the event (in the same form as events received via fabconnect)
+	protocolID := fmt.Sprintf("%.12d/%s", event.BlockNumber, event.TransactionID)
+
+	return &blockchain.Event{
+		BlockchainTXID: event.TransactionID,
+		Source:         f.Name(),
+		Name:           event.EventName,
+		ProtocolID:     protocolID,
+		Output:         payload,
+		Info: fftypes.JSONObject{
+			"blockNumber":   event.BlockNumber,
+			"transactionId": event.TransactionID,
+			"chaincodeId":   event.ChaincodeName,
+			"eventName":     event.EventName,
+			"subId":         l.id,
+		},
+		// Chaincode events from the gateway do not carry the block timestamp, so the time of receipt is used
+		Timestamp: fftypes.Now(),
+		Location:  fmt.Sprintf("chaincode=%s", event.ChaincodeName),
+		Signature: event.EventName,
+	}
+}
+
+func (f *FabricGateway) processContractEvent(ctx context.Context, events common.EventsToDispatch, l *eventStream, chaincodeEvent *client.ChaincodeEvent) {
+	event := f.parseBlockchainEvent(ctx, l, chaincodeEvent)
+	if event != nil {
+		f.callbacks.PrepareBlockchainEvent(ctx, events, l.namespace, &blockchain.EventForListener{
+			Event:      event,
+			ListenerID: l.id,
+		})
+	}
+}
+
+func (f *FabricGateway) processBatchPinEvent(ctx context.Context, events common.EventsToDispatch, l *eventStream, chaincodeEvent *client.ChaincodeEvent) {
+	f.listenerMux.Lock()
+	subInfo := f.subs.GetSubscription(l.id)
+	f.listenerMux.Unlock()
+	if subInfo == nil {
+		return // subscription has been removed
+	}
+
+	event := f.parseBlockchainEvent(ctx, l, chaincodeEvent)
+	if event == nil {
+		return // move on
+	}
+	location, _ := encodeContractLocation(ctx, blockchain.NormalizeCall, &Location{
+		Channel:   l.location.Channel,
+		Chaincode: chaincodeEvent.ChaincodeName,
+	})
+
+	params := &common.BatchPinParams{
+		UUIDs:      event.Output.GetString("uuids"),
+		BatchHash:  event.Output.GetString("batchHash"),
+		PayloadRef: event.Output.GetString("payloadRef"),
+		Contexts:   event.Output.GetStringArray("contexts"),
+		NsOrAction: event.Output.GetString("namespace"),
+	}
+	verifier := &core.VerifierRef{
+		Type:  core.VerifierTypeMSPIdentity,
+		Value: event.Output.GetString("signer"),
+	}
+	f.callbacks.PrepareBatchPinOrNetworkAction(ctx, events, subInfo, location, event, verifier, params)
+}
+
+func (f *FabricGateway) AddFireflySubscription(ctx context.Context, namespace *core.Namespace, contract *blockchain.MultipartyContract) (string, error) {
+	fabricOnChainLocation, err := parseContractLocation(ctx, contract.Location)
+	if err != nil {
+		return "", err
+	}
+
+	var options ContractOptions
+	optionBytes := contract.Options.Bytes()
+	if optionBytes != nil {
+		if err = json.Unmarshal(optionBytes, &options); err != nil {
+			log.L(ctx).Warnf("Could not parse multiparty contract options (%s): %s", err, optionBytes)
+		}
+	}
+	if options.CustomPinSupport {
+		// Chaincode event streams are always scoped to a single chaincode
+		return "", i18n.NewError(ctx, coremsgs.MsgNotSupportedByBlockchainPlugin)
+	}
+	if _, err = encodeContractLocation(ctx, blockchain.NormalizeCall, fabricOnChainLocation); err != nil {
+		return "", err
+	}
+
+	version, err := f.GetNetworkVersion(ctx, contract.Location)
+	if err != nil {
+		return "", err
+	}
+
+	// A version 1 contract is shared by all namespaces, while version 2 requires a stream per namespace
+	name := batchPinEventName
+	if version != 1 {
+		name = fmt.Sprintf("%s_%s", namespace.Name, batchPinEventName)
+	}
+	subID := fmt.Sprintf("%s-%s-%s", name, fabricOnChainLocation.Channel, fabricOnChainLocation.Chaincode)
+
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	if f.listeners[subID] == nil {
+		err = f.startListener(ctx, &eventStream{
+			id:         subID,
+			location:   fabricOnChainLocation,
+			eventName:  batchPinEventName,
+			firstEvent: contract.FirstEvent,
+			process:    f.processBatchPinEvent,
+		})
+		if err != nil {
+			return "", err
+		}
+		log.L(ctx).Infof("%s subscription: %s", batchPinEventName, subID)
+	}
+	f.subs.AddSubscription(ctx, namespace, version, subID, fabricOnChainLocation.Channel)
+	return subID, nil
+}
+
+func (f *FabricGateway) RemoveFireflySubscription(ctx context.Context, subID string) {
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	f.subs.RemoveSubscription(ctx, subID)
+	// This may be called while processing events from the stream itself, so we stop the
+	// stream without waiting for it to exit. The checkpoint is kept to resume from later.
+	if l := f.listeners[subID]; l != nil {
+		l.cancel()
+		delete(f.listeners, subID)
+	}
+}
+
+func (f *FabricGateway) AddContractListener(ctx context.Context, listener *core.ContractListener) error {
+	location, err := parseContractLocation(ctx, listener.Location)
+	if err != nil {
+		return err
+	}
+	if _, err = encodeContractLocation(ctx, blockchain.NormalizeCall, location); err != nil {
+		return err
+	}
+
+	subID := fmt.Sprintf("ff-sub-%s-%s", listener.Namespace, listener.ID)
+	f.listenerMux.Lock()
+	defer f.listenerMux.Unlock()
+	if f.listeners[subID] == nil {
+		err = f.startListener(ctx, &eventStream{
+			id:         subID,
+			namespace:  listener.Namespace,
+			location:   location,
+			eventName:  listener.Event.Name,
+			firstEvent: listener.Options.FirstEvent,
+			process:    f.processContractEvent,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	listener.BackendID = subID
+	return nil
+}
+
+func (f *FabricGateway) DeleteContractListener(ctx context.Context, subscription *core.ContractListener, okNotFound bool) error {
+	f.listenerMux.Lock()
+	l := f.listeners[subscription.BackendID]
+	delete(f.listeners, subscription.BackendID)
+	f.listenerMux.Unlock()
+	if l == nil {
+		if okNotFound {
+			return nil
+		}
+		return i18n.NewError(ctx, coremsgs.Msg404NotFound)
+	}
+
+	l.cancel()
+	<-l.done
+	f.removeCheckpoint(l.id)
+	return nil
+}
+
+func (f *FabricGateway) GetContractListenerStatus(ctx context.Context, subID string, okNotFound bool) (bool, interface{}, error) {
+	f.listenerMux.Lock()
+	l := f.listeners[subID]
+	f.listenerMux.Unlock()
+	if l == nil {
+		if okNotFound {
+			return false, nil, nil
+		}
+		return false, nil, i18n.NewError(ctx, coremsgs.Msg404NotFound)
+	}
+	return true, &ListenerStatus{
+		Checkpoint: ListenerCheckpoint{
+			Block:         l.checkpoint.BlockNumber(),
+			TransactionID: l.checkpoint.TransactionID(),
+		},
+	}, nil
+}
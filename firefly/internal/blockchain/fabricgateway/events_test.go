@@ -0,0 +1,448 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly/mocks/blockchainmocks"
+	"github.com/hyperledger/firefly/pkg/blockchain"
+	"github.com/hyperledger/firefly/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// eventServer feeds chaincode events to every stream opened on the fake gateway, and
+// closes the stream after each batch if requested
+type eventServer struct {
+	requests    chan *gateway.ChaincodeEventsRequest
+	responses   chan *gateway.ChaincodeEventsResponse
+	closeStream bool
+}
+
+func newEventServer(fake *fakeGateway) *eventServer {
+	s := &eventServer{
+		requests:  make(chan *gateway.ChaincodeEventsRequest, 10),
+		responses: make(chan *gateway.ChaincodeEventsResponse, 10),
+	}
+	fake.events = func(req *gateway.ChaincodeEventsRequest, stream gateway.Gateway_ChaincodeEventsServer) error {
+		s.requests <- req
+		for {
+			select {
+			case <-stream.Context().Done():
+				return nil
+			case response := <-s.responses:
+				if err := stream.Send(response); err != nil {
+					return err
+				}
+				if s.closeStream {
+					return nil
+				}
+			}
+		}
+	}
+	return s
+}
+
+func chaincodeEvent(block uint64, txID, chaincode, name, payload string) *gateway.ChaincodeEventsResponse {
+	return &gateway.ChaincodeEventsResponse{
+		BlockNumber: block,
+		Events: []*peer.ChaincodeEvent{
+			{
+				ChaincodeId: chaincode,
+				TxId:        txID,
+				EventName:   name,
+				Payload:     []byte(payload),
+			},
+		},
+	}
+}
+
+func testContractListener() *core.ContractListener {
+	return &core.ContractListener{
+		ID:        fftypes.NewUUID(),
+		Namespace: "ns1",
+		Location:  fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`),
+		Event: &core.FFISerializedEvent{
+			FFIEventDefinition: fftypes.FFIEventDefinition{
+				Name: "Changed",
+			},
+		},
+		Options: &core.ContractListenerOptions{},
+	}
+}
+
+func TestContractListenerEvents(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	events := newEventServer(fake)
+
+	dispatched := make(chan *blockchain.EventToDispatch, 1)
+	em := &blockchainmocks.Callbacks{}
+	em.On("BlockchainEventBatch", mock.Anything).Run(func(args mock.Arguments) {
+		batch := args[0].([]*blockchain.EventToDispatch)
+		dispatched <- batch[0]
+	}).Return(nil)
+	f.SetHandler("ns1", em)
+
+	listener := testContractListener()
+	err := f.AddContractListener(context.Background(), listener)
+	assert.NoError(t, err)
+	assert.Equal(t, "ff-sub-ns1-"+listener.ID.String(), listener.BackendID)
+
+	// Adding again is a no-op
+	err = f.AddContractListener(context.Background(), listener)
+	assert.NoError(t, err)
+
+	req := <-events.requests
+	assert.Equal(t, "firefly", req.ChannelId)
+	assert.Equal(t, "simplestorage", req.ChaincodeId)
+	assert.NotNil(t, req.StartPosition.GetNextCommit())
+
+	events.responses <- chaincodeEvent(10, "tx0", "simplestorage", "Other", `{}`)
+	events.responses <- chaincodeEvent(11, "tx1", "simplestorage", "Changed", `not json`)
+	events.responses <- chaincodeEvent(12, "tx2", "simplestorage", "Changed", `{"value":"1"}`)
+
+	event := <-dispatched
+	assert.Equal(t, blockchain.EventTypeForListener, event.Type)
+	assert.Equal(t, listener.BackendID, event.ForListener.ListenerID)
+	assert.Equal(t, "Changed", event.ForListener.Event.Name)
+	assert.Equal(t, "000000000012/tx2", event.ForListener.Event.ProtocolID)
+	assert.Equal(t, "tx2", event.ForListener.Event.BlockchainTXID)
+	assert.Equal(t, "chaincode=simplestorage", event.ForListener.Event.Location)
+	assert.Equal(t, "1", event.ForListener.Event.Output.GetString("value"))
+	assert.Equal(t, "simplestorage", event.ForListener.Event.Info.GetString("chaincodeId"))
+
+	assert.Eventually(t, func() bool {
+		found, status, err := f.GetContractListenerStatus(context.Background(), listener.BackendID, false)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		return status.(*ListenerStatus).Checkpoint.TransactionID == "tx2"
+	}, 5*time.Second, time.Millisecond)
+	_, status, _ := f.GetContractListenerStatus(context.Background(), listener.BackendID, false)
+	assert.Equal(t, uint64(12), status.(*ListenerStatus).Checkpoint.Block)
+
+	err = f.DeleteContractListener(context.Background(), listener, false)
+	assert.NoError(t, err)
+	found, _, err := f.GetContractListenerStatus(context.Background(), listener.BackendID, true)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	_, _, err = f.GetContractListenerStatus(context.Background(), listener.BackendID, false)
+	assert.Regexp(t, "FF10109", err)
+	err = f.DeleteContractListener(context.Background(), listener, true)
+	assert.NoError(t, err)
+	err = f.DeleteContractListener(context.Background(), listener, false)
+	assert.Regexp(t, "FF10109", err)
+}
+
+func TestContractListenerReconnectFromCheckpoint(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	events := newEventServer(fake)
+	events.closeStream = true
+
+	dispatched := make(chan *blockchain.EventToDispatch, 1)
+	em := &blockchainmocks.Callbacks{}
+	em.On("BlockchainEventBatch", mock.Anything).Return(fmt.Errorf("pop")).Once()
+	em.On("BlockchainEventBatch", mock.Anything).Run(func(args mock.Arguments) {
+		batch := args[0].([]*blockchain.EventToDispatch)
+		dispatched <- batch[0]
+	}).Return(nil)
+	f.SetHandler("ns1", em)
+
+	checkpointPath := t.TempDir()
+	f.checkpointPath = checkpointPath
+	listener := testContractListener()
+	listener.Options.FirstEvent = string(core.SubOptsFirstEventOldest)
+	err := f.AddContractListener(context.Background(), listener)
+	assert.NoError(t, err)
+
+	req := <-events.requests
+	assert.Equal(t, uint64(0), req.StartPosition.GetSpecified().Number)
+
+	// The failed dispatch restarts the stream from the same position
+	events.responses <- chaincodeEvent(5, "tx1", "simplestorage", "Changed", `{}`)
+	req = <-events.requests
+	assert.Equal(t, uint64(0), req.StartPosition.GetSpecified().Number)
+	assert.Empty(t, req.AfterTransactionId)
+
+	// The stream closing after a successful dispatch restarts it after the checkpoint
+	events.responses <- chaincodeEvent(5, "tx1", "simplestorage", "Changed", `{}`)
+	<-dispatched
+	req = <-events.requests
+	assert.Equal(t, uint64(5), req.StartPosition.GetSpecified().Number)
+	assert.Equal(t, "tx1", req.AfterTransactionId)
+
+	checkpointFile := filepath.Join(checkpointPath, listener.BackendID+".json")
+	_, err = os.Stat(checkpointFile)
+	assert.NoError(t, err)
+
+	err = f.DeleteContractListener(context.Background(), listener, false)
+	assert.NoError(t, err)
+	_, err = os.Stat(checkpointFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestContractListenerStartBlock(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	events := newEventServer(fake)
+
+	listener := testContractListener()
+	listener.Options.FirstEvent = "100"
+	err := f.AddContractListener(context.Background(), listener)
+	assert.NoError(t, err)
+
+	req := <-events.requests
+	assert.Equal(t, uint64(100), req.StartPosition.GetSpecified().Number)
+}
+
+func TestContractListenerErrors(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	listener := testContractListener()
+	listener.Options.FirstEvent = "badness"
+	err := f.AddContractListener(context.Background(), listener)
+	assert.Regexp(t, "FF10191", err)
+
+	listener = testContractListener()
+	listener.Location = fftypes.JSONAnyPtr(`{"channel":"firefly"}`)
+	err = f.AddContractListener(context.Background(), listener)
+	assert.Regexp(t, "FF10310.*chaincode", err)
+
+	listener.Location = nil
+	err = f.AddContractListener(context.Background(), listener)
+	assert.Regexp(t, "FF10310.*channel", err)
+
+	f.checkpointPath = filepath.Join(t.TempDir(), "missing")
+	err = f.AddContractListener(context.Background(), testContractListener())
+	assert.Regexp(t, "FF10468", err)
+}
+
+func TestContractListenerUnknownSigner(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	f.signer = "unknown"
+	listener := testContractListener()
+	err := f.AddContractListener(context.Background(), listener)
+	assert.NoError(t, err)
+	err = f.DeleteContractListener(context.Background(), listener, false)
+	assert.NoError(t, err)
+}
+
+func testBatchPinPayload(namespace string) string {
+	return fmt.Sprintf(`{
+		"signer": "orgMSP::x509::CN=signer001,OU=client::CN=fabric-ca",
+		"timestamp": {"seconds": 1630031667, "nanos": 791499000},
+		"namespace": "%s",
+		"uuids": "0xe19af8b390604051812d7597d19adfb9847d3bfd074249efb65d3fed15f5b0a6",
+		"batchHash": "0xd71eb138d74c229a388eb0e1abc03f4c7cbb21d4fc4b839fbf0ec73e4263f6be",
+		"payloadRef": "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD",
+		"contexts": ["0x68e4da79f805bca5b912bcda9c63d03e6e867108dabb9b944109aea541ef522a"]
+	}`, namespace)
+}
+
+func TestFireflySubscriptionV1(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	events := newEventServer(fake)
+	fake.evaluate = networkVersionEvaluator("")
+
+	dispatched := make(chan *blockchain.EventToDispatch, 1)
+	em := &blockchainmocks.Callbacks{}
+	em.On("BlockchainEventBatch", mock.Anything).Run(func(args mock.Arguments) {
+		batch := args[0].([]*blockchain.EventToDispatch)
+		dispatched <- batch[0]
+	}).Return(nil)
+	f.SetHandler("ns1", em)
+
+	contract := &blockchain.MultipartyContract{
+		Location:   fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`),
+		FirstEvent: "oldest",
+	}
+	subID, err := f.AddFireflySubscription(context.Background(), &core.Namespace{Name: "ns1", NetworkName: "ns1"}, contract)
+	assert.NoError(t, err)
+	assert.Equal(t, "BatchPin-firefly-firefly", subID)
+	subID, err = f.AddFireflySubscription(context.Background(), &core.Namespace{Name: "ns2", NetworkName: "ns2"}, contract)
+	assert.NoError(t, err)
+	assert.Equal(t, "BatchPin-firefly-firefly", subID)
+
+	<-events.requests
+	events.responses <- chaincodeEvent(10, "tx1", "firefly", batchPinEventName, testBatchPinPayload("ns1"))
+
+	event := <-dispatched
+	assert.Equal(t, blockchain.EventTypeBatchPinComplete, event.Type)
+	assert.Equal(t, "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD", event.BatchPinComplete.Batch.BatchPayloadRef)
+	assert.Equal(t, "orgMSP::x509::CN=signer001,OU=client::CN=fabric-ca", event.BatchPinComplete.SigningKey.Value)
+	assert.Equal(t, "ns1", event.BatchPinComplete.Namespace)
+
+	f.RemoveFireflySubscription(context.Background(), subID)
+	found, _, err := f.GetContractListenerStatus(context.Background(), subID, true)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFireflySubscriptionV2(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	events := newEventServer(fake)
+	fake.evaluate = networkVersionEvaluator("2")
+
+	dispatched := make(chan *blockchain.EventToDispatch, 1)
+	em := &blockchainmocks.Callbacks{}
+	em.On("BlockchainEventBatch", mock.Anything).Run(func(args mock.Arguments) {
+		batch := args[0].([]*blockchain.EventToDispatch)
+		dispatched <- batch[0]
+	}).Return(nil)
+	f.SetHandler("ns1", em)
+
+	contract := &blockchain.MultipartyContract{
+		Location: fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`),
+		Options:  fftypes.JSONAnyPtr(`{"customPinSupport":false}`),
+	}
+	subID, err := f.AddFireflySubscription(context.Background(), &core.Namespace{Name: "ns1", NetworkName: "ns1"}, contract)
+	assert.NoError(t, err)
+	assert.Equal(t, "ns1_BatchPin-firefly-firefly", subID)
+
+	<-events.requests
+	events.responses <- chaincodeEvent(10, "tx1", "firefly", batchPinEventName, testBatchPinPayload(""))
+
+	event := <-dispatched
+	assert.Equal(t, blockchain.EventTypeBatchPinComplete, event.Type)
+	assert.Equal(t, "ns1", event.BatchPinComplete.Namespace)
+
+	// Events arriving after the subscription is removed are ignored
+	f.listenerMux.Lock()
+	l := f.listeners[subID]
+	f.listenerMux.Unlock()
+	f.RemoveFireflySubscription(context.Background(), subID)
+	f.processBatchPinEvent(context.Background(), nil, l, nil)
+}
+
+func TestFireflySubscriptionBadPayload(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	f.subs.AddSubscription(context.Background(), &core.Namespace{Name: "ns1", NetworkName: "ns1"}, 2, "sub1", "firefly")
+	l := &eventStream{id: "sub1", location: &Location{Channel: "firefly", Chaincode: "firefly"}}
+	f.processBatchPinEvent(context.Background(), nil, l, &client.ChaincodeEvent{Payload: []byte("!json")})
+}
+
+func TestFireflySubscriptionErrors(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	fake.evaluate = func(inv *invocation) ([]byte, error) { return nil, gatewayError("pop") }
+	ns := &core.Namespace{Name: "ns1", NetworkName: "ns1"}
+
+	_, err := f.AddFireflySubscription(context.Background(), ns, &blockchain.MultipartyContract{
+		Location: fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`),
+		Options:  fftypes.JSONAnyPtr(`{"customPinSupport":true}`),
+	})
+	assert.Regexp(t, "FF10429", err)
+
+	_, err = f.AddFireflySubscription(context.Background(), ns, &blockchain.MultipartyContract{
+		Location: fftypes.JSONAnyPtr(`{"channel":"firefly"}`),
+		Options:  fftypes.JSONAnyPtr(`!json`),
+	})
+	assert.Regexp(t, "FF10310.*chaincode", err)
+
+	_, err = f.AddFireflySubscription(context.Background(), ns, &blockchain.MultipartyContract{})
+	assert.Regexp(t, "FF10310.*channel", err)
+
+	_, err = f.AddFireflySubscription(context.Background(), ns, &blockchain.MultipartyContract{
+		Location: fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`),
+	})
+	assert.Regexp(t, "pop", err)
+
+	fake.evaluate = networkVersionEvaluator("2")
+	_, err = f.AddFireflySubscription(context.Background(), ns, &blockchain.MultipartyContract{
+		Location:   fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`),
+		FirstEvent: "badness",
+	})
+	assert.Regexp(t, "FF10191", err)
+}
+
+func testEventStream() *eventStream {
+	return &eventStream{
+		id:         "es1",
+		location:   &Location{Channel: "firefly", Chaincode: "simplestorage"},
+		checkpoint: &eventCheckpoint{},
+	}
+}
+
+func TestStreamEventsCancelled(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+	events := newEventServer(fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	streamDone := make(chan error)
+	go func() {
+		streamDone <- f.streamEvents(ctx, testEventStream())
+	}()
+	<-events.requests
+	cancel()
+	assert.NoError(t, <-streamDone)
+}
+
+func TestStreamEventsCancelledBeforeStart(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := f.streamEvents(ctx, testEventStream())
+	assert.Regexp(t, "FF10468", err)
+}
+
+func TestStreamEventsClosed(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.events = func(req *gateway.ChaincodeEventsRequest, stream gateway.Gateway_ChaincodeEventsServer) error {
+		return nil
+	}
+	err := f.streamEvents(context.Background(), testEventStream())
+	assert.Regexp(t, "FF10468.*chaincode event stream closed", err)
+}
+
+func TestHandleChaincodeEventCheckpointFail(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	f.checkpointPath = t.TempDir()
+	l := testEventStream()
+	l.eventName = "Changed"
+	checkpoint, err := f.newCheckpoint(context.Background(), l.id)
+	assert.NoError(t, err)
+	checkpoint.close()
+	l.checkpoint = checkpoint
+
+	err = f.handleChaincodeEvent(context.Background(), l, &client.ChaincodeEvent{BlockNumber: 5, TransactionID: "tx1", EventName: "Other"})
+	assert.Regexp(t, "FF10468", err)
+}
@@ -0,0 +1,629 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/hyperledger/firefly/internal/blockchain/common"
+	"github.com/hyperledger/firefly/internal/cache"
+	"github.com/hyperledger/firefly/internal/coreconfig"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/internal/metrics"
+	"github.com/hyperledger/firefly/pkg/blockchain"
+	"github.com/hyperledger/firefly/pkg/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// FabricGateway is a Fabric blockchain plugin that talks directly to the Fabric Gateway service
+// of a peer over gRPC, signing with local MSP key material, rather than going through fabconnect.
+type FabricGateway struct {
+	ctx                 context.Context
+	cancelCtx           context.CancelFunc
+	defaultChannel      string
+	signer              string
+	mspID               string
+	mspPath             string
+	checkpointPath      string
+	evaluateTimeout     time.Duration
+	endorseTimeout      time.Duration
+	submitTimeout       time.Duration
+	commitStatusTimeout time.Duration
+	eventsRetry         *retry.Retry
+	capabilities        *blockchain.Capabilities
+	callbacks           common.BlockchainCallbacks
+	metrics             metrics.Manager
+	gatewayConf         config.Section
+	dialOptions         []grpc.DialOption
+	conn                *grpc.ClientConn
+	idMux               sync.Mutex
+	idCache             map[string]*signingIdentity
+	listenerMux         sync.Mutex
+	listeners           map[string]*eventStream
+	subs                common.FireflySubscriptions
+	cache               cache.CInterface
+}
+
+type Location struct {
+	Channel   string `json:"channel"`
+	Chaincode string `json:"chaincode"`
+}
+
+type ContractOptions struct {
+	CustomPinSupport bool `json:"customPinSupport"`
+}
+
+type ffiMethodAndErrors struct {
+	method *fftypes.FFIMethod
+	errors []*fftypes.FFIError
+}
+
+const (
+	batchPinEventName        = "BatchPin"
+	batchPinMethodName       = "PinBatch"
+	networkActionMethodName  = "NetworkAction"
+	networkVersionMethodName = "NetworkVersion"
+
+	optionTransientMap           = "transientMap"
+	optionEndorsingOrganizations = "endorsingOrganizations"
+)
+
+var batchPinParamsV1 = []string{"namespace", "uuids", "batchHash", "payloadRef", "contexts"}
+var batchPinParams = []string{"uuids", "batchHash", "payloadRef", "contexts"}
+var networkActionParams = []string{"action", "payload"}
+
+func (f *FabricGateway) Name() string {
+	return "fabricgateway"
+}
+
+func (f *FabricGateway) VerifierType() core.VerifierType {
+	return core.VerifierTypeMSPIdentity
+}
+
+func (f *FabricGateway) Init(ctx context.Context, cancelCtx context.CancelFunc, conf config.Section, metrics metrics.Manager, cacheManager cache.Manager) (err error) {
+	f.InitConfig(conf)
+	gatewayConf := f.gatewayConf
+
+	f.ctx = log.WithLogField(ctx, "proto", "fabricgateway")
+	f.cancelCtx = cancelCtx
+	f.idCache = make(map[string]*signingIdentity)
+	f.listeners = make(map[string]*eventStream)
+	f.metrics = metrics
+	f.capabilities = &blockchain.Capabilities{}
+	f.callbacks = common.NewBlockchainCallbacks()
+	f.subs = common.NewFireflySubscriptions()
+
+	address := gatewayConf.GetString(GatewayConfigAddress)
+	if address == "" {
+		return i18n.NewError(ctx, coremsgs.MsgMissingPluginConfig, GatewayConfigAddress, "blockchain.fabricgateway.gateway")
+	}
+	f.mspID = gatewayConf.GetString(GatewayConfigMSPID)
+	if f.mspID == "" {
+		return i18n.NewError(ctx, coremsgs.MsgMissingPluginConfig, GatewayConfigMSPID, "blockchain.fabricgateway.gateway")
+	}
+	f.mspPath = gatewayConf.GetString(GatewayConfigMSPPath)
+	if f.mspPath == "" {
+		return i18n.NewError(ctx, coremsgs.MsgMissingPluginConfig, GatewayConfigMSPPath, "blockchain.fabricgateway.gateway")
+	}
+	f.defaultChannel = gatewayConf.GetString(GatewayConfigDefaultChannel)
+	// the org identity is guaranteed to be configured by the core
+	f.signer = gatewayConf.GetString(GatewayConfigSigner)
+	f.checkpointPath = gatewayConf.GetString(GatewayConfigCheckpointPath)
+	f.evaluateTimeout = gatewayConf.GetDuration(GatewayConfigEvaluateTimeout)
+	f.endorseTimeout = gatewayConf.GetDuration(GatewayConfigEndorseTimeout)
+	f.submitTimeout = gatewayConf.GetDuration(GatewayConfigSubmitTimeout)
+	f.commitStatusTimeout = gatewayConf.GetDuration(GatewayConfigCommitStatusTimeout)
+	f.eventsRetry = &retry.Retry{
+		InitialDelay: gatewayConf.GetDuration(GatewayConfigEventsRetryInitialDelay),
+		MaximumDelay: gatewayConf.GetDuration(GatewayConfigEventsRetryMaxDelay),
+		Factor:       gatewayConf.GetFloat64(GatewayConfigEventsRetryFactor),
+	}
+
+	tlsConfig, err := fftls.ConstructTLSConfig(ctx, gatewayConf.SubSection(GatewayConfigTLS), fftls.ClientType)
+	if err != nil {
+		return err
+	}
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+	// Dialing is non-blocking - the connection is established (and re-established) on demand
+	dialOptions := append([]grpc.DialOption{grpc.WithTransportCredentials(transportCredentials)}, f.dialOptions...)
+	f.conn, err = grpc.DialContext(f.ctx, address, dialOptions...)
+	if err != nil {
+		return err
+	}
+
+	cache, err := cacheManager.GetCache(
+		cache.NewCacheConfig(
+			ctx,
+			coreconfig.CacheBlockchainLimit,
+			coreconfig.CacheBlockchainTTL,
+			"",
+		),
+	)
+	if err != nil {
+		return err
+	}
+	f.cache = cache
+
+	go func() {
+		<-f.ctx.Done()
+		f.closeIdentities()
+		_ = f.conn.Close()
+	}()
+	return nil
+}
+
+func (f *FabricGateway) SetHandler(namespace string, handler blockchain.Callbacks) {
+	f.callbacks.SetHandler(namespace, handler)
+}
+
+func (f *FabricGateway) SetOperationHandler(namespace string, handler core.OperationCallbacks) {
+	f.callbacks.SetOperationalHandler(namespace, handler)
+}
+
+func (f *FabricGateway) Start() error {
+	// Event streams are started individually as subscriptions and listeners are added
+	return nil
+}
+
+func (f *FabricGateway) Capabilities() *blockchain.Capabilities {
+	return f.capabilities
+}
+
+// wrapGatewayError extracts the gRPC status message, and the per-peer details the
+// gateway attaches to it, which carry the actual chaincode error
+func wrapGatewayError(ctx context.Context, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return i18n.NewError(ctx, coremsgs.MsgFabricGatewayErr, err)
+	}
+	message := st.Message()
+	for _, detail := range st.Details() {
+		if errDetail, ok := detail.(*gateway.ErrorDetail); ok {
+			message = fmt.Sprintf("%s; %s (%s): %s", message, errDetail.Address, errDetail.MspId, errDetail.Message)
+		}
+	}
+	return i18n.NewError(ctx, coremsgs.MsgFabricGatewayErr, message)
+}
+
+func buildProposalOptions(ctx context.Context, args []string, options map[string]interface{}) ([]client.ProposalOption, error) {
+	proposalOptions := []client.ProposalOption{client.WithArguments(args...)}
+	for k, v := range options {
+		switch k {
+		case optionTransientMap:
+			transientInput, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, i18n.NewError(ctx, i18n.MsgJSONObjectParseFailed, k)
+			}
+			transient := make(map[string][]byte, len(transientInput))
+			for key, value := range transientInput {
+				encoded, err := jsonEncodeValue(value)
+				if err != nil {
+					return nil, i18n.WrapError(ctx, err, i18n.MsgJSONObjectParseFailed, k)
+				}
+				transient[key] = []byte(encoded)
+			}
+			proposalOptions = append(proposalOptions, client.WithTransient(transient))
+		case optionEndorsingOrganizations:
+			orgsInput, ok := v.([]interface{})
+			if !ok {
+				return nil, i18n.NewError(ctx, i18n.MsgJSONObjectParseFailed, k)
+			}
+			orgs := make([]string, len(orgsInput))
+			for i, org := range orgsInput {
+				if orgs[i], ok = org.(string); !ok {
+					return nil, i18n.NewError(ctx, i18n.MsgJSONObjectParseFailed, k)
+				}
+			}
+			proposalOptions = append(proposalOptions, client.WithEndorsingOrganizations(orgs...))
+		default:
+			return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayUnsupportedOption, k)
+		}
+	}
+	return proposalOptions, nil
+}
+
+// buildArgs lays out the named inputs as the positional string arguments chaincode expects,
+// with all non-string values JSON serialized
+func buildArgs(ctx context.Context, paramNames []string, input map[string]interface{}) ([]string, error) {
+	args := make([]string, len(paramNames))
+	for i, name := range paramNames {
+		encoded, err := jsonEncodeValue(input[name])
+		if err != nil {
+			return nil, i18n.WrapError(ctx, err, i18n.MsgJSONObjectParseFailed, name)
+		}
+		args[i] = encoded
+	}
+	return args, nil
+}
+
+func jsonEncodeValue(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encodedValue, err := json.Marshal(value)
+	return string(encodedValue), err
+}
+
+func (f *FabricGateway) invokeContractMethod(ctx context.Context, channel, chaincode, methodName, signingKey, requestID string, args []string, options map[string]interface{}) (submissionRejected bool, err error) {
+	id, err := f.getIdentity(ctx, signingKey)
+	if err != nil {
+		return true, err
+	}
+	proposalOptions, err := buildProposalOptions(ctx, args, options)
+	if err != nil {
+		return true, err
+	}
+	proposal, err := id.gateway.GetNetwork(channel).GetContract(chaincode).NewProposal(methodName, proposalOptions...)
+	if err != nil {
+		return true, i18n.NewError(ctx, coremsgs.MsgFabricGatewayErr, err)
+	}
+
+	endorseCtx, cancelEndorse := context.WithTimeout(ctx, f.endorseTimeout)
+	defer cancelEndorse()
+	transaction, err := proposal.EndorseWithContext(endorseCtx)
+	if err != nil {
+		// Endorsement failures are returned by the chaincode itself, so will not succeed on retry
+		return true, wrapGatewayError(ctx, err)
+	}
+
+	submitCtx, cancelSubmit := context.WithTimeout(ctx, f.submitTimeout)
+	defer cancelSubmit()
+	commit, err := transaction.SubmitWithContext(submitCtx)
+	if err != nil {
+		return false, wrapGatewayError(ctx, err)
+	}
+	log.L(ctx).Infof("Submitted transaction %s for operation %s", commit.TransactionID(), requestID)
+	_ = common.HandleReceipt(ctx, f, submittedReceipt(requestID, commit.TransactionID()), f.callbacks)
+
+	go f.waitForCommit(requestID, commit)
+	return false, nil
+}
+
+// waitForCommit delivers the outcome of a submitted transaction as a receipt, in the same
+// form as the receipts delivered by the blockchain connectors
+func (f *FabricGateway) waitForCommit(requestID string, commit *client.Commit) {
+	ctx, cancel := context.WithTimeout(f.ctx, f.commitStatusTimeout)
+	defer cancel()
+	commitStatus, err := commit.StatusWithContext(ctx)
+	if err != nil {
+		// We do not know the outcome, so the operation remains pending until its status is looked up
+		log.L(f.ctx).Errorf("Failed to get commit status of transaction %s for operation %s: %s", commit.TransactionID(), requestID, wrapGatewayError(ctx, err))
+		return
+	}
+
+	_ = common.HandleReceipt(f.ctx, f, commitReceipt(requestID, commitStatus.TransactionID, commitStatus.BlockNumber, commitStatus.Code), f.callbacks)
+}
+
+func (f *FabricGateway) queryContractMethod(ctx context.Context, channel, chaincode, methodName, signingKey string, args []string, options map[string]interface{}) ([]byte, error) {
+	id, err := f.getIdentity(ctx, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	proposalOptions, err := buildProposalOptions(ctx, args, options)
+	if err != nil {
+		return nil, err
+	}
+	evaluateCtx, cancel := context.WithTimeout(ctx, f.evaluateTimeout)
+	defer cancel()
+	result, err := id.gateway.GetNetwork(channel).GetContract(chaincode).EvaluateWithContext(evaluateCtx, methodName, proposalOptions...)
+	if err != nil {
+		return nil, wrapGatewayError(ctx, err)
+	}
+	return result, nil
+}
+
+func hexFormatB32(b *fftypes.Bytes32) string {
+	if b == nil {
+		return "0x0000000000000000000000000000000000000000000000000000000000000000"
+	}
+	return "0x" + hex.EncodeToString(b[0:32])
+}
+
+func (f *FabricGateway) buildBatchPinInput(ctx context.Context, version int, namespace string, batch *blockchain.BatchPin) (paramNames []string, pinInput map[string]interface{}) {
+	hashes := make([]string, len(batch.Contexts))
+	for i, v := range batch.Contexts {
+		hashes[i] = hexFormatB32(v)
+	}
+	var uuids fftypes.Bytes32
+	copy(uuids[0:16], (*batch.TransactionID)[:])
+	copy(uuids[16:32], (*batch.BatchID)[:])
+
+	pinInput = map[string]interface{}{
+		"uuids":      hexFormatB32(&uuids),
+		"batchHash":  hexFormatB32(batch.BatchHash),
+		"payloadRef": batch.BatchPayloadRef,
+		"contexts":   hashes,
+	}
+	if version == 1 {
+		pinInput["namespace"] = namespace
+		return batchPinParamsV1, pinInput
+	}
+	return batchPinParams, pinInput
+}
+
+func (f *FabricGateway) SubmitBatchPin(ctx context.Context, nsOpID, networkNamespace, signingKey string, batch *blockchain.BatchPin, location *fftypes.JSONAny) error {
+	fabricOnChainLocation, err := parseContractLocation(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	version, err := f.GetNetworkVersion(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	paramNames, pinInput := f.buildBatchPinInput(ctx, version, networkNamespace, batch)
+	args, _ := buildArgs(ctx, paramNames, pinInput)
+	_, err = f.invokeContractMethod(ctx, fabricOnChainLocation.Channel, fabricOnChainLocation.Chaincode, batchPinMethodName, signingKey, nsOpID, args, nil)
+	return err
+}
+
+func (f *FabricGateway) SubmitNetworkAction(ctx context.Context, nsOpID string, signingKey string, action core.NetworkActionType, location *fftypes.JSONAny) error {
+	fabricOnChainLocation, err := parseContractLocation(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	version, err := f.GetNetworkVersion(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	var methodName string
+	var paramNames []string
+	var pinInput map[string]interface{}
+
+	if version == 1 {
+		methodName = batchPinMethodName
+		paramNames = batchPinParamsV1
+		pinInput = map[string]interface{}{
+			"namespace":  "firefly:" + string(action),
+			"uuids":      hexFormatB32(nil),
+			"batchHash":  hexFormatB32(nil),
+			"payloadRef": "",
+			"contexts":   []string{},
+		}
+	} else {
+		methodName = networkActionMethodName
+		paramNames = networkActionParams
+		pinInput = map[string]interface{}{
+			"action":  "firefly:" + string(action),
+			"payload": "",
+		}
+	}
+
+	args, _ := buildArgs(ctx, paramNames, pinInput)
+	_, err = f.invokeContractMethod(ctx, fabricOnChainLocation.Channel, fabricOnChainLocation.Chaincode, methodName, signingKey, nsOpID, args, nil)
+	return err
+}
+
+func (f *FabricGateway) DeployContract(ctx context.Context, nsOpID, signingKey string, definition, contract *fftypes.JSONAny, input []interface{}, options map[string]interface{}) (submissionRejected bool, err error) {
+	return true, i18n.NewError(ctx, coremsgs.MsgNotSupportedByBlockchainPlugin)
+}
+
+func (f *FabricGateway) ValidateInvokeRequest(ctx context.Context, parsedMethod interface{}, input map[string]interface{}, hasMessage bool) error {
+	// No additional validation beyond what is enforced by Contract Manager
+	_, _, err := f.recoverFFI(ctx, parsedMethod)
+	return err
+}
+
+func methodParamNames(method *fftypes.FFIMethod) []string {
+	paramNames := make([]string, len(method.Params))
+	for i, param := range method.Params {
+		paramNames[i] = param.Name
+	}
+	return paramNames
+}
+
+func (f *FabricGateway) InvokeContract(ctx context.Context, nsOpID string, signingKey string, location *fftypes.JSONAny, parsedMethod interface{}, input map[string]interface{}, options map[string]interface{}, batch *blockchain.BatchPin) (bool, error) {
+	method, _, err := f.recoverFFI(ctx, parsedMethod)
+	if err != nil {
+		return true, err
+	}
+
+	fabricOnChainLocation, err := parseContractLocation(ctx, location)
+	if err != nil {
+		return true, err
+	}
+
+	if batch != nil {
+		_, batchPin := f.buildBatchPinInput(ctx, 2, "", batch)
+		if input == nil {
+			input = make(map[string]interface{})
+		}
+		batchPinBytes, _ := json.Marshal(batchPin)
+		lastParam := method.Params[len(method.Params)-1]
+		input[lastParam.Name] = string(batchPinBytes)
+	}
+
+	args, err := buildArgs(ctx, methodParamNames(method), input)
+	if err != nil {
+		return true, err
+	}
+
+	if f.metrics.IsMetricsEnabled() {
+		f.metrics.BlockchainTransaction(fabricOnChainLocation.Chaincode, method.Name)
+	}
+	return f.invokeContractMethod(ctx, fabricOnChainLocation.Channel, fabricOnChainLocation.Chaincode, method.Name, signingKey, nsOpID, args, options)
+}
+
+func (f *FabricGateway) ParseInterface(ctx context.Context, method *fftypes.FFIMethod, errors []*fftypes.FFIError) (interface{}, error) {
+	// As with the fabconnect based plugin, there is no underlying schema to map the FFI to,
+	// so we just use it directly.
+	return &ffiMethodAndErrors{
+		method: method,
+		errors: errors,
+	}, nil
+}
+
+func (f *FabricGateway) recoverFFI(ctx context.Context, parsedMethod interface{}) (*fftypes.FFIMethod, []*fftypes.FFIError, error) {
+	methodInfo, ok := parsedMethod.(*ffiMethodAndErrors)
+	if !ok || methodInfo.method == nil {
+		return nil, nil, i18n.NewError(ctx, coremsgs.MsgUnexpectedInterfaceType, parsedMethod)
+	}
+	return methodInfo.method, methodInfo.errors, nil
+}
+
+func (f *FabricGateway) QueryContract(ctx context.Context, signingKey string, location *fftypes.JSONAny, parsedMethod interface{}, input map[string]interface{}, options map[string]interface{}) (interface{}, error) {
+	method, _, err := f.recoverFFI(ctx, parsedMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	fabricOnChainLocation, err := parseContractLocation(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := buildArgs(ctx, methodParamNames(method), input)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.metrics.IsMetricsEnabled() {
+		f.metrics.BlockchainQuery(fabricOnChainLocation.Chaincode, method.Name)
+	}
+	result, err := f.queryContractMethod(ctx, fabricOnChainLocation.Channel, fabricOnChainLocation.Chaincode, method.Name, signingKey, args, options)
+	if err != nil || len(result) == 0 {
+		return nil, err
+	}
+	// Chaincode results are arbitrary bytes - return them parsed if they are JSON, and as a string otherwise
+	var output interface{}
+	if err := json.Unmarshal(result, &output); err != nil {
+		return string(result), nil
+	}
+	return output, nil
+}
+
+func (f *FabricGateway) NormalizeContractLocation(ctx context.Context, ntype blockchain.NormalizeType, location *fftypes.JSONAny) (result *fftypes.JSONAny, err error) {
+	parsed, err := parseContractLocation(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	return encodeContractLocation(ctx, ntype, parsed)
+}
+
+func parseContractLocation(ctx context.Context, location *fftypes.JSONAny) (*Location, error) {
+	if location == nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgContractLocationInvalid, "'channel' not set")
+	}
+	fabricLocation := Location{}
+	if err := json.Unmarshal(location.Bytes(), &fabricLocation); err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgContractLocationInvalid, err)
+	}
+	if fabricLocation.Channel == "" {
+		return nil, i18n.NewError(ctx, coremsgs.MsgContractLocationInvalid, "'channel' not set")
+	}
+	return &fabricLocation, nil
+}
+
+func encodeContractLocation(ctx context.Context, ntype blockchain.NormalizeType, location *Location) (result *fftypes.JSONAny, err error) {
+	if location.Channel == "" {
+		return nil, i18n.NewError(ctx, coremsgs.MsgContractLocationInvalid, "'channel' not set")
+	}
+	if ntype == blockchain.NormalizeCall && location.Chaincode == "" {
+		return nil, i18n.NewError(ctx, coremsgs.MsgContractLocationInvalid, "'chaincode' not set")
+	}
+	normalized, err := json.Marshal(location)
+	if err == nil {
+		result = fftypes.JSONAnyPtrBytes(normalized)
+	}
+	return result, err
+}
+
+func (f *FabricGateway) GetFFIParamValidator(ctx context.Context) (fftypes.FFIParamValidator, error) {
+	// Chaincode does not require any additional validation beyond "JSON Schema correctness" at this time
+	return nil, nil
+}
+
+func (f *FabricGateway) GenerateFFI(ctx context.Context, generationRequest *fftypes.FFIGenerationRequest) (*fftypes.FFI, error) {
+	return nil, i18n.NewError(ctx, coremsgs.MsgFFIGenerationUnsupported)
+}
+
+func (f *FabricGateway) GenerateEventSignature(ctx context.Context, event *fftypes.FFIEventDefinition) string {
+	return event.Name
+}
+
+func (f *FabricGateway) GenerateErrorSignature(ctx context.Context, event *fftypes.FFIErrorDefinition) string {
+	// not relevant to Fabric blockchains
+	return ""
+}
+
+func (f *FabricGateway) GetNetworkVersion(ctx context.Context, location *fftypes.JSONAny) (version int, err error) {
+	fabricOnChainLocation, err := parseContractLocation(ctx, location)
+	if err != nil {
+		return 0, err
+	}
+
+	cacheKey := "version:" + fabricOnChainLocation.Channel + ":" + fabricOnChainLocation.Chaincode
+	if cachedValue := f.cache.GetInt(cacheKey); cachedValue != 0 {
+		return cachedValue, nil
+	}
+
+	version, err = f.queryNetworkVersion(ctx, fabricOnChainLocation.Channel, fabricOnChainLocation.Chaincode)
+	if err == nil {
+		f.cache.SetInt(cacheKey, version)
+	}
+	return version, err
+}
+
+func (f *FabricGateway) queryNetworkVersion(ctx context.Context, channel, chaincode string) (version int, err error) {
+	result, err := f.queryContractMethod(ctx, channel, chaincode, networkVersionMethodName, f.signer, []string{}, nil)
+	if err != nil {
+		// "Function not found" is interpreted as "default to version 1"
+		notFoundError := fmt.Sprintf("Function %s not found", networkVersionMethodName)
+		if strings.Contains(err.Error(), notFoundError) {
+			return 1, nil
+		}
+		return 0, err
+	}
+
+	var output interface{}
+	_ = json.Unmarshal(result, &output)
+	switch typedOutput := output.(type) {
+	case float64:
+		version = int(typedOutput)
+	default:
+		err = i18n.NewError(ctx, coremsgs.MsgBadNetworkVersion, string(result))
+	}
+	return version, err
+}
+
+func (f *FabricGateway) GetAndConvertDeprecatedContractConfig(ctx context.Context) (location *fftypes.JSONAny, fromBlock string, err error) {
+	// There is no deprecated config to migrate for this plugin
+	return nil, "", nil
+}
@@ -0,0 +1,963 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly/internal/cache"
+	"github.com/hyperledger/firefly/internal/coreconfig"
+	"github.com/hyperledger/firefly/mocks/blockchainmocks"
+	"github.com/hyperledger/firefly/mocks/cachemocks"
+	"github.com/hyperledger/firefly/mocks/coremocks"
+	"github.com/hyperledger/firefly/mocks/metricsmocks"
+	"github.com/hyperledger/firefly/pkg/blockchain"
+	"github.com/hyperledger/firefly/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+var utConfig = config.RootSection("fabgw_unit_tests")
+var utGatewayConf = utConfig.SubSection(GatewayConfigKey)
+
+// invocation is the content of a transaction proposal, as received by the fake gateway
+type invocation struct {
+	channel       string
+	chaincode     string
+	fn            string
+	args          []string
+	transient     map[string][]byte
+	endorsingOrgs []string
+	mspID         string
+	txID          string
+}
+
+// fakeGateway is an in-process implementation of the Fabric Gateway gRPC service
+type fakeGateway struct {
+	gateway.UnimplementedGatewayServer
+	evaluate     func(inv *invocation) ([]byte, error)
+	endorse      func(inv *invocation) ([]byte, error)
+	submit       func(txID string) error
+	commitStatus func(txID string) (*gateway.CommitStatusResponse, error)
+	events       func(req *gateway.ChaincodeEventsRequest, stream gateway.Gateway_ChaincodeEventsServer) error
+}
+
+func mustMarshal(m proto.Message) []byte {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func parseInvocation(signedProposal *peer.SignedProposal, endorsingOrgs []string) *invocation {
+	proposal := &peer.Proposal{}
+	_ = proto.Unmarshal(signedProposal.ProposalBytes, proposal)
+	header := &common.Header{}
+	_ = proto.Unmarshal(proposal.Header, header)
+	channelHeader := &common.ChannelHeader{}
+	_ = proto.Unmarshal(header.ChannelHeader, channelHeader)
+	signatureHeader := &common.SignatureHeader{}
+	_ = proto.Unmarshal(header.SignatureHeader, signatureHeader)
+	creator := &msp.SerializedIdentity{}
+	_ = proto.Unmarshal(signatureHeader.Creator, creator)
+	payload := &peer.ChaincodeProposalPayload{}
+	_ = proto.Unmarshal(proposal.Payload, payload)
+	spec := &peer.ChaincodeInvocationSpec{}
+	_ = proto.Unmarshal(payload.Input, spec)
+
+	inv := &invocation{
+		channel:       channelHeader.ChannelId,
+		txID:          channelHeader.TxId,
+		mspID:         creator.Mspid,
+		chaincode:     spec.ChaincodeSpec.ChaincodeId.Name,
+		transient:     payload.TransientMap,
+		endorsingOrgs: endorsingOrgs,
+	}
+	for i, arg := range spec.ChaincodeSpec.Input.Args {
+		if i == 0 {
+			inv.fn = string(arg)
+		} else {
+			inv.args = append(inv.args, string(arg))
+		}
+	}
+	return inv
+}
+
+func gatewayError(message string) error {
+	st, _ := status.New(codes.Aborted, message).WithDetails(&gateway.ErrorDetail{
+		Address: "peer0:7051",
+		MspId:   "orgMSP",
+		Message: "chaincode response 500, " + message,
+	})
+	return st.Err()
+}
+
+func (g *fakeGateway) Evaluate(ctx context.Context, req *gateway.EvaluateRequest) (*gateway.EvaluateResponse, error) {
+	result, err := g.evaluate(parseInvocation(req.ProposedTransaction, req.TargetOrganizations))
+	if err != nil {
+		return nil, err
+	}
+	return &gateway.EvaluateResponse{Result: &peer.Response{Status: 200, Payload: result}}, nil
+}
+
+func (g *fakeGateway) Endorse(ctx context.Context, req *gateway.EndorseRequest) (*gateway.EndorseResponse, error) {
+	inv := parseInvocation(req.ProposedTransaction, req.EndorsingOrganizations)
+	result, err := g.endorse(inv)
+	if err != nil {
+		return nil, err
+	}
+	chaincodeAction := &peer.ChaincodeAction{Response: &peer.Response{Status: 200, Payload: result}}
+	actionPayload := &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: mustMarshal(&peer.ProposalResponsePayload{Extension: mustMarshal(chaincodeAction)}),
+		},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader: mustMarshal(&common.ChannelHeader{ChannelId: inv.channel, TxId: inv.txID}),
+		},
+		Data: mustMarshal(&peer.Transaction{
+			Actions: []*peer.TransactionAction{{Payload: mustMarshal(actionPayload)}},
+		}),
+	}
+	return &gateway.EndorseResponse{
+		PreparedTransaction: &common.Envelope{Payload: mustMarshal(payload)},
+	}, nil
+}
+
+func (g *fakeGateway) Submit(ctx context.Context, req *gateway.SubmitRequest) (*gateway.SubmitResponse, error) {
+	if err := g.submit(req.TransactionId); err != nil {
+		return nil, err
+	}
+	return &gateway.SubmitResponse{}, nil
+}
+
+func (g *fakeGateway) CommitStatus(ctx context.Context, req *gateway.SignedCommitStatusRequest) (*gateway.CommitStatusResponse, error) {
+	request := &gateway.CommitStatusRequest{}
+	_ = proto.Unmarshal(req.Request, request)
+	return g.commitStatus(request.TransactionId)
+}
+
+func (g *fakeGateway) ChaincodeEvents(req *gateway.SignedChaincodeEventsRequest, stream gateway.Gateway_ChaincodeEventsServer) error {
+	request := &gateway.ChaincodeEventsRequest{}
+	_ = proto.Unmarshal(req.Request, request)
+	return g.events(request, stream)
+}
+
+func writePEM(t *testing.T, path, pemType string, der []byte) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0600)
+	assert.NoError(t, err)
+}
+
+// newTestMSP writes an MSP directory for a user, with a certificate issued by a test CA
+func newTestMSP(t *testing.T, mspPath, name string, key crypto.Signer) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fabric-ca"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	userTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name, OrganizationalUnit: []string{"client"}},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, userTemplate, caTemplate, key.Public(), caKey)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	writePEM(t, filepath.Join(mspPath, name, "signcerts", "cert.pem"), "CERTIFICATE", certDER)
+	writePEM(t, filepath.Join(mspPath, name, "keystore", "priv_sk"), "PRIVATE KEY", keyDER)
+}
+
+func newTestKey() crypto.Signer {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return key
+}
+
+func resetConf(f *FabricGateway) {
+	coreconfig.Reset()
+	f.InitConfig(utConfig)
+}
+
+func newTestFabricGatewayUninitialized(t *testing.T) (*FabricGateway, *fakeGateway, func()) {
+	fake := &fakeGateway{
+		evaluate: func(inv *invocation) ([]byte, error) { return nil, gatewayError("unexpected evaluate") },
+		endorse:  func(inv *invocation) ([]byte, error) { return nil, gatewayError("unexpected endorse") },
+		submit:   func(txID string) error { return gatewayError("unexpected submit") },
+		commitStatus: func(txID string) (*gateway.CommitStatusResponse, error) {
+			return nil, gatewayError("unexpected status")
+		},
+		events: func(req *gateway.ChaincodeEventsRequest, stream gateway.Gateway_ChaincodeEventsServer) error {
+			<-stream.Context().Done()
+			return nil
+		},
+	}
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	gateway.RegisterGatewayServer(server, fake)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+
+	mspPath := t.TempDir()
+	newTestMSP(t, mspPath, "signer001", newTestKey())
+
+	f := &FabricGateway{
+		dialOptions: []grpc.DialOption{
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+		},
+	}
+	resetConf(f)
+	utGatewayConf.Set(GatewayConfigAddress, "bufnet")
+	utGatewayConf.Set(GatewayConfigMSPID, "orgMSP")
+	utGatewayConf.Set(GatewayConfigMSPPath, mspPath)
+	utGatewayConf.Set(GatewayConfigSigner, "signer001")
+	utGatewayConf.Set(GatewayConfigDefaultChannel, "firefly")
+	utGatewayConf.Set(GatewayConfigEventsRetryInitialDelay, "1ms")
+	utGatewayConf.Set(GatewayConfigEventsRetryMaxDelay, "1ms")
+	return f, fake, server.Stop
+}
+
+func newTestFabricGateway(t *testing.T) (*FabricGateway, *fakeGateway, func()) {
+	f, fake, stop := newTestFabricGatewayUninitialized(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cmi := &cachemocks.Manager{}
+	cmi.On("GetCache", mock.Anything).Return(cache.NewUmanagedCache(ctx, 100, 5*time.Minute), nil)
+	mm := &metricsmocks.Manager{}
+	mm.On("IsMetricsEnabled").Return(false)
+	err := f.Init(ctx, cancel, utConfig, mm, cmi)
+	assert.NoError(t, err)
+	return f, fake, func() {
+		cancel()
+		stop()
+	}
+}
+
+func testFFIMethod() *fftypes.FFIMethod {
+	return &fftypes.FFIMethod{
+		Name: "sum",
+		Params: []*fftypes.FFIParam{
+			{
+				Name:   "x",
+				Schema: fftypes.JSONAnyPtr(`{"type": "integer"}`),
+			},
+			{
+				Name:   "y",
+				Schema: fftypes.JSONAnyPtr(`{"type": "integer"}`),
+			},
+			{
+				Name:   "description",
+				Schema: fftypes.JSONAnyPtr(`{"type": "string"}`),
+			},
+		},
+		Returns: []*fftypes.FFIParam{
+			{
+				Name:   "z",
+				Schema: fftypes.JSONAnyPtr(`{"type": "integer"}`),
+			},
+		},
+	}
+}
+
+func testFFIPinMethod() *fftypes.FFIMethod {
+	return &fftypes.FFIMethod{
+		Name: "customPin",
+		Params: []*fftypes.FFIParam{
+			{
+				Name:   "data",
+				Schema: fftypes.JSONAnyPtr(`{"type": "string"}`),
+			},
+		},
+		Returns: []*fftypes.FFIParam{},
+	}
+}
+
+func networkVersionEvaluator(version string) func(inv *invocation) ([]byte, error) {
+	return func(inv *invocation) ([]byte, error) {
+		if inv.fn == networkVersionMethodName {
+			if version == "" {
+				return nil, gatewayError("Function NetworkVersion not found")
+			}
+			return []byte(version), nil
+		}
+		return nil, gatewayError("unexpected evaluate")
+	}
+}
+
+func TestInitMissingAddress(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	utGatewayConf.Set(GatewayConfigAddress, "")
+	err := f.Init(context.Background(), func() {}, utConfig, &metricsmocks.Manager{}, &cachemocks.Manager{})
+	assert.Regexp(t, "FF10138.*address", err)
+}
+
+func TestInitMissingMSPID(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	utGatewayConf.Set(GatewayConfigMSPID, "")
+	err := f.Init(context.Background(), func() {}, utConfig, &metricsmocks.Manager{}, &cachemocks.Manager{})
+	assert.Regexp(t, "FF10138.*msp.id", err)
+}
+
+func TestInitMissingMSPPath(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	utGatewayConf.Set(GatewayConfigMSPPath, "")
+	err := f.Init(context.Background(), func() {}, utConfig, &metricsmocks.Manager{}, &cachemocks.Manager{})
+	assert.Regexp(t, "FF10138.*msp.path", err)
+}
+
+func TestInitBadTLS(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	tlsConf := utGatewayConf.SubSection(GatewayConfigTLS)
+	tlsConf.Set(fftls.HTTPConfTLSEnabled, true)
+	tlsConf.Set(fftls.HTTPConfTLSCAFile, "!!!badness")
+	err := f.Init(context.Background(), func() {}, utConfig, &metricsmocks.Manager{}, &cachemocks.Manager{})
+	assert.Regexp(t, "FF00153", err)
+}
+
+type tlsOnlyCredentials struct{}
+
+func (c tlsOnlyCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (c tlsOnlyCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+func TestInitDialFail(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	f.dialOptions = append(f.dialOptions, grpc.WithPerRPCCredentials(tlsOnlyCredentials{}))
+	err := f.Init(context.Background(), func() {}, utConfig, &metricsmocks.Manager{}, &cachemocks.Manager{})
+	assert.Regexp(t, "transport", err)
+}
+
+func TestInitCacheFail(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmi := &cachemocks.Manager{}
+	cmi.On("GetCache", mock.Anything).Return(nil, fmt.Errorf("pop"))
+	err := f.Init(ctx, cancel, utConfig, &metricsmocks.Manager{}, cmi)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestInitTLS(t *testing.T) {
+	f, _, stop := newTestFabricGatewayUninitialized(t)
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	utGatewayConf.SubSection(GatewayConfigTLS).Set(fftls.HTTPConfTLSEnabled, true)
+	cmi := &cachemocks.Manager{}
+	cmi.On("GetCache", mock.Anything).Return(cache.NewUmanagedCache(ctx, 100, 5*time.Minute), nil)
+	err := f.Init(ctx, cancel, utConfig, &metricsmocks.Manager{}, cmi)
+	assert.NoError(t, err)
+	cmi.AssertCalled(t, "GetCache", cache.NewCacheConfig(
+		ctx,
+		coreconfig.CacheBlockchainLimit,
+		coreconfig.CacheBlockchainTTL,
+		"",
+	))
+}
+
+func TestPluginBasics(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	assert.Equal(t, "fabricgateway", f.Name())
+	assert.Equal(t, core.VerifierTypeMSPIdentity, f.VerifierType())
+	assert.NotNil(t, f.Capabilities())
+	assert.NoError(t, f.Start())
+	f.SetHandler("ns1", &blockchainmocks.Callbacks{})
+	f.SetOperationHandler("ns1", &coremocks.OperationCallbacks{})
+
+	validator, err := f.GetFFIParamValidator(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, validator)
+
+	_, err = f.GenerateFFI(context.Background(), &fftypes.FFIGenerationRequest{})
+	assert.Regexp(t, "FF10347", err)
+
+	submissionRejected, err := f.DeployContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", nil, nil, nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF10429", err)
+
+	assert.Equal(t, "Changed", f.GenerateEventSignature(context.Background(), &fftypes.FFIEventDefinition{Name: "Changed"}))
+	assert.Equal(t, "", f.GenerateErrorSignature(context.Background(), &fftypes.FFIErrorDefinition{Name: "Error"}))
+
+	location, fromBlock, err := f.GetAndConvertDeprecatedContractConfig(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, location)
+	assert.Empty(t, fromBlock)
+
+	txStatus, err := f.GetTransactionStatus(context.Background(), &core.Operation{})
+	assert.NoError(t, err)
+	assert.Nil(t, txStatus)
+}
+
+func TestInvokeContractOK(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	invocations := make(chan *invocation, 1)
+	fake.endorse = func(inv *invocation) ([]byte, error) {
+		invocations <- inv
+		return []byte("{}"), nil
+	}
+	fake.submit = func(txID string) error { return nil }
+	fake.commitStatus = func(txID string) (*gateway.CommitStatusResponse, error) {
+		return &gateway.CommitStatusResponse{Result: peer.TxValidationCode_VALID, BlockNumber: 12}, nil
+	}
+
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+	updated := make(chan struct{})
+	em := &coremocks.OperationCallbacks{}
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID &&
+			update.Status == core.OpStatusPending &&
+			update.BlockchainTXID != "" &&
+			update.Output.GetString("transactionHash") == update.BlockchainTXID
+	})).Return(nil).Once()
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID &&
+			update.Status == core.OpStatusSucceeded &&
+			update.BlockchainTXID != "" &&
+			update.Output.GetString("protocolId") == fmt.Sprintf("000000000012/%s", update.BlockchainTXID)
+	})).Run(func(args mock.Arguments) { close(updated) }).Return(nil)
+	f.SetOperationHandler("ns1", em)
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	input := map[string]interface{}{
+		"x":           float64(1),
+		"y":           float64(2),
+		"description": "test",
+	}
+	options := map[string]interface{}{
+		"transientMap":           map[string]interface{}{"secret": "shh", "more": map[string]interface{}{"a": "b"}},
+		"endorsingOrganizations": []interface{}{"org1MSP", "org2MSP"},
+	}
+	parsedMethod, err := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	assert.NoError(t, err)
+	err = f.ValidateInvokeRequest(context.Background(), parsedMethod, input, false)
+	assert.NoError(t, err)
+	submissionRejected, err := f.InvokeContract(context.Background(), nsOpID, "signer001", location, parsedMethod, input, options, nil)
+	assert.NoError(t, err)
+	assert.False(t, submissionRejected)
+
+	inv := <-invocations
+	assert.Equal(t, "firefly", inv.channel)
+	assert.Equal(t, "simplestorage", inv.chaincode)
+	assert.Equal(t, "orgMSP", inv.mspID)
+	assert.Equal(t, "sum", inv.fn)
+	assert.Equal(t, []string{"1", "2", "test"}, inv.args)
+	assert.Equal(t, "shh", string(inv.transient["secret"]))
+	assert.Equal(t, `{"a":"b"}`, string(inv.transient["more"]))
+	assert.Equal(t, []string{"org1MSP", "org2MSP"}, inv.endorsingOrgs)
+
+	<-updated
+	em.AssertExpectations(t)
+}
+
+func TestInvokeContractWithBatchCommitFailed(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	invocations := make(chan *invocation, 1)
+	fake.endorse = func(inv *invocation) ([]byte, error) {
+		invocations <- inv
+		return nil, nil
+	}
+	fake.submit = func(txID string) error { return nil }
+	fake.commitStatus = func(txID string) (*gateway.CommitStatusResponse, error) {
+		return &gateway.CommitStatusResponse{Result: peer.TxValidationCode_MVCC_READ_CONFLICT, BlockNumber: 12}, nil
+	}
+
+	nsOpID := "ns1:" + fftypes.NewUUID().String()
+	updated := make(chan struct{})
+	em := &coremocks.OperationCallbacks{}
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID && update.Status == core.OpStatusPending
+	})).Return(nil).Once()
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == nsOpID &&
+			update.Status == core.OpStatusFailed &&
+			update.ErrorMessage == fmt.Sprintf("Transaction %s failed to commit with status code 11 (MVCC_READ_CONFLICT)", update.BlockchainTXID)
+	})).Run(func(args mock.Arguments) { close(updated) }).Return(nil)
+	f.SetOperationHandler("ns1", em)
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	batch := &blockchain.BatchPin{
+		TransactionID:   fftypes.NewUUID(),
+		BatchID:         fftypes.NewUUID(),
+		BatchHash:       fftypes.NewRandB32(),
+		BatchPayloadRef: "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD",
+		Contexts:        []*fftypes.Bytes32{fftypes.NewRandB32()},
+	}
+	parsedMethod, err := f.ParseInterface(context.Background(), testFFIPinMethod(), nil)
+	assert.NoError(t, err)
+	submissionRejected, err := f.InvokeContract(context.Background(), nsOpID, "signer001", location, parsedMethod, nil, nil, batch)
+	assert.NoError(t, err)
+	assert.False(t, submissionRejected)
+
+	inv := <-invocations
+	assert.Equal(t, "customPin", inv.fn)
+	var pin map[string]interface{}
+	err = json.Unmarshal([]byte(inv.args[0]), &pin)
+	assert.NoError(t, err)
+	assert.Equal(t, batch.BatchPayloadRef, pin["payloadRef"])
+	assert.Equal(t, []interface{}{hexFormatB32(batch.Contexts[0])}, pin["contexts"])
+
+	<-updated
+	em.AssertExpectations(t)
+}
+
+func TestInvokeContractCommitStatusFail(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	statusRequested := make(chan struct{})
+	fake.endorse = func(inv *invocation) ([]byte, error) { return nil, nil }
+	fake.submit = func(txID string) error { return nil }
+	fake.commitStatus = func(txID string) (*gateway.CommitStatusResponse, error) {
+		defer close(statusRequested)
+		return nil, gatewayError("pop")
+	}
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, parsedMethod, nil, nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, submissionRejected)
+	<-statusRequested
+}
+
+func TestInvokeContractEndorseFail(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.endorse = func(inv *invocation) ([]byte, error) {
+		return nil, gatewayError("Asset already exists")
+	}
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, parsedMethod, nil, nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF10468.*Asset already exists; peer0:7051 \\(orgMSP\\): chaincode response 500, Asset already exists", err)
+}
+
+func TestInvokeContractSubmitFail(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.endorse = func(inv *invocation) ([]byte, error) { return nil, nil }
+	fake.submit = func(txID string) error { return fmt.Errorf("pop") }
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, parsedMethod, nil, nil, nil)
+	assert.False(t, submissionRejected)
+	assert.Regexp(t, "FF10468.*pop", err)
+}
+
+func TestInvokeContractBadProposal(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	// Protobuf refuses to marshal strings that are not valid UTF-8
+	submissionRejected, err := f.invokeContractMethod(context.Background(), "firefly", "\xff", "sum", "signer001", "ns1:"+fftypes.NewUUID().String(), nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF10468", err)
+}
+
+func TestInvokeContractBadOptions(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	for _, tc := range []struct {
+		options map[string]interface{}
+		err     string
+	}{
+		{options: map[string]interface{}{"unknown": true}, err: "FF10469.*unknown"},
+		{options: map[string]interface{}{"transientMap": "wrong"}, err: "FF00127.*transientMap"},
+		{options: map[string]interface{}{"transientMap": map[string]interface{}{"a": map[bool]bool{true: true}}}, err: "FF00127.*transientMap"},
+		{options: map[string]interface{}{"endorsingOrganizations": "wrong"}, err: "FF00127.*endorsingOrganizations"},
+		{options: map[string]interface{}{"endorsingOrganizations": []interface{}{false}}, err: "FF00127.*endorsingOrganizations"},
+	} {
+		submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, parsedMethod, nil, tc.options, nil)
+		assert.True(t, submissionRejected)
+		assert.Regexp(t, tc.err, err)
+	}
+}
+
+func TestInvokeContractBadInput(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	input := map[string]interface{}{"x": map[bool]bool{true: false}}
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, parsedMethod, input, nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF00127.*x", err)
+}
+
+func TestInvokeContractBadLocation(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", fftypes.JSONAnyPtr(`{}`), parsedMethod, nil, nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF10310", err)
+}
+
+func TestInvokeContractBadMethod(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, "wrong", nil, nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF10457", err)
+	err = f.ValidateInvokeRequest(context.Background(), "wrong", nil, false)
+	assert.Regexp(t, "FF10457", err)
+}
+
+func TestInvokeContractUnknownSigner(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	submissionRejected, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "unknown", location, parsedMethod, nil, nil, nil)
+	assert.True(t, submissionRejected)
+	assert.Regexp(t, "FF10466.*unknown", err)
+}
+
+func TestInvokeContractMetrics(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	mm := &metricsmocks.Manager{}
+	mm.On("IsMetricsEnabled").Return(true)
+	mm.On("BlockchainTransaction", "simplestorage", "sum").Return()
+	mm.On("BlockchainQuery", "simplestorage", "sum").Return()
+	f.metrics = mm
+	fake.endorse = func(inv *invocation) ([]byte, error) { return nil, gatewayError("pop") }
+	fake.evaluate = func(inv *invocation) ([]byte, error) { return nil, gatewayError("pop") }
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	_, err := f.InvokeContract(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", location, parsedMethod, nil, nil, nil)
+	assert.Regexp(t, "pop", err)
+	_, err = f.QueryContract(context.Background(), "signer001", location, parsedMethod, nil, nil)
+	assert.Regexp(t, "pop", err)
+	mm.AssertExpectations(t)
+}
+
+func TestQueryContractOK(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	results := [][]byte{[]byte(`{"z":3}`), []byte("not json"), nil}
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		assert.Equal(t, "sum", inv.fn)
+		assert.Equal(t, []string{"1", "2", "test"}, inv.args)
+		assert.Equal(t, []string{"org1MSP"}, inv.endorsingOrgs)
+		result := results[0]
+		results = results[1:]
+		return result, nil
+	}
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	input := map[string]interface{}{
+		"x":           float64(1),
+		"y":           float64(2),
+		"description": "test",
+	}
+	options := map[string]interface{}{
+		"endorsingOrganizations": []interface{}{"org1MSP"},
+	}
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+
+	result, err := f.QueryContract(context.Background(), "signer001", location, parsedMethod, input, options)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"z": float64(3)}, result)
+
+	result, err = f.QueryContract(context.Background(), "signer001", location, parsedMethod, input, options)
+	assert.NoError(t, err)
+	assert.Equal(t, "not json", result)
+
+	result, err = f.QueryContract(context.Background(), "signer001", location, parsedMethod, input, options)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestQueryContractErrors(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+
+	_, err := f.QueryContract(context.Background(), "signer001", location, "wrong", nil, nil)
+	assert.Regexp(t, "FF10457", err)
+
+	_, err = f.QueryContract(context.Background(), "signer001", nil, parsedMethod, nil, nil)
+	assert.Regexp(t, "FF10310", err)
+
+	_, err = f.QueryContract(context.Background(), "signer001", location, parsedMethod, map[string]interface{}{"y": map[bool]bool{true: false}}, nil)
+	assert.Regexp(t, "FF00127.*y", err)
+
+	_, err = f.QueryContract(context.Background(), "signer001", location, parsedMethod, nil, map[string]interface{}{"bad": true})
+	assert.Regexp(t, "FF10469", err)
+
+	_, err = f.QueryContract(context.Background(), "unknown", location, parsedMethod, nil, nil)
+	assert.Regexp(t, "FF10466", err)
+}
+
+func TestQueryContractNotGRPCError(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`)
+	parsedMethod, _ := f.ParseInterface(context.Background(), testFFIMethod(), nil)
+	_, err := f.QueryContract(ctx, "signer001", location, parsedMethod, nil, nil)
+	assert.Regexp(t, "FF10468", err)
+
+	err = wrapGatewayError(context.Background(), fmt.Errorf("pop"))
+	assert.Regexp(t, "FF10468.*pop", err)
+}
+
+func TestSubmitBatchPinV1(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	invocations := make(chan *invocation, 1)
+	fake.evaluate = networkVersionEvaluator("")
+	fake.endorse = func(inv *invocation) ([]byte, error) {
+		invocations <- inv
+		return nil, nil
+	}
+	fake.submit = func(txID string) error { return nil }
+	fake.commitStatus = func(txID string) (*gateway.CommitStatusResponse, error) {
+		return &gateway.CommitStatusResponse{Result: peer.TxValidationCode_VALID, BlockNumber: 12}, nil
+	}
+
+	batch := &blockchain.BatchPin{
+		TransactionID:   fftypes.NewUUID(),
+		BatchID:         fftypes.NewUUID(),
+		BatchHash:       fftypes.NewRandB32(),
+		BatchPayloadRef: "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD",
+		Contexts:        []*fftypes.Bytes32{fftypes.NewRandB32(), fftypes.NewRandB32()},
+	}
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`)
+	err := f.SubmitBatchPin(context.Background(), "ns1:"+fftypes.NewUUID().String(), "ns1", "signer001", batch, location)
+	assert.NoError(t, err)
+
+	inv := <-invocations
+	assert.Equal(t, batchPinMethodName, inv.fn)
+	assert.Len(t, inv.args, 5)
+	assert.Equal(t, "ns1", inv.args[0])
+	assert.Equal(t, hexFormatB32(batch.BatchHash), inv.args[2])
+	assert.Equal(t, batch.BatchPayloadRef, inv.args[3])
+	var contexts []string
+	err = json.Unmarshal([]byte(inv.args[4]), &contexts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{hexFormatB32(batch.Contexts[0]), hexFormatB32(batch.Contexts[1])}, contexts)
+}
+
+func TestSubmitBatchPinV2(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	invocations := make(chan *invocation, 1)
+	fake.evaluate = networkVersionEvaluator("2")
+	fake.endorse = func(inv *invocation) ([]byte, error) {
+		invocations <- inv
+		return nil, gatewayError("pop")
+	}
+
+	batch := &blockchain.BatchPin{
+		TransactionID:   fftypes.NewUUID(),
+		BatchID:         fftypes.NewUUID(),
+		BatchHash:       fftypes.NewRandB32(),
+		BatchPayloadRef: "",
+		Contexts:        []*fftypes.Bytes32{},
+	}
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`)
+	err := f.SubmitBatchPin(context.Background(), "ns1:"+fftypes.NewUUID().String(), "ns1", "signer001", batch, location)
+	assert.Regexp(t, "pop", err)
+
+	inv := <-invocations
+	assert.Equal(t, batchPinMethodName, inv.fn)
+	assert.Len(t, inv.args, 4)
+	assert.Equal(t, "[]", inv.args[3])
+}
+
+func TestSubmitBatchPinErrors(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) { return nil, gatewayError("pop") }
+	err := f.SubmitBatchPin(context.Background(), "ns1:"+fftypes.NewUUID().String(), "ns1", "signer001", &blockchain.BatchPin{}, nil)
+	assert.Regexp(t, "FF10310", err)
+	err = f.SubmitBatchPin(context.Background(), "ns1:"+fftypes.NewUUID().String(), "ns1", "signer001", &blockchain.BatchPin{}, fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`))
+	assert.Regexp(t, "pop", err)
+}
+
+func TestSubmitNetworkAction(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	invocations := make(chan *invocation, 2)
+	versions := []string{"", "2"}
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		version := versions[0]
+		versions = versions[1:]
+		return networkVersionEvaluator(version)(inv)
+	}
+	fake.endorse = func(inv *invocation) ([]byte, error) {
+		invocations <- inv
+		return nil, gatewayError("pop")
+	}
+
+	err := f.SubmitNetworkAction(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", core.NetworkActionTerminate, fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"v1"}`))
+	assert.Regexp(t, "pop", err)
+	inv := <-invocations
+	assert.Equal(t, batchPinMethodName, inv.fn)
+	assert.Equal(t, []string{"firefly:terminate", hexFormatB32(nil), hexFormatB32(nil), "", "[]"}, inv.args)
+
+	err = f.SubmitNetworkAction(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", core.NetworkActionTerminate, fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"v2"}`))
+	assert.Regexp(t, "pop", err)
+	inv = <-invocations
+	assert.Equal(t, networkActionMethodName, inv.fn)
+	assert.Equal(t, []string{"firefly:terminate", ""}, inv.args)
+}
+
+func TestSubmitNetworkActionErrors(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) { return nil, gatewayError("pop") }
+	err := f.SubmitNetworkAction(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", core.NetworkActionTerminate, nil)
+	assert.Regexp(t, "FF10310", err)
+	err = f.SubmitNetworkAction(context.Background(), "ns1:"+fftypes.NewUUID().String(), "signer001", core.NetworkActionTerminate, fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`))
+	assert.Regexp(t, "pop", err)
+}
+
+func TestGetNetworkVersion(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	queries := 0
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		queries++
+		return networkVersionEvaluator("2")(inv)
+	}
+	location := fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`)
+	version, err := f.GetNetworkVersion(context.Background(), location)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	version, err = f.GetNetworkVersion(context.Background(), location)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, 1, queries)
+
+	_, err = f.GetNetworkVersion(context.Background(), nil)
+	assert.Regexp(t, "FF10310", err)
+}
+
+func TestGetNetworkVersionBadResult(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = networkVersionEvaluator(`"two"`)
+	_, err := f.GetNetworkVersion(context.Background(), fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"firefly"}`))
+	assert.Regexp(t, "FF10412", err)
+}
+
+func TestNormalizeContractLocation(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	result, err := f.NormalizeContractLocation(context.Background(), blockchain.NormalizeCall, fftypes.JSONAnyPtr(`{"channel":"firefly","chaincode":"simplestorage"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"channel":"firefly","chaincode":"simplestorage"}`, result.String())
+
+	result, err = f.NormalizeContractLocation(context.Background(), blockchain.NormalizeListener, fftypes.JSONAnyPtr(`{"channel":"firefly"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"channel":"firefly","chaincode":""}`, result.String())
+
+	_, err = f.NormalizeContractLocation(context.Background(), blockchain.NormalizeCall, fftypes.JSONAnyPtr(`{"channel":"firefly"}`))
+	assert.Regexp(t, "FF10310.*chaincode", err)
+
+	_, err = f.NormalizeContractLocation(context.Background(), blockchain.NormalizeCall, fftypes.JSONAnyPtr(`bad`))
+	assert.Regexp(t, "FF10310", err)
+
+	_, err = encodeContractLocation(context.Background(), blockchain.NormalizeCall, &Location{})
+	assert.Regexp(t, "FF10310.*channel", err)
+}
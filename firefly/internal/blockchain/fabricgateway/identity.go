@@ -0,0 +1,159 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/pkg/blockchain"
+)
+
+var fullIdentityPattern = regexp.MustCompile(".+::x509::(.+)::.+")
+
+var cnPattern = regexp.MustCompile("CN=([^,]+)")
+
+// signingIdentity is a local MSP identity, with a gateway connection that signs as that identity
+type signingIdentity struct {
+	fullID  string
+	gateway *client.Gateway
+}
+
+func getUserName(fullIDString string) string {
+	matches := fullIdentityPattern.FindStringSubmatch(fullIDString)
+	if len(matches) == 0 {
+		return fullIDString
+	}
+	matches = cnPattern.FindStringSubmatch(matches[1])
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// borrowed from fabric-chaincode-go to guarantee the same
+// resolution of "DN" string from x509 certs
+func getDN(name *pkix.Name) string {
+	r := name.ToRDNSequence()
+	return r.String()
+}
+
+// firstFile returns the first regular file in a directory, which is how Fabric tooling
+// lays out the signcerts and keystore folders of an MSP directory
+func firstFile(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			return os.ReadFile(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return nil, fmt.Errorf("no files found in %s", dir)
+}
+
+// loadIdentity loads the signing identity of a user from its MSP folder directly under the configured
+// MSP path. The name comes from the signing key of a request, so it must not reach outside that folder.
+func (f *FabricGateway) loadIdentity(ctx context.Context, name string) (*signingIdentity, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityLoadFailed, name, "user names must not contain path separators or '..'")
+	}
+	mspDir := filepath.Join(f.mspPath, name)
+	certPEM, err := firstFile(filepath.Join(mspDir, "signcerts"))
+	if err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityLoadFailed, name, err)
+	}
+	keyPEM, err := firstFile(filepath.Join(mspDir, "keystore"))
+	if err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityLoadFailed, name, err)
+	}
+	cert, err := identity.CertificateFromPEM(certPEM)
+	if err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityLoadFailed, name, err)
+	}
+	key, err := identity.PrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityLoadFailed, name, err)
+	}
+	sign, err := identity.NewPrivateKeySign(key)
+	if err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityLoadFailed, name, err)
+	}
+	id, _ := identity.NewX509Identity(f.mspID, cert)
+
+	// All identities share the single gRPC connection to the gateway peer
+	gw, _ := client.Connect(id, client.WithSign(sign), client.WithClientConnection(f.conn))
+	return &signingIdentity{
+		fullID:  fmt.Sprintf("%s::x509::%s::%s", f.mspID, getDN(&cert.Subject), getDN(&cert.Issuer)),
+		gateway: gw,
+	}, nil
+}
+
+// getIdentity returns the local identity for a short user name, or a fully qualified
+// "mspid::x509::{ecert DN}::{CA DN}" identity string that names a local user in its CN
+func (f *FabricGateway) getIdentity(ctx context.Context, signingKey string) (*signingIdentity, error) {
+	name := getUserName(signingKey)
+
+	f.idMux.Lock()
+	defer f.idMux.Unlock()
+	id := f.idCache[name]
+	if id == nil {
+		var err error
+		if id, err = f.loadIdentity(ctx, name); err != nil {
+			return nil, err
+		}
+		f.idCache[name] = id
+	}
+	if name != signingKey && id.fullID != signingKey {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayIdentityMismatch, signingKey, id.fullID)
+	}
+	return id, nil
+}
+
+func (f *FabricGateway) ResolveSigningKey(ctx context.Context, signingKeyInput string, intent blockchain.ResolveKeyIntent) (string, error) {
+	// Note: "intent" is not currently used for Fabric, as signing is always performed with
+	//       local key material that must be available in the configured MSP directory.
+
+	// we expand the short user name into the fully qualified onchain identity:
+	// mspid::x509::{ecert DN}::{CA DN}
+	id, err := f.getIdentity(ctx, signingKeyInput)
+	if err != nil {
+		return "", err
+	}
+	log.L(ctx).Debugf("Resolved signing key: %s", id.fullID)
+	return id.fullID, nil
+}
+
+func (f *FabricGateway) closeIdentities() {
+	f.idMux.Lock()
+	defer f.idMux.Unlock()
+	for name, id := range f.idCache {
+		_ = id.gateway.Close()
+		delete(f.idCache, name)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/firefly/pkg/blockchain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSigningKey(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	fullID, err := f.ResolveSigningKey(context.Background(), "signer001", blockchain.ResolveKeyIntentSign)
+	assert.NoError(t, err)
+	assert.Equal(t, "orgMSP::x509::CN=signer001,OU=client::CN=fabric-ca", fullID)
+
+	resolved, err := f.ResolveSigningKey(context.Background(), fullID, blockchain.ResolveKeyIntentSign)
+	assert.NoError(t, err)
+	assert.Equal(t, fullID, resolved)
+
+	_, err = f.ResolveSigningKey(context.Background(), "otherMSP::x509::CN=signer001,OU=client::CN=fabric-ca", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10467", err)
+}
+
+func TestResolveSigningKeyNoCN(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	_, err := f.ResolveSigningKey(context.Background(), "orgMSP::x509::OU=client::CN=fabric-ca", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10466", err)
+}
+
+func TestLoadIdentityErrors(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	// No signing certificate
+	_, err := f.ResolveSigningKey(context.Background(), "missing", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10466.*missing", err)
+
+	// No key
+	newTestMSP(t, f.mspPath, "nokey", newTestKey())
+	err = os.Remove(filepath.Join(f.mspPath, "nokey", "keystore", "priv_sk"))
+	assert.NoError(t, err)
+	_, err = f.ResolveSigningKey(context.Background(), "nokey", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10466.*nokey.*no files found", err)
+
+	// Bad certificate
+	newTestMSP(t, f.mspPath, "badcert", newTestKey())
+	err = os.WriteFile(filepath.Join(f.mspPath, "badcert", "signcerts", "cert.pem"), []byte("!pem"), 0600)
+	assert.NoError(t, err)
+	_, err = f.ResolveSigningKey(context.Background(), "badcert", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10466.*badcert", err)
+
+	// Bad key
+	newTestMSP(t, f.mspPath, "badkey", newTestKey())
+	err = os.WriteFile(filepath.Join(f.mspPath, "badkey", "keystore", "priv_sk"), []byte("!pem"), 0600)
+	assert.NoError(t, err)
+	_, err = f.ResolveSigningKey(context.Background(), "badkey", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10466.*badkey", err)
+
+	// Unsupported key type
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	newTestMSP(t, f.mspPath, "rsa", rsaKey)
+	_, err = f.ResolveSigningKey(context.Background(), "rsa", blockchain.ResolveKeyIntentSign)
+	assert.Regexp(t, "FF10466.*rsa", err)
+}
+
+func TestLoadIdentityOutsideMSPPath(t *testing.T) {
+	f, _, done := newTestFabricGateway(t)
+	defer done()
+
+	// A complete MSP folder next to the configured MSP path must not be reachable through the user name
+	newTestMSP(t, filepath.Dir(f.mspPath), "escape", newTestKey())
+	for _, signingKey := range []string{
+		"../escape",
+		"orgMSP::x509::CN=../escape,OU=client::CN=fabric-ca",
+		filepath.Join(filepath.Dir(f.mspPath), "escape"),
+		`..\escape`,
+		"..",
+	} {
+		_, err := f.ResolveSigningKey(context.Background(), signingKey, blockchain.ResolveKeyIntentSign)
+		assert.Regexp(t, "FF10466.*path separators", err, signingKey)
+	}
+	assert.Empty(t, f.idCache)
+}
+
+func TestGetUserName(t *testing.T) {
+	assert.Equal(t, "user1", getUserName("user1"))
+	assert.Equal(t, "user1", getUserName("orgMSP::x509::CN=user1,OU=client::CN=fabric-ca"))
+	assert.Equal(t, "", getUserName("orgMSP::x509::OU=client::CN=fabric-ca"))
+}
@@ -0,0 +1,158 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	fabcommon "github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly/internal/blockchain/common"
+	"github.com/hyperledger/firefly/internal/coremsgs"
+	"github.com/hyperledger/firefly/pkg/core"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	qsccChaincode        = "qscc"
+	qsccGetBlockByTxID   = "GetBlockByTxID"
+	qsccTxNotFoundPrefix = "Failed to get block for txID"
+)
+
+// TransactionStatus is the status of a committed Fabric transaction, as returned in the detail of an operation
+type TransactionStatus struct {
+	TransactionID  string `json:"transactionId"`
+	Channel        string `json:"channel"`
+	BlockNumber    uint64 `json:"blockNumber"`
+	ValidationCode string `json:"validationCode"`
+}
+
+// commitReceipt builds the receipt for a committed transaction, in the same form as the receipts
+// delivered by the blockchain connectors
+func commitReceipt(requestID, txID string, blockNumber uint64, code peer.TxValidationCode) *common.BlockchainReceiptNotification {
+	receipt := &common.BlockchainReceiptNotification{
+		Headers: common.BlockchainReceiptHeaders{
+			ReceiptID: requestID,
+			ReplyType: "TransactionSuccess",
+		},
+		TxHash:     txID,
+		ProtocolID: fmt.Sprintf("%.12d/%s", blockNumber, txID),
+	}
+	if code != peer.TxValidationCode_VALID {
+		receipt.Headers.ReplyType = "TransactionFailed"
+		receipt.Message = fmt.Sprintf("Transaction %s failed to commit with status code %d (%s)", txID, int32(code), code)
+	}
+	return receipt
+}
+
+// submittedReceipt records the ID of a submitted transaction against its operation, so the commit
+// status can still be looked up if we never hear the outcome
+func submittedReceipt(requestID, txID string) *common.BlockchainReceiptNotification {
+	return &common.BlockchainReceiptNotification{
+		Headers: common.BlockchainReceiptHeaders{
+			ReceiptID: requestID,
+			ReplyType: "TransactionUpdate",
+		},
+		TxHash: txID,
+	}
+}
+
+// transactionValidationCode finds a transaction in a block, returning the validation code the
+// committing peer recorded for it
+func transactionValidationCode(block *fabcommon.Block, txID string) (code peer.TxValidationCode, found bool) {
+	filter := block.GetMetadata().GetMetadata()
+	var validationCodes []byte
+	if len(filter) > int(fabcommon.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		validationCodes = filter[fabcommon.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+	for i, data := range block.GetData().GetData() {
+		// Anything we cannot parse cannot be the transaction we are looking for
+		envelope := &fabcommon.Envelope{}
+		_ = proto.Unmarshal(data, envelope)
+		payload := &fabcommon.Payload{}
+		_ = proto.Unmarshal(envelope.Payload, payload)
+		channelHeader := &fabcommon.ChannelHeader{}
+		_ = proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader)
+		if channelHeader.TxId != txID {
+			continue
+		}
+		if i < len(validationCodes) {
+			return peer.TxValidationCode(validationCodes[i]), true
+		}
+		return peer.TxValidationCode_NOT_VALIDATED, true
+	}
+	return 0, false
+}
+
+func (f *FabricGateway) GetTransactionStatus(ctx context.Context, operation *core.Operation) (interface{}, error) {
+	// The transaction ID is recorded against the operation when the transaction is submitted
+	txID := operation.Output.GetString("transactionHash")
+	if txID == "" {
+		return nil, nil
+	}
+
+	channel := operation.Input.GetObject("location").GetString("channel")
+	if channel == "" {
+		channel = f.defaultChannel
+	}
+	if channel == "" {
+		return nil, i18n.NewError(ctx, coremsgs.MsgDefaultChannelNotConfigured)
+	}
+	signer := operation.Input.GetString("key")
+	if signer == "" {
+		signer = f.signer
+	}
+
+	// Evaluating against the query system chaincode returns straight away, whether or not the
+	// transaction has committed
+	result, err := f.queryContractMethod(ctx, channel, qsccChaincode, qsccGetBlockByTxID, signer, []string{channel, txID}, nil)
+	if err != nil {
+		if strings.Contains(err.Error(), qsccTxNotFoundPrefix) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	block := &fabcommon.Block{}
+	if err := proto.Unmarshal(result, block); err != nil {
+		return nil, i18n.NewError(ctx, coremsgs.MsgFabricGatewayErr, err)
+	}
+	code, found := transactionValidationCode(block, txID)
+	if !found {
+		log.L(ctx).Warnf("Transaction %s not found in block %d", txID, block.GetHeader().GetNumber())
+		return nil, nil
+	}
+
+	status := &TransactionStatus{
+		TransactionID:  txID,
+		Channel:        channel,
+		BlockNumber:    block.GetHeader().GetNumber(),
+		ValidationCode: code.String(),
+	}
+
+	// If the transaction has committed since we last heard about it, deliver the receipt
+	// as if we had waited for the commit status
+	if operation.Status == core.OpStatusPending || operation.Status == core.OpStatusInitialized {
+		nsOpID := (&core.PreparedOperation{ID: operation.ID, Namespace: operation.Namespace}).NamespacedIDString()
+		_ = common.HandleReceipt(ctx, f, commitReceipt(nsOpID, txID, status.BlockNumber, code), f.callbacks)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,185 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fabricgateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly/mocks/coremocks"
+	"github.com/hyperledger/firefly/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testBlock builds a block holding the given transactions, with the validation codes recorded by the committing peer
+func testBlock(number uint64, validationCodes []byte, txIDs ...string) []byte {
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: number},
+		Data:   &common.BlockData{},
+	}
+	for _, txID := range txIDs {
+		payload := &common.Payload{
+			Header: &common.Header{ChannelHeader: mustMarshal(&common.ChannelHeader{ChannelId: "firefly", TxId: txID})},
+		}
+		block.Data.Data = append(block.Data.Data, mustMarshal(&common.Envelope{Payload: mustMarshal(payload)}))
+	}
+	if validationCodes != nil {
+		block.Metadata = &common.BlockMetadata{Metadata: make([][]byte, common.BlockMetadataIndex_COMMIT_HASH+1)}
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = validationCodes
+	}
+	return mustMarshal(block)
+}
+
+func testPendingOperation(input fftypes.JSONObject) *core.Operation {
+	return &core.Operation{
+		ID:        fftypes.NewUUID(),
+		Namespace: "ns1",
+		Status:    core.OpStatusPending,
+		Input:     input,
+		Output:    fftypes.JSONObject{"transactionHash": "tx1"},
+	}
+}
+
+func TestGetTransactionStatusSuccess(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		assert.Equal(t, "other", inv.channel)
+		assert.Equal(t, "qscc", inv.chaincode)
+		assert.Equal(t, "GetBlockByTxID", inv.fn)
+		assert.Equal(t, []string{"other", "tx1"}, inv.args)
+		return testBlock(12, []byte{byte(peer.TxValidationCode_VALID), byte(peer.TxValidationCode_VALID)}, "tx0", "tx1"), nil
+	}
+
+	op := testPendingOperation(fftypes.JSONObject{
+		"key":      "signer001",
+		"location": map[string]interface{}{"channel": "other", "chaincode": "simplestorage"},
+	})
+	em := &coremocks.OperationCallbacks{}
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.NamespacedOpID == "ns1:"+op.ID.String() &&
+			update.Status == core.OpStatusSucceeded &&
+			update.BlockchainTXID == "tx1" &&
+			update.Output.GetString("protocolId") == "000000000012/tx1"
+	})).Return(nil)
+	f.SetOperationHandler("ns1", em)
+
+	status, err := f.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, &TransactionStatus{
+		TransactionID:  "tx1",
+		Channel:        "other",
+		BlockNumber:    12,
+		ValidationCode: "VALID",
+	}, status)
+	em.AssertExpectations(t)
+}
+
+func TestGetTransactionStatusInvalid(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		return testBlock(12, []byte{byte(peer.TxValidationCode_MVCC_READ_CONFLICT)}, "tx1"), nil
+	}
+
+	op := testPendingOperation(nil)
+	em := &coremocks.OperationCallbacks{}
+	em.On("OperationUpdate", mock.MatchedBy(func(update *core.OperationUpdate) bool {
+		return update.Status == core.OpStatusFailed &&
+			update.ErrorMessage == "Transaction tx1 failed to commit with status code 11 (MVCC_READ_CONFLICT)"
+	})).Return(nil)
+	f.SetOperationHandler("ns1", em)
+
+	status, err := f.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, "MVCC_READ_CONFLICT", status.(*TransactionStatus).ValidationCode)
+	em.AssertExpectations(t)
+}
+
+func TestGetTransactionStatusAlreadyComplete(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		// The default channel and signer are used for operations that do not record them
+		assert.Equal(t, "firefly", inv.channel)
+		assert.Equal(t, "orgMSP", inv.mspID)
+		return testBlock(12, nil, "tx1"), nil
+	}
+
+	op := testPendingOperation(nil)
+	op.Status = core.OpStatusSucceeded
+	f.SetOperationHandler("ns1", &coremocks.OperationCallbacks{})
+
+	status, err := f.GetTransactionStatus(context.Background(), op)
+	assert.NoError(t, err)
+	assert.Equal(t, "NOT_VALIDATED", status.(*TransactionStatus).ValidationCode)
+}
+
+func TestGetTransactionStatusNotCommitted(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		return nil, gatewayError("Failed to get block for txID tx1, error entry not found in index")
+	}
+
+	status, err := f.GetTransactionStatus(context.Background(), testPendingOperation(nil))
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestGetTransactionStatusNotInBlock(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		// Protobuf merges repeated fields of concatenated messages, so this block also holds an unparsable transaction
+		return append(testBlock(12, nil, "tx0"), mustMarshal(&common.Block{Data: &common.BlockData{Data: [][]byte{{0xff}}}})...), nil
+	}
+
+	status, err := f.GetTransactionStatus(context.Background(), testPendingOperation(nil))
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestGetTransactionStatusErrors(t *testing.T) {
+	f, fake, done := newTestFabricGateway(t)
+	defer done()
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		return nil, gatewayError("pop")
+	}
+	_, err := f.GetTransactionStatus(context.Background(), testPendingOperation(nil))
+	assert.Regexp(t, "FF10468.*pop", err)
+
+	fake.evaluate = func(inv *invocation) ([]byte, error) {
+		return []byte{0xff}, nil
+	}
+	_, err = f.GetTransactionStatus(context.Background(), testPendingOperation(nil))
+	assert.Regexp(t, "FF10468", err)
+
+	f.defaultChannel = ""
+	_, err = f.GetTransactionStatus(context.Background(), testPendingOperation(nil))
+	assert.Regexp(t, "FF10440", err)
+}
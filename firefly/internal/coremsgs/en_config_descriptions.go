@@ -219,11 +219,26 @@ var (
 	ConfigPluginBlockchainFabricFabconnectPrefixShort                 = ffc("config.plugins.blockchain[].fabric.fabconnect.prefixShort", "The prefix that will be used for Fabconnect specific query parameters when FireFly makes requests to Fabconnect", i18n.StringType)
 	ConfigPluginBlockchainFabricFabconnectSigner                      = ffc("config.plugins.blockchain[].fabric.fabconnect.signer", "The Fabric signing key to use when submitting transactions to Fabconnect", i18n.StringType)
 	ConfigPluginBlockchainFabricFabconnectTopic                       = ffc("config.plugins.blockchain[].fabric.fabconnect.topic", "The websocket listen topic that the node should register on, which is important if there are multiple nodes using a single Fabconnect", i18n.StringType)
+	ConfigPluginBlockchainFabricFabconnectListenerStatusInterval      = ffc("config.plugins.blockchain[].fabric.fabconnect.listenerStatus.interval", "How often to query the height of the channels followed by contract listeners, to report how far behind they are", i18n.TimeDurationType)
 	ConfigPluginBlockchainFabricFabconnectURL                         = ffc("config.plugins.blockchain[].fabric.fabconnect.url", "The URL of the Fabconnect instance", urlStringType)
 	ConfigPluginBlockchainFabricFabconnectProxyURL                    = ffc("config.plugins.blockchain[].fabric.fabconnect.proxy.url", "Optional HTTP proxy server to use when connecting to Fabconnect", urlStringType)
 	ConfigPluginBlockchainFabricFabconnectChaincode                   = ffc("config.plugins.blockchain[].fabric.fabconnect.chaincode", "The name of the Fabric chaincode that FireFly will use for BatchPin transactions (deprecated - use fireflyContract[].chaincode)", i18n.StringType)
 	ConfigPluginBlockchainFabricFabconnectChannel                     = ffc("config.plugins.blockchain[].fabric.fabconnect.channel", "The Fabric channel that FireFly will use for BatchPin transactions", i18n.StringType)
 
+	ConfigPluginBlockchainFabricGatewayGatewayAddress                 = ffc("config.plugins.blockchain[].fabricgateway.gateway.address", "The host:port of the gRPC endpoint of the Fabric Gateway peer", i18n.StringType)
+	ConfigPluginBlockchainFabricGatewayGatewayChannel                 = ffc("config.plugins.blockchain[].fabricgateway.gateway.channel", "The default Fabric channel", i18n.StringType)
+	ConfigPluginBlockchainFabricGatewayGatewaySigner                  = ffc("config.plugins.blockchain[].fabricgateway.gateway.signer", "The name of the local identity used to query the FireFly chaincode and to stream chaincode events", i18n.StringType)
+	ConfigPluginBlockchainFabricGatewayGatewayMSPID                   = ffc("config.plugins.blockchain[].fabricgateway.gateway.msp.id", "The MSP ID of the organization that owns the local signing identities", i18n.StringType)
+	ConfigPluginBlockchainFabricGatewayGatewayMSPPath                 = ffc("config.plugins.blockchain[].fabricgateway.gateway.msp.path", "A directory containing one MSP directory per signing identity, named by the identity, each with a signcerts and a keystore folder", i18n.StringType)
+	ConfigPluginBlockchainFabricGatewayGatewayCheckpointPath          = ffc("config.plugins.blockchain[].fabricgateway.gateway.checkpoint.path", "A directory in which to persist chaincode event checkpoints. Checkpoints are only held in memory if not set", i18n.StringType)
+	ConfigPluginBlockchainFabricGatewayGatewayTimeoutEvaluate         = ffc("config.plugins.blockchain[].fabricgateway.gateway.timeout.evaluate", "The timeout for evaluating (querying) a transaction", i18n.TimeDurationType)
+	ConfigPluginBlockchainFabricGatewayGatewayTimeoutEndorse          = ffc("config.plugins.blockchain[].fabricgateway.gateway.timeout.endorse", "The timeout for collecting the endorsements for a transaction", i18n.TimeDurationType)
+	ConfigPluginBlockchainFabricGatewayGatewayTimeoutSubmit           = ffc("config.plugins.blockchain[].fabricgateway.gateway.timeout.submit", "The timeout for submitting an endorsed transaction to the orderer", i18n.TimeDurationType)
+	ConfigPluginBlockchainFabricGatewayGatewayTimeoutCommitStatus     = ffc("config.plugins.blockchain[].fabricgateway.gateway.timeout.commitStatus", "The maximum time to wait for a submitted transaction to be committed", i18n.TimeDurationType)
+	ConfigPluginBlockchainFabricGatewayGatewayEventsRetryInitialDelay = ffc("config.plugins.blockchain[].fabricgateway.gateway.events.retry.initialDelay", "The initial delay before re-establishing a failed chaincode event stream", i18n.TimeDurationType)
+	ConfigPluginBlockchainFabricGatewayGatewayEventsRetryMaxDelay     = ffc("config.plugins.blockchain[].fabricgateway.gateway.events.retry.maxDelay", "The maximum delay between attempts to re-establish a failed chaincode event stream", i18n.TimeDurationType)
+	ConfigPluginBlockchainFabricGatewayGatewayEventsRetryFactor       = ffc("config.plugins.blockchain[].fabricgateway.gateway.events.retry.factor", "The factor by which the delay increases when re-establishing a failed chaincode event stream", i18n.FloatType)
+
 	ConfigBroadcastBatchAgentTimeout = ffc("config.broadcast.batch.agentTimeout", "How long to keep around a batching agent for a sending identity before disposal", i18n.StringType)
 	ConfigBroadcastBatchPayloadLimit = ffc("config.broadcast.batch.payloadLimit", "The maximum payload size of a batch for broadcast messages", i18n.ByteSizeType)
 	ConfigBroadcastBatchSize         = ffc("config.broadcast.batch.size", "The maximum number of messages that can be packed into a batch", i18n.IntType)
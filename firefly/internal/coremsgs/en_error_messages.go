@@ -303,4 +303,9 @@ var (
 	MsgWSWrongNamespace                      = ffe("FF10462", "Websocket request received on a namespace scoped connection but the provided namespace does not match")
 	MsgMaxSubscriptionEventScanLimitBreached = ffe("FF10463", "Event scan limit breached with start sequence ID %d and end sequence ID %d. Please restrict your query to a narrower range", 400)
 	MsgSequenceIDDidNotParseToInt            = ffe("FF10464", "Could not parse provided %s to an integer sequence ID", 400)
+	MsgInvalidChaincodeDeployment            = ffe("FF10465", "Invalid chaincode deployment: %s", 400)
+	MsgFabricGatewayIdentityLoadFailed       = ffe("FF10466", "Failed to load Fabric signing identity '%s': %s", 400)
+	MsgFabricGatewayIdentityMismatch         = ffe("FF10467", "Signing key '%s' does not match the local Fabric identity '%s'", 400)
+	MsgFabricGatewayErr                      = ffe("FF10468", "Error from Fabric Gateway: %s")
+	MsgFabricGatewayUnsupportedOption        = ffe("FF10469", "Option '%s' is not supported for Fabric Gateway transactions", 400)
 )
@@ -1,4 +1,4 @@
-// Copyright © 2022 Kaleido, Inc.
+// Copyright © 2023 Kaleido, Inc.
 //
 // SPDX-License-Identifier: Apache-2.0
 //
@@ -23,6 +23,10 @@ import (
 var BlockchainTransactionsCounter *prometheus.CounterVec
 var BlockchainQueriesCounter *prometheus.CounterVec
 var BlockchainEventsCounter *prometheus.CounterVec
+var BlockchainListenerDeliveredBlockGauge *prometheus.GaugeVec
+var BlockchainListenerCheckpointBlockGauge *prometheus.GaugeVec
+var BlockchainListenerChainHeightGauge *prometheus.GaugeVec
+var BlockchainListenerErrorGauge *prometheus.GaugeVec
 
 // BlockchainTransactionsCounterName is the prometheus metric for tracking the total number of blockchain transactions
 var BlockchainTransactionsCounterName = "ff_blockchain_transactions_total"
@@ -33,9 +37,31 @@ var BlockchainQueriesCounterName = "ff_blockchain_queries_total"
 // BlockchainEventsCounterName is the prometheus metric for tracking the total number of blockchain events
 var BlockchainEventsCounterName = "ff_blockchain_events_total"
 
+// BlockchainListenerDeliveredBlockGaugeName is the prometheus metric for tracking the last block delivered to a contract listener
+var BlockchainListenerDeliveredBlockGaugeName = "ff_blockchain_listener_delivered_block"
+
+// BlockchainListenerCheckpointBlockGaugeName is the prometheus metric for tracking the last block acknowledged by a contract listener
+var BlockchainListenerCheckpointBlockGaugeName = "ff_blockchain_listener_checkpoint_block"
+
+// BlockchainListenerChainHeightGaugeName is the prometheus metric for tracking the height of the chain a contract listener follows
+var BlockchainListenerChainHeightGaugeName = "ff_blockchain_listener_chain_height"
+
+// BlockchainListenerErrorGaugeName is the prometheus metric for tracking whether a contract listener is failing to deliver events
+var BlockchainListenerErrorGaugeName = "ff_blockchain_listener_error"
+
 var LocationLabelName = "location"
 var MethodNameLabelName = "methodName"
 var SignatureLabelName = "signature"
+var NamespaceLabelName = "namespace"
+var ListenerLabelName = "listener"
+
+// BlockchainListenerStatus is the progress of a contract listener, as reported by a blockchain plugin
+type BlockchainListenerStatus struct {
+	DeliveredBlock  uint64
+	CheckpointBlock uint64
+	ChainHeight     uint64
+	Errored         bool
+}
 
 func InitBlockchainMetrics() {
 	BlockchainTransactionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -50,10 +76,30 @@ func InitBlockchainMetrics() {
 		Name: BlockchainEventsCounterName,
 		Help: "Number of blockchain events",
 	}, []string{LocationLabelName, SignatureLabelName})
+	BlockchainListenerDeliveredBlockGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: BlockchainListenerDeliveredBlockGaugeName,
+		Help: "Last block delivered to a contract listener",
+	}, []string{NamespaceLabelName, ListenerLabelName})
+	BlockchainListenerCheckpointBlockGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: BlockchainListenerCheckpointBlockGaugeName,
+		Help: "Last block acknowledged by a contract listener",
+	}, []string{NamespaceLabelName, ListenerLabelName})
+	BlockchainListenerChainHeightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: BlockchainListenerChainHeightGaugeName,
+		Help: "Height of the chain followed by a contract listener, one more than its last block number",
+	}, []string{NamespaceLabelName, ListenerLabelName})
+	BlockchainListenerErrorGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: BlockchainListenerErrorGaugeName,
+		Help: "Whether a contract listener is failing to deliver events (1) or not (0)",
+	}, []string{NamespaceLabelName, ListenerLabelName})
 }
 
 func RegisterBlockchainMetrics() {
 	registry.MustRegister(BlockchainTransactionsCounter)
 	registry.MustRegister(BlockchainQueriesCounter)
 	registry.MustRegister(BlockchainEventsCounter)
+	registry.MustRegister(BlockchainListenerDeliveredBlockGauge)
+	registry.MustRegister(BlockchainListenerCheckpointBlockGauge)
+	registry.MustRegister(BlockchainListenerChainHeightGauge)
+	registry.MustRegister(BlockchainListenerErrorGauge)
 }
@@ -39,6 +39,8 @@ type Manager interface {
 	BlockchainTransaction(location, methodName string)
 	BlockchainQuery(location, methodName string)
 	BlockchainEvent(location, signature string)
+	BlockchainListenerStatus(namespace, listener string, status *BlockchainListenerStatus)
+	BlockchainListenerRemoved(namespace, listener string)
 	AddTime(id string)
 	GetTime(id string) time.Time
 	DeleteTime(id string)
@@ -146,6 +148,24 @@ func (mm *metricsManager) BlockchainEvent(location, signature string) {
 	BlockchainEventsCounter.WithLabelValues(location, signature).Inc()
 }
 
+func (mm *metricsManager) BlockchainListenerStatus(namespace, listener string, status *BlockchainListenerStatus) {
+	BlockchainListenerDeliveredBlockGauge.WithLabelValues(namespace, listener).Set(float64(status.DeliveredBlock))
+	BlockchainListenerCheckpointBlockGauge.WithLabelValues(namespace, listener).Set(float64(status.CheckpointBlock))
+	BlockchainListenerChainHeightGauge.WithLabelValues(namespace, listener).Set(float64(status.ChainHeight))
+	errored := 0.0
+	if status.Errored {
+		errored = 1
+	}
+	BlockchainListenerErrorGauge.WithLabelValues(namespace, listener).Set(errored)
+}
+
+func (mm *metricsManager) BlockchainListenerRemoved(namespace, listener string) {
+	BlockchainListenerDeliveredBlockGauge.DeleteLabelValues(namespace, listener)
+	BlockchainListenerCheckpointBlockGauge.DeleteLabelValues(namespace, listener)
+	BlockchainListenerChainHeightGauge.DeleteLabelValues(namespace, listener)
+	BlockchainListenerErrorGauge.DeleteLabelValues(namespace, listener)
+}
+
 func (mm *metricsManager) AddTime(id string) {
 	mutex.Lock()
 	mm.timeMap[id] = time.Now()
@@ -215,6 +215,29 @@ func TestBlockchainEvents(t *testing.T) {
 	assert.Equal(t, float64(1), v)
 }
 
+func TestBlockchainListenerStatus(t *testing.T) {
+	mm, cancel := newTestMetricsManager(t)
+	defer cancel()
+	mm.BlockchainListenerStatus("ns1", "listener1", &BlockchainListenerStatus{
+		DeliveredBlock:  12,
+		CheckpointBlock: 10,
+		ChainHeight:     20,
+		Errored:         true,
+	})
+	labels := prometheus.Labels{NamespaceLabelName: "ns1", ListenerLabelName: "listener1"}
+	assert.Equal(t, float64(12), testutil.ToFloat64(BlockchainListenerDeliveredBlockGauge.With(labels)))
+	assert.Equal(t, float64(10), testutil.ToFloat64(BlockchainListenerCheckpointBlockGauge.With(labels)))
+	assert.Equal(t, float64(20), testutil.ToFloat64(BlockchainListenerChainHeightGauge.With(labels)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(BlockchainListenerErrorGauge.With(labels)))
+
+	mm.BlockchainListenerStatus("ns1", "listener1", &BlockchainListenerStatus{})
+	assert.Equal(t, float64(0), testutil.ToFloat64(BlockchainListenerErrorGauge.With(labels)))
+
+	mm.BlockchainListenerRemoved("ns1", "listener1")
+	assert.Equal(t, 0, testutil.CollectAndCount(BlockchainListenerDeliveredBlockGauge))
+	assert.Equal(t, 0, testutil.CollectAndCount(BlockchainListenerErrorGauge))
+}
+
 func TestIsMetricsEnabledTrue(t *testing.T) {
 	mm, cancel := newTestMetricsManager(t)
 	defer cancel()
@@ -6,6 +6,8 @@ import (
 	fftypes "github.com/hyperledger/firefly-common/pkg/fftypes"
 	core "github.com/hyperledger/firefly/pkg/core"
 
+	metrics "github.com/hyperledger/firefly/internal/metrics"
+
 	mock "github.com/stretchr/testify/mock"
 
 	time "time"
@@ -31,6 +33,16 @@ func (_m *Manager) BlockchainEvent(location string, signature string) {
 	_m.Called(location, signature)
 }
 
+// BlockchainListenerRemoved provides a mock function with given fields: namespace, listener
+func (_m *Manager) BlockchainListenerRemoved(namespace string, listener string) {
+	_m.Called(namespace, listener)
+}
+
+// BlockchainListenerStatus provides a mock function with given fields: namespace, listener, status
+func (_m *Manager) BlockchainListenerStatus(namespace string, listener string, status *metrics.BlockchainListenerStatus) {
+	_m.Called(namespace, listener, status)
+}
+
 // BlockchainQuery provides a mock function with given fields: location, methodName
 func (_m *Manager) BlockchainQuery(location string, methodName string) {
 	_m.Called(location, methodName)